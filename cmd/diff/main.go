@@ -0,0 +1,118 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// diff prints the changes the operator would make to the Platforms of the configured cluster,
+// without changing anything. It exits with 1 if there are changes.
+//
+//	diff -n infinimesh -name infinimesh
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes/scheme"
+	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/client/config"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+
+	"github.com/infinimesh/operator/pkg/apis"
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+	"github.com/infinimesh/operator/pkg/controller/platform"
+)
+
+func main() {
+	var namespace, name string
+	flag.StringVar(&namespace, "n", "", "The namespace of the Platforms. Defaults to all namespaces.")
+	flag.StringVar(&name, "name", "", "The name of the Platform. Defaults to all Platforms.")
+	flag.Parse()
+
+	// Keep the reconcilers' logs out of the diff
+	logf.SetLogger(logf.ZapLoggerTo(ioutil.Discard, false))
+
+	changed, err := run(namespace, name, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if changed {
+		os.Exit(1)
+	}
+}
+
+func run(namespace, name string, out io.Writer) (bool, error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return false, err
+	}
+
+	s := runtime.NewScheme()
+	if err := scheme.AddToScheme(s); err != nil {
+		return false, err
+	}
+	if err := apis.AddToScheme(s); err != nil {
+		return false, err
+	}
+
+	mapper, err := apiutil.NewDiscoveryRESTMapper(cfg)
+	if err != nil {
+		return false, err
+	}
+	c, err := client.New(cfg, client.Options{Scheme: s, Mapper: mapper})
+	if err != nil {
+		return false, err
+	}
+	dyn, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return false, err
+	}
+
+	platforms := &infinimeshv1beta1.PlatformList{}
+	if err := c.List(context.TODO(), &client.ListOptions{Namespace: namespace}, platforms); err != nil {
+		return false, err
+	}
+
+	changed := false
+	for i := range platforms.Items {
+		instance := &platforms.Items[i]
+		if name != "" && instance.Name != name {
+			continue
+		}
+
+		diffs, err := platform.Diff(c, dyn, mapper, s, instance)
+		if err != nil {
+			return changed, fmt.Errorf("%v/%v: %v", instance.Namespace, instance.Name, err)
+		}
+		if len(diffs) == 0 {
+			continue
+		}
+		changed = true
+
+		fmt.Fprintf(out, "# %v/%v\n", instance.Namespace, instance.Name)
+		for _, d := range diffs {
+			fmt.Fprintf(out, "%v\n%v", d, d.Diff)
+		}
+	}
+	return changed, nil
+}
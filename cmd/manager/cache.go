@@ -0,0 +1,193 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// newMultiNamespaceCache returns a manager.NewCacheFunc creating one cache per namespace, so the
+// operator only needs permissions in the namespaces it watches.
+func newMultiNamespaceCache(namespaces []string) manager.NewCacheFunc {
+	return func(config *rest.Config, opts cache.Options) (cache.Cache, error) {
+		// Share the discovery of the API between the caches
+		if opts.Mapper == nil {
+			mapper, err := apiutil.NewDiscoveryRESTMapper(config)
+			if err != nil {
+				return nil, err
+			}
+			opts.Mapper = mapper
+		}
+
+		c := &multiNamespaceCache{caches: map[string]cache.Cache{}}
+		for _, ns := range namespaces {
+			opts.Namespace = ns
+			nsCache, err := cache.New(config, opts)
+			if err != nil {
+				return nil, err
+			}
+			c.namespaces = append(c.namespaces, ns)
+			c.caches[ns] = nsCache
+		}
+		return c, nil
+	}
+}
+
+type multiNamespaceCache struct {
+	namespaces []string
+	caches     map[string]cache.Cache
+}
+
+var _ cache.Cache = &multiNamespaceCache{}
+
+func (c *multiNamespaceCache) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	nsCache, ok := c.caches[key.Namespace]
+	if !ok {
+		return fmt.Errorf("namespace %v is not watched", key.Namespace)
+	}
+	return nsCache.Get(ctx, key, obj)
+}
+
+func (c *multiNamespaceCache) List(ctx context.Context, opts *client.ListOptions, list runtime.Object) error {
+	if opts != nil && opts.Namespace != "" {
+		nsCache, ok := c.caches[opts.Namespace]
+		if !ok {
+			return fmt.Errorf("namespace %v is not watched", opts.Namespace)
+		}
+		return nsCache.List(ctx, opts, list)
+	}
+
+	var items []runtime.Object
+	for _, ns := range c.namespaces {
+		nsList := list.DeepCopyObject()
+		if err := c.caches[ns].List(ctx, opts, nsList); err != nil {
+			return err
+		}
+		nsItems, err := meta.ExtractList(nsList)
+		if err != nil {
+			return err
+		}
+		items = append(items, nsItems...)
+	}
+	return meta.SetList(list, items)
+}
+
+func (c *multiNamespaceCache) GetInformer(obj runtime.Object) (toolscache.SharedIndexInformer, error) {
+	informer := &multiNamespaceInformer{}
+	for _, ns := range c.namespaces {
+		nsInformer, err := c.caches[ns].GetInformer(obj)
+		if err != nil {
+			return nil, err
+		}
+		informer.informers = append(informer.informers, nsInformer)
+	}
+	informer.SharedIndexInformer = informer.informers[0]
+	return informer, nil
+}
+
+func (c *multiNamespaceCache) GetInformerForKind(gvk schema.GroupVersionKind) (toolscache.SharedIndexInformer, error) {
+	informer := &multiNamespaceInformer{}
+	for _, ns := range c.namespaces {
+		nsInformer, err := c.caches[ns].GetInformerForKind(gvk)
+		if err != nil {
+			return nil, err
+		}
+		informer.informers = append(informer.informers, nsInformer)
+	}
+	informer.SharedIndexInformer = informer.informers[0]
+	return informer, nil
+}
+
+func (c *multiNamespaceCache) Start(stopCh <-chan struct{}) error {
+	for _, ns := range c.namespaces {
+		go func(nsCache cache.Cache) {
+			if err := nsCache.Start(stopCh); err != nil {
+				log.Error(err, "cache failed to start")
+			}
+		}(c.caches[ns])
+	}
+	<-stopCh
+	return nil
+}
+
+func (c *multiNamespaceCache) WaitForCacheSync(stop <-chan struct{}) bool {
+	synced := true
+	for _, ns := range c.namespaces {
+		if !c.caches[ns].WaitForCacheSync(stop) {
+			synced = false
+		}
+	}
+	return synced
+}
+
+func (c *multiNamespaceCache) IndexField(obj runtime.Object, field string, extractValue client.IndexerFunc) error {
+	for _, ns := range c.namespaces {
+		if err := c.caches[ns].IndexField(obj, field, extractValue); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// multiNamespaceInformer fans event handlers out to the informers of every namespace. The store
+// and indexer are the ones of the first namespace, reads go through multiNamespaceCache instead.
+type multiNamespaceInformer struct {
+	toolscache.SharedIndexInformer
+	informers []toolscache.SharedIndexInformer
+}
+
+func (i *multiNamespaceInformer) AddEventHandler(handler toolscache.ResourceEventHandler) {
+	for _, informer := range i.informers {
+		informer.AddEventHandler(handler)
+	}
+}
+
+func (i *multiNamespaceInformer) AddEventHandlerWithResyncPeriod(handler toolscache.ResourceEventHandler, resyncPeriod time.Duration) {
+	for _, informer := range i.informers {
+		informer.AddEventHandlerWithResyncPeriod(handler, resyncPeriod)
+	}
+}
+
+func (i *multiNamespaceInformer) AddIndexers(indexers toolscache.Indexers) error {
+	for _, informer := range i.informers {
+		if err := informer.AddIndexers(indexers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (i *multiNamespaceInformer) HasSynced() bool {
+	for _, informer := range i.informers {
+		if !informer.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
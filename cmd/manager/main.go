@@ -18,28 +18,105 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"io/ioutil"
 	"math/rand"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/go-logr/logr"
+	"github.com/go-logr/zapr"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
 	"sigs.k8s.io/controller-runtime/pkg/runtime/signals"
+	"sigs.k8s.io/yaml"
 
 	"github.com/infinimesh/operator/pkg/apis"
-	"github.com/infinimesh/operator/pkg/controller"
+	ctrl "github.com/infinimesh/operator/pkg/controller"
+	"github.com/infinimesh/operator/pkg/controller/platform"
 	"github.com/infinimesh/operator/pkg/webhook"
+	"github.com/infinimesh/operator/pkg/webhook/conversion"
 )
 
+var log = logf.Log.WithName("entrypoint")
+
+// options configures the manager, either through flags or a YAML config file with the same
+// keys. Flags take precedence over the config file.
+type options struct {
+	MetricsAddr             string          `json:"metricsAddr,omitempty"`
+	HealthProbeAddr         string          `json:"healthProbeAddr,omitempty"`
+	LeaderElection          bool            `json:"leaderElection,omitempty"`
+	LeaderElectionNamespace string          `json:"leaderElectionNamespace,omitempty"`
+	LeaderElectionID        string          `json:"leaderElectionID,omitempty"`
+	Namespaces              stringList      `json:"namespaces,omitempty"`
+	MaxConcurrentReconciles int             `json:"maxConcurrentReconciles,omitempty"`
+	SyncPeriod              metav1.Duration `json:"syncPeriod,omitempty"`
+	LogLevel                string          `json:"logLevel,omitempty"`
+	LogFormat               string          `json:"logFormat,omitempty"`
+	DryRun                  bool            `json:"dryRun,omitempty"`
+	WebhookPort             int             `json:"webhookPort,omitempty"`
+	WebhookCertDir          string          `json:"webhookCertDir,omitempty"`
+}
+
+// stringList is a comma separated flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = nil
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
 func main() {
 	rand.Seed(time.Now().UTC().UnixNano())
-	var metricsAddr string
-	flag.StringVar(&metricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
+
+	var configFile string
+	opts := options{}
+	flag.StringVar(&configFile, "config", "", "A YAML file with the manager options, flags take precedence.")
+	flag.StringVar(&opts.MetricsAddr, "metrics-addr", ":8080", "The address the metric endpoint binds to.")
+	flag.StringVar(&opts.HealthProbeAddr, "health-probe-addr", ":8081", "The address /healthz and /readyz bind to, empty to disable.")
+	flag.BoolVar(&opts.LeaderElection, "leader-elect", false, "Enable leader election so only one replica reconciles at a time.")
+	flag.StringVar(&opts.LeaderElectionNamespace, "leader-election-namespace", "", "The namespace of the leader election ConfigMap. Defaults to the namespace of the pod.")
+	flag.StringVar(&opts.LeaderElectionID, "leader-election-id", "infinimesh-operator-leader", "The name of the leader election ConfigMap.")
+	flag.Var(&opts.Namespaces, "namespace", "Comma separated namespaces to watch. Defaults to all namespaces.")
+	flag.IntVar(&opts.MaxConcurrentReconciles, "max-concurrent-reconciles", 1, "The number of platforms reconciled in parallel.")
+	flag.DurationVar(&opts.SyncPeriod.Duration, "sync-period", 10*time.Hour, "The minimum frequency at which all platforms are reconciled.")
+	flag.StringVar(&opts.LogLevel, "log-level", "info", "One of debug, info, warn or error, or a verbosity level.")
+	flag.StringVar(&opts.LogFormat, "log-format", "json", "One of json or console.")
+	flag.BoolVar(&opts.DryRun, "dry-run", false, "Record the changes to each platform as events instead of making them.")
+	flag.IntVar(&opts.WebhookPort, "webhook-port", 9876, "The port the conversion webhook binds to.")
+	flag.StringVar(&opts.WebhookCertDir, "webhook-cert-dir", "/tmp/cert", "The directory with the tls.crt and tls.key of the conversion webhook.")
 	flag.Parse()
-	logf.SetLogger(logf.ZapLogger(false))
-	log := logf.Log.WithName("entrypoint")
+
+	if configFile != "" {
+		if err := loadConfig(configFile, &opts); err != nil {
+			fmt.Fprintf(os.Stderr, "unable to load config %v: %v\n", configFile, err)
+			os.Exit(1)
+		}
+	}
+
+	logger, err := newLogger(opts.LogLevel, opts.LogFormat)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	logf.SetLogger(logger)
 
 	// Get a config to talk to the apiserver
 	log.Info("setting up client for manager")
@@ -49,9 +126,24 @@ func main() {
 		os.Exit(1)
 	}
 
+	mgrOptions := manager.Options{
+		MetricsBindAddress:      opts.MetricsAddr,
+		LeaderElection:          opts.LeaderElection,
+		LeaderElectionNamespace: opts.LeaderElectionNamespace,
+		LeaderElectionID:        opts.LeaderElectionID,
+		SyncPeriod:              &opts.SyncPeriod.Duration,
+	}
+	switch len(opts.Namespaces) {
+	case 0:
+	case 1:
+		mgrOptions.Namespace = opts.Namespaces[0]
+	default:
+		mgrOptions.NewCache = newMultiNamespaceCache(opts.Namespaces)
+	}
+
 	// Create a new Cmd to provide shared dependencies and start components
-	log.Info("setting up manager")
-	mgr, err := manager.New(cfg, manager.Options{MetricsBindAddress: metricsAddr})
+	log.Info("setting up manager", "namespaces", opts.Namespaces.String(), "leaderElection", opts.LeaderElection)
+	mgr, err := manager.New(cfg, mgrOptions)
 	if err != nil {
 		log.Error(err, "unable to set up overall controller manager")
 		os.Exit(1)
@@ -68,21 +160,101 @@ func main() {
 
 	// Setup all Controllers
 	log.Info("Setting up controller")
-	if err := controller.AddToManager(mgr); err != nil {
+	platform.DryRun = opts.DryRun
+	platform.Namespaces = opts.Namespaces
+	controllerOptions := controller.Options{MaxConcurrentReconciles: opts.MaxConcurrentReconciles}
+	if opts.DryRun {
+		// Only the platform controller dry-runs, the others would change devices and objects
+		// in the services of the platforms
+		err = platform.Add(mgr, controllerOptions)
+	} else {
+		err = ctrl.AddToManager(mgr, controllerOptions)
+	}
+	if err != nil {
 		log.Error(err, "unable to register controllers to the manager")
 		os.Exit(1)
 	}
 
+	// The webhook server isn't run by the manager, it is served without leader election
+	stop := signals.SetupSignalHandler()
+
 	log.Info("setting up webhooks")
+	conversion.Port = opts.WebhookPort
+	conversion.CertDir = opts.WebhookCertDir
+	conversion.Stop = stop
 	if err := webhook.AddToManager(mgr); err != nil {
 		log.Error(err, "unable to register webhooks to the manager")
 		os.Exit(1)
 	}
 
+	if opts.HealthProbeAddr != "" {
+		p := &probes{}
+		if opts.LeaderElection {
+			p.setReady()
+		} else if err := mgr.Add(p); err != nil {
+			log.Error(err, "unable to register the readiness probe")
+			os.Exit(1)
+		}
+		go func() {
+			if err := p.serve(opts.HealthProbeAddr); err != nil {
+				log.Error(err, "unable to serve health probes")
+				os.Exit(1)
+			}
+		}()
+	}
+
 	// Start the Cmd
 	log.Info("Starting the Cmd.")
-	if err := mgr.Start(signals.SetupSignalHandler()); err != nil {
+	if err := mgr.Start(stop); err != nil {
 		log.Error(err, "unable to run the manager")
 		os.Exit(1)
 	}
 }
+
+// loadConfig reads the options from a YAML file, keeping the flags set on the command line.
+func loadConfig(path string, opts *options) error {
+	set := map[string]string{}
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = f.Value.String()
+	})
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := yaml.UnmarshalStrict(data, opts); err != nil {
+		return err
+	}
+
+	for name, value := range set {
+		if err := flag.Set(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newLogger returns a zap logger with the given level and format. Numeric levels enable the
+// matching logr verbosity, e.g. 1 for log.V(1).
+func newLogger(level, format string) (logr.Logger, error) {
+	var lvl zapcore.Level
+	if v, err := strconv.Atoi(level); err == nil {
+		lvl = zapcore.Level(-v)
+	} else if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", level)
+	}
+
+	var enc zapcore.Encoder
+	switch format {
+	case "json":
+		enc = zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+	case "console":
+		enc = zapcore.NewConsoleEncoder(zap.NewDevelopmentEncoderConfig())
+	default:
+		return nil, fmt.Errorf("invalid log format %q", format)
+	}
+
+	sink := zapcore.AddSync(os.Stderr)
+	core := zapcore.NewCore(&logf.KubeAwareEncoder{Encoder: enc, Verbose: lvl < zapcore.InfoLevel}, sink, zap.NewAtomicLevelAt(lvl))
+	return zapr.NewLogger(zap.New(core, zap.AddCallerSkip(1), zap.ErrorOutput(sink), zap.AddStacktrace(zap.ErrorLevel))), nil
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// probes serves /healthz and /readyz. The operator is ready once its caches have synced, or
+// right away with leader election as standby replicas only start their caches once they lead.
+type probes struct {
+	ready int32
+}
+
+// Start marks the operator as ready, the manager starts runnables after its caches synced.
+func (p *probes) Start(stop <-chan struct{}) error {
+	atomic.StoreInt32(&p.ready, 1)
+	<-stop
+	return nil
+}
+
+// setReady marks the operator as ready.
+func (p *probes) setReady() {
+	atomic.StoreInt32(&p.ready, 1)
+}
+
+func (p *probes) serve(addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&p.ready) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	return http.ListenAndServe(addr, mux)
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// render prints the objects the operator creates for a Platform as YAML, without a cluster.
+//
+//	render -f platform.yaml
+//
+// Platforms are read as v1beta1 or v1.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"sigs.k8s.io/yaml"
+
+	"github.com/infinimesh/operator/pkg/apis"
+	infinimeshv1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1"
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+	"github.com/infinimesh/operator/pkg/controller/platform"
+	"github.com/infinimesh/operator/pkg/webhook/conversion"
+)
+
+const redacted = "REDACTED"
+
+func main() {
+	var file string
+	var showSecrets bool
+	var groups string
+	flag.StringVar(&file, "f", "-", "The Platform YAML file, - for stdin.")
+	flag.BoolVar(&showSecrets, "show-secrets", false, "Print the generated values of Secrets instead of redacting them.")
+	flag.StringVar(&groups, "api-groups", "", "Comma separated API groups of other operators to render the resources of, e.g. kafka.strimzi.io,kubedb.com,monitoring.coreos.com.")
+	flag.Parse()
+
+	// Keep the reconcilers' logs out of the rendered YAML
+	logf.SetLogger(logf.ZapLoggerTo(ioutil.Discard, false))
+
+	var apiGroups []string
+	if groups != "" {
+		apiGroups = strings.Split(groups, ",")
+	}
+	if err := run(file, showSecrets, apiGroups, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(file string, showSecrets bool, groups []string, out io.Writer) error {
+	var data []byte
+	var err error
+	if file == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(file)
+	}
+	if err != nil {
+		return err
+	}
+
+	instance, err := decodePlatform(data)
+	if err != nil {
+		return err
+	}
+	if instance.Namespace == "" {
+		instance.Namespace = "default"
+	}
+
+	s := runtime.NewScheme()
+	if err := scheme.AddToScheme(s); err != nil {
+		return err
+	}
+	if err := apis.AddToScheme(s); err != nil {
+		return err
+	}
+
+	objects, err := platform.Render(instance, s, groups...)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objects {
+		if secret, ok := obj.(*corev1.Secret); ok && !showSecrets {
+			redactSecret(secret)
+		}
+		b, err := yaml.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "---\n%s", b)
+	}
+	return nil
+}
+
+// decodePlatform decodes the Platform in data, converting v1 to v1beta1.
+func decodePlatform(data []byte) (*infinimeshv1beta1.Platform, error) {
+	typeMeta := metav1.TypeMeta{}
+	if err := yaml.Unmarshal(data, &typeMeta); err != nil {
+		return nil, err
+	}
+	if typeMeta.Kind != "Platform" {
+		return nil, fmt.Errorf("expected a Platform, got %q", typeMeta.Kind)
+	}
+
+	switch typeMeta.APIVersion {
+	case infinimeshv1beta1.SchemeGroupVersion.String():
+		instance := &infinimeshv1beta1.Platform{}
+		if err := yaml.UnmarshalStrict(data, instance); err != nil {
+			return nil, err
+		}
+		return instance, nil
+	case infinimeshv1.SchemeGroupVersion.String():
+		instance := &infinimeshv1.Platform{}
+		if err := yaml.UnmarshalStrict(data, instance); err != nil {
+			return nil, err
+		}
+		return conversion.ToV1beta1(instance), nil
+	}
+	return nil, fmt.Errorf("unsupported Platform version %q", typeMeta.APIVersion)
+}
+
+// redactSecret replaces the values of secret, the operator generates most of them randomly.
+func redactSecret(secret *corev1.Secret) {
+	if len(secret.Data) > 0 && secret.StringData == nil {
+		secret.StringData = map[string]string{}
+	}
+	for k := range secret.Data {
+		secret.StringData[k] = redacted
+	}
+	for k := range secret.StringData {
+		secret.StringData[k] = redacted
+	}
+	secret.Data = nil
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestRunSamples(t *testing.T) {
+	for _, sample := range []string{
+		"../../config/samples/infinimesh_v1beta1_platform.yaml",
+		"../../config/samples/infinimesh_v1_platform.yaml",
+	} {
+		out := &bytes.Buffer{}
+		if err := run(sample, false, nil, out); err != nil {
+			t.Errorf("%v: %v", sample, err)
+			continue
+		}
+		if !strings.Contains(out.String(), "name: my-infinimesh-root-account\n") {
+			t.Errorf("%v: root account secret is not rendered", sample)
+		}
+		if strings.Contains(out.String(), "\n  password: ") && !strings.Contains(out.String(), "password: "+redacted) {
+			t.Errorf("%v: password is not redacted", sample)
+		}
+	}
+}
+
+func TestDecodePlatform(t *testing.T) {
+	data, err := ioutil.ReadFile("../../config/samples/infinimesh_v1_platform.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	instance, err := decodePlatform(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if instance.Spec.Apiserver.Restful.Host != "api.infinimesh.io" {
+		t.Errorf("v1 isn't converted: %+v", instance.Spec.Apiserver)
+	}
+
+	for _, data := range []string{
+		"apiVersion: v1\nkind: ConfigMap\n",
+		"apiVersion: infinimesh.infinimesh.io/v1alpha1\nkind: Platform\n",
+		"apiVersion: infinimesh.infinimesh.io/v1beta1\nkind: Platform\nspec:\n  unknown: true\n",
+	} {
+		if _, err := decodePlatform([]byte(data)); err == nil {
+			t.Errorf("decoded %q", data)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DeviceCertificateRequestSpec requests a client certificate from the device CA of a Platform.
+// The certificate is issued once, a new request is needed to renew it.
+type DeviceCertificateRequestSpec struct {
+	// Platform is the name of the Platform in the namespace of the request
+	Platform string `json:"platform" protobuf:"bytes,1,name=platform"`
+	// CommonName of the certificate, defaults to the name of the object
+	CommonName string `json:"commonName,omitempty" protobuf:"bytes,2,name=commonName"`
+	// Validity of the certificate, defaults to a year. A certificate never outlives the CA.
+	Validity *metav1.Duration `json:"validity,omitempty" protobuf:"bytes,3,opt,name=validity"`
+	// Request is a PEM encoded certificate signing request. The operator generates a key if it
+	// is empty.
+	Request string `json:"request,omitempty" protobuf:"bytes,4,name=request"`
+	// SecretName is the Secret the certificate is stored in, defaults to the name of the object
+	SecretName string `json:"secretName,omitempty" protobuf:"bytes,5,name=secretName"`
+	// Revoked puts the certificate on the revocation list of the CA. Deleting the request revokes
+	// it as well.
+	Revoked bool `json:"revoked,omitempty" protobuf:"varint,6,opt,name=revoked"`
+}
+
+// DeviceCertificateRequestStatus describes the issued certificate.
+type DeviceCertificateRequestStatus struct {
+	// SerialNumber is the hex encoded serial number of the certificate
+	SerialNumber string `json:"serialNumber,omitempty" protobuf:"bytes,1,name=serialNumber"`
+	// Issuer is the fingerprint of the CA that issued the certificate
+	Issuer string `json:"issuer,omitempty" protobuf:"bytes,2,name=issuer"`
+	// Fingerprint is the hex encoded SHA-256 fingerprint of the certificate
+	Fingerprint string       `json:"fingerprint,omitempty" protobuf:"bytes,3,name=fingerprint"`
+	NotAfter    *metav1.Time `json:"notAfter,omitempty" protobuf:"bytes,4,opt,name=notAfter"`
+	// Message is the error of the last failed attempt to issue the certificate
+	Message string `json:"message,omitempty" protobuf:"bytes,5,name=message"`
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// DeviceCertificateRequest is the Schema for the devicecertificaterequests API
+// +k8s:openapi-gen=true
+// +kubebuilder:subresource:status
+type DeviceCertificateRequest struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DeviceCertificateRequestSpec   `json:"spec,omitempty"`
+	Status DeviceCertificateRequestStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// DeviceCertificateRequestList contains a list of DeviceCertificateRequest
+type DeviceCertificateRequestList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DeviceCertificateRequest `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DeviceCertificateRequest{}, &DeviceCertificateRequestList{})
+}
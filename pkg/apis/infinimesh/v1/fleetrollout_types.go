@@ -0,0 +1,110 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// FleetRolloutSpec defines a desired state patch applied to a fleet of devices in batches,
+// through the shadow API of a Platform.
+type FleetRolloutSpec struct {
+	// Platform is the name of the Platform in the namespace of the rollout
+	Platform string               `json:"platform" protobuf:"bytes,1,name=platform"`
+	Selector FleetRolloutSelector `json:"selector" protobuf:"bytes,2,name=selector"`
+	// Patch is the JSON merge patch applied to the desired state of the devices
+	Patch runtime.RawExtension `json:"patch" protobuf:"bytes,3,name=patch"`
+	// Batches are rolled out in order, the last one is repeated until all devices are patched.
+	// Defaults to a single batch of all devices.
+	Batches []FleetRolloutBatch `json:"batches,omitempty" protobuf:"bytes,4,rep,name=batches"`
+	// Rollback restores the previous desired state of the patched devices
+	Rollback bool `json:"rollback,omitempty" protobuf:"varint,5,opt,name=rollback"`
+	// AutoRollback rolls back once the rollout halted
+	AutoRollback bool `json:"autoRollback,omitempty" protobuf:"varint,6,opt,name=autoRollback"`
+}
+
+// FleetRolloutSelector selects the devices of an infinimesh namespace, optionally only those
+// with all of the tags.
+type FleetRolloutSelector struct {
+	Namespace string   `json:"namespace" protobuf:"bytes,1,name=namespace"`
+	Tags      []string `json:"tags,omitempty" protobuf:"bytes,2,rep,name=tags"`
+}
+
+// FleetRolloutBatch is a step of a rollout. A device of the batch succeeds once its reported
+// state matches the patch.
+type FleetRolloutBatch struct {
+	// Size is the number, or percentage of the selected devices, of devices in the batch
+	Size intstr.IntOrString `json:"size" protobuf:"bytes,1,name=size"`
+	// Pause is how long to wait after the batch succeeded before starting the next one
+	Pause *metav1.Duration `json:"pause,omitempty" protobuf:"bytes,2,opt,name=pause"`
+	// Timeout is how long the devices of the batch have to report the desired state, defaults
+	// to 10m
+	Timeout *metav1.Duration `json:"timeout,omitempty" protobuf:"bytes,3,opt,name=timeout"`
+	// FailureThreshold is the number, or percentage of the batch, of devices that may fail to
+	// report the desired state before the rollout halts. Defaults to 0.
+	FailureThreshold *intstr.IntOrString `json:"failureThreshold,omitempty" protobuf:"bytes,4,opt,name=failureThreshold"`
+}
+
+// FleetRolloutStatus defines the observed state of FleetRollout
+type FleetRolloutStatus struct {
+	// Phase is one of Progressing, Halted, Succeeded, RollingBack or RolledBack
+	Phase string `json:"phase,omitempty" protobuf:"bytes,1,name=phase"`
+	// Batch is the index of the current batch
+	Batch int32 `json:"batch,omitempty" protobuf:"varint,2,opt,name=batch"`
+	// BatchDevices are the ids of the devices of the current batch
+	BatchDevices   []string     `json:"batchDevices,omitempty" protobuf:"bytes,3,rep,name=batchDevices"`
+	BatchStartedAt *metav1.Time `json:"batchStartedAt,omitempty" protobuf:"bytes,4,opt,name=batchStartedAt"`
+	// NextBatchAt is the end of the pause after the last batch
+	NextBatchAt *metav1.Time `json:"nextBatchAt,omitempty" protobuf:"bytes,5,opt,name=nextBatchAt"`
+	// Selected is the number of devices the selector matched last
+	Selected int32 `json:"selected,omitempty" protobuf:"varint,6,opt,name=selected"`
+	// Patched, Succeeded and Failed count the devices of all batches
+	Patched            int32  `json:"patched,omitempty" protobuf:"varint,7,opt,name=patched"`
+	Succeeded          int32  `json:"succeeded,omitempty" protobuf:"varint,8,opt,name=succeeded"`
+	Failed             int32  `json:"failed,omitempty" protobuf:"varint,9,opt,name=failed"`
+	ObservedGeneration int64  `json:"observedGeneration,omitempty" protobuf:"varint,10,opt,name=observedGeneration"`
+	Message            string `json:"message,omitempty" protobuf:"bytes,11,name=message"`
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// FleetRollout is the Schema for the fleetrollouts API
+// +k8s:openapi-gen=true
+// +kubebuilder:subresource:status
+type FleetRollout struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   FleetRolloutSpec   `json:"spec,omitempty"`
+	Status FleetRolloutStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// FleetRolloutList contains a list of FleetRollout
+type FleetRolloutList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []FleetRollout `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&FleetRollout{}, &FleetRolloutList{})
+}
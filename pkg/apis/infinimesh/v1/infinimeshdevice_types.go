@@ -0,0 +1,95 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// InfinimeshDeviceSpec defines a device registered with the device registry of a Platform.
+type InfinimeshDeviceSpec struct {
+	// Platform is the name of the Platform in the namespace of the device
+	Platform string `json:"platform" protobuf:"bytes,1,name=platform"`
+	// Namespace is the infinimesh namespace the device belongs to
+	Namespace string `json:"namespace" protobuf:"bytes,2,name=namespace"`
+	// Name is the name of the device in infinimesh, defaults to the name of the object
+	Name string   `json:"name,omitempty" protobuf:"bytes,3,name=name"`
+	Tags []string `json:"tags,omitempty" protobuf:"bytes,4,rep,name=tags"`
+	// Enabled defaults to true
+	Enabled     *bool                       `json:"enabled,omitempty" protobuf:"varint,5,opt,name=enabled"`
+	Certificate InfinimeshDeviceCertificate `json:"certificate" protobuf:"bytes,6,name=certificate"`
+}
+
+// InfinimeshDeviceCertificate is the source of the certificate the device authenticates with,
+// exactly one of Secret and Generate is set.
+type InfinimeshDeviceCertificate struct {
+	Secret *InfinimeshDeviceCertificateSecret `json:"secret,omitempty" protobuf:"bytes,1,opt,name=secret"`
+	// Generate issues a certificate from the device CA of the platform, it is stored in the
+	// kubernetes.io/tls Secret <name>-device-cert
+	Generate *InfinimeshDeviceCertificateGenerate `json:"generate,omitempty" protobuf:"bytes,2,opt,name=generate"`
+}
+
+// InfinimeshDeviceCertificateSecret refers to a PEM encoded certificate in a Secret of the
+// namespace of the device.
+type InfinimeshDeviceCertificateSecret struct {
+	Name string `json:"name" protobuf:"bytes,1,name=name"`
+	// Key defaults to tls.crt
+	Key string `json:"key,omitempty" protobuf:"bytes,2,name=key"`
+}
+
+type InfinimeshDeviceCertificateGenerate struct {
+	// Validity of the certificate, defaults to a year. A certificate never outlives the CA.
+	Validity *metav1.Duration `json:"validity,omitempty" protobuf:"bytes,1,opt,name=validity"`
+}
+
+// InfinimeshDeviceStatus defines the observed state of InfinimeshDevice
+type InfinimeshDeviceStatus struct {
+	// ID is the id the device registry assigned to the device
+	ID string `json:"id,omitempty" protobuf:"bytes,1,name=id"`
+	// Fingerprint is the hex encoded SHA-256 fingerprint of the registered certificate
+	Fingerprint        string `json:"fingerprint,omitempty" protobuf:"bytes,2,name=fingerprint"`
+	ObservedGeneration int64  `json:"observedGeneration,omitempty" protobuf:"varint,3,opt,name=observedGeneration"`
+	// Message is the error of the last failed registration
+	Message string `json:"message,omitempty" protobuf:"bytes,4,name=message"`
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// InfinimeshDevice is the Schema for the infinimeshdevices API
+// +k8s:openapi-gen=true
+// +kubebuilder:subresource:status
+type InfinimeshDevice struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   InfinimeshDeviceSpec   `json:"spec,omitempty"`
+	Status InfinimeshDeviceStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// InfinimeshDeviceList contains a list of InfinimeshDevice
+type InfinimeshDeviceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []InfinimeshDevice `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&InfinimeshDevice{}, &InfinimeshDeviceList{})
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// InfinimeshDeviceStateSpec defines the desired state of a device, pushed through the shadow API
+// of a Platform. Exactly one of Device and InfinimeshDevice is set.
+type InfinimeshDeviceStateSpec struct {
+	// Platform is the name of the Platform in the namespace of the device state
+	Platform string `json:"platform" protobuf:"bytes,1,name=platform"`
+	// Device is the id of the device in the device registry
+	Device string `json:"device,omitempty" protobuf:"bytes,2,name=device"`
+	// InfinimeshDevice is the name of an InfinimeshDevice in the namespace of the device state
+	InfinimeshDevice string `json:"infinimeshDevice,omitempty" protobuf:"bytes,3,name=infinimeshDevice"`
+	// Desired is the JSON document the desired state of the device is converged to. Keys
+	// removed from it are removed from the desired state, keys set by others are kept.
+	Desired runtime.RawExtension `json:"desired" protobuf:"bytes,4,name=desired"`
+	// SyncInterval is how often the reported state is read, defaults to a minute
+	SyncInterval *metav1.Duration `json:"syncInterval,omitempty" protobuf:"bytes,5,opt,name=syncInterval"`
+}
+
+// InfinimeshDeviceStateStatus defines the observed state of InfinimeshDeviceState
+type InfinimeshDeviceStateStatus struct {
+	// Device is the id of the device in the device registry
+	Device string `json:"device,omitempty" protobuf:"bytes,1,name=device"`
+	// DesiredVersion is the version of the desired state in the shadow API
+	DesiredVersion int64 `json:"desiredVersion,omitempty" protobuf:"varint,2,opt,name=desiredVersion"`
+	// Reported is the state last reported by the device
+	Reported        *runtime.RawExtension `json:"reported,omitempty" protobuf:"bytes,3,opt,name=reported"`
+	ReportedVersion int64                 `json:"reportedVersion,omitempty" protobuf:"varint,4,opt,name=reportedVersion"`
+	// LastSeen is when the device last reported its state
+	LastSeen           *metav1.Time `json:"lastSeen,omitempty" protobuf:"bytes,5,opt,name=lastSeen"`
+	ObservedGeneration int64        `json:"observedGeneration,omitempty" protobuf:"varint,6,opt,name=observedGeneration"`
+	// Message is the error of the last failed sync
+	Message string `json:"message,omitempty" protobuf:"bytes,7,name=message"`
+	// Applied is the desired state last patched into the shadow, its keys are the ones the
+	// device state manages
+	Applied *runtime.RawExtension `json:"applied,omitempty" protobuf:"bytes,8,opt,name=applied"`
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// InfinimeshDeviceState is the Schema for the infinimeshdevicestates API
+// +k8s:openapi-gen=true
+// +kubebuilder:subresource:status
+type InfinimeshDeviceState struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   InfinimeshDeviceStateSpec   `json:"spec,omitempty"`
+	Status InfinimeshDeviceStateStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// InfinimeshDeviceStateList contains a list of InfinimeshDeviceState
+type InfinimeshDeviceStateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []InfinimeshDeviceState `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&InfinimeshDeviceState{}, &InfinimeshDeviceStateList{})
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Kinds of objects in the object hierarchy of infinimesh
+const (
+	ObjectKindAsset  = "asset"
+	ObjectKindDevice = "device"
+)
+
+// InfinimeshObjectTreeSpec defines the hierarchy of assets and devices in an infinimesh namespace
+// of a Platform.
+type InfinimeshObjectTreeSpec struct {
+	// Platform is the name of the Platform in the namespace of the tree
+	Platform string `json:"platform" protobuf:"bytes,1,name=platform"`
+	// Namespace is the name of the infinimesh namespace the objects are created in
+	Namespace string `json:"namespace" protobuf:"bytes,2,name=namespace"`
+	// Objects are the top level objects of the tree
+	Objects []InfinimeshObject `json:"objects,omitempty" protobuf:"bytes,3,rep,name=objects"`
+}
+
+// InfinimeshObject is a node of the object hierarchy. Names are unique among siblings.
+type InfinimeshObject struct {
+	Name string `json:"name" protobuf:"bytes,1,name=name"`
+	// Kind is asset or device, defaults to asset
+	// +kubebuilder:validation:Enum=asset,device
+	Kind string `json:"kind,omitempty" protobuf:"bytes,2,name=kind"`
+	// Objects are the children of the object
+	Objects []InfinimeshObject `json:"objects,omitempty" protobuf:"bytes,3,rep,name=objects"`
+}
+
+// InfinimeshObjectTreeStatus defines the observed state of InfinimeshObjectTree
+type InfinimeshObjectTreeStatus struct {
+	// NamespaceID is the uid of the infinimesh namespace the objects were created in
+	NamespaceID string `json:"namespaceID,omitempty" protobuf:"bytes,1,name=namespaceID"`
+	// Objects are the objects created in dgraph, parents before their children
+	Objects            []InfinimeshObjectStatus `json:"objects,omitempty" protobuf:"bytes,2,rep,name=objects"`
+	ObservedGeneration int64                    `json:"observedGeneration,omitempty" protobuf:"varint,3,opt,name=observedGeneration"`
+	// Message is the error of the last failed convergence
+	Message string `json:"message,omitempty" protobuf:"bytes,4,name=message"`
+}
+
+// InfinimeshObjectStatus is an object created in dgraph.
+type InfinimeshObjectStatus struct {
+	// Path is the slash separated list of names from the top level object to the object
+	Path string `json:"path" protobuf:"bytes,1,name=path"`
+	Kind string `json:"kind" protobuf:"bytes,2,name=kind"`
+	UID  string `json:"uid" protobuf:"bytes,3,name=uid"`
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// InfinimeshObjectTree is the Schema for the infinimeshobjecttrees API
+// +k8s:openapi-gen=true
+// +kubebuilder:subresource:status
+type InfinimeshObjectTree struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   InfinimeshObjectTreeSpec   `json:"spec,omitempty"`
+	Status InfinimeshObjectTreeStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// InfinimeshObjectTreeList contains a list of InfinimeshObjectTree
+type InfinimeshObjectTreeList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []InfinimeshObjectTree `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&InfinimeshObjectTree{}, &InfinimeshObjectTreeList{})
+}
@@ -0,0 +1,1478 @@
+// +build !ignore_autogenerated
+
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Code generated by main. DO NOT EDIT.
+
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+	intstr "k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DeviceCertificateRequest) DeepCopyInto(out *DeviceCertificateRequest) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DeviceCertificateRequest.
+func (in *DeviceCertificateRequest) DeepCopy() *DeviceCertificateRequest {
+	if in == nil {
+		return nil
+	}
+	out := new(DeviceCertificateRequest)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *DeviceCertificateRequest) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DeviceCertificateRequestList) DeepCopyInto(out *DeviceCertificateRequestList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	out.ListMeta = in.ListMeta
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]DeviceCertificateRequest, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DeviceCertificateRequestList.
+func (in *DeviceCertificateRequestList) DeepCopy() *DeviceCertificateRequestList {
+	if in == nil {
+		return nil
+	}
+	out := new(DeviceCertificateRequestList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *DeviceCertificateRequestList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DeviceCertificateRequestSpec) DeepCopyInto(out *DeviceCertificateRequestSpec) {
+	*out = *in
+	if in.Validity != nil {
+		in, out := &in.Validity, &out.Validity
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DeviceCertificateRequestSpec.
+func (in *DeviceCertificateRequestSpec) DeepCopy() *DeviceCertificateRequestSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DeviceCertificateRequestSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DeviceCertificateRequestStatus) DeepCopyInto(out *DeviceCertificateRequestStatus) {
+	*out = *in
+	if in.NotAfter != nil {
+		in, out := &in.NotAfter, &out.NotAfter
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DeviceCertificateRequestStatus.
+func (in *DeviceCertificateRequestStatus) DeepCopy() *DeviceCertificateRequestStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(DeviceCertificateRequestStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FleetRollout) DeepCopyInto(out *FleetRollout) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FleetRollout.
+func (in *FleetRollout) DeepCopy() *FleetRollout {
+	if in == nil {
+		return nil
+	}
+	out := new(FleetRollout)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *FleetRollout) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FleetRolloutBatch) DeepCopyInto(out *FleetRolloutBatch) {
+	*out = *in
+	out.Size = in.Size
+	if in.Pause != nil {
+		in, out := &in.Pause, &out.Pause
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.Timeout != nil {
+		in, out := &in.Timeout, &out.Timeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.FailureThreshold != nil {
+		in, out := &in.FailureThreshold, &out.FailureThreshold
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FleetRolloutBatch.
+func (in *FleetRolloutBatch) DeepCopy() *FleetRolloutBatch {
+	if in == nil {
+		return nil
+	}
+	out := new(FleetRolloutBatch)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FleetRolloutList) DeepCopyInto(out *FleetRolloutList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	out.ListMeta = in.ListMeta
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]FleetRollout, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FleetRolloutList.
+func (in *FleetRolloutList) DeepCopy() *FleetRolloutList {
+	if in == nil {
+		return nil
+	}
+	out := new(FleetRolloutList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *FleetRolloutList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FleetRolloutSelector) DeepCopyInto(out *FleetRolloutSelector) {
+	*out = *in
+	if in.Tags != nil {
+		in, out := &in.Tags, &out.Tags
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FleetRolloutSelector.
+func (in *FleetRolloutSelector) DeepCopy() *FleetRolloutSelector {
+	if in == nil {
+		return nil
+	}
+	out := new(FleetRolloutSelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FleetRolloutSpec) DeepCopyInto(out *FleetRolloutSpec) {
+	*out = *in
+	in.Selector.DeepCopyInto(&out.Selector)
+	in.Patch.DeepCopyInto(&out.Patch)
+	if in.Batches != nil {
+		in, out := &in.Batches, &out.Batches
+		*out = make([]FleetRolloutBatch, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FleetRolloutSpec.
+func (in *FleetRolloutSpec) DeepCopy() *FleetRolloutSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(FleetRolloutSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FleetRolloutStatus) DeepCopyInto(out *FleetRolloutStatus) {
+	*out = *in
+	if in.BatchDevices != nil {
+		in, out := &in.BatchDevices, &out.BatchDevices
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.BatchStartedAt != nil {
+		in, out := &in.BatchStartedAt, &out.BatchStartedAt
+		*out = (*in).DeepCopy()
+	}
+	if in.NextBatchAt != nil {
+		in, out := &in.NextBatchAt, &out.NextBatchAt
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FleetRolloutStatus.
+func (in *FleetRolloutStatus) DeepCopy() *FleetRolloutStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(FleetRolloutStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InfinimeshDevice) DeepCopyInto(out *InfinimeshDevice) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	out.Status = in.Status
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InfinimeshDevice.
+func (in *InfinimeshDevice) DeepCopy() *InfinimeshDevice {
+	if in == nil {
+		return nil
+	}
+	out := new(InfinimeshDevice)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *InfinimeshDevice) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InfinimeshDeviceCertificate) DeepCopyInto(out *InfinimeshDeviceCertificate) {
+	*out = *in
+	if in.Secret != nil {
+		in, out := &in.Secret, &out.Secret
+		*out = new(InfinimeshDeviceCertificateSecret)
+		**out = **in
+	}
+	if in.Generate != nil {
+		in, out := &in.Generate, &out.Generate
+		*out = new(InfinimeshDeviceCertificateGenerate)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InfinimeshDeviceCertificate.
+func (in *InfinimeshDeviceCertificate) DeepCopy() *InfinimeshDeviceCertificate {
+	if in == nil {
+		return nil
+	}
+	out := new(InfinimeshDeviceCertificate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InfinimeshDeviceCertificateGenerate) DeepCopyInto(out *InfinimeshDeviceCertificateGenerate) {
+	*out = *in
+	if in.Validity != nil {
+		in, out := &in.Validity, &out.Validity
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InfinimeshDeviceCertificateGenerate.
+func (in *InfinimeshDeviceCertificateGenerate) DeepCopy() *InfinimeshDeviceCertificateGenerate {
+	if in == nil {
+		return nil
+	}
+	out := new(InfinimeshDeviceCertificateGenerate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InfinimeshDeviceCertificateSecret) DeepCopyInto(out *InfinimeshDeviceCertificateSecret) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InfinimeshDeviceCertificateSecret.
+func (in *InfinimeshDeviceCertificateSecret) DeepCopy() *InfinimeshDeviceCertificateSecret {
+	if in == nil {
+		return nil
+	}
+	out := new(InfinimeshDeviceCertificateSecret)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InfinimeshDeviceList) DeepCopyInto(out *InfinimeshDeviceList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	out.ListMeta = in.ListMeta
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]InfinimeshDevice, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InfinimeshDeviceList.
+func (in *InfinimeshDeviceList) DeepCopy() *InfinimeshDeviceList {
+	if in == nil {
+		return nil
+	}
+	out := new(InfinimeshDeviceList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *InfinimeshDeviceList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InfinimeshDeviceSpec) DeepCopyInto(out *InfinimeshDeviceSpec) {
+	*out = *in
+	if in.Tags != nil {
+		in, out := &in.Tags, &out.Tags
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Enabled != nil {
+		in, out := &in.Enabled, &out.Enabled
+		*out = new(bool)
+		**out = **in
+	}
+	in.Certificate.DeepCopyInto(&out.Certificate)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InfinimeshDeviceSpec.
+func (in *InfinimeshDeviceSpec) DeepCopy() *InfinimeshDeviceSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(InfinimeshDeviceSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InfinimeshDeviceState) DeepCopyInto(out *InfinimeshDeviceState) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InfinimeshDeviceState.
+func (in *InfinimeshDeviceState) DeepCopy() *InfinimeshDeviceState {
+	if in == nil {
+		return nil
+	}
+	out := new(InfinimeshDeviceState)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *InfinimeshDeviceState) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InfinimeshDeviceStateList) DeepCopyInto(out *InfinimeshDeviceStateList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	out.ListMeta = in.ListMeta
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]InfinimeshDeviceState, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InfinimeshDeviceStateList.
+func (in *InfinimeshDeviceStateList) DeepCopy() *InfinimeshDeviceStateList {
+	if in == nil {
+		return nil
+	}
+	out := new(InfinimeshDeviceStateList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *InfinimeshDeviceStateList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InfinimeshDeviceStateSpec) DeepCopyInto(out *InfinimeshDeviceStateSpec) {
+	*out = *in
+	in.Desired.DeepCopyInto(&out.Desired)
+	if in.SyncInterval != nil {
+		in, out := &in.SyncInterval, &out.SyncInterval
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InfinimeshDeviceStateSpec.
+func (in *InfinimeshDeviceStateSpec) DeepCopy() *InfinimeshDeviceStateSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(InfinimeshDeviceStateSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InfinimeshDeviceStateStatus) DeepCopyInto(out *InfinimeshDeviceStateStatus) {
+	*out = *in
+	if in.Reported != nil {
+		in, out := &in.Reported, &out.Reported
+		*out = new(runtime.RawExtension)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.LastSeen != nil {
+		in, out := &in.LastSeen, &out.LastSeen
+		*out = (*in).DeepCopy()
+	}
+	if in.Applied != nil {
+		in, out := &in.Applied, &out.Applied
+		*out = new(runtime.RawExtension)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InfinimeshDeviceStateStatus.
+func (in *InfinimeshDeviceStateStatus) DeepCopy() *InfinimeshDeviceStateStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(InfinimeshDeviceStateStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InfinimeshDeviceStatus) DeepCopyInto(out *InfinimeshDeviceStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InfinimeshDeviceStatus.
+func (in *InfinimeshDeviceStatus) DeepCopy() *InfinimeshDeviceStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(InfinimeshDeviceStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InfinimeshObject) DeepCopyInto(out *InfinimeshObject) {
+	*out = *in
+	if in.Objects != nil {
+		in, out := &in.Objects, &out.Objects
+		*out = make([]InfinimeshObject, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InfinimeshObject.
+func (in *InfinimeshObject) DeepCopy() *InfinimeshObject {
+	if in == nil {
+		return nil
+	}
+	out := new(InfinimeshObject)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InfinimeshObjectStatus) DeepCopyInto(out *InfinimeshObjectStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InfinimeshObjectStatus.
+func (in *InfinimeshObjectStatus) DeepCopy() *InfinimeshObjectStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(InfinimeshObjectStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InfinimeshObjectTree) DeepCopyInto(out *InfinimeshObjectTree) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InfinimeshObjectTree.
+func (in *InfinimeshObjectTree) DeepCopy() *InfinimeshObjectTree {
+	if in == nil {
+		return nil
+	}
+	out := new(InfinimeshObjectTree)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *InfinimeshObjectTree) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InfinimeshObjectTreeList) DeepCopyInto(out *InfinimeshObjectTreeList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	out.ListMeta = in.ListMeta
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]InfinimeshObjectTree, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InfinimeshObjectTreeList.
+func (in *InfinimeshObjectTreeList) DeepCopy() *InfinimeshObjectTreeList {
+	if in == nil {
+		return nil
+	}
+	out := new(InfinimeshObjectTreeList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *InfinimeshObjectTreeList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InfinimeshObjectTreeSpec) DeepCopyInto(out *InfinimeshObjectTreeSpec) {
+	*out = *in
+	if in.Objects != nil {
+		in, out := &in.Objects, &out.Objects
+		*out = make([]InfinimeshObject, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InfinimeshObjectTreeSpec.
+func (in *InfinimeshObjectTreeSpec) DeepCopy() *InfinimeshObjectTreeSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(InfinimeshObjectTreeSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InfinimeshObjectTreeStatus) DeepCopyInto(out *InfinimeshObjectTreeStatus) {
+	*out = *in
+	if in.Objects != nil {
+		in, out := &in.Objects, &out.Objects
+		*out = make([]InfinimeshObjectStatus, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InfinimeshObjectTreeStatus.
+func (in *InfinimeshObjectTreeStatus) DeepCopy() *InfinimeshObjectTreeStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(InfinimeshObjectTreeStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Platform) DeepCopyInto(out *Platform) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Platform.
+func (in *Platform) DeepCopy() *Platform {
+	if in == nil {
+		return nil
+	}
+	out := new(Platform)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *Platform) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformComponent) DeepCopyInto(out *PlatformComponent) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformComponent.
+func (in *PlatformComponent) DeepCopy() *PlatformComponent {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformComponent)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformDeviceCA) DeepCopyInto(out *PlatformDeviceCA) {
+	*out = *in
+	if in.Validity != nil {
+		in, out := &in.Validity, &out.Validity
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.RenewBefore != nil {
+		in, out := &in.RenewBefore, &out.RenewBefore
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformDeviceCA.
+func (in *PlatformDeviceCA) DeepCopy() *PlatformDeviceCA {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformDeviceCA)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformDeviceCAStatus) DeepCopyInto(out *PlatformDeviceCAStatus) {
+	*out = *in
+	in.NotAfter.DeepCopyInto(&out.NotAfter)
+	if in.Trusted != nil {
+		in, out := &in.Trusted, &out.Trusted
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformDeviceCAStatus.
+func (in *PlatformDeviceCAStatus) DeepCopy() *PlatformDeviceCAStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformDeviceCAStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformDgraph) DeepCopyInto(out *PlatformDgraph) {
+	*out = *in
+	if in.Storage != nil {
+		in, out := &in.Storage, &out.Storage
+		*out = new(corev1.PersistentVolumeClaimSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.External != nil {
+		in, out := &in.External, &out.External
+		*out = new(PlatformDgraphExternal)
+		**out = **in
+	}
+	in.Alpha.DeepCopyInto(&out.Alpha)
+	in.Zero.DeepCopyInto(&out.Zero)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformDgraph.
+func (in *PlatformDgraph) DeepCopy() *PlatformDgraph {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformDgraph)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformDgraphExternal) DeepCopyInto(out *PlatformDgraphExternal) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformDgraphExternal.
+func (in *PlatformDgraphExternal) DeepCopy() *PlatformDgraphExternal {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformDgraphExternal)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformDgraphNode) DeepCopyInto(out *PlatformDgraphNode) {
+	*out = *in
+	if in.Storage != nil {
+		in, out := &in.Storage, &out.Storage
+		*out = new(corev1.PersistentVolumeClaimSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformDgraphNode.
+func (in *PlatformDgraphNode) DeepCopy() *PlatformDgraphNode {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformDgraphNode)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformEndpoint) DeepCopyInto(out *PlatformEndpoint) {
+	*out = *in
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = make([]v1beta1.IngressTLS, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformEndpoint.
+func (in *PlatformEndpoint) DeepCopy() *PlatformEndpoint {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformEndpoint)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformGrafana) DeepCopyInto(out *PlatformGrafana) {
+	*out = *in
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = make([]v1beta1.IngressTLS, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Storage != nil {
+		in, out := &in.Storage, &out.Storage
+		*out = new(corev1.PersistentVolumeClaimSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformGrafana.
+func (in *PlatformGrafana) DeepCopy() *PlatformGrafana {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformGrafana)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformJobs) DeepCopyInto(out *PlatformJobs) {
+	*out = *in
+	out.ResetRootAccountPassword = in.ResetRootAccountPassword
+	out.HardDeleteNamespaces = in.HardDeleteNamespaces
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformJobs.
+func (in *PlatformJobs) DeepCopy() *PlatformJobs {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformJobs)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformKafka) DeepCopyInto(out *PlatformKafka) {
+	*out = *in
+	if in.Topics != nil {
+		in, out := &in.Topics, &out.Topics
+		*out = make([]PlatformKafkaTopic, len(*in))
+		copy(*out, *in)
+	}
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(PlatformKafkaTLS)
+		**out = **in
+	}
+	if in.SASL != nil {
+		in, out := &in.SASL, &out.SASL
+		*out = new(PlatformKafkaSASL)
+		**out = **in
+	}
+	if in.Managed != nil {
+		in, out := &in.Managed, &out.Managed
+		*out = new(PlatformKafkaManaged)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformKafka.
+func (in *PlatformKafka) DeepCopy() *PlatformKafka {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformKafka)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformKafkaManaged) DeepCopyInto(out *PlatformKafkaManaged) {
+	*out = *in
+	if in.Storage != nil {
+		in, out := &in.Storage, &out.Storage
+		*out = new(corev1.PersistentVolumeClaimSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformKafkaManaged.
+func (in *PlatformKafkaManaged) DeepCopy() *PlatformKafkaManaged {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformKafkaManaged)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformKafkaSASL) DeepCopyInto(out *PlatformKafkaSASL) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformKafkaSASL.
+func (in *PlatformKafkaSASL) DeepCopy() *PlatformKafkaSASL {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformKafkaSASL)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformKafkaTLS) DeepCopyInto(out *PlatformKafkaTLS) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformKafkaTLS.
+func (in *PlatformKafkaTLS) DeepCopy() *PlatformKafkaTLS {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformKafkaTLS)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformKafkaTopic) DeepCopyInto(out *PlatformKafkaTopic) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformKafkaTopic.
+func (in *PlatformKafkaTopic) DeepCopy() *PlatformKafkaTopic {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformKafkaTopic)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformKafkaTopicStatus) DeepCopyInto(out *PlatformKafkaTopicStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformKafkaTopicStatus.
+func (in *PlatformKafkaTopicStatus) DeepCopy() *PlatformKafkaTopicStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformKafkaTopicStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformList) DeepCopyInto(out *PlatformList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	out.ListMeta = in.ListMeta
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]Platform, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformList.
+func (in *PlatformList) DeepCopy() *PlatformList {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PlatformList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformMQTTBridge) DeepCopyInto(out *PlatformMQTTBridge) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformMQTTBridge.
+func (in *PlatformMQTTBridge) DeepCopy() *PlatformMQTTBridge {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformMQTTBridge)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformMaintenance) DeepCopyInto(out *PlatformMaintenance) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformMaintenance.
+func (in *PlatformMaintenance) DeepCopy() *PlatformMaintenance {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformMaintenance)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformObservability) DeepCopyInto(out *PlatformObservability) {
+	*out = *in
+	if in.Prometheus != nil {
+		in, out := &in.Prometheus, &out.Prometheus
+		*out = new(PlatformPrometheus)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformObservability.
+func (in *PlatformObservability) DeepCopy() *PlatformObservability {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformObservability)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformPrometheus) DeepCopyInto(out *PlatformPrometheus) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformPrometheus.
+func (in *PlatformPrometheus) DeepCopy() *PlatformPrometheus {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformPrometheus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformRedis) DeepCopyInto(out *PlatformRedis) {
+	*out = *in
+	in.DeviceDetails.DeepCopyInto(&out.DeviceDetails)
+	in.Twin.DeepCopyInto(&out.Twin)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformRedis.
+func (in *PlatformRedis) DeepCopy() *PlatformRedis {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformRedis)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformRedisExternal) DeepCopyInto(out *PlatformRedisExternal) {
+	*out = *in
+	if in.SentinelAddresses != nil {
+		in, out := &in.SentinelAddresses, &out.SentinelAddresses
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformRedisExternal.
+func (in *PlatformRedisExternal) DeepCopy() *PlatformRedisExternal {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformRedisExternal)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformRedisStore) DeepCopyInto(out *PlatformRedisStore) {
+	*out = *in
+	if in.Storage != nil {
+		in, out := &in.Storage, &out.Storage
+		*out = new(corev1.PersistentVolumeClaimSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	in.Resources.DeepCopyInto(&out.Resources)
+	if in.External != nil {
+		in, out := &in.External, &out.External
+		*out = new(PlatformRedisExternal)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformRedisStore.
+func (in *PlatformRedisStore) DeepCopy() *PlatformRedisStore {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformRedisStore)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformSecurity) DeepCopyInto(out *PlatformSecurity) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformSecurity.
+func (in *PlatformSecurity) DeepCopy() *PlatformSecurity {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformSecurity)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformSpec) DeepCopyInto(out *PlatformSpec) {
+	*out = *in
+	in.Upgrade.DeepCopyInto(&out.Upgrade)
+	if in.Storage != nil {
+		in, out := &in.Storage, &out.Storage
+		*out = new(corev1.PersistentVolumeClaimSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	in.Dgraph.DeepCopyInto(&out.Dgraph)
+	in.Kafka.DeepCopyInto(&out.Kafka)
+	in.Redis.DeepCopyInto(&out.Redis)
+	out.DeviceRegistry = in.DeviceRegistry
+	out.DeviceDetails = in.DeviceDetails
+	out.NodeServer = in.NodeServer
+	out.TelemetryRouter = in.TelemetryRouter
+	out.Twin = in.Twin
+	out.MQTTBridge = in.MQTTBridge
+	in.Timeseries.DeepCopyInto(&out.Timeseries)
+	in.Apiserver.DeepCopyInto(&out.Apiserver)
+	in.ApiserverRest.DeepCopyInto(&out.ApiserverRest)
+	in.Frontend.DeepCopyInto(&out.Frontend)
+	in.Grafana.DeepCopyInto(&out.Grafana)
+	out.Jobs = in.Jobs
+	in.Observability.DeepCopyInto(&out.Observability)
+	out.Maintenance = in.Maintenance
+	in.DeviceCA.DeepCopyInto(&out.DeviceCA)
+	out.Security = in.Security
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformSpec.
+func (in *PlatformSpec) DeepCopy() *PlatformSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformStatus) DeepCopyInto(out *PlatformStatus) {
+	*out = *in
+	if in.KafkaTopics != nil {
+		in, out := &in.KafkaTopics, &out.KafkaTopics
+		*out = make([]PlatformKafkaTopicStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.UnmanagedComponents != nil {
+		in, out := &in.UnmanagedComponents, &out.UnmanagedComponents
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Upgrade != nil {
+		in, out := &in.Upgrade, &out.Upgrade
+		*out = new(PlatformUpgradeStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.UpgradeHistory != nil {
+		in, out := &in.UpgradeHistory, &out.UpgradeHistory
+		*out = make([]PlatformUpgradeRecord, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.DeviceCA != nil {
+		in, out := &in.DeviceCA, &out.DeviceCA
+		*out = new(PlatformDeviceCAStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformStatus.
+func (in *PlatformStatus) DeepCopy() *PlatformStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformTimescaleDB) DeepCopyInto(out *PlatformTimescaleDB) {
+	*out = *in
+	if in.Storage != nil {
+		in, out := &in.Storage, &out.Storage
+		*out = new(corev1.PersistentVolumeClaimSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformTimescaleDB.
+func (in *PlatformTimescaleDB) DeepCopy() *PlatformTimescaleDB {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformTimescaleDB)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformTimeseries) DeepCopyInto(out *PlatformTimeseries) {
+	*out = *in
+	if in.TimescaleDB != nil {
+		in, out := &in.TimescaleDB, &out.TimescaleDB
+		*out = new(PlatformTimescaleDB)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformTimeseries.
+func (in *PlatformTimeseries) DeepCopy() *PlatformTimeseries {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformTimeseries)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformUpgrade) DeepCopyInto(out *PlatformUpgrade) {
+	*out = *in
+	if in.Hooks != nil {
+		in, out := &in.Hooks, &out.Hooks
+		*out = make([]PlatformUpgradeHook, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformUpgrade.
+func (in *PlatformUpgrade) DeepCopy() *PlatformUpgrade {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformUpgrade)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformUpgradeHook) DeepCopyInto(out *PlatformUpgradeHook) {
+	*out = *in
+	if in.Command != nil {
+		in, out := &in.Command, &out.Command
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Args != nil {
+		in, out := &in.Args, &out.Args
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Env != nil {
+		in, out := &in.Env, &out.Env
+		*out = make([]corev1.EnvVar, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformUpgradeHook.
+func (in *PlatformUpgradeHook) DeepCopy() *PlatformUpgradeHook {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformUpgradeHook)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformUpgradeRecord) DeepCopyInto(out *PlatformUpgradeRecord) {
+	*out = *in
+	in.StartedAt.DeepCopyInto(&out.StartedAt)
+	in.FinishedAt.DeepCopyInto(&out.FinishedAt)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformUpgradeRecord.
+func (in *PlatformUpgradeRecord) DeepCopy() *PlatformUpgradeRecord {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformUpgradeRecord)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformUpgradeStatus) DeepCopyInto(out *PlatformUpgradeStatus) {
+	*out = *in
+	in.StartedAt.DeepCopyInto(&out.StartedAt)
+	in.StepStartedAt.DeepCopyInto(&out.StepStartedAt)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformUpgradeStatus.
+func (in *PlatformUpgradeStatus) DeepCopy() *PlatformUpgradeStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformUpgradeStatus)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -37,6 +37,18 @@ type PlatformSpec struct {
 	InfinimeshDefaultStorage PlatformInfinimeshDefaultStorage `json:"infinimeshDefaultStorage,omitempty" protobuf:"bytes,2,name=infinimeshDefaultStorage"`
 	Controller               PlatformController               `json:"controller,omitempty" protobuf:"bytes,13,name=controller"`
 	Host                     PlatformHost                     `json:"host,omitempty" protobuf:"bytes,1,name=host"`
+	Redis                    PlatformRedis                    `json:"redis,omitempty" protobuf:"bytes,14,name=redis"`
+	Timeseries               PlatformTimeseries               `json:"timeseries,omitempty" protobuf:"bytes,15,name=timeseries"`
+	Grafana                  PlatformGrafana                  `json:"grafana,omitempty" protobuf:"bytes,16,name=grafana"`
+	Observability            PlatformObservability            `json:"observability,omitempty" protobuf:"bytes,17,name=observability"`
+	Maintenance              PlatformMaintenance              `json:"maintenance,omitempty" protobuf:"bytes,18,name=maintenance"`
+	// Version is the tag of the infinimesh images. Changing it upgrades the platform step by
+	// step, see Upgrade. Defaults to latest, which is pulled whenever a pod starts.
+	Version string          `json:"version,omitempty" protobuf:"bytes,19,name=version"`
+	Upgrade PlatformUpgrade `json:"upgrade,omitempty" protobuf:"bytes,20,name=upgrade"`
+
+	DeviceCA PlatformDeviceCA `json:"deviceCA,omitempty" protobuf:"bytes,21,name=deviceCA"`
+	Security PlatformSecurity `json:"security,omitempty" protobuf:"bytes,22,name=security"`
 
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
@@ -44,6 +56,16 @@ type PlatformSpec struct {
 
 type PlatformDgraph struct {
 	Storage *core.PersistentVolumeClaimSpec `json:"storage,omitempty" protobuf:"bytes,1,name=storage"`
+	// External points the platform at a dgraph cluster not managed by the operator,
+	// no dgraph statefulsets are deployed if set
+	External *PlatformDgraphExternal `json:"external,omitempty" protobuf:"bytes,2,opt,name=external"`
+}
+
+type PlatformDgraphExternal struct {
+	// Address of a dgraph alpha gRPC endpoint, e.g. dgraph.example.com:9080
+	Address string `json:"address" protobuf:"bytes,1,name=address"`
+	// CredentialsSecret is a Secret with the username and password keys of a dgraph ACL user
+	CredentialsSecret string `json:"credentialsSecret,omitempty" protobuf:"bytes,2,name=credentialsSecret"`
 }
 type PlatformDgraphAlpha struct {
 	Storage *core.PersistentVolumeClaimSpec `json:"storage,omitempty" protobuf:"bytes,1,name=storage"`
@@ -74,9 +96,92 @@ type PlatformTimeseries struct {
 }
 
 type PlatformTimescaleDB struct {
+	// Backend is native for a TimescaleDB statefulset run by the operator, or kubedb for a
+	// KubeDB Postgres if the KubeDB CRDs are installed. Defaults to native.
+	// +kubebuilder:validation:Enum=native,kubedb
+	Backend string                          `json:"backend,omitempty" protobuf:"bytes,1,name=backend"`
 	Storage *core.PersistentVolumeClaimSpec `json:"storage,omitempty" protobuf:"bytes,2,name=storage"`
 }
 
+type PlatformGrafana struct {
+	Host string                         `json:"host,omitempty" protobuf:"bytes,1,name=host"`
+	TLS  []extensionsv1beta1.IngressTLS `json:"tls,omitempty" protobuf:"bytes,2,name=tls"`
+	// Storage of the volume holding grafana.db. Defaults to 1Gi.
+	Storage *core.PersistentVolumeClaimSpec `json:"storage,omitempty" protobuf:"bytes,3,name=storage"`
+}
+
+type PlatformObservability struct {
+	// Prometheus enables ServiceMonitors, metrics exporters and alerting rules for the
+	// platform. Requires the prometheus-operator CRDs.
+	Prometheus *PlatformPrometheus `json:"prometheus,omitempty" protobuf:"bytes,1,opt,name=prometheus"`
+}
+
+type PlatformPrometheus struct {
+	// Labels are added to the ServiceMonitors and PrometheusRules so a Prometheus can select them
+	Labels map[string]string `json:"labels,omitempty" protobuf:"bytes,1,rep,name=labels"`
+	// Interval is the scrape interval of the ServiceMonitors. Defaults to 30s.
+	Interval string `json:"interval,omitempty" protobuf:"bytes,2,name=interval"`
+}
+
+type PlatformMaintenance struct {
+	// Enabled scales the frontend, the REST apiserver and Grafana down and serves a maintenance
+	// page on their hosts instead. Data services keep running.
+	Enabled bool `json:"enabled,omitempty" protobuf:"varint,1,opt,name=enabled"`
+	// Message is shown on the maintenance page
+	Message string `json:"message,omitempty" protobuf:"bytes,2,name=message"`
+}
+
+// PlatformDeviceCA configures the CA the operator issues device certificates from, see
+// InfinimeshDevice and DeviceCertificateRequest.
+type PlatformDeviceCA struct {
+	Enabled bool `json:"enabled,omitempty" protobuf:"varint,1,opt,name=enabled"`
+	// Issuer is the name of a cert-manager issuer signing the CA, it is self-signed if empty
+	Issuer string `json:"issuer,omitempty" protobuf:"bytes,2,name=issuer"`
+	// IssuerKind is the kind of the issuer, defaults to Issuer
+	// +kubebuilder:validation:Enum=Issuer,ClusterIssuer
+	IssuerKind string `json:"issuerKind,omitempty" protobuf:"bytes,3,name=issuerKind"`
+	// Validity of the CA, defaults to ten years
+	Validity *metav1.Duration `json:"validity,omitempty" protobuf:"bytes,4,opt,name=validity"`
+	// RenewBefore is how long before it expires the CA is replaced, defaults to 90 days. The
+	// previous CA stays trusted until it expires.
+	RenewBefore *metav1.Duration `json:"renewBefore,omitempty" protobuf:"bytes,5,opt,name=renewBefore"`
+}
+
+// PlatformSecurity configures how the pods of the platform are hardened. Every workload runs as
+// a ServiceAccount of its own, named like the workload, regardless of the profile.
+type PlatformSecurity struct {
+	// Profile is the Pod Security Standard the pods of the platform comply with, baseline or
+	// restricted. The security contexts are left at their defaults if empty.
+	// +kubebuilder:validation:Enum=baseline,restricted
+	Profile string `json:"profile,omitempty" protobuf:"bytes,1,opt,name=profile"`
+}
+
+// PlatformUpgrade configures how a change of the version is rolled out. The steps of an upgrade
+// are schema, dgraph, backends, apis and frontend. Each step runs its pre hooks, rolls out its
+// workloads, waits for them to be ready and runs its post hooks.
+type PlatformUpgrade struct {
+	Hooks []PlatformUpgradeHook `json:"hooks,omitempty" protobuf:"bytes,1,rep,name=hooks"`
+	// StepTimeout is how long a step may take before the upgrade fails and the platform is
+	// paused, e.g. 15m. Defaults to 10m.
+	StepTimeout string `json:"stepTimeout,omitempty" protobuf:"bytes,2,name=stepTimeout"`
+}
+
+// PlatformUpgradeHook is a Job run during an upgrade. It gets the UPGRADE_FROM and UPGRADE_TO
+// environment variables with the versions.
+type PlatformUpgradeHook struct {
+	Name string `json:"name" protobuf:"bytes,1,name=name"`
+	// +kubebuilder:validation:Enum=schema,dgraph,backends,apis,frontend
+	Step string `json:"step" protobuf:"bytes,2,name=step"`
+	// Phase is pre to run the hook before the workloads of the step are upgraded, post after
+	// they are ready
+	// +kubebuilder:validation:Enum=pre,post
+	Phase   string        `json:"phase" protobuf:"bytes,3,name=phase"`
+	Image   string        `json:"image" protobuf:"bytes,4,name=image"`
+	Command []string      `json:"command,omitempty" protobuf:"bytes,5,rep,name=command"`
+	Args    []string      `json:"args,omitempty" protobuf:"bytes,6,rep,name=args"`
+	Env     []core.EnvVar `json:"env,omitempty" protobuf:"bytes,7,rep,name=env"`
+}
+
 type PlatformApp struct {
 	Host string                         `json:"host,omitempty" protobuf:"bytes,1,name=host"`
 	TLS  []extensionsv1beta1.IngressTLS `json:"tls,omitempty" protobuf:"bytes,2,name=tls"`
@@ -98,6 +203,78 @@ type PlatformGRPCApiserver struct {
 
 type PlatformKafka struct {
 	BootstrapServers string `json:"bootstrapServers,omitempty" protobuf:"bytes,1,name=bootstrapServers"`
+	// StrimziCluster is the name of the Strimzi Kafka cluster the topics belong to.
+	// Defaults to the bootstrap host with its "-kafka-bootstrap" suffix removed.
+	StrimziCluster string `json:"strimziCluster,omitempty" protobuf:"bytes,2,name=strimziCluster"`
+	// Topics overrides or extends the default topics used by the platform.
+	Topics []PlatformKafkaTopic `json:"topics,omitempty" protobuf:"bytes,3,rep,name=topics"`
+	TLS    *PlatformKafkaTLS    `json:"tls,omitempty" protobuf:"bytes,4,opt,name=tls"`
+	SASL   *PlatformKafkaSASL   `json:"sasl,omitempty" protobuf:"bytes,5,opt,name=sasl"`
+	// Managed deploys a KRaft Kafka owned by the Platform serving PLAINTEXT. BootstrapServers,
+	// TLS and SASL are ignored if set.
+	Managed *PlatformKafkaManaged `json:"managed,omitempty" protobuf:"bytes,6,opt,name=managed"`
+}
+
+type PlatformKafkaManaged struct {
+	// Replicas is the number of combined broker and controller nodes, either 1 or 3. Defaults to 1.
+	// +kubebuilder:validation:Enum=1,3
+	Replicas int32                           `json:"replicas,omitempty" protobuf:"varint,1,opt,name=replicas"`
+	Storage  *core.PersistentVolumeClaimSpec `json:"storage,omitempty" protobuf:"bytes,2,name=storage"`
+}
+
+// PlatformKafkaTLS enables TLS towards the brokers.
+type PlatformKafkaTLS struct {
+	// CASecret is the name of a Secret holding the broker CA under ca.crt.
+	CASecret string `json:"caSecret,omitempty" protobuf:"bytes,1,name=caSecret"`
+	// CertSecret is the name of a kubernetes.io/tls Secret used as client certificate.
+	CertSecret string `json:"certSecret,omitempty" protobuf:"bytes,2,name=certSecret"`
+}
+
+// PlatformKafkaSASL enables SASL authentication towards the brokers.
+type PlatformKafkaSASL struct {
+	// Mechanism is one of PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512.
+	// +kubebuilder:validation:Enum=PLAIN,SCRAM-SHA-256,SCRAM-SHA-512
+	Mechanism string `json:"mechanism,omitempty" protobuf:"bytes,1,name=mechanism"`
+	// CredentialsSecret is the name of a Secret holding username and password.
+	CredentialsSecret string `json:"credentialsSecret,omitempty" protobuf:"bytes,2,name=credentialsSecret"`
+}
+
+type PlatformKafkaTopic struct {
+	Name        string `json:"name" protobuf:"bytes,1,name=name"`
+	Partitions  int32  `json:"partitions,omitempty" protobuf:"varint,2,opt,name=partitions"`
+	Replicas    int32  `json:"replicas,omitempty" protobuf:"varint,3,opt,name=replicas"`
+	RetentionMs int64  `json:"retentionMs,omitempty" protobuf:"varint,4,opt,name=retentionMs"`
+}
+
+type PlatformRedis struct {
+	DeviceDetails PlatformRedisStore `json:"deviceDetails,omitempty" protobuf:"bytes,1,name=deviceDetails"`
+	Twin          PlatformRedisStore `json:"twin,omitempty" protobuf:"bytes,2,name=twin"`
+}
+
+type PlatformRedisStore struct {
+	// Mode is one of standalone, sentinel or external. Defaults to external if External
+	// is set and to standalone otherwise.
+	// +kubebuilder:validation:Enum=standalone,sentinel,external
+	Mode string `json:"mode,omitempty" protobuf:"bytes,1,name=mode"`
+	// Replicas is the number of redis nodes in sentinel mode. Defaults to 3.
+	Replicas int32 `json:"replicas,omitempty" protobuf:"varint,2,opt,name=replicas"`
+	// AuthSecret is the name of a Secret holding the redis password under "password".
+	// The operator generates one unless the mode is external.
+	AuthSecret string `json:"authSecret,omitempty" protobuf:"bytes,3,name=authSecret"`
+	// Persistence is one of aof, rdb or none. Defaults to aof.
+	// +kubebuilder:validation:Enum=aof,rdb,none
+	Persistence string                          `json:"persistence,omitempty" protobuf:"bytes,4,name=persistence"`
+	Storage     *core.PersistentVolumeClaimSpec `json:"storage,omitempty" protobuf:"bytes,5,name=storage"`
+	Resources   core.ResourceRequirements       `json:"resources,omitempty" protobuf:"bytes,6,name=resources"`
+	External    *PlatformRedisExternal          `json:"external,omitempty" protobuf:"bytes,7,opt,name=external"`
+}
+
+type PlatformRedisExternal struct {
+	// Address is the host:port of the redis master.
+	Address string `json:"address,omitempty" protobuf:"bytes,1,name=address"`
+	// SentinelAddresses are the host:port pairs of the sentinels watching MasterName.
+	SentinelAddresses []string `json:"sentinelAddresses,omitempty" protobuf:"bytes,2,rep,name=sentinelAddresses"`
+	MasterName        string   `json:"masterName,omitempty" protobuf:"bytes,3,name=masterName"`
 }
 
 type PlatformMQTTBroker struct {
@@ -111,6 +288,60 @@ type PlatformHost struct {
 type PlatformStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+	KafkaTopics []PlatformKafkaTopicStatus `json:"kafkaTopics,omitempty" protobuf:"bytes,1,rep,name=kafkaTopics"`
+	// Paused is set while the platform has the infinimesh.io/paused annotation
+	Paused bool `json:"paused,omitempty" protobuf:"varint,2,opt,name=paused"`
+	// UnmanagedComponents are skipped because of an infinimesh.io/unmanaged-<component> annotation
+	UnmanagedComponents []string `json:"unmanagedComponents,omitempty" protobuf:"bytes,3,rep,name=unmanagedComponents"`
+	// Maintenance is set while the maintenance page is served
+	Maintenance bool `json:"maintenance,omitempty" protobuf:"varint,4,opt,name=maintenance"`
+	// CurrentVersion is the version all steps have been upgraded to
+	CurrentVersion string `json:"currentVersion,omitempty" protobuf:"bytes,5,name=currentVersion"`
+	// TargetVersion is the version being upgraded to
+	TargetVersion string `json:"targetVersion,omitempty" protobuf:"bytes,6,name=targetVersion"`
+	// Upgrade is the progress of the upgrade to TargetVersion
+	Upgrade *PlatformUpgradeStatus `json:"upgrade,omitempty" protobuf:"bytes,7,opt,name=upgrade"`
+	// UpgradeHistory are the last upgrades, oldest first
+	UpgradeHistory []PlatformUpgradeRecord `json:"upgradeHistory,omitempty" protobuf:"bytes,8,rep,name=upgradeHistory"`
+	DeviceCA       *PlatformDeviceCAStatus `json:"deviceCA,omitempty" protobuf:"bytes,9,opt,name=deviceCA"`
+}
+
+// PlatformDeviceCAStatus describes the device CA.
+type PlatformDeviceCAStatus struct {
+	// Fingerprint is the hex encoded SHA-256 fingerprint of the CA issuing certificates
+	Fingerprint string      `json:"fingerprint" protobuf:"bytes,1,name=fingerprint"`
+	NotAfter    metav1.Time `json:"notAfter" protobuf:"bytes,2,name=notAfter"`
+	// Trusted are the fingerprints of the CAs the MQTT bridge accepts certificates of, the current
+	// one first
+	Trusted []string `json:"trusted,omitempty" protobuf:"bytes,3,rep,name=trusted"`
+}
+
+type PlatformUpgradeStatus struct {
+	Step string `json:"step" protobuf:"bytes,1,name=step"`
+	// Phase is one of pre, rollout or post
+	Phase         string      `json:"phase" protobuf:"bytes,2,name=phase"`
+	StartedAt     metav1.Time `json:"startedAt" protobuf:"bytes,3,name=startedAt"`
+	StepStartedAt metav1.Time `json:"stepStartedAt" protobuf:"bytes,4,name=stepStartedAt"`
+	// Attempt is increased each time the upgrade is resumed after a failure
+	Attempt int32 `json:"attempt,omitempty" protobuf:"varint,5,opt,name=attempt"`
+	// Failed is the reason the upgrade failed and paused the platform
+	Failed string `json:"failed,omitempty" protobuf:"bytes,6,name=failed"`
+}
+
+type PlatformUpgradeRecord struct {
+	From       string      `json:"from" protobuf:"bytes,1,name=from"`
+	To         string      `json:"to" protobuf:"bytes,2,name=to"`
+	StartedAt  metav1.Time `json:"startedAt" protobuf:"bytes,3,name=startedAt"`
+	FinishedAt metav1.Time `json:"finishedAt" protobuf:"bytes,4,name=finishedAt"`
+	// Result is one of Succeeded, Failed or Superseded
+	Result  string `json:"result" protobuf:"bytes,5,name=result"`
+	Message string `json:"message,omitempty" protobuf:"bytes,6,name=message"`
+}
+
+type PlatformKafkaTopicStatus struct {
+	Name    string `json:"name" protobuf:"bytes,1,name=name"`
+	Ready   bool   `json:"ready" protobuf:"varint,2,opt,name=ready"`
+	Message string `json:"message,omitempty" protobuf:"bytes,3,name=message"`
 }
 
 // +genclient
@@ -118,6 +349,7 @@ type PlatformStatus struct {
 
 // Platform is the Schema for the platforms API
 // +k8s:openapi-gen=true
+// +kubebuilder:subresource:status
 type Platform struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -20,8 +20,9 @@ limitations under the License.
 package v1beta1
 
 import (
-	v1 "k8s.io/api/core/v1"
+	corev1 "k8s.io/api/core/v1"
 	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -31,7 +32,7 @@ func (in *Platform) DeepCopyInto(out *Platform) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -95,101 +96,149 @@ func (in *PlatformApp) DeepCopy() *PlatformApp {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *PlatformDgraph) DeepCopyInto(out *PlatformDgraph) {
+func (in *PlatformController) DeepCopyInto(out *PlatformController) {
 	*out = *in
-	if in.Storage != nil {
-		in, out := &in.Storage, &out.Storage
-		*out = new(v1.PersistentVolumeClaimSpec)
-		(*in).DeepCopyInto(*out)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformController.
+func (in *PlatformController) DeepCopy() *PlatformController {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformController)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformDeviceCA) DeepCopyInto(out *PlatformDeviceCA) {
+	*out = *in
+	if in.Validity != nil {
+		in, out := &in.Validity, &out.Validity
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.RenewBefore != nil {
+		in, out := &in.RenewBefore, &out.RenewBefore
+		*out = new(v1.Duration)
+		**out = **in
 	}
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformDgraph.
-func (in *PlatformDgraph) DeepCopy() *PlatformDgraph {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformDeviceCA.
+func (in *PlatformDeviceCA) DeepCopy() *PlatformDeviceCA {
 	if in == nil {
 		return nil
 	}
-	out := new(PlatformDgraph)
+	out := new(PlatformDeviceCA)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *PlatformHost) DeepCopyInto(out *PlatformHost) {
+func (in *PlatformDeviceCAStatus) DeepCopyInto(out *PlatformDeviceCAStatus) {
 	*out = *in
+	in.NotAfter.DeepCopyInto(&out.NotAfter)
+	if in.Trusted != nil {
+		in, out := &in.Trusted, &out.Trusted
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformMQTTBroker.
-func (in *PlatformHost) DeepCopy() *PlatformHost {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformDeviceCAStatus.
+func (in *PlatformDeviceCAStatus) DeepCopy() *PlatformDeviceCAStatus {
 	if in == nil {
 		return nil
 	}
-	out := new(PlatformHost)
+	out := new(PlatformDeviceCAStatus)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *PlatformDgraphAlpha) DeepCopyInto(out *PlatformDgraphAlpha) {
+func (in *PlatformDgraph) DeepCopyInto(out *PlatformDgraph) {
 	*out = *in
 	if in.Storage != nil {
 		in, out := &in.Storage, &out.Storage
-		*out = new(v1.PersistentVolumeClaimSpec)
+		*out = new(corev1.PersistentVolumeClaimSpec)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.External != nil {
+		in, out := &in.External, &out.External
+		*out = new(PlatformDgraphExternal)
+		**out = **in
+	}
 	return
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformDgraph.
-func (in *PlatformDgraphAlpha) DeepCopy() *PlatformDgraphAlpha {
+func (in *PlatformDgraph) DeepCopy() *PlatformDgraph {
 	if in == nil {
 		return nil
 	}
-	out := new(PlatformDgraphAlpha)
+	out := new(PlatformDgraph)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *PlatformDgraphZero) DeepCopyInto(out *PlatformDgraphZero) {
+func (in *PlatformDgraphAlpha) DeepCopyInto(out *PlatformDgraphAlpha) {
 	*out = *in
 	if in.Storage != nil {
 		in, out := &in.Storage, &out.Storage
-		*out = new(v1.PersistentVolumeClaimSpec)
+		*out = new(corev1.PersistentVolumeClaimSpec)
 		(*in).DeepCopyInto(*out)
 	}
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformDgraph.
-func (in *PlatformDgraphZero) DeepCopy() *PlatformDgraphZero {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformDgraphAlpha.
+func (in *PlatformDgraphAlpha) DeepCopy() *PlatformDgraphAlpha {
 	if in == nil {
 		return nil
 	}
-	out := new(PlatformDgraphZero)
+	out := new(PlatformDgraphAlpha)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *PlatformInfinimeshDefaultStorage) DeepCopyInto(out *PlatformInfinimeshDefaultStorage) {
+func (in *PlatformDgraphExternal) DeepCopyInto(out *PlatformDgraphExternal) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformDgraphExternal.
+func (in *PlatformDgraphExternal) DeepCopy() *PlatformDgraphExternal {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformDgraphExternal)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformDgraphZero) DeepCopyInto(out *PlatformDgraphZero) {
 	*out = *in
 	if in.Storage != nil {
 		in, out := &in.Storage, &out.Storage
-		*out = new(v1.PersistentVolumeClaimSpec)
+		*out = new(corev1.PersistentVolumeClaimSpec)
 		(*in).DeepCopyInto(*out)
 	}
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformDgraph.
-func (in *PlatformInfinimeshDefaultStorage) DeepCopy() *PlatformInfinimeshDefaultStorage {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformDgraphZero.
+func (in *PlatformDgraphZero) DeepCopy() *PlatformDgraphZero {
 	if in == nil {
 		return nil
 	}
-	out := new(PlatformInfinimeshDefaultStorage)
+	out := new(PlatformDgraphZero)
 	in.DeepCopyInto(out)
 	return out
 }
@@ -217,9 +266,94 @@ func (in *PlatformGRPCApiserver) DeepCopy() *PlatformGRPCApiserver {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformGrafana) DeepCopyInto(out *PlatformGrafana) {
+	*out = *in
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = make([]extensionsv1beta1.IngressTLS, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Storage != nil {
+		in, out := &in.Storage, &out.Storage
+		*out = new(corev1.PersistentVolumeClaimSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformGrafana.
+func (in *PlatformGrafana) DeepCopy() *PlatformGrafana {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformGrafana)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformHost) DeepCopyInto(out *PlatformHost) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformHost.
+func (in *PlatformHost) DeepCopy() *PlatformHost {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformHost)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformInfinimeshDefaultStorage) DeepCopyInto(out *PlatformInfinimeshDefaultStorage) {
+	*out = *in
+	if in.Storage != nil {
+		in, out := &in.Storage, &out.Storage
+		*out = new(corev1.PersistentVolumeClaimSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformInfinimeshDefaultStorage.
+func (in *PlatformInfinimeshDefaultStorage) DeepCopy() *PlatformInfinimeshDefaultStorage {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformInfinimeshDefaultStorage)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PlatformKafka) DeepCopyInto(out *PlatformKafka) {
 	*out = *in
+	if in.Topics != nil {
+		in, out := &in.Topics, &out.Topics
+		*out = make([]PlatformKafkaTopic, len(*in))
+		copy(*out, *in)
+	}
+	if in.TLS != nil {
+		in, out := &in.TLS, &out.TLS
+		*out = new(PlatformKafkaTLS)
+		**out = **in
+	}
+	if in.SASL != nil {
+		in, out := &in.SASL, &out.SASL
+		*out = new(PlatformKafkaSASL)
+		**out = **in
+	}
+	if in.Managed != nil {
+		in, out := &in.Managed, &out.Managed
+		*out = new(PlatformKafkaManaged)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -233,6 +367,91 @@ func (in *PlatformKafka) DeepCopy() *PlatformKafka {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformKafkaManaged) DeepCopyInto(out *PlatformKafkaManaged) {
+	*out = *in
+	if in.Storage != nil {
+		in, out := &in.Storage, &out.Storage
+		*out = new(corev1.PersistentVolumeClaimSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformKafkaManaged.
+func (in *PlatformKafkaManaged) DeepCopy() *PlatformKafkaManaged {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformKafkaManaged)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformKafkaSASL) DeepCopyInto(out *PlatformKafkaSASL) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformKafkaSASL.
+func (in *PlatformKafkaSASL) DeepCopy() *PlatformKafkaSASL {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformKafkaSASL)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformKafkaTLS) DeepCopyInto(out *PlatformKafkaTLS) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformKafkaTLS.
+func (in *PlatformKafkaTLS) DeepCopy() *PlatformKafkaTLS {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformKafkaTLS)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformKafkaTopic) DeepCopyInto(out *PlatformKafkaTopic) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformKafkaTopic.
+func (in *PlatformKafkaTopic) DeepCopy() *PlatformKafkaTopic {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformKafkaTopic)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformKafkaTopicStatus) DeepCopyInto(out *PlatformKafkaTopicStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformKafkaTopicStatus.
+func (in *PlatformKafkaTopicStatus) DeepCopy() *PlatformKafkaTopicStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformKafkaTopicStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PlatformList) DeepCopyInto(out *PlatformList) {
 	*out = *in
@@ -283,17 +502,127 @@ func (in *PlatformMQTTBroker) DeepCopy() *PlatformMQTTBroker {
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *PlatformController) DeepCopyInto(out *PlatformController) {
+func (in *PlatformMaintenance) DeepCopyInto(out *PlatformMaintenance) {
 	*out = *in
 	return
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformMQTTBroker.
-func (in *PlatformController) DeepCopy() *PlatformController {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformMaintenance.
+func (in *PlatformMaintenance) DeepCopy() *PlatformMaintenance {
 	if in == nil {
 		return nil
 	}
-	out := new(PlatformController)
+	out := new(PlatformMaintenance)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformObservability) DeepCopyInto(out *PlatformObservability) {
+	*out = *in
+	if in.Prometheus != nil {
+		in, out := &in.Prometheus, &out.Prometheus
+		*out = new(PlatformPrometheus)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformObservability.
+func (in *PlatformObservability) DeepCopy() *PlatformObservability {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformObservability)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformPrometheus) DeepCopyInto(out *PlatformPrometheus) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformPrometheus.
+func (in *PlatformPrometheus) DeepCopy() *PlatformPrometheus {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformPrometheus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformRedis) DeepCopyInto(out *PlatformRedis) {
+	*out = *in
+	in.DeviceDetails.DeepCopyInto(&out.DeviceDetails)
+	in.Twin.DeepCopyInto(&out.Twin)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformRedis.
+func (in *PlatformRedis) DeepCopy() *PlatformRedis {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformRedis)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformRedisExternal) DeepCopyInto(out *PlatformRedisExternal) {
+	*out = *in
+	if in.SentinelAddresses != nil {
+		in, out := &in.SentinelAddresses, &out.SentinelAddresses
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformRedisExternal.
+func (in *PlatformRedisExternal) DeepCopy() *PlatformRedisExternal {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformRedisExternal)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformRedisStore) DeepCopyInto(out *PlatformRedisStore) {
+	*out = *in
+	if in.Storage != nil {
+		in, out := &in.Storage, &out.Storage
+		*out = new(corev1.PersistentVolumeClaimSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	in.Resources.DeepCopyInto(&out.Resources)
+	if in.External != nil {
+		in, out := &in.External, &out.External
+		*out = new(PlatformRedisExternal)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformRedisStore.
+func (in *PlatformRedisStore) DeepCopy() *PlatformRedisStore {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformRedisStore)
 	in.DeepCopyInto(out)
 	return out
 }
@@ -321,14 +650,43 @@ func (in *PlatformRestfulApiserver) DeepCopy() *PlatformRestfulApiserver {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformSecurity) DeepCopyInto(out *PlatformSecurity) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformSecurity.
+func (in *PlatformSecurity) DeepCopy() *PlatformSecurity {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformSecurity)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PlatformSpec) DeepCopyInto(out *PlatformSpec) {
 	*out = *in
 	out.MQTT = in.MQTT
 	in.DGraph.DeepCopyInto(&out.DGraph)
-	out.Kafka = in.Kafka
+	in.DGraphAlpha.DeepCopyInto(&out.DGraphAlpha)
+	in.DGraphZero.DeepCopyInto(&out.DGraphZero)
+	in.Kafka.DeepCopyInto(&out.Kafka)
 	in.Apiserver.DeepCopyInto(&out.Apiserver)
 	in.App.DeepCopyInto(&out.App)
+	in.InfinimeshDefaultStorage.DeepCopyInto(&out.InfinimeshDefaultStorage)
+	out.Controller = in.Controller
+	out.Host = in.Host
+	in.Redis.DeepCopyInto(&out.Redis)
+	in.Timeseries.DeepCopyInto(&out.Timeseries)
+	in.Grafana.DeepCopyInto(&out.Grafana)
+	in.Observability.DeepCopyInto(&out.Observability)
+	out.Maintenance = in.Maintenance
+	in.Upgrade.DeepCopyInto(&out.Upgrade)
+	in.DeviceCA.DeepCopyInto(&out.DeviceCA)
+	out.Security = in.Security
 	return
 }
 
@@ -345,6 +703,33 @@ func (in *PlatformSpec) DeepCopy() *PlatformSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PlatformStatus) DeepCopyInto(out *PlatformStatus) {
 	*out = *in
+	if in.KafkaTopics != nil {
+		in, out := &in.KafkaTopics, &out.KafkaTopics
+		*out = make([]PlatformKafkaTopicStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.UnmanagedComponents != nil {
+		in, out := &in.UnmanagedComponents, &out.UnmanagedComponents
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Upgrade != nil {
+		in, out := &in.Upgrade, &out.Upgrade
+		*out = new(PlatformUpgradeStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.UpgradeHistory != nil {
+		in, out := &in.UpgradeHistory, &out.UpgradeHistory
+		*out = make([]PlatformUpgradeRecord, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.DeviceCA != nil {
+		in, out := &in.DeviceCA, &out.DeviceCA
+		*out = new(PlatformDeviceCAStatus)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -363,7 +748,7 @@ func (in *PlatformTimescaleDB) DeepCopyInto(out *PlatformTimescaleDB) {
 	*out = *in
 	if in.Storage != nil {
 		in, out := &in.Storage, &out.Storage
-		*out = new(v1.PersistentVolumeClaimSpec)
+		*out = new(corev1.PersistentVolumeClaimSpec)
 		(*in).DeepCopyInto(*out)
 	}
 	return
@@ -399,3 +784,95 @@ func (in *PlatformTimeseries) DeepCopy() *PlatformTimeseries {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformUpgrade) DeepCopyInto(out *PlatformUpgrade) {
+	*out = *in
+	if in.Hooks != nil {
+		in, out := &in.Hooks, &out.Hooks
+		*out = make([]PlatformUpgradeHook, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformUpgrade.
+func (in *PlatformUpgrade) DeepCopy() *PlatformUpgrade {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformUpgrade)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformUpgradeHook) DeepCopyInto(out *PlatformUpgradeHook) {
+	*out = *in
+	if in.Command != nil {
+		in, out := &in.Command, &out.Command
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Args != nil {
+		in, out := &in.Args, &out.Args
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Env != nil {
+		in, out := &in.Env, &out.Env
+		*out = make([]corev1.EnvVar, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformUpgradeHook.
+func (in *PlatformUpgradeHook) DeepCopy() *PlatformUpgradeHook {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformUpgradeHook)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformUpgradeRecord) DeepCopyInto(out *PlatformUpgradeRecord) {
+	*out = *in
+	in.StartedAt.DeepCopyInto(&out.StartedAt)
+	in.FinishedAt.DeepCopyInto(&out.FinishedAt)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformUpgradeRecord.
+func (in *PlatformUpgradeRecord) DeepCopy() *PlatformUpgradeRecord {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformUpgradeRecord)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlatformUpgradeStatus) DeepCopyInto(out *PlatformUpgradeStatus) {
+	*out = *in
+	in.StartedAt.DeepCopyInto(&out.StartedAt)
+	in.StepStartedAt.DeepCopyInto(&out.StepStartedAt)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlatformUpgradeStatus.
+func (in *PlatformUpgradeStatus) DeepCopy() *PlatformUpgradeStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PlatformUpgradeStatus)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package clients connects the operator to the services of a platform: dgraph, the nodeserver,
+// the device registry, the shadow API and Grafana. The controllers reach the platform through a
+// Factory, the fake package implements it in memory.
+package clients
+
+import (
+	"io"
+
+	"github.com/infinimesh/infinimesh/pkg/node"
+	"github.com/infinimesh/infinimesh/pkg/node/nodepb"
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+	"github.com/infinimesh/operator/pkg/registrypb"
+	"github.com/infinimesh/operator/pkg/shadowpb"
+)
+
+// Dgraph is the dgraph of a platform as the operator uses it.
+type Dgraph interface {
+	node.Repo
+	// ImportSchema imports the infinimesh schema, keeping the data.
+	ImportSchema() error
+}
+
+// Grafana is the admin API of the Grafana of a platform. Ids are 0 if the user or org doesn't
+// exist.
+type Grafana interface {
+	GetUserID(name string) (int, error)
+	CreateUser(name string) error
+	SetUserPassword(userID int, password string) error
+	MakeUserAdmin(userID int) error
+	GetOrgID(name string) (int, error)
+	CreateOrg(name string) error
+	AddUserToOrg(orgID int, name, role string) error
+	// OrgMembers returns the roles of the members of the org by login.
+	OrgMembers(orgID int) (map[string]string, error)
+	SetOrgUserRole(orgID, userID int, role string) error
+	SwitchUserOrg(userID, orgID int) error
+	// ReloadDatasources makes Grafana read its provisioned datasources again.
+	ReloadDatasources() error
+}
+
+// Factory connects to the services of a platform. The caller closes the returned io.Closer.
+type Factory interface {
+	// Dgraph connects to the dgraph of instance, in-cluster or external.
+	Dgraph(instance *infinimeshv1beta1.Platform) (Dgraph, io.Closer, error)
+	// Nodeserver connects to the account service of the nodeserver of instance.
+	Nodeserver(instance *infinimeshv1beta1.Platform) (nodepb.AccountServiceClient, io.Closer, error)
+	// DeviceRegistry connects to the device registry of instance.
+	DeviceRegistry(instance *infinimeshv1beta1.Platform) (registrypb.DevicesClient, io.Closer, error)
+	// Shadows connects to the shadow API of instance.
+	Shadows(instance *infinimeshv1beta1.Platform) (shadowpb.ShadowsClient, io.Closer, error)
+	// Grafana returns a client of the Grafana of instance signed in as the admin user.
+	Grafana(instance *infinimeshv1beta1.Platform, user, password string) Grafana
+}
@@ -0,0 +1,486 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/infinimesh/infinimesh/pkg/node/nodepb"
+)
+
+// Dgraph implements clients.Dgraph on the data plane of a platform. It returns the errors of
+// the dgraph repository of infinimesh.
+type Dgraph struct {
+	p *Platform
+}
+
+func (d *Dgraph) ImportSchema() error {
+	d.p.mu.Lock()
+	defer d.p.mu.Unlock()
+	d.p.schemaImports++
+	return nil
+}
+
+// Accounts
+
+func (d *Dgraph) CreateUserAccount(ctx context.Context, username, password string, isRoot, isAdmin, enabled bool) (string, error) {
+	d.p.mu.Lock()
+	defer d.p.mu.Unlock()
+	return d.p.createUserAccount(username, password, isRoot, isAdmin, enabled)
+}
+
+// createUserAccount creates an account with a default namespace of the same name, p.mu must be
+// held.
+func (p *Platform) createUserAccount(username, password string, isRoot, isAdmin, enabled bool) (string, error) {
+	if p.accountByName(username) != nil {
+		return "", errors.New("User exists already")
+	}
+	ns := p.createNamespace(username)
+	uid := p.newUID()
+	p.accounts[uid] = &account{
+		uid:              uid,
+		name:             username,
+		password:         password,
+		isRoot:           isRoot,
+		isAdmin:          isAdmin,
+		enabled:          enabled,
+		defaultNamespace: ns,
+		namespaces:       map[string]nodepb.Action{ns: nodepb.Action_WRITE},
+		objects:          map[string]string{},
+	}
+	return uid, nil
+}
+
+func (d *Dgraph) ListAccounts(ctx context.Context) ([]*nodepb.Account, error) {
+	d.p.mu.Lock()
+	defer d.p.mu.Unlock()
+	var accounts []*nodepb.Account
+	for _, uid := range sortedUIDs(d.p.accounts) {
+		accounts = append(accounts, d.p.toAccount(d.p.accounts[uid]))
+	}
+	return accounts, nil
+}
+
+func (d *Dgraph) ListAccountsforAdmin(ctx context.Context, requestorID string) ([]*nodepb.Account, error) {
+	d.p.mu.Lock()
+	defer d.p.mu.Unlock()
+	var accounts []*nodepb.Account
+	for _, uid := range sortedUIDs(d.p.accounts) {
+		if a := d.p.accounts[uid]; a.owner == requestorID {
+			accounts = append(accounts, d.p.toAccount(a))
+		}
+	}
+	return accounts, nil
+}
+
+func (d *Dgraph) UpdateAccount(ctx context.Context, request *nodepb.UpdateAccountRequest, isself bool) error {
+	d.p.mu.Lock()
+	defer d.p.mu.Unlock()
+	a, ok := d.p.accounts[request.Account.Uid]
+	if !ok {
+		return errors.New("The Account is not found")
+	}
+	for _, field := range request.FieldMask.GetPaths() {
+		switch field {
+		case "name":
+			a.name = request.Account.Name
+		case "is_root":
+			a.isRoot = request.Account.IsRoot
+		case "is_admin":
+			a.isAdmin = request.Account.IsAdmin
+		case "enabled":
+			a.enabled = request.Account.Enabled
+		case "password":
+			a.password = request.Account.Password
+		}
+	}
+	return nil
+}
+
+func (d *Dgraph) GetAccount(ctx context.Context, accountID string) (*nodepb.Account, error) {
+	d.p.mu.Lock()
+	defer d.p.mu.Unlock()
+	a, ok := d.p.accounts[accountID]
+	if !ok {
+		return nil, errors.New("The Account is not found")
+	}
+	return d.p.toAccount(a), nil
+}
+
+func (d *Dgraph) SetPassword(ctx context.Context, accountID, password string) error {
+	d.p.mu.Lock()
+	defer d.p.mu.Unlock()
+	a, ok := d.p.accounts[accountID]
+	if !ok {
+		return errors.New("The Account is not found")
+	}
+	a.password = password
+	return nil
+}
+
+func (d *Dgraph) DeleteAccount(ctx context.Context, request *nodepb.DeleteAccountRequest) error {
+	d.p.mu.Lock()
+	defer d.p.mu.Unlock()
+	if _, ok := d.p.accounts[request.Uid]; !ok {
+		return errors.New("The Account is not found")
+	}
+	delete(d.p.accounts, request.Uid)
+	return nil
+}
+
+func (d *Dgraph) AssignOwner(ctx context.Context, ownerID, accountID string) error {
+	return d.setOwner(ownerID, accountID)
+}
+
+func (d *Dgraph) RemoveOwner(ctx context.Context, ownerID, accountID string) error {
+	return d.setOwner("", accountID)
+}
+
+func (d *Dgraph) setOwner(ownerID, accountID string) error {
+	d.p.mu.Lock()
+	defer d.p.mu.Unlock()
+	a, ok := d.p.accounts[accountID]
+	if !ok {
+		return errors.New("The Account is not found")
+	}
+	a.owner = ownerID
+	return nil
+}
+
+func (d *Dgraph) UserExists(ctx context.Context, name string) (bool, error) {
+	d.p.mu.Lock()
+	defer d.p.mu.Unlock()
+	return d.p.accountByName(name) != nil, nil
+}
+
+// Authorizations
+
+func (d *Dgraph) IsAuthorized(ctx context.Context, target, who, action string) (bool, error) {
+	d.p.mu.Lock()
+	defer d.p.mu.Unlock()
+	a, ok := d.p.accounts[who]
+	if !ok {
+		return false, nil
+	}
+	if a.isRoot {
+		return true, nil
+	}
+	want := nodepb.Action(nodepb.Action_value[action])
+	for uid := target; uid != ""; {
+		o, ok := d.p.objects[uid]
+		if !ok {
+			return false, nil
+		}
+		if granted, ok := a.objects[uid]; ok && nodepb.Action(nodepb.Action_value[granted]) >= want {
+			return true, nil
+		}
+		if o.parent == "" && a.namespaces[o.namespace] >= want {
+			return true, nil
+		}
+		uid = o.parent
+	}
+	return false, nil
+}
+
+func (d *Dgraph) IsAuthorizedNamespace(ctx context.Context, namespaceID, accountID string, action nodepb.Action) (bool, error) {
+	d.p.mu.Lock()
+	defer d.p.mu.Unlock()
+	a, ok := d.p.accounts[accountID]
+	if !ok {
+		return false, nil
+	}
+	return a.isRoot || a.namespaces[namespaceID] >= action, nil
+}
+
+func (d *Dgraph) Authorize(ctx context.Context, accountID, node, action string, inherit bool) error {
+	d.p.mu.Lock()
+	defer d.p.mu.Unlock()
+	a, ok := d.p.accounts[accountID]
+	if !ok {
+		return errors.New("The Account is not found")
+	}
+	if _, ok := d.p.objects[node]; !ok {
+		return errors.New("The Object is not found")
+	}
+	a.objects[node] = action
+	return nil
+}
+
+func (d *Dgraph) AuthorizeNamespace(ctx context.Context, accountID, namespaceID string, action nodepb.Action) error {
+	d.p.mu.Lock()
+	defer d.p.mu.Unlock()
+	a, ok := d.p.accounts[accountID]
+	if !ok {
+		return errors.New("The Account is not found")
+	}
+	if _, ok := d.p.namespaces[namespaceID]; !ok {
+		return errors.New("The Namespace is not found")
+	}
+	a.namespaces[namespaceID] = action
+	return nil
+}
+
+func (d *Dgraph) Authenticate(ctx context.Context, username, password string) (bool, string, string, error) {
+	d.p.mu.Lock()
+	defer d.p.mu.Unlock()
+	a := d.p.accountByName(username)
+	if a == nil || a.password != password {
+		return false, "", "", errors.New("Invalid credentials")
+	}
+	if !a.enabled {
+		return false, "", "", status.Error(codes.Unauthenticated, "Account is disabled")
+	}
+	var defaultNamespace string
+	if ns, ok := d.p.namespaces[a.defaultNamespace]; ok {
+		defaultNamespace = ns.name
+	}
+	return true, a.uid, defaultNamespace, nil
+}
+
+// Objects
+
+func (d *Dgraph) CreateObject(ctx context.Context, name, parentID, kind, namespaceID string) (string, error) {
+	d.p.mu.Lock()
+	defer d.p.mu.Unlock()
+	if _, ok := d.p.namespaces[namespaceID]; !ok {
+		return "", errors.New("Invalid namespace")
+	}
+	if parentID != "" {
+		if _, ok := d.p.objects[parentID]; !ok {
+			return "", errors.New("Invalid parent")
+		}
+	}
+	uid := d.p.newUID()
+	d.p.objects[uid] = &object{uid: uid, name: name, kind: kind, namespace: namespaceID, parent: parentID}
+	return uid, nil
+}
+
+func (d *Dgraph) DeleteObject(ctx context.Context, uid string) error {
+	d.p.mu.Lock()
+	defer d.p.mu.Unlock()
+	if _, ok := d.p.objects[uid]; !ok {
+		return errors.New("The Object is not found")
+	}
+	d.p.deleteObject(uid)
+	return nil
+}
+
+// deleteObject deletes the object uid and its children, p.mu must be held.
+func (p *Platform) deleteObject(uid string) {
+	for _, child := range sortedUIDs(p.objects) {
+		if p.objects[child].parent == uid {
+			p.deleteObject(child)
+		}
+	}
+	delete(p.objects, uid)
+	for _, a := range p.accounts {
+		delete(a.objects, uid)
+	}
+}
+
+func (d *Dgraph) ListForAccount(ctx context.Context, accountID string, namespaceID string, recurse bool) ([]*nodepb.Object, error) {
+	d.p.mu.Lock()
+	defer d.p.mu.Unlock()
+	a, ok := d.p.accounts[accountID]
+	if !ok {
+		return nil, nil
+	}
+	depth := 0
+	if recurse {
+		depth = 10
+	}
+	var objects []*nodepb.Object
+	for _, ns := range sortedUIDs(d.p.namespaces) {
+		if namespaceID != "" && ns != namespaceID {
+			continue
+		}
+		if !a.isRoot && a.namespaces[ns] == nodepb.Action_NONE {
+			continue
+		}
+		objects = append(objects, d.p.tree(ns, "", depth)...)
+	}
+	return objects, nil
+}
+
+// Namespaces
+
+func (d *Dgraph) CreateNamespace(ctx context.Context, name string) (string, error) {
+	d.p.mu.Lock()
+	defer d.p.mu.Unlock()
+	return d.p.createNamespace(name), nil
+}
+
+// createNamespace creates the namespace name, p.mu must be held. Like dgraph it doesn't check
+// whether the name is taken.
+func (p *Platform) createNamespace(name string) string {
+	uid := p.newUID()
+	p.namespaces[uid] = &namespace{uid: uid, name: name, deleteInitiationTime: neverDeleted}
+	return uid
+}
+
+func (d *Dgraph) GetNamespace(ctx context.Context, name string) (*nodepb.Namespace, error) {
+	d.p.mu.Lock()
+	defer d.p.mu.Unlock()
+	ns := d.p.namespaceByName(name)
+	if ns == nil {
+		return nil, errors.New("The Namespace is not found")
+	}
+	return toNamespace(ns), nil
+}
+
+func (d *Dgraph) GetNamespaceID(ctx context.Context, namespaceID string) (*nodepb.Namespace, error) {
+	d.p.mu.Lock()
+	defer d.p.mu.Unlock()
+	ns, ok := d.p.namespaces[namespaceID]
+	if !ok {
+		return nil, errors.New("The Namespace is not found")
+	}
+	return toNamespace(ns), nil
+}
+
+func (d *Dgraph) ListNamespaces(ctx context.Context) ([]*nodepb.Namespace, error) {
+	d.p.mu.Lock()
+	defer d.p.mu.Unlock()
+	var namespaces []*nodepb.Namespace
+	for _, uid := range sortedUIDs(d.p.namespaces) {
+		namespaces = append(namespaces, toNamespace(d.p.namespaces[uid]))
+	}
+	return namespaces, nil
+}
+
+func (d *Dgraph) ListNamespacesForAccount(ctx context.Context, accountID string) ([]*nodepb.Namespace, error) {
+	d.p.mu.Lock()
+	defer d.p.mu.Unlock()
+	a, ok := d.p.accounts[accountID]
+	if !ok {
+		return nil, nil
+	}
+	var namespaces []*nodepb.Namespace
+	for _, uid := range sortedUIDs(d.p.namespaces) {
+		if a.isRoot || a.namespaces[uid] != nodepb.Action_NONE {
+			namespaces = append(namespaces, toNamespace(d.p.namespaces[uid]))
+		}
+	}
+	return namespaces, nil
+}
+
+func (d *Dgraph) ListPermissionsInNamespace(ctx context.Context, namespaceID string) ([]*nodepb.Permission, error) {
+	d.p.mu.Lock()
+	defer d.p.mu.Unlock()
+	ns, ok := d.p.namespaces[namespaceID]
+	if !ok {
+		return nil, nil
+	}
+	var permissions []*nodepb.Permission
+	for _, uid := range sortedUIDs(d.p.accounts) {
+		a := d.p.accounts[uid]
+		if action, ok := a.namespaces[namespaceID]; ok {
+			permissions = append(permissions, &nodepb.Permission{
+				Namespace:   ns.name,
+				AccountId:   a.uid,
+				AccountName: a.name,
+				Action:      action,
+			})
+		}
+	}
+	return permissions, nil
+}
+
+func (d *Dgraph) DeletePermissionInNamespace(ctx context.Context, namespaceID, accountID string) error {
+	d.p.mu.Lock()
+	defer d.p.mu.Unlock()
+	a, ok := d.p.accounts[accountID]
+	if !ok {
+		return errors.New("The Account is not found")
+	}
+	delete(a.namespaces, namespaceID)
+	return nil
+}
+
+func (d *Dgraph) SoftDeleteNamespace(ctx context.Context, namespaceID string) error {
+	return d.markForDeletion(namespaceID, true)
+}
+
+func (d *Dgraph) RevokeNamespace(ctx context.Context, namespaceID string) error {
+	return d.markForDeletion(namespaceID, false)
+}
+
+func (d *Dgraph) markForDeletion(namespaceID string, mark bool) error {
+	d.p.mu.Lock()
+	defer d.p.mu.Unlock()
+	ns, ok := d.p.namespaces[namespaceID]
+	if !ok {
+		return errors.New("The Namespace is not found")
+	}
+	ns.markForDeletion = mark
+	ns.deleteInitiationTime = neverDeleted
+	if mark {
+		ns.deleteInitiationTime = time.Now().Format(time.RFC3339)
+	}
+	return nil
+}
+
+// HardDeleteNamespace deletes the namespaces marked for deletion before datecondition, an
+// RFC 3339 time, together with their objects. The root namespace is never deleted.
+func (d *Dgraph) HardDeleteNamespace(ctx context.Context, datecondition string) error {
+	d.p.mu.Lock()
+	defer d.p.mu.Unlock()
+	for _, uid := range sortedUIDs(d.p.namespaces) {
+		ns := d.p.namespaces[uid]
+		if !ns.markForDeletion || ns.name == "root" || ns.deleteInitiationTime >= datecondition {
+			continue
+		}
+		for _, o := range sortedUIDs(d.p.objects) {
+			if obj, ok := d.p.objects[o]; ok && obj.namespace == uid && obj.parent == "" {
+				d.p.deleteObject(o)
+			}
+		}
+		for _, a := range d.p.accounts {
+			delete(a.namespaces, uid)
+		}
+		delete(d.p.namespaces, uid)
+	}
+	return nil
+}
+
+func (d *Dgraph) UpdateNamespace(ctx context.Context, request *nodepb.UpdateNamespaceRequest) error {
+	d.p.mu.Lock()
+	defer d.p.mu.Unlock()
+	ns, ok := d.p.namespaces[request.Namespace.Id]
+	if !ok {
+		return errors.New("The Namespace is not found")
+	}
+	for _, field := range request.NamespaceMask.GetPaths() {
+		switch strings.ToLower(field) {
+		case "name":
+			ns.name = request.Namespace.Name
+		case "markfordeletion":
+			ns.markForDeletion = request.Namespace.Markfordeletion
+			ns.deleteInitiationTime = neverDeleted
+			if ns.markForDeletion {
+				ns.deleteInitiationTime = time.Now().Format(time.RFC3339)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,296 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fake implements clients.Factory in memory. Every platform gets a data plane of its
+// own: the accounts, namespaces and objects of its dgraph, which its nodeserver works on too, the
+// devices of its registry, their shadows and the users and orgs of its Grafana.
+package fake
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/infinimesh/infinimesh/pkg/node/nodepb"
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+	"github.com/infinimesh/operator/pkg/clients"
+	"github.com/infinimesh/operator/pkg/registrypb"
+	"github.com/infinimesh/operator/pkg/shadowpb"
+)
+
+// Factory hands out the clients of the data plane of each platform, keyed by namespace and name.
+type Factory struct {
+	mu        sync.Mutex
+	platforms map[string]*Platform
+}
+
+var _ clients.Factory = &Factory{}
+
+// NewFactory returns a Factory without platforms.
+func NewFactory() *Factory {
+	return &Factory{platforms: map[string]*Platform{}}
+}
+
+// Platform returns the data plane of instance, creating an empty one on first use.
+func (f *Factory) Platform(instance *infinimeshv1beta1.Platform) *Platform {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := instance.Namespace + "/" + instance.Name
+	p, ok := f.platforms[key]
+	if !ok {
+		p = NewPlatform()
+		f.platforms[key] = p
+	}
+	return p
+}
+
+func (f *Factory) Dgraph(instance *infinimeshv1beta1.Platform) (clients.Dgraph, io.Closer, error) {
+	return f.Platform(instance).Dgraph(), nopCloser{}, nil
+}
+
+func (f *Factory) Nodeserver(instance *infinimeshv1beta1.Platform) (nodepb.AccountServiceClient, io.Closer, error) {
+	return f.Platform(instance).Nodeserver(), nopCloser{}, nil
+}
+
+func (f *Factory) DeviceRegistry(instance *infinimeshv1beta1.Platform) (registrypb.DevicesClient, io.Closer, error) {
+	return f.Platform(instance).DeviceRegistry(), nopCloser{}, nil
+}
+
+func (f *Factory) Shadows(instance *infinimeshv1beta1.Platform) (shadowpb.ShadowsClient, io.Closer, error) {
+	return f.Platform(instance).Shadows(), nopCloser{}, nil
+}
+
+func (f *Factory) Grafana(instance *infinimeshv1beta1.Platform, user, password string) clients.Grafana {
+	return f.Platform(instance).Grafana()
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+// Platform is the data plane of one platform. Its methods are safe for concurrent use.
+type Platform struct {
+	mu            sync.Mutex
+	nextUID       int
+	schemaImports int
+	accounts      map[string]*account
+	namespaces    map[string]*namespace
+	objects       map[string]*object
+	devices       map[string]*registrypb.Device
+	shadows       map[string]*shadowpb.Shadow
+	grafana       *grafanaState
+}
+
+type account struct {
+	uid, name, password string
+	isRoot, isAdmin     bool
+	enabled             bool
+	owner               string
+	defaultNamespace    string
+	// namespaces maps namespace uids to the action the account may take in them
+	namespaces map[string]nodepb.Action
+	// objects maps object uids to the action the account may take on them
+	objects map[string]string
+}
+
+type namespace struct {
+	uid, name            string
+	markForDeletion      bool
+	deleteInitiationTime string
+}
+
+type object struct {
+	uid, name, kind string
+	namespace       string
+	parent          string
+}
+
+// neverDeleted is the deletion time of namespaces that aren't marked for deletion.
+const neverDeleted = "0000-01-01T00:00:00Z"
+
+// NewPlatform returns an empty data plane. Like a fresh dgraph it hands out uids from 0x1, so
+// the first account created gets 0x2, after its default namespace.
+func NewPlatform() *Platform {
+	return &Platform{
+		nextUID:    1,
+		accounts:   map[string]*account{},
+		namespaces: map[string]*namespace{},
+		objects:    map[string]*object{},
+		devices:    map[string]*registrypb.Device{},
+		shadows:    map[string]*shadowpb.Shadow{},
+		grafana:    newGrafanaState(),
+	}
+}
+
+// Dgraph returns a client of the dgraph of p.
+func (p *Platform) Dgraph() clients.Dgraph {
+	return &Dgraph{p: p}
+}
+
+// Nodeserver returns a client of the account service of p.
+func (p *Platform) Nodeserver() nodepb.AccountServiceClient {
+	return &Nodeserver{p: p}
+}
+
+// DeviceRegistry returns a client of the device registry of p.
+func (p *Platform) DeviceRegistry() registrypb.DevicesClient {
+	return &DeviceRegistry{p: p}
+}
+
+// Grafana returns a client of the Grafana of p.
+func (p *Platform) Grafana() clients.Grafana {
+	return &Grafana{p: p}
+}
+
+// SchemaImports returns how often the schema was imported.
+func (p *Platform) SchemaImports() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.schemaImports
+}
+
+// Account returns the account called name, including its password.
+func (p *Platform) Account(name string) (*nodepb.Account, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	a := p.accountByName(name)
+	if a == nil {
+		return nil, false
+	}
+	account := p.toAccount(a)
+	account.Password = a.password
+	return account, true
+}
+
+// Namespace returns the namespace called name.
+func (p *Platform) Namespace(name string) (*nodepb.Namespace, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ns := p.namespaceByName(name)
+	if ns == nil {
+		return nil, false
+	}
+	return toNamespace(ns), true
+}
+
+// Objects returns the object trees of the namespace called name.
+func (p *Platform) Objects(name string) []*nodepb.Object {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ns := p.namespaceByName(name)
+	if ns == nil {
+		return nil
+	}
+	return p.tree(ns.uid, "", -1)
+}
+
+// newUID allocates a uid, p.mu must be held.
+func (p *Platform) newUID() string {
+	uid := fmt.Sprintf("0x%x", p.nextUID)
+	p.nextUID++
+	return uid
+}
+
+func (p *Platform) accountByName(name string) *account {
+	for _, a := range p.accounts {
+		if a.name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+func (p *Platform) namespaceByName(name string) *namespace {
+	for _, uid := range sortedUIDs(p.namespaces) {
+		if p.namespaces[uid].name == name {
+			return p.namespaces[uid]
+		}
+	}
+	return nil
+}
+
+func (p *Platform) toAccount(a *account) *nodepb.Account {
+	account := &nodepb.Account{
+		Uid:     a.uid,
+		Name:    a.name,
+		IsRoot:  a.isRoot,
+		IsAdmin: a.isAdmin,
+		Enabled: a.enabled,
+		Owner:   a.owner,
+	}
+	if ns, ok := p.namespaces[a.defaultNamespace]; ok {
+		account.DefaultNamespace = toNamespace(ns)
+	}
+	return account
+}
+
+func toNamespace(ns *namespace) *nodepb.Namespace {
+	return &nodepb.Namespace{
+		Id:                   ns.uid,
+		Name:                 ns.name,
+		Markfordeletion:      ns.markForDeletion,
+		Deleteinitiationtime: ns.deleteInitiationTime,
+	}
+}
+
+// tree returns the objects in the namespace ns below parent, depth levels deep or all of them if
+// depth is negative.
+func (p *Platform) tree(ns, parent string, depth int) []*nodepb.Object {
+	var objects []*nodepb.Object
+	for _, uid := range sortedUIDs(p.objects) {
+		o := p.objects[uid]
+		if o.namespace != ns || o.parent != parent {
+			continue
+		}
+		obj := &nodepb.Object{Uid: o.uid, Name: o.name, Kind: o.kind}
+		if depth != 0 {
+			obj.Objects = p.tree(ns, o.uid, depth-1)
+		}
+		objects = append(objects, obj)
+	}
+	return objects
+}
+
+// sortedUIDs returns the keys of m in the order they were allocated.
+func sortedUIDs(m interface{}) []string {
+	var uids []string
+	switch m := m.(type) {
+	case map[string]*account:
+		for uid := range m {
+			uids = append(uids, uid)
+		}
+	case map[string]*namespace:
+		for uid := range m {
+			uids = append(uids, uid)
+		}
+	case map[string]*object:
+		for uid := range m {
+			uids = append(uids, uid)
+		}
+	case map[string]*registrypb.Device:
+		for uid := range m {
+			uids = append(uids, uid)
+		}
+	}
+	sort.Slice(uids, func(i, j int) bool {
+		a, _ := strconv.ParseUint(uids[i][2:], 16, 64)
+		b, _ := strconv.ParseUint(uids[j][2:], 16, 64)
+		return a < b
+	})
+	return uids
+}
@@ -0,0 +1,389 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/genproto/protobuf/field_mask"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/infinimesh/infinimesh/pkg/node/nodepb"
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+	"github.com/infinimesh/operator/pkg/registrypb"
+	"github.com/infinimesh/operator/pkg/shadowpb"
+)
+
+func TestFactoryKeepsPlatformsApart(t *testing.T) {
+	f := NewFactory()
+	a := &infinimeshv1beta1.Platform{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "a"}}
+	b := &infinimeshv1beta1.Platform{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "b"}}
+
+	dg, _, err := f.Dgraph(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dg.CreateUserAccount(context.TODO(), "joe", "pw", false, false, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.Platform(a).Account("joe"); !ok {
+		t.Error("account missing on its platform")
+	}
+	if _, ok := f.Platform(b).Account("joe"); ok {
+		t.Error("account leaked to another platform")
+	}
+}
+
+func TestAccounts(t *testing.T) {
+	ctx := context.TODO()
+	p := NewPlatform()
+	dg, ns := p.Dgraph(), p.Nodeserver()
+
+	// The operator expects the first account at 0x2
+	uid, err := dg.CreateUserAccount(ctx, "root", "secret", true, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uid != "0x2" {
+		t.Errorf("uid = %v, want 0x2", uid)
+	}
+	if _, err := dg.CreateUserAccount(ctx, "root", "other", true, true, true); err == nil {
+		t.Error("created an account twice")
+	}
+
+	account, err := dg.GetAccount(ctx, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.Name != "root" || !account.IsRoot || account.DefaultNamespace.GetName() != "root" {
+		t.Errorf("account = %v", account)
+	}
+	if account.Password != "" {
+		t.Error("GetAccount returned the password")
+	}
+
+	permissions, err := dg.ListPermissionsInNamespace(ctx, account.DefaultNamespace.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(permissions) != 1 || permissions[0].AccountName != "root" || permissions[0].Action != nodepb.Action_WRITE {
+		t.Errorf("permissions = %v", permissions)
+	}
+
+	if _, err := ns.Authenticate(ctx, &nodepb.AuthenticateRequest{Username: "root", Password: "wrong"}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Authenticate with a wrong password: %v", err)
+	}
+	if _, err := ns.SetPassword(ctx, &nodepb.SetPasswordRequest{Username: uid, Password: "rotated"}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := ns.Authenticate(ctx, &nodepb.AuthenticateRequest{Username: "root", Password: "rotated"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Success || resp.Account.Uid != uid || resp.DefaultNamespace != "root" {
+		t.Errorf("Authenticate = %v", resp)
+	}
+
+	disabled, err := ns.CreateUserAccount(ctx, &nodepb.CreateUserAccountRequest{Account: &nodepb.Account{Name: "joe", Password: "pw"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ns.Authenticate(ctx, &nodepb.AuthenticateRequest{Username: "joe", Password: "pw"}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Authenticate with a disabled account: %v", err)
+	}
+	if _, err := ns.GetAccount(ctx, &nodepb.GetAccountRequest{Id: "0x99"}); status.Code(err) != codes.NotFound {
+		t.Errorf("GetAccount of a missing account: %v", err)
+	}
+
+	_, err = ns.UpdateAccount(ctx, &nodepb.UpdateAccountRequest{
+		Account:   &nodepb.Account{Uid: disabled.Uid, Enabled: true},
+		FieldMask: &field_mask.FieldMask{Paths: []string{"enabled"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ns.Authenticate(ctx, &nodepb.AuthenticateRequest{Username: "joe", Password: "pw"}); err != nil {
+		t.Errorf("Authenticate after enabling: %v", err)
+	}
+}
+
+func TestObjects(t *testing.T) {
+	ctx := context.TODO()
+	p := NewPlatform()
+	dg := p.Dgraph()
+
+	joe, err := dg.CreateUserAccount(ctx, "joe", "pw", false, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := dg.CreateUserAccount(ctx, "other", "pw", false, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns, err := dg.GetNamespace(ctx, "joe")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := dg.CreateObject(ctx, "x", "", "asset", "0x99"); err == nil {
+		t.Error("created an object in a missing namespace")
+	}
+	if _, err := dg.CreateObject(ctx, "x", "0x99", "asset", ns.Id); err == nil {
+		t.Error("created an object below a missing parent")
+	}
+
+	building, err := dg.CreateObject(ctx, "building", "", "asset", ns.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	floor, err := dg.CreateObject(ctx, "floor", building, "asset", ns.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sensor, err := dg.CreateObject(ctx, "sensor", floor, "device", ns.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	objects, err := dg.ListForAccount(ctx, joe, ns.Id, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 1 || objects[0].Name != "building" || objects[0].Objects[0].Objects[0].Uid != sensor {
+		t.Errorf("objects = %v", objects)
+	}
+	objects, err = dg.ListForAccount(ctx, joe, ns.Id, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 1 || len(objects[0].Objects) != 0 {
+		t.Errorf("objects without recursion = %v", objects)
+	}
+
+	if ok, _ := dg.IsAuthorized(ctx, sensor, joe, "WRITE"); !ok {
+		t.Error("owner of the namespace is not authorized")
+	}
+	if ok, _ := dg.IsAuthorized(ctx, sensor, other, "READ"); ok {
+		t.Error("other account is authorized")
+	}
+	if err := dg.Authorize(ctx, other, floor, "READ", true); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := dg.IsAuthorized(ctx, sensor, other, "READ"); !ok {
+		t.Error("access to the parent is not inherited")
+	}
+	if ok, _ := dg.IsAuthorized(ctx, sensor, other, "WRITE"); ok {
+		t.Error("read access allows writes")
+	}
+
+	if err := dg.DeleteObject(ctx, floor); err != nil {
+		t.Fatal(err)
+	}
+	if err := dg.DeleteObject(ctx, sensor); err == nil || err.Error() != "The Object is not found" {
+		t.Errorf("DeleteObject of a deleted child: %v", err)
+	}
+	if objects := p.Objects("joe"); len(objects) != 1 || len(objects[0].Objects) != 0 {
+		t.Errorf("objects after deletion = %v", objects)
+	}
+}
+
+func TestHardDeleteNamespace(t *testing.T) {
+	ctx := context.TODO()
+	p := NewPlatform()
+	dg := p.Dgraph()
+
+	keep, err := dg.CreateNamespace(ctx, "keep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	drop, err := dg.CreateNamespace(ctx, "drop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, err := dg.CreateNamespace(ctx, "revoked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dg.CreateObject(ctx, "x", "", "asset", drop); err != nil {
+		t.Fatal(err)
+	}
+	for _, ns := range []string{drop, revoked} {
+		if err := dg.SoftDeleteNamespace(ctx, ns); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := dg.RevokeNamespace(ctx, revoked); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dg.HardDeleteNamespace(ctx, time.Now().Add(time.Minute).Format(time.RFC3339)); err != nil {
+		t.Fatal(err)
+	}
+	namespaces, err := dg.ListNamespaces(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, ns := range namespaces {
+		names = append(names, ns.Name)
+	}
+	if len(names) != 2 || names[0] != "keep" || names[1] != "revoked" {
+		t.Errorf("namespaces = %v", names)
+	}
+	if len(p.objects) != 0 {
+		t.Errorf("objects of the deleted namespace are left: %v", p.objects)
+	}
+	if _, err := dg.GetNamespaceID(ctx, keep); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDeviceRegistry(t *testing.T) {
+	ctx := context.TODO()
+	p := NewPlatform()
+	registry := p.DeviceRegistry()
+
+	device := &registrypb.Device{Name: "sensor", Namespace: "joe", Tags: []string{"a"}, Enabled: &wrappers.BoolValue{Value: true}}
+	if _, err := registry.Create(ctx, &registrypb.CreateRequest{Device: device}); status.Code(err) != codes.NotFound {
+		t.Errorf("Create in a missing namespace: %v", err)
+	}
+	if _, err := p.Dgraph().CreateNamespace(ctx, "joe"); err != nil {
+		t.Fatal(err)
+	}
+	created, err := registry.Create(ctx, &registrypb.CreateRequest{Device: device})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := created.Device.Id
+
+	_, err = registry.Update(ctx, &registrypb.UpdateRequest{
+		Device:    &registrypb.Device{Id: id, Name: "renamed", Tags: []string{"b"}},
+		FieldMask: &field_mask.FieldMask{Paths: []string{"tags"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := registry.Get(ctx, &registrypb.GetRequest{Id: id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Device.Name != "sensor" || len(got.Device.Tags) != 1 || got.Device.Tags[0] != "b" || !got.Device.Enabled.Value {
+		t.Errorf("device = %v", got.Device)
+	}
+
+	list, err := registry.List(ctx, &registrypb.ListDevicesRequest{Namespace: "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Devices) != 0 {
+		t.Errorf("devices in other = %v", list.Devices)
+	}
+
+	if _, err := registry.Delete(ctx, &registrypb.DeleteRequest{Id: id}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.Get(ctx, &registrypb.GetRequest{Id: id}); status.Code(err) != codes.NotFound {
+		t.Errorf("Get of a deleted device: %v", err)
+	}
+}
+
+func TestShadows(t *testing.T) {
+	ctx := context.TODO()
+	p := NewPlatform()
+	shadows := p.Shadows()
+
+	if _, err := shadows.Get(ctx, &shadowpb.GetRequest{Id: "0x2"}); status.Code(err) != codes.NotFound {
+		t.Errorf("Get of an unregistered device: %v", err)
+	}
+	if _, err := p.Dgraph().CreateNamespace(ctx, "joe"); err != nil {
+		t.Fatal(err)
+	}
+	created, err := p.DeviceRegistry().Create(ctx, &registrypb.CreateRequest{Device: &registrypb.Device{Name: "sensor", Namespace: "joe"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := created.Device.Id
+
+	for _, patch := range []string{`{"a":1,"b":{"c":2}}`, `{"a":null,"b":{"d":3}}`} {
+		_, err := shadows.PatchDesiredState(ctx, &shadowpb.PatchDesiredStateRequest{Id: id, Data: &shadowpb.Value{JSON: []byte(patch)}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if desired := string(p.DesiredState(id)); desired != `{"b":{"c":2,"d":3}}` {
+		t.Errorf("desired state %v", desired)
+	}
+
+	p.ReportState(id, []byte(`{"b":{"c":2}}`))
+	got, err := shadows.Get(ctx, &shadowpb.GetRequest{Id: id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Shadow.Desired.Version != 2 || got.Shadow.Reported.Version != 1 || string(got.Shadow.Reported.Data.JSON) != `{"b":{"c":2}}` || got.Shadow.Reported.Timestamp == nil {
+		t.Errorf("shadow = %v", got.Shadow)
+	}
+}
+
+func TestGrafana(t *testing.T) {
+	p := NewPlatform()
+	g := p.Grafana()
+
+	if id, _ := g.GetUserID("joe"); id != 0 {
+		t.Errorf("id of a missing user = %v", id)
+	}
+	if err := g.CreateUser("joe"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.CreateOrg("joe"); err != nil {
+		t.Fatal(err)
+	}
+	userID, _ := g.GetUserID("joe")
+	orgID, _ := g.GetOrgID("joe")
+
+	if err := g.AddUserToOrg(orgID, "joe", "Editor"); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.AddUserToOrg(orgID, "joe", "Viewer"); err == nil {
+		t.Error("added a member twice")
+	}
+	if err := g.SwitchUserOrg(userID, orgID); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.SetOrgUserRole(1, userID, "Editor"); err != nil {
+		t.Fatal(err)
+	}
+	members, err := g.OrgMembers(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if members["admin"] != "Admin" || members["joe"] != "Editor" {
+		t.Errorf("members of the main org = %v", members)
+	}
+
+	user, ok := p.GrafanaUser("joe")
+	if !ok {
+		t.Fatal("user missing")
+	}
+	if user.OrgID != orgID || user.Orgs[orgID] != "Editor" || user.Admin {
+		t.Errorf("user = %+v", user)
+	}
+}
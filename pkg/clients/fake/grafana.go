@@ -0,0 +1,258 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"errors"
+)
+
+// GrafanaUser is a user of the Grafana of a platform.
+type GrafanaUser struct {
+	ID       int
+	Name     string
+	Password string
+	Admin    bool
+	// OrgID is the current org of the user
+	OrgID int
+	// Orgs maps the ids of the orgs of the user to its role in them
+	Orgs map[int]string
+}
+
+// GrafanaOrg is an org of the Grafana of a platform.
+type GrafanaOrg struct {
+	ID   int
+	Name string
+}
+
+type grafanaState struct {
+	users   []*GrafanaUser
+	orgs    []*GrafanaOrg
+	reloads int
+}
+
+// newGrafanaState returns a fresh Grafana with its admin user in the main org.
+func newGrafanaState() *grafanaState {
+	return &grafanaState{
+		users: []*GrafanaUser{{ID: 1, Name: "admin", Admin: true, OrgID: 1, Orgs: map[int]string{1: "Admin"}}},
+		orgs:  []*GrafanaOrg{{ID: 1, Name: "Main Org."}},
+	}
+}
+
+func (g *grafanaState) user(id int) *GrafanaUser {
+	for _, user := range g.users {
+		if user.ID == id {
+			return user
+		}
+	}
+	return nil
+}
+
+func (g *grafanaState) org(id int) *GrafanaOrg {
+	for _, org := range g.orgs {
+		if org.ID == id {
+			return org
+		}
+	}
+	return nil
+}
+
+// GrafanaUser returns the Grafana user called name.
+func (p *Platform) GrafanaUser(name string) (GrafanaUser, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, user := range p.grafana.users {
+		if user.Name == name {
+			out := *user
+			out.Orgs = map[int]string{}
+			for id, role := range user.Orgs {
+				out.Orgs[id] = role
+			}
+			return out, true
+		}
+	}
+	return GrafanaUser{}, false
+}
+
+// GrafanaOrg returns the Grafana org called name.
+func (p *Platform) GrafanaOrg(name string) (GrafanaOrg, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, org := range p.grafana.orgs {
+		if org.Name == name {
+			return *org, true
+		}
+	}
+	return GrafanaOrg{}, false
+}
+
+// DatasourceReloads returns how often Grafana was asked to reload its datasources.
+func (p *Platform) DatasourceReloads() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.grafana.reloads
+}
+
+// Grafana implements clients.Grafana on the data plane of a platform.
+type Grafana struct {
+	p *Platform
+}
+
+func (g *Grafana) GetUserID(name string) (int, error) {
+	g.p.mu.Lock()
+	defer g.p.mu.Unlock()
+	for _, user := range g.p.grafana.users {
+		if user.Name == name {
+			return user.ID, nil
+		}
+	}
+	return 0, nil
+}
+
+func (g *Grafana) CreateUser(name string) error {
+	g.p.mu.Lock()
+	defer g.p.mu.Unlock()
+	state := g.p.grafana
+	for _, user := range state.users {
+		if user.Name == name {
+			return errors.New("User with same email or login already exists")
+		}
+	}
+	// New users join the main org like they do in Grafana
+	state.users = append(state.users, &GrafanaUser{
+		ID:    state.users[len(state.users)-1].ID + 1,
+		Name:  name,
+		OrgID: 1,
+		Orgs:  map[int]string{1: "Viewer"},
+	})
+	return nil
+}
+
+func (g *Grafana) SetUserPassword(userID int, password string) error {
+	g.p.mu.Lock()
+	defer g.p.mu.Unlock()
+	user := g.p.grafana.user(userID)
+	if user == nil {
+		return errors.New("User not found")
+	}
+	user.Password = password
+	return nil
+}
+
+func (g *Grafana) MakeUserAdmin(userID int) error {
+	g.p.mu.Lock()
+	defer g.p.mu.Unlock()
+	user := g.p.grafana.user(userID)
+	if user == nil {
+		return errors.New("User not found")
+	}
+	user.Admin = true
+	return nil
+}
+
+func (g *Grafana) GetOrgID(name string) (int, error) {
+	g.p.mu.Lock()
+	defer g.p.mu.Unlock()
+	for _, org := range g.p.grafana.orgs {
+		if org.Name == name {
+			return org.ID, nil
+		}
+	}
+	return 0, nil
+}
+
+func (g *Grafana) CreateOrg(name string) error {
+	g.p.mu.Lock()
+	defer g.p.mu.Unlock()
+	state := g.p.grafana
+	for _, org := range state.orgs {
+		if org.Name == name {
+			return errors.New("Organization name taken")
+		}
+	}
+	state.orgs = append(state.orgs, &GrafanaOrg{ID: state.orgs[len(state.orgs)-1].ID + 1, Name: name})
+	return nil
+}
+
+// AddUserToOrg adds the user called name to the org, rejecting existing members like Grafana.
+func (g *Grafana) AddUserToOrg(orgID int, name, role string) error {
+	g.p.mu.Lock()
+	defer g.p.mu.Unlock()
+	if g.p.grafana.org(orgID) == nil {
+		return errors.New("Organization not found")
+	}
+	for _, user := range g.p.grafana.users {
+		if user.Name != name {
+			continue
+		}
+		if _, ok := user.Orgs[orgID]; ok {
+			return errors.New("User is already member of this organization")
+		}
+		user.Orgs[orgID] = role
+		return nil
+	}
+	return errors.New("User not found")
+}
+
+func (g *Grafana) OrgMembers(orgID int) (map[string]string, error) {
+	g.p.mu.Lock()
+	defer g.p.mu.Unlock()
+	if g.p.grafana.org(orgID) == nil {
+		return nil, errors.New("Organization not found")
+	}
+	members := map[string]string{}
+	for _, user := range g.p.grafana.users {
+		if role, ok := user.Orgs[orgID]; ok {
+			members[user.Name] = role
+		}
+	}
+	return members, nil
+}
+
+func (g *Grafana) SetOrgUserRole(orgID, userID int, role string) error {
+	g.p.mu.Lock()
+	defer g.p.mu.Unlock()
+	user := g.p.grafana.user(userID)
+	if user == nil {
+		return errors.New("User not found")
+	}
+	if _, ok := user.Orgs[orgID]; !ok {
+		return errors.New("User is not a member of this organization")
+	}
+	user.Orgs[orgID] = role
+	return nil
+}
+
+func (g *Grafana) SwitchUserOrg(userID, orgID int) error {
+	g.p.mu.Lock()
+	defer g.p.mu.Unlock()
+	user := g.p.grafana.user(userID)
+	if user == nil {
+		return errors.New("User not found")
+	}
+	if _, ok := user.Orgs[orgID]; !ok {
+		return errors.New("Not a valid organization")
+	}
+	user.OrgID = orgID
+	return nil
+}
+
+func (g *Grafana) ReloadDatasources() error {
+	g.p.mu.Lock()
+	defer g.p.mu.Unlock()
+	g.p.grafana.reloads++
+	return nil
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/infinimesh/infinimesh/pkg/node/nodepb"
+)
+
+// Nodeserver implements the account service of the nodeserver on the data plane of a platform,
+// returning gRPC status errors.
+type Nodeserver struct {
+	p *Platform
+}
+
+var _ nodepb.AccountServiceClient = &Nodeserver{}
+
+func (n *Nodeserver) dgraph() *Dgraph {
+	return &Dgraph{p: n.p}
+}
+
+func (n *Nodeserver) CreateUserAccount(ctx context.Context, in *nodepb.CreateUserAccountRequest, opts ...grpc.CallOption) (*nodepb.CreateUserAccountResponse, error) {
+	password := in.Account.GetPassword()
+	if password == "" {
+		password = in.Password
+	}
+	uid, err := n.dgraph().CreateUserAccount(ctx, in.Account.GetName(), password, in.Account.GetIsRoot(), in.Account.GetIsAdmin(), in.Account.GetEnabled())
+	if err != nil {
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	}
+	return &nodepb.CreateUserAccountResponse{Uid: uid}, nil
+}
+
+func (n *Nodeserver) UpdateAccount(ctx context.Context, in *nodepb.UpdateAccountRequest, opts ...grpc.CallOption) (*nodepb.UpdateAccountResponse, error) {
+	if err := n.dgraph().UpdateAccount(ctx, in, false); err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return &nodepb.UpdateAccountResponse{}, nil
+}
+
+func (n *Nodeserver) GetAccount(ctx context.Context, in *nodepb.GetAccountRequest, opts ...grpc.CallOption) (*nodepb.Account, error) {
+	account, err := n.dgraph().GetAccount(ctx, in.Id)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return account, nil
+}
+
+func (n *Nodeserver) ListAccounts(ctx context.Context, in *nodepb.ListAccountsRequest, opts ...grpc.CallOption) (*nodepb.ListAccountsResponse, error) {
+	accounts, err := n.dgraph().ListAccounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &nodepb.ListAccountsResponse{Accounts: accounts}, nil
+}
+
+// SetPassword sets the password of the account with the uid or name in in.Username.
+func (n *Nodeserver) SetPassword(ctx context.Context, in *nodepb.SetPasswordRequest, opts ...grpc.CallOption) (*nodepb.SetPasswordResponse, error) {
+	n.p.mu.Lock()
+	defer n.p.mu.Unlock()
+	a, ok := n.p.accounts[in.Username]
+	if !ok {
+		a = n.p.accountByName(in.Username)
+	}
+	if a == nil {
+		return nil, status.Error(codes.NotFound, "The Account is not found")
+	}
+	a.password = in.Password
+	return &nodepb.SetPasswordResponse{}, nil
+}
+
+func (n *Nodeserver) DeleteAccount(ctx context.Context, in *nodepb.DeleteAccountRequest, opts ...grpc.CallOption) (*nodepb.DeleteAccountResponse, error) {
+	if err := n.dgraph().DeleteAccount(ctx, in); err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return &nodepb.DeleteAccountResponse{}, nil
+}
+
+func (n *Nodeserver) Authenticate(ctx context.Context, in *nodepb.AuthenticateRequest, opts ...grpc.CallOption) (*nodepb.AuthenticateResponse, error) {
+	_, uid, defaultNamespace, err := n.dgraph().Authenticate(ctx, in.Username, in.Password)
+	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			return nil, err
+		}
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	account, err := n.dgraph().GetAccount(ctx, uid)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return &nodepb.AuthenticateResponse{Success: true, Account: account, DefaultNamespace: defaultNamespace}, nil
+}
+
+func (n *Nodeserver) IsAuthorized(ctx context.Context, in *nodepb.IsAuthorizedRequest, opts ...grpc.CallOption) (*nodepb.IsAuthorizedResponse, error) {
+	decision, err := n.dgraph().IsAuthorized(ctx, in.Node, in.Account, in.Action.String())
+	if err != nil {
+		return nil, err
+	}
+	return &nodepb.IsAuthorizedResponse{Decision: &wrappers.BoolValue{Value: decision}}, nil
+}
+
+func (n *Nodeserver) IsAuthorizedNamespace(ctx context.Context, in *nodepb.IsAuthorizedNamespaceRequest, opts ...grpc.CallOption) (*nodepb.IsAuthorizedNamespaceResponse, error) {
+	decision, err := n.dgraph().IsAuthorizedNamespace(ctx, in.Namespaceid, in.Account, in.Action)
+	if err != nil {
+		return nil, err
+	}
+	return &nodepb.IsAuthorizedNamespaceResponse{Decision: &wrappers.BoolValue{Value: decision}}, nil
+}
+
+func (n *Nodeserver) Authorize(ctx context.Context, in *nodepb.AuthorizeRequest, opts ...grpc.CallOption) (*nodepb.AuthorizeResponse, error) {
+	if err := n.dgraph().Authorize(ctx, in.Account, in.Node, in.Action, in.Inherit); err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return &nodepb.AuthorizeResponse{}, nil
+}
+
+func (n *Nodeserver) AuthorizeNamespace(ctx context.Context, in *nodepb.AuthorizeNamespaceRequest, opts ...grpc.CallOption) (*nodepb.AuthorizeNamespaceResponse, error) {
+	if err := n.dgraph().AuthorizeNamespace(ctx, in.Account, in.Namespace, in.Action); err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return &nodepb.AuthorizeNamespaceResponse{}, nil
+}
+
+func (n *Nodeserver) IsRoot(ctx context.Context, in *nodepb.IsRootRequest, opts ...grpc.CallOption) (*nodepb.IsRootResponse, error) {
+	account, err := n.dgraph().GetAccount(ctx, in.Account)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return &nodepb.IsRootResponse{IsRoot: account.IsRoot}, nil
+}
+
+func (n *Nodeserver) IsAdmin(ctx context.Context, in *nodepb.IsAdminRequest, opts ...grpc.CallOption) (*nodepb.IsAdminResponse, error) {
+	account, err := n.dgraph().GetAccount(ctx, in.Account)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return &nodepb.IsAdminResponse{IsAdmin: account.IsAdmin}, nil
+}
+
+func (n *Nodeserver) AssignOwner(ctx context.Context, in *nodepb.OwnershipRequest, opts ...grpc.CallOption) (*nodepb.OwnershipResponse, error) {
+	if err := n.dgraph().AssignOwner(ctx, in.Ownerid, in.Accountid); err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return &nodepb.OwnershipResponse{}, nil
+}
+
+func (n *Nodeserver) RemoveOwner(ctx context.Context, in *nodepb.OwnershipRequest, opts ...grpc.CallOption) (*nodepb.OwnershipResponse, error) {
+	if err := n.dgraph().RemoveOwner(ctx, in.Ownerid, in.Accountid); err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return &nodepb.OwnershipResponse{}, nil
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/infinimesh/operator/pkg/registrypb"
+)
+
+// DeviceRegistry implements the device registry on the data plane of a platform. Devices live
+// in the namespaces of its dgraph and get their ids from it.
+type DeviceRegistry struct {
+	p *Platform
+}
+
+var _ registrypb.DevicesClient = &DeviceRegistry{}
+
+func (r *DeviceRegistry) Create(ctx context.Context, in *registrypb.CreateRequest, opts ...grpc.CallOption) (*registrypb.CreateResponse, error) {
+	r.p.mu.Lock()
+	defer r.p.mu.Unlock()
+	if in.Device == nil || in.Device.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "Device name is required")
+	}
+	if r.p.namespaceByName(in.Device.Namespace) == nil {
+		return nil, status.Error(codes.NotFound, "The Namespace is not found")
+	}
+	device := copyDevice(in.Device)
+	device.Id = r.p.newUID()
+	r.p.devices[device.Id] = device
+	return &registrypb.CreateResponse{Device: copyDevice(device)}, nil
+}
+
+func (r *DeviceRegistry) Get(ctx context.Context, in *registrypb.GetRequest, opts ...grpc.CallOption) (*registrypb.GetResponse, error) {
+	r.p.mu.Lock()
+	defer r.p.mu.Unlock()
+	device, ok := r.p.devices[in.Id]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "The Device is not found")
+	}
+	return &registrypb.GetResponse{Device: copyDevice(device)}, nil
+}
+
+// Update updates the fields of the device in the field mask, all of them without one.
+func (r *DeviceRegistry) Update(ctx context.Context, in *registrypb.UpdateRequest, opts ...grpc.CallOption) (*registrypb.UpdateResponse, error) {
+	r.p.mu.Lock()
+	defer r.p.mu.Unlock()
+	if in.Device == nil {
+		return nil, status.Error(codes.InvalidArgument, "Device is required")
+	}
+	device, ok := r.p.devices[in.Device.Id]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "The Device is not found")
+	}
+	paths := in.FieldMask.GetPaths()
+	if len(paths) == 0 {
+		paths = []string{"name", "enabled", "tags", "certificate"}
+	}
+	update := copyDevice(in.Device)
+	for _, path := range paths {
+		switch path {
+		case "name":
+			device.Name = update.Name
+		case "enabled":
+			device.Enabled = update.Enabled
+		case "tags":
+			device.Tags = update.Tags
+		case "certificate":
+			device.Certificate = update.Certificate
+		}
+	}
+	return &registrypb.UpdateResponse{}, nil
+}
+
+func (r *DeviceRegistry) Delete(ctx context.Context, in *registrypb.DeleteRequest, opts ...grpc.CallOption) (*registrypb.DeleteResponse, error) {
+	r.p.mu.Lock()
+	defer r.p.mu.Unlock()
+	if _, ok := r.p.devices[in.Id]; !ok {
+		return nil, status.Error(codes.NotFound, "The Device is not found")
+	}
+	delete(r.p.devices, in.Id)
+	delete(r.p.shadows, in.Id)
+	return &registrypb.DeleteResponse{}, nil
+}
+
+// List returns the devices in the namespace in.Namespace, or all of them.
+func (r *DeviceRegistry) List(ctx context.Context, in *registrypb.ListDevicesRequest, opts ...grpc.CallOption) (*registrypb.ListResponse, error) {
+	r.p.mu.Lock()
+	defer r.p.mu.Unlock()
+	resp := &registrypb.ListResponse{}
+	for _, id := range sortedUIDs(r.p.devices) {
+		if device := r.p.devices[id]; in.Namespace == "" || device.Namespace == in.Namespace {
+			resp.Devices = append(resp.Devices, copyDevice(device))
+		}
+	}
+	return resp, nil
+}
+
+func copyDevice(in *registrypb.Device) *registrypb.Device {
+	out := &registrypb.Device{
+		Id:        in.Id,
+		Name:      in.Name,
+		Namespace: in.Namespace,
+		Tags:      append([]string(nil), in.Tags...),
+	}
+	if in.Enabled != nil {
+		out.Enabled = &wrappers.BoolValue{Value: in.Enabled.Value}
+	}
+	if in.Certificate != nil {
+		out.Certificate = &registrypb.Certificate{
+			PemData:     in.Certificate.PemData,
+			Algorithm:   in.Certificate.Algorithm,
+			Fingerprint: append([]byte(nil), in.Certificate.Fingerprint...),
+		}
+	}
+	return out
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/infinimesh/operator/pkg/shadowpb"
+)
+
+// Shadows implements the shadow API on the data plane of a platform. Only devices of its
+// registry have a shadow.
+type Shadows struct {
+	p *Platform
+}
+
+var _ shadowpb.ShadowsClient = &Shadows{}
+
+func (s *Shadows) Get(ctx context.Context, in *shadowpb.GetRequest, opts ...grpc.CallOption) (*shadowpb.GetResponse, error) {
+	s.p.mu.Lock()
+	defer s.p.mu.Unlock()
+	if _, ok := s.p.devices[in.Id]; !ok {
+		return nil, status.Error(codes.NotFound, "The Device is not found")
+	}
+	shadow := s.p.shadows[in.Id]
+	if shadow == nil {
+		return &shadowpb.GetResponse{Shadow: &shadowpb.Shadow{}}, nil
+	}
+	return &shadowpb.GetResponse{Shadow: &shadowpb.Shadow{
+		Reported: copyValue(shadow.Reported),
+		Desired:  copyValue(shadow.Desired),
+	}}, nil
+}
+
+// PatchDesiredState applies the JSON merge patch in in.Data to the desired state.
+func (s *Shadows) PatchDesiredState(ctx context.Context, in *shadowpb.PatchDesiredStateRequest, opts ...grpc.CallOption) (*shadowpb.PatchDesiredStateResponse, error) {
+	s.p.mu.Lock()
+	defer s.p.mu.Unlock()
+	if _, ok := s.p.devices[in.Id]; !ok {
+		return nil, status.Error(codes.NotFound, "The Device is not found")
+	}
+	var patch interface{}
+	if in.Data != nil && len(in.Data.JSON) > 0 {
+		if err := json.Unmarshal(in.Data.JSON, &patch); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
+	shadow := s.p.shadow(in.Id)
+	var desired interface{}
+	if shadow.Desired != nil && shadow.Desired.Data != nil && len(shadow.Desired.Data.JSON) > 0 {
+		if err := json.Unmarshal(shadow.Desired.Data.JSON, &desired); err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	}
+	data, err := json.Marshal(applyMergePatch(desired, patch))
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	shadow.Desired = nextValue(shadow.Desired, data)
+	return &shadowpb.PatchDesiredStateResponse{}, nil
+}
+
+// Shadows returns a client of the shadow API of p.
+func (p *Platform) Shadows() shadowpb.ShadowsClient {
+	return &Shadows{p: p}
+}
+
+// DesiredState returns the desired state of the device with the given id as JSON, nil if it has
+// none.
+func (p *Platform) DesiredState(id string) []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if shadow := p.shadows[id]; shadow != nil && shadow.Desired != nil {
+		return append([]byte(nil), shadow.Desired.Data.JSON...)
+	}
+	return nil
+}
+
+// ReportState has the device with the given id report the JSON document state, like the device
+// would through the MQTT bridge.
+func (p *Platform) ReportState(id string, state []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	shadow := p.shadow(id)
+	shadow.Reported = nextValue(shadow.Reported, state)
+}
+
+// shadow returns the shadow of the device with the given id, p.mu must be held.
+func (p *Platform) shadow(id string) *shadowpb.Shadow {
+	shadow, ok := p.shadows[id]
+	if !ok {
+		shadow = &shadowpb.Shadow{}
+		p.shadows[id] = shadow
+	}
+	return shadow
+}
+
+// nextValue returns the version after previous holding data.
+func nextValue(previous *shadowpb.VersionedValue, data []byte) *shadowpb.VersionedValue {
+	value := &shadowpb.VersionedValue{
+		Version: 1,
+		Data:    &shadowpb.Value{JSON: append([]byte(nil), data...)},
+	}
+	if previous != nil {
+		value.Version = previous.Version + 1
+	}
+	value.Timestamp, _ = ptypes.TimestampProto(time.Now())
+	return value
+}
+
+func copyValue(in *shadowpb.VersionedValue) *shadowpb.VersionedValue {
+	if in == nil {
+		return nil
+	}
+	out := &shadowpb.VersionedValue{Version: in.Version}
+	if in.Data != nil {
+		out.Data = &shadowpb.Value{JSON: append([]byte(nil), in.Data.JSON...)}
+	}
+	if in.Timestamp != nil {
+		out.Timestamp = &timestamp.Timestamp{Seconds: in.Timestamp.Seconds, Nanos: in.Timestamp.Nanos}
+	}
+	return out
+}
+
+// applyMergePatch applies the JSON merge patch (RFC 7386) to state.
+func applyMergePatch(state, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	result := map[string]interface{}{}
+	if stateObject, ok := state.(map[string]interface{}); ok {
+		for key, value := range stateObject {
+			result[key] = value
+		}
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(result, key)
+		} else {
+			result[key] = applyMergePatch(result[key], value)
+		}
+	}
+	return result
+}
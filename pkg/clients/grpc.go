@@ -0,0 +1,203 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clients
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/dgraph-io/dgo"
+	"github.com/dgraph-io/dgo/protos/api"
+	"google.golang.org/grpc"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/infinimesh/infinimesh/pkg/grafana"
+	"github.com/infinimesh/infinimesh/pkg/node"
+	"github.com/infinimesh/infinimesh/pkg/node/dgraph"
+	"github.com/infinimesh/infinimesh/pkg/node/nodepb"
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+	"github.com/infinimesh/operator/pkg/registrypb"
+	"github.com/infinimesh/operator/pkg/shadowpb"
+)
+
+// NewFactory returns a Factory reaching the services of a platform at their in-cluster
+// addresses. Credentials of an external dgraph are read with c.
+func NewFactory(c client.Client) Factory {
+	return &factory{client: c}
+}
+
+type factory struct {
+	client client.Client
+}
+
+func (f *factory) Dgraph(instance *infinimeshv1beta1.Platform) (Dgraph, io.Closer, error) {
+	dg, conn, err := DgraphClient(f.client, instance)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &dgraphRepo{Repo: dgraph.NewDGraphRepo(dg), dg: dg}, conn, nil
+}
+
+func (f *factory) Nodeserver(instance *infinimeshv1beta1.Platform) (nodepb.AccountServiceClient, io.Closer, error) {
+	conn, err := grpc.Dial(serviceHost(instance, "nodeserver"), grpc.WithInsecure())
+	if err != nil {
+		return nil, nil, err
+	}
+	return nodepb.NewAccountServiceClient(conn), conn, nil
+}
+
+func (f *factory) DeviceRegistry(instance *infinimeshv1beta1.Platform) (registrypb.DevicesClient, io.Closer, error) {
+	conn, err := grpc.Dial(serviceHost(instance, "device-registry"), grpc.WithInsecure())
+	if err != nil {
+		return nil, nil, err
+	}
+	return registrypb.NewDevicesClient(conn), conn, nil
+}
+
+func (f *factory) Shadows(instance *infinimeshv1beta1.Platform) (shadowpb.ShadowsClient, io.Closer, error) {
+	conn, err := grpc.Dial(serviceHost(instance, "shadow-api"), grpc.WithInsecure())
+	if err != nil {
+		return nil, nil, err
+	}
+	return shadowpb.NewShadowsClient(conn), conn, nil
+}
+
+func (f *factory) Grafana(instance *infinimeshv1beta1.Platform, user, password string) Grafana {
+	url := "http://" + instance.Name + "-grafana." + instance.Namespace + ".svc.cluster.local:3000"
+	return &grafanaClient{Client: grafana.NewClient(url, user, password), url: url, user: user, password: password}
+}
+
+// serviceHost returns the gRPC address of the service svc of instance.
+func serviceHost(instance *infinimeshv1beta1.Platform, svc string) string {
+	return instance.Name + "-" + svc + "." + instance.Namespace + ".svc.cluster.local:8080"
+}
+
+// DgraphClient connects to the dgraph of instance like the platform controller does, reading
+// the credentials of an external dgraph with c. The caller closes the returned connection.
+func DgraphClient(c client.Client, instance *infinimeshv1beta1.Platform) (*dgo.Dgraph, *grpc.ClientConn, error) {
+	host := instance.Name + "-dgraph-alpha." + instance.Namespace + ".svc.cluster.local:9080"
+	if external := instance.Spec.DGraph.External; external != nil {
+		host = external.Address
+	}
+	conn, err := grpc.Dial(host, grpc.WithInsecure())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dg := dgo.NewDgraphClient(api.NewDgraphClient(conn))
+
+	if external := instance.Spec.DGraph.External; external != nil && external.CredentialsSecret != "" {
+		credentials := &corev1.Secret{}
+		err = c.Get(context.TODO(), types.NamespacedName{Name: external.CredentialsSecret, Namespace: instance.Namespace}, credentials)
+		if err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+
+		err = dg.Login(context.TODO(), string(credentials.Data["username"]), string(credentials.Data["password"]))
+		if err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+	}
+
+	return dg, conn, nil
+}
+
+type dgraphRepo struct {
+	node.Repo
+	dg *dgo.Dgraph
+}
+
+func (r *dgraphRepo) ImportSchema() error {
+	return dgraph.ImportSchema(r.dg, false)
+}
+
+// grafanaClient is the vendored Grafana client plus the admin APIs it does not cover.
+type grafanaClient struct {
+	*grafana.Client
+	url, user, password string
+}
+
+func (c *grafanaClient) SetUserPassword(userID int, password string) error {
+	return c.request(c.url+"/api/admin/users/"+strconv.Itoa(userID)+"/password", "PUT", map[string]string{
+		"password": password,
+	}, nil)
+}
+
+func (c *grafanaClient) OrgMembers(orgID int) (map[string]string, error) {
+	var users []struct {
+		Login string `json:"login"`
+		Role  string `json:"role"`
+	}
+	if err := c.request(c.url+"/api/orgs/"+strconv.Itoa(orgID)+"/users", "GET", nil, &users); err != nil {
+		return nil, err
+	}
+	members := map[string]string{}
+	for _, user := range users {
+		members[user.Login] = user.Role
+	}
+	return members, nil
+}
+
+func (c *grafanaClient) SetOrgUserRole(orgID, userID int, role string) error {
+	return c.request(c.url+"/api/orgs/"+strconv.Itoa(orgID)+"/users/"+strconv.Itoa(userID), "PATCH", map[string]string{
+		"role": role,
+	}, nil)
+}
+
+func (c *grafanaClient) ReloadDatasources() error {
+	return c.request(c.url+"/api/admin/provisioning/datasources/reload", "POST", nil, nil)
+}
+
+// request sends body to url and decodes the response into out unless it is nil.
+func (c *grafanaClient) request(url, method string, body, out interface{}) error {
+	buf := &bytes.Buffer{}
+	if body != nil {
+		if err := json.NewEncoder(buf).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, url, buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(c.user, c.password)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Wrong status code: %v", resp.StatusCode)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package controllertest sets up the cluster and the data plane the controllers of device
+// resources work on in tests: the Platform foo in the namespace default, kept by a memory
+// client, whose data plane runs on the fakes of the clients package.
+package controllertest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/infinimesh/operator/pkg/apis"
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+	"github.com/infinimesh/operator/pkg/clients/fake"
+	"github.com/infinimesh/operator/pkg/controller/platform"
+	"github.com/infinimesh/operator/pkg/pki"
+	"github.com/infinimesh/operator/pkg/registrypb"
+)
+
+const (
+	// Namespace is the Kubernetes namespace of the Platform and the objects of the test
+	Namespace = "default"
+	// PlatformName is the name of the Platform
+	PlatformName = "foo"
+	// InfinimeshNamespace is the infinimesh namespace the data plane of the Platform has
+	InfinimeshNamespace = "joe"
+)
+
+// Env is the cluster and the data plane of a test.
+type Env struct {
+	Client   client.Client
+	Recorder *record.FakeRecorder
+	Clients  *fake.Factory
+	Platform *infinimeshv1beta1.Platform
+	// Data is the data plane of Platform
+	Data *fake.Platform
+}
+
+// New returns an Env whose cluster has the Platform and objs.
+func New(t *testing.T, objs ...runtime.Object) *Env {
+	if err := apis.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+	e := &Env{
+		Client:   platform.NewMemoryClient(scheme.Scheme),
+		Recorder: record.NewFakeRecorder(100),
+		Clients:  fake.NewFactory(),
+		Platform: &infinimeshv1beta1.Platform{ObjectMeta: metav1.ObjectMeta{Name: PlatformName, Namespace: Namespace}},
+	}
+	e.Data = e.Clients.Platform(e.Platform)
+	if _, err := e.Data.Dgraph().CreateNamespace(context.TODO(), InfinimeshNamespace); err != nil {
+		t.Fatal(err)
+	}
+	e.Create(t, e.Platform)
+	e.Create(t, objs...)
+	return e
+}
+
+// Create creates objs in the cluster.
+func (e *Env) Create(t *testing.T, objs ...runtime.Object) {
+	for _, obj := range objs {
+		if err := e.Client.Create(context.TODO(), obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Get reads the object named name into obj.
+func Get(t *testing.T, c client.Client, name string, obj runtime.Object) {
+	if err := c.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: Namespace}, obj); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// EnableDeviceCA enables the device CA of the Platform and creates its Secret.
+func (e *Env) EnableDeviceCA(t *testing.T) {
+	caCert, caKey, err := pki.NewCA(PlatformName, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Platform.Spec.DeviceCA.Enabled = true
+	if err := e.Client.Update(context.TODO(), e.Platform); err != nil {
+		t.Fatal(err)
+	}
+	e.Create(t, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: platform.DeviceCASecretName(PlatformName), Namespace: Namespace},
+		Data:       map[string][]byte{corev1.TLSCertKey: caCert, corev1.TLSPrivateKeyKey: caKey},
+	})
+}
+
+// RegisterDevice registers a device named name in the infinimesh namespace and returns its id.
+func (e *Env) RegisterDevice(t *testing.T, name string) string {
+	created, err := e.Data.DeviceRegistry().Create(context.TODO(), &registrypb.CreateRequest{Device: &registrypb.Device{Name: name, Namespace: InfinimeshNamespace}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return created.Device.Id
+}
+
+// FailingStatus is a client whose status updates fail, like they do when the object changed in
+// between.
+type FailingStatus struct {
+	client.Client
+}
+
+// Status returns a StatusWriter that fails every update.
+func (c FailingStatus) Status() client.StatusWriter {
+	return failingStatusWriter{}
+}
+
+type failingStatusWriter struct{}
+
+func (failingStatusWriter) Update(ctx context.Context, obj runtime.Object) error {
+	return errors.New("status update failed")
+}
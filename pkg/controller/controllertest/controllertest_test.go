@@ -0,0 +1,41 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllertest
+
+import (
+	"context"
+	"testing"
+
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+)
+
+func TestEnv(t *testing.T) {
+	env := New(t)
+	env.EnableDeviceCA(t)
+
+	p := &infinimeshv1beta1.Platform{}
+	Get(t, env.Client, PlatformName, p)
+	if !p.Spec.DeviceCA.Enabled {
+		t.Error("the device CA is not enabled")
+	}
+	if _, err := env.Data.Dgraph().GetNamespace(context.TODO(), InfinimeshNamespace); err != nil {
+		t.Error(err)
+	}
+	if err := (FailingStatus{Client: env.Client}).Status().Update(context.TODO(), p); err == nil {
+		t.Error("status update didn't fail")
+	}
+}
@@ -0,0 +1,324 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package devicecertificaterequest
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"fmt"
+	"reflect"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	infinimeshv1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1"
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+	"github.com/infinimesh/operator/pkg/controller/finalizers"
+	"github.com/infinimesh/operator/pkg/controller/platform"
+	"github.com/infinimesh/operator/pkg/pki"
+)
+
+var logger = logf.Log.WithName("devicecertificaterequest-controller")
+
+// finalizer revokes the certificate of a deleted request
+const finalizer = "infinimesh.io/revocation"
+
+// Add creates a new DeviceCertificateRequest Controller and adds it to the Manager. The Manager
+// will set fields on the Controller and Start it when the Manager is Started.
+func Add(mgr manager.Manager, opts controller.Options) error {
+	opts.Reconciler = newReconciler(mgr)
+	return add(mgr, opts)
+}
+
+// newReconciler returns a new reconcile.Reconciler
+func newReconciler(mgr manager.Manager) *ReconcileDeviceCertificateRequest {
+	return &ReconcileDeviceCertificateRequest{
+		Client:   mgr.GetClient(),
+		scheme:   mgr.GetScheme(),
+		recorder: mgr.GetRecorder("devicecertificaterequest-controller"),
+	}
+}
+
+// add adds a new Controller to mgr with opts.Reconciler as the reconcile.Reconciler
+func add(mgr manager.Manager, opts controller.Options) error {
+	c, err := controller.New("devicecertificaterequest-controller", mgr, opts)
+	if err != nil {
+		return err
+	}
+
+	err = c.Watch(&source.Kind{Type: &infinimeshv1.DeviceCertificateRequest{}}, &handler.EnqueueRequestForObject{})
+	if err != nil {
+		return err
+	}
+
+	return c.Watch(&source.Kind{Type: &corev1.Secret{}}, &handler.EnqueueRequestForOwner{
+		IsController: true,
+		OwnerType:    &infinimeshv1.DeviceCertificateRequest{},
+	})
+}
+
+var _ reconcile.Reconciler = &ReconcileDeviceCertificateRequest{}
+
+// ReconcileDeviceCertificateRequest reconciles a DeviceCertificateRequest object
+type ReconcileDeviceCertificateRequest struct {
+	client.Client
+	scheme   *runtime.Scheme
+	recorder record.EventRecorder
+}
+
+// Reconcile issues the requested certificate from the device CA of the platform. Revocation is
+// up to the platform controller, which lists revoked requests and the certificates of deleted
+// ones on its CRLs.
+// +kubebuilder:rbac:groups=infinimesh.infinimesh.io,resources=devicecertificaterequests,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=infinimesh.infinimesh.io,resources=devicecertificaterequests/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+func (r *ReconcileDeviceCertificateRequest) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	instance := &infinimeshv1.DeviceCertificateRequest{}
+	err := r.Get(context.TODO(), request.NamespacedName, instance)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	if instance.DeletionTimestamp != nil {
+		return reconcile.Result{}, r.finalize(instance)
+	}
+
+	if instance.Status.SerialNumber != "" {
+		return reconcile.Result{}, nil
+	}
+
+	if !finalizers.Has(instance, finalizer) {
+		finalizers.Add(instance, finalizer)
+		if err := r.Update(context.TODO(), instance); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	status := instance.Status.DeepCopy()
+
+	err = r.issue(instance)
+	if err != nil {
+		instance.Status.Message = err.Error()
+		r.recorder.Eventf(instance, corev1.EventTypeWarning, "IssueFailed", "Failed to issue certificate: %v", err)
+	} else {
+		instance.Status.Message = ""
+		r.recorder.Eventf(instance, corev1.EventTypeNormal, "Issued", "Issued certificate %v into Secret %v", instance.Status.SerialNumber, secretName(instance))
+	}
+
+	if !reflect.DeepEqual(*status, instance.Status) {
+		if err := r.Status().Update(context.TODO(), instance); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+	return reconcile.Result{}, err
+}
+
+// finalize revokes the certificate of a deleted request and releases the request. The
+// revocation is kept by the platform until the certificate expires.
+func (r *ReconcileDeviceCertificateRequest) finalize(instance *infinimeshv1.DeviceCertificateRequest) error {
+	if !finalizers.Has(instance, finalizer) {
+		return nil
+	}
+
+	if instance.Status.SerialNumber != "" && instance.Status.NotAfter != nil {
+		p := &infinimeshv1beta1.Platform{}
+		err := r.Get(context.TODO(), types.NamespacedName{Name: instance.Spec.Platform, Namespace: instance.Namespace}, p)
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		if err == nil && p.DeletionTimestamp == nil {
+			err := platform.RevokeDeviceCertificate(r.Client, r.scheme, p, instance.Status.Issuer, instance.Status.SerialNumber, instance.Status.NotAfter.Time)
+			if err != nil {
+				return err
+			}
+			logger.Info("Revoked certificate", "namespace", instance.Namespace, "name", instance.Name, "serial", instance.Status.SerialNumber)
+		}
+	}
+
+	finalizers.Remove(instance, finalizer)
+	return r.Update(context.TODO(), instance)
+}
+
+// issue signs the certificate and stores it in the Secret of the request.
+func (r *ReconcileDeviceCertificateRequest) issue(instance *infinimeshv1.DeviceCertificateRequest) error {
+	p := &infinimeshv1beta1.Platform{}
+	err := r.Get(context.TODO(), types.NamespacedName{Name: instance.Spec.Platform, Namespace: instance.Namespace}, p)
+	if err != nil {
+		return err
+	}
+	if !p.Spec.DeviceCA.Enabled {
+		return fmt.Errorf("the device CA of platform %v is not enabled", p.Name)
+	}
+
+	caSecret := &corev1.Secret{}
+	err = r.Get(context.TODO(), types.NamespacedName{Name: platform.DeviceCASecretName(p.Name), Namespace: p.Namespace}, caSecret)
+	if err != nil {
+		return err
+	}
+	ca, err := pki.LoadCA(caSecret.Data[corev1.TLSCertKey], caSecret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return err
+	}
+
+	commonName := instance.Spec.CommonName
+	if commonName == "" {
+		commonName = instance.Name
+	}
+	validity := pki.DefaultValidity
+	if instance.Spec.Validity != nil && instance.Spec.Validity.Duration > 0 {
+		validity = instance.Spec.Validity.Duration
+	}
+
+	var csr *x509.CertificateRequest
+	if instance.Spec.Request != "" {
+		csr, err = pki.ParseCertificateRequest([]byte(instance.Spec.Request))
+		if err != nil {
+			return fmt.Errorf("invalid certificate request: %v", err)
+		}
+	}
+
+	found := &corev1.Secret{}
+	err = r.Get(context.TODO(), types.NamespacedName{Name: secretName(instance), Namespace: instance.Namespace}, found)
+	exists := err == nil
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if exists && !metav1.IsControlledBy(found, instance) {
+		return fmt.Errorf("secret %v already exists", found.Name)
+	}
+
+	// A previous attempt failed to record the certificate, it is kept instead of issuing another
+	// one that the request would lose track of
+	if exists {
+		if cert := issuedCertificate(found, ca, commonName, csr); cert != nil {
+			logger.Info("Recording certificate", "namespace", instance.Namespace, "name", instance.Name, "serial", cert.SerialNumber.Text(16))
+			recordCertificate(instance, ca, cert)
+			return nil
+		}
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      secretName(instance),
+			Namespace: instance.Namespace,
+		},
+		Data: map[string][]byte{
+			"ca.crt": caSecret.Data[corev1.TLSCertKey],
+		},
+	}
+	var certPEM []byte
+	if csr != nil {
+		certPEM, err = ca.IssueFor(commonName, csr.PublicKey, validity)
+		if err != nil {
+			return err
+		}
+		secret.Type = corev1.SecretTypeOpaque
+	} else {
+		var keyPEM []byte
+		certPEM, keyPEM, err = ca.Issue(commonName, validity)
+		if err != nil {
+			return err
+		}
+		secret.Type = corev1.SecretTypeTLS
+		secret.Data[corev1.TLSPrivateKeyKey] = keyPEM
+	}
+	secret.Data[corev1.TLSCertKey] = certPEM
+	if err := controllerutil.SetControllerReference(instance, secret, r.scheme); err != nil {
+		return err
+	}
+
+	if !exists {
+		logger.Info("Creating Secret", "namespace", secret.Namespace, "name", secret.Name)
+		err = r.Create(context.TODO(), secret)
+	} else {
+		found.Type = secret.Type
+		found.Data = secret.Data
+		logger.Info("Updating Secret", "namespace", secret.Namespace, "name", secret.Name)
+		err = r.Update(context.TODO(), found)
+	}
+	if err != nil {
+		return err
+	}
+
+	cert, err := pki.ParseCertificate(certPEM)
+	if err != nil {
+		return err
+	}
+	recordCertificate(instance, ca, cert)
+	return nil
+}
+
+// issuedCertificate returns the certificate in secret if ca issued it for commonName and the key
+// of csr, or the key in secret if csr is nil, and it is still valid.
+func issuedCertificate(secret *corev1.Secret, ca *pki.CA, commonName string, csr *x509.CertificateRequest) *x509.Certificate {
+	cert, err := pki.ParseCertificate(secret.Data[corev1.TLSCertKey])
+	if err != nil || cert.CheckSignatureFrom(ca.Cert) != nil {
+		return nil
+	}
+	if cert.Subject.CommonName != commonName || !time.Now().Before(cert.NotAfter) {
+		return nil
+	}
+	if csr == nil {
+		if len(secret.Data[corev1.TLSPrivateKeyKey]) == 0 {
+			return nil
+		}
+		return cert
+	}
+	want, err := x509.MarshalPKIXPublicKey(csr.PublicKey)
+	if err != nil {
+		return nil
+	}
+	got, err := x509.MarshalPKIXPublicKey(cert.PublicKey)
+	if err != nil || !bytes.Equal(got, want) {
+		return nil
+	}
+	return cert
+}
+
+// recordCertificate records cert issued by ca in the status of the request.
+func recordCertificate(instance *infinimeshv1.DeviceCertificateRequest, ca *pki.CA, cert *x509.Certificate) {
+	notAfter := metav1.NewTime(cert.NotAfter.Local())
+	instance.Status.SerialNumber = cert.SerialNumber.Text(16)
+	instance.Status.Issuer = pki.HexFingerprint(ca.Cert)
+	instance.Status.Fingerprint = pki.HexFingerprint(cert)
+	instance.Status.NotAfter = &notAfter
+}
+
+func secretName(instance *infinimeshv1.DeviceCertificateRequest) string {
+	if instance.Spec.SecretName != "" {
+		return instance.Spec.SecretName
+	}
+	return instance.Name
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package devicecertificaterequest
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	infinimeshv1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1"
+	"github.com/infinimesh/operator/pkg/controller/controllertest"
+	"github.com/infinimesh/operator/pkg/controller/platform"
+	"github.com/infinimesh/operator/pkg/pki"
+)
+
+var request = reconcile.Request{NamespacedName: types.NamespacedName{Name: "sensor", Namespace: "default"}}
+
+// newTestReconciler returns a reconciler with the request sensor of the platform and its CA.
+func newTestReconciler(t *testing.T) (*ReconcileDeviceCertificateRequest, client.Client) {
+	env := controllertest.New(t, &infinimeshv1.DeviceCertificateRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: "sensor", Namespace: controllertest.Namespace},
+		Spec:       infinimeshv1.DeviceCertificateRequestSpec{Platform: controllertest.PlatformName},
+	})
+	env.EnableDeviceCA(t)
+	r := &ReconcileDeviceCertificateRequest{Client: env.Client, scheme: scheme.Scheme, recorder: env.Recorder}
+	return r, env.Client
+}
+
+func TestRevokeOnDelete(t *testing.T) {
+	r, c := newTestReconciler(t)
+
+	if _, err := r.Reconcile(request); err != nil {
+		t.Fatal(err)
+	}
+	instance := &infinimeshv1.DeviceCertificateRequest{}
+	if err := c.Get(context.TODO(), request.NamespacedName, instance); err != nil {
+		t.Fatal(err)
+	}
+	if instance.Status.SerialNumber == "" || len(instance.Finalizers) != 1 {
+		t.Fatalf("certificate wasn't issued: %+v", instance)
+	}
+
+	// The request is released right away, its certificate stays revoked
+	now := metav1.Now()
+	instance.DeletionTimestamp = &now
+	if err := c.Update(context.TODO(), instance); err != nil {
+		t.Fatal(err)
+	}
+	result, err := r.Reconcile(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Get(context.TODO(), request.NamespacedName, instance); err != nil {
+		t.Fatal(err)
+	}
+	if len(instance.Finalizers) != 0 || result.RequeueAfter != 0 {
+		t.Errorf("request is kept: finalizers %v, requeued after %v", instance.Finalizers, result.RequeueAfter)
+	}
+	revocations := &corev1.ConfigMap{}
+	if err := c.Get(context.TODO(), types.NamespacedName{Name: platform.DeviceRevocationsName("foo"), Namespace: "default"}, revocations); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := revocations.Data[instance.Status.Issuer+"."+instance.Status.SerialNumber]; !ok {
+		t.Errorf("certificate isn't revoked: %v", revocations.Data)
+	}
+}
+
+func TestKeepCertificateAfterFailedStatusUpdate(t *testing.T) {
+	r, c := newTestReconciler(t)
+
+	r.Client = controllertest.FailingStatus{Client: c}
+	if _, err := r.Reconcile(request); err == nil {
+		t.Fatal("status update didn't fail")
+	}
+	secret := &corev1.Secret{}
+	if err := c.Get(context.TODO(), request.NamespacedName, secret); err != nil {
+		t.Fatal(err)
+	}
+	issued, err := pki.ParseCertificate(secret.Data[corev1.TLSCertKey])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The retry records the certificate of the Secret, so deleting the request revokes it
+	r.Client = c
+	if _, err := r.Reconcile(request); err != nil {
+		t.Fatal(err)
+	}
+	instance := &infinimeshv1.DeviceCertificateRequest{}
+	if err := c.Get(context.TODO(), request.NamespacedName, instance); err != nil {
+		t.Fatal(err)
+	}
+	if instance.Status.SerialNumber != issued.SerialNumber.Text(16) {
+		t.Errorf("recorded certificate %v, the Secret holds %v", instance.Status.SerialNumber, issued.SerialNumber.Text(16))
+	}
+	if err := c.Get(context.TODO(), request.NamespacedName, secret); err != nil {
+		t.Fatal(err)
+	}
+	if cert, err := pki.ParseCertificate(secret.Data[corev1.TLSCertKey]); err != nil || cert.SerialNumber.Cmp(issued.SerialNumber) != 0 {
+		t.Errorf("the Secret holds another certificate: %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package finalizers manages the finalizers the controllers put on their objects.
+package finalizers
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Has reports whether obj has the finalizer name.
+func Has(obj metav1.Object, name string) bool {
+	for _, finalizer := range obj.GetFinalizers() {
+		if finalizer == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Add adds the finalizer name to obj unless it has it already.
+func Add(obj metav1.Object, name string) {
+	if !Has(obj, name) {
+		obj.SetFinalizers(append(obj.GetFinalizers(), name))
+	}
+}
+
+// Remove removes the finalizer name from obj.
+func Remove(obj metav1.Object, name string) {
+	var result []string
+	for _, finalizer := range obj.GetFinalizers() {
+		if finalizer != name {
+			result = append(result, finalizer)
+		}
+	}
+	obj.SetFinalizers(result)
+}
@@ -0,0 +1,42 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package finalizers
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFinalizers(t *testing.T) {
+	obj := &metav1.ObjectMeta{Finalizers: []string{"other"}}
+
+	Add(obj, "infinimesh.io/test")
+	Add(obj, "infinimesh.io/test")
+	if !reflect.DeepEqual(obj.Finalizers, []string{"other", "infinimesh.io/test"}) {
+		t.Errorf("finalizers after Add: %v", obj.Finalizers)
+	}
+	if !Has(obj, "infinimesh.io/test") {
+		t.Error("added finalizer is missing")
+	}
+
+	Remove(obj, "infinimesh.io/test")
+	if Has(obj, "infinimesh.io/test") || !Has(obj, "other") {
+		t.Errorf("finalizers after Remove: %v", obj.Finalizers)
+	}
+}
@@ -0,0 +1,630 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fleetrollout
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	infinimeshv1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1"
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+	"github.com/infinimesh/operator/pkg/clients"
+	"github.com/infinimesh/operator/pkg/registrypb"
+	"github.com/infinimesh/operator/pkg/shadowpb"
+)
+
+var logger = logf.Log.WithName("fleetrollout-controller")
+
+const (
+	phaseProgressing = "Progressing"
+	phaseHalted      = "Halted"
+	phaseSucceeded   = "Succeeded"
+	phaseRollingBack = "RollingBack"
+	phaseRolledBack  = "RolledBack"
+
+	// rpcTimeout bounds the calls to the device registry and the shadow API of a reconciliation
+	rpcTimeout = 30 * time.Second
+	// defaultBatchTimeout is how long the devices of a batch have by default
+	defaultBatchTimeout = 10 * time.Minute
+	// pollInterval is how often the reported state of the current batch is read
+	pollInterval = 15 * time.Second
+
+	// rolloutLabel is the label with the name of the rollout on its rollback ConfigMaps
+	rolloutLabel = "infinimesh.io/rollout"
+	// rollbackMaxSize keeps the rollback ConfigMap of a batch below the 1 MiB limit of objects
+	rollbackMaxSize = 900 * 1024
+)
+
+// Add creates a new FleetRollout Controller and adds it to the Manager. The Manager will set
+// fields on the Controller and Start it when the Manager is Started.
+func Add(mgr manager.Manager, opts controller.Options) error {
+	opts.Reconciler = newReconciler(mgr)
+	return add(mgr, opts)
+}
+
+// newReconciler returns a new reconcile.Reconciler
+func newReconciler(mgr manager.Manager) *ReconcileFleetRollout {
+	return &ReconcileFleetRollout{
+		Client:   mgr.GetClient(),
+		scheme:   mgr.GetScheme(),
+		recorder: mgr.GetRecorder("fleetrollout-controller"),
+		clients:  clients.NewFactory(mgr.GetClient()),
+	}
+}
+
+// add adds a new Controller to mgr with opts.Reconciler as the reconcile.Reconciler
+func add(mgr manager.Manager, opts controller.Options) error {
+	c, err := controller.New("fleetrollout-controller", mgr, opts)
+	if err != nil {
+		return err
+	}
+
+	err = c.Watch(&source.Kind{Type: &infinimeshv1.FleetRollout{}}, &handler.EnqueueRequestForObject{})
+	if err != nil {
+		return err
+	}
+
+	return c.Watch(&source.Kind{Type: &corev1.ConfigMap{}}, &handler.EnqueueRequestForOwner{
+		IsController: true,
+		OwnerType:    &infinimeshv1.FleetRollout{},
+	})
+}
+
+var _ reconcile.Reconciler = &ReconcileFleetRollout{}
+
+// ReconcileFleetRollout reconciles a FleetRollout object
+type ReconcileFleetRollout struct {
+	client.Client
+	scheme   *runtime.Scheme
+	recorder record.EventRecorder
+	// clients connects to the device registry and the shadow API of a platform
+	clients clients.Factory
+}
+
+// Reconcile patches the desired state of the selected devices batch by batch, waiting for each
+// batch to report it. The previous desired state of each device is kept in the ConfigMap
+// <rollout>-rollback-<batch> to roll back to.
+// +kubebuilder:rbac:groups=infinimesh.infinimesh.io,resources=infinimeshdevicestates,verbs=get;list;watch
+// +kubebuilder:rbac:groups=infinimesh.infinimesh.io,resources=fleetrollouts,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=infinimesh.infinimesh.io,resources=fleetrollouts/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+func (r *ReconcileFleetRollout) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	instance := &infinimeshv1.FleetRollout{}
+	err := r.Get(context.TODO(), request.NamespacedName, instance)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	status := instance.Status.DeepCopy()
+
+	result, err := r.rollout(instance)
+	if err != nil {
+		instance.Status.Message = err.Error()
+		r.recorder.Eventf(instance, corev1.EventTypeWarning, "RolloutFailed", "Failed to roll out: %v", err)
+	} else {
+		if instance.Status.Phase != phaseHalted {
+			instance.Status.Message = ""
+		}
+		instance.Status.ObservedGeneration = instance.Generation
+	}
+
+	if !reflect.DeepEqual(*status, instance.Status) {
+		if err := r.Status().Update(context.TODO(), instance); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+	return result, err
+}
+
+// rollout advances the rollout by a step.
+func (r *ReconcileFleetRollout) rollout(instance *infinimeshv1.FleetRollout) (reconcile.Result, error) {
+	s := &instance.Status
+	if s.Phase == "" {
+		s.Phase = phaseProgressing
+	}
+	rollingBack := instance.Spec.Rollback || s.Phase == phaseRollingBack || s.Phase == phaseHalted && instance.Spec.AutoRollback
+	if s.Phase == phaseRolledBack || !rollingBack && (s.Phase == phaseSucceeded || s.Phase == phaseHalted) {
+		return reconcile.Result{}, nil
+	}
+
+	p := &infinimeshv1beta1.Platform{}
+	err := r.Get(context.TODO(), types.NamespacedName{Name: instance.Spec.Platform, Namespace: instance.Namespace}, p)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	registry, registryConn, err := r.clients.DeviceRegistry(p)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	defer registryConn.Close()
+	shadows, shadowConn, err := r.clients.Shadows(p)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	defer shadowConn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+
+	if rollingBack {
+		return reconcile.Result{}, r.rollBack(ctx, instance, shadows)
+	}
+
+	var patch interface{}
+	if err := json.Unmarshal(instance.Spec.Patch.Raw, &patch); err != nil {
+		return reconcile.Result{}, fmt.Errorf("invalid patch: %v", err)
+	}
+	if _, ok := patch.(map[string]interface{}); !ok {
+		return reconcile.Result{}, fmt.Errorf("the patch must be a JSON object")
+	}
+
+	if len(s.BatchDevices) > 0 {
+		return r.evaluateBatch(ctx, instance, shadows, patch)
+	}
+
+	if s.NextBatchAt != nil {
+		if wait := time.Until(s.NextBatchAt.Time); wait > 0 {
+			return reconcile.Result{RequeueAfter: wait}, nil
+		}
+	}
+	return r.startBatch(ctx, instance, registry, shadows, patch)
+}
+
+// startBatch starts the next batch of devices that weren't patched yet. The batch is written to
+// the status before any device is patched, evaluateBatch then patches its devices.
+func (r *ReconcileFleetRollout) startBatch(ctx context.Context, instance *infinimeshv1.FleetRollout, registry registrypb.DevicesClient, shadows shadowpb.ShadowsClient, patch interface{}) (reconcile.Result, error) {
+	s := &instance.Status
+
+	devices, err := r.selectDevices(ctx, instance, registry, patch)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	s.Selected = int32(len(devices))
+
+	previous, err := r.rollbackPatches(instance)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	var remaining []string
+	for _, id := range devices {
+		if _, ok := previous[id]; !ok {
+			remaining = append(remaining, id)
+		}
+	}
+	if len(remaining) == 0 {
+		s.Phase = phaseSucceeded
+		s.NextBatchAt = nil
+		logger.Info("Rollout succeeded", "namespace", instance.Namespace, "name", instance.Name)
+		r.recorder.Eventf(instance, corev1.EventTypeNormal, "Succeeded", "Rolled out to %v devices, %v failed", s.Patched, s.Failed)
+		return reconcile.Result{}, nil
+	}
+
+	batch := batchSpec(instance, s.Batch)
+	size, err := intstr.GetValueFromIntOrPercent(&batch.Size, len(devices), true)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if size < 1 {
+		size = 1
+	}
+	if size > len(remaining) {
+		size = len(remaining)
+	}
+	ids := remaining[:size]
+
+	now := metav1.NewTime(time.Now().Local())
+	s.BatchDevices = ids
+	s.BatchStartedAt = &now
+	s.NextBatchAt = nil
+	s.Patched += int32(len(ids))
+	if err := r.Status().Update(context.TODO(), instance); err != nil {
+		return reconcile.Result{}, err
+	}
+	logger.Info("Started batch", "namespace", instance.Namespace, "name", instance.Name, "batch", s.Batch, "devices", len(ids))
+	r.recorder.Eventf(instance, corev1.EventTypeNormal, "BatchStarted", "Patching %v devices in batch %v", len(ids), s.Batch)
+	return r.evaluateBatch(ctx, instance, shadows, patch)
+}
+
+// evaluateBatch completes the current batch once its devices report the desired state, and halts
+// the rollout if too many didn't when the batch times out.
+func (r *ReconcileFleetRollout) evaluateBatch(ctx context.Context, instance *infinimeshv1.FleetRollout, shadows shadowpb.ShadowsClient, patch interface{}) (reconcile.Result, error) {
+	s := &instance.Status
+	batch := batchSpec(instance, s.Batch)
+
+	previous, err := r.rollbackConfigMap(instance, s.Batch)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	recorded := false
+	var unpatched []string
+
+	succeeded, gone := 0, 0
+	for _, id := range s.BatchDevices {
+		resp, err := shadows.Get(ctx, &shadowpb.GetRequest{Id: id})
+		if status.Code(err) == codes.NotFound {
+			// Deleted devices neither succeed nor fail
+			gone++
+			continue
+		}
+		if err != nil {
+			return reconcile.Result{}, fmt.Errorf("device %v: %v", id, err)
+		}
+		desired, err := desiredState(resp.Shadow)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if _, ok := previous.Data[id]; !ok {
+			data, err := json.Marshal(rollbackPatch(desired, patch))
+			if err != nil {
+				return reconcile.Result{}, err
+			}
+			previous.Data[id] = string(data)
+			recorded = true
+		}
+		reported, err := reportedState(resp.Shadow)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if matches(reported, patch) {
+			succeeded++
+			continue
+		}
+		if !matches(desired, patch) {
+			unpatched = append(unpatched, id)
+		}
+	}
+
+	// The previous desired state is recorded before any device is patched
+	if recorded {
+		size := 0
+		for id, data := range previous.Data {
+			size += len(id) + len(data)
+		}
+		if size > rollbackMaxSize {
+			return reconcile.Result{}, fmt.Errorf("the previous desired state of the %v devices of batch %v exceeds %v bytes, use smaller batches", len(s.BatchDevices), s.Batch, rollbackMaxSize)
+		}
+		if err := r.Update(context.TODO(), previous); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+	for _, id := range unpatched {
+		err := patchDevice(ctx, shadows, id, patch)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return reconcile.Result{}, fmt.Errorf("device %v: %v", id, err)
+		}
+	}
+
+	failed := len(s.BatchDevices) - succeeded - gone
+	threshold := 0
+	if batch.FailureThreshold != nil {
+		var err error
+		threshold, err = intstr.GetValueFromIntOrPercent(batch.FailureThreshold, len(s.BatchDevices), false)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+	timeout := defaultBatchTimeout
+	if batch.Timeout != nil && batch.Timeout.Duration > 0 {
+		timeout = batch.Timeout.Duration
+	}
+	timedOut := s.BatchStartedAt == nil || time.Since(s.BatchStartedAt.Time) > timeout
+
+	switch {
+	case failed == 0 || timedOut && failed <= threshold:
+		r.recorder.Eventf(instance, corev1.EventTypeNormal, "BatchSucceeded", "%v of %v devices of batch %v report the desired state", succeeded, len(s.BatchDevices), s.Batch)
+		s.Succeeded += int32(succeeded)
+		s.Failed += int32(failed)
+		s.Batch++
+		s.BatchDevices = nil
+		s.BatchStartedAt = nil
+		if batch.Pause != nil && batch.Pause.Duration > 0 {
+			next := metav1.NewTime(time.Now().Add(batch.Pause.Duration).Local())
+			s.NextBatchAt = &next
+			return reconcile.Result{RequeueAfter: batch.Pause.Duration}, nil
+		}
+		return reconcile.Result{Requeue: true}, nil
+	case timedOut:
+		s.Succeeded += int32(succeeded)
+		s.Failed += int32(failed)
+		s.Phase = phaseHalted
+		s.Message = fmt.Sprintf("%v of %v devices of batch %v did not report the desired state within %v", failed, len(s.BatchDevices), s.Batch, timeout)
+		logger.Info("Rollout halted", "namespace", instance.Namespace, "name", instance.Name, "batch", s.Batch, "failed", failed)
+		r.recorder.Event(instance, corev1.EventTypeWarning, "Halted", s.Message)
+		return reconcile.Result{Requeue: instance.Spec.AutoRollback}, nil
+	}
+	return reconcile.Result{RequeueAfter: pollInterval}, nil
+}
+
+// rollBack restores the previous desired state of all patched devices.
+func (r *ReconcileFleetRollout) rollBack(ctx context.Context, instance *infinimeshv1.FleetRollout, shadows shadowpb.ShadowsClient) error {
+	s := &instance.Status
+	s.Phase = phaseRollingBack
+
+	previous, err := r.rollbackPatches(instance)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]string, 0, len(previous))
+	for id := range previous {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		var rollback interface{}
+		if err := json.Unmarshal([]byte(previous[id]), &rollback); err != nil {
+			return fmt.Errorf("device %v: %v", id, err)
+		}
+		err := patchDevice(ctx, shadows, id, rollback)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return fmt.Errorf("device %v: %v", id, err)
+		}
+	}
+
+	s.Phase = phaseRolledBack
+	s.BatchDevices = nil
+	s.BatchStartedAt = nil
+	s.NextBatchAt = nil
+	logger.Info("Rolled back", "namespace", instance.Namespace, "name", instance.Name, "devices", len(ids))
+	r.recorder.Eventf(instance, corev1.EventTypeNormal, "RolledBack", "Restored the desired state of %v devices", len(ids))
+	return nil
+}
+
+// rollbackPatches returns the rollback patches of the devices patched by all batches so far.
+func (r *ReconcileFleetRollout) rollbackPatches(instance *infinimeshv1.FleetRollout) (map[string]string, error) {
+	list := &corev1.ConfigMapList{}
+	err := r.List(context.TODO(), client.InNamespace(instance.Namespace).MatchingLabels(map[string]string{rolloutLabel: instance.Name}), list)
+	if err != nil {
+		return nil, err
+	}
+	patches := map[string]string{}
+	for i := range list.Items {
+		if !metav1.IsControlledBy(&list.Items[i], instance) {
+			continue
+		}
+		for id, data := range list.Items[i].Data {
+			patches[id] = data
+		}
+	}
+	return patches, nil
+}
+
+// rollbackConfigMap returns the ConfigMap holding the rollback patches of the devices of batch,
+// creating it if necessary. Each batch has its own so that large fleets stay below the size limit
+// of a ConfigMap.
+func (r *ReconcileFleetRollout) rollbackConfigMap(instance *infinimeshv1.FleetRollout, batch int32) (*corev1.ConfigMap, error) {
+	name := fmt.Sprintf("%v-rollback-%v", instance.Name, batch)
+	found := &corev1.ConfigMap{}
+	err := r.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: instance.Namespace}, found)
+	if err == nil {
+		if found.Data == nil {
+			found.Data = map[string]string{}
+		}
+		return found, nil
+	}
+	if !errors.IsNotFound(err) {
+		return nil, err
+	}
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: instance.Namespace,
+			Labels:    map[string]string{rolloutLabel: instance.Name},
+		},
+		Data: map[string]string{},
+	}
+	if err := controllerutil.SetControllerReference(instance, cm, r.scheme); err != nil {
+		return nil, err
+	}
+	logger.Info("Creating ConfigMap", "namespace", cm.Namespace, "name", cm.Name)
+	if err := r.Create(context.TODO(), cm); err != nil {
+		return nil, err
+	}
+	return cm, nil
+}
+
+// batchSpec returns the batch with index i, the last batch is repeated.
+func batchSpec(instance *infinimeshv1.FleetRollout, i int32) infinimeshv1.FleetRolloutBatch {
+	batches := instance.Spec.Batches
+	if len(batches) == 0 {
+		return infinimeshv1.FleetRolloutBatch{Size: intstr.FromString("100%")}
+	}
+	if int(i) >= len(batches) {
+		return batches[len(batches)-1]
+	}
+	return batches[i]
+}
+
+// selectDevices returns the ids of the devices matched by the selector of instance, sorted.
+// Devices whose InfinimeshDeviceState manages keys of the patch are left out, the device state
+// would revert them.
+func (r *ReconcileFleetRollout) selectDevices(ctx context.Context, instance *infinimeshv1.FleetRollout, registry registrypb.DevicesClient, patch interface{}) ([]string, error) {
+	states := &infinimeshv1.InfinimeshDeviceStateList{}
+	if err := r.List(context.TODO(), &client.ListOptions{Namespace: instance.Namespace}, states); err != nil {
+		return nil, err
+	}
+	managed := map[string]bool{}
+	for _, state := range states.Items {
+		if state.Spec.Platform != instance.Spec.Platform || state.Status.Device == "" || state.Status.Applied == nil {
+			continue
+		}
+		var applied interface{}
+		if err := json.Unmarshal(state.Status.Applied.Raw, &applied); err != nil {
+			continue
+		}
+		if overlaps(applied, patch) {
+			managed[state.Status.Device] = true
+		}
+	}
+
+	selector := instance.Spec.Selector
+	resp, err := registry.List(ctx, &registrypb.ListDevicesRequest{Namespace: selector.Namespace})
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, device := range resp.Devices {
+		if hasTags(device.Tags, selector.Tags) && !managed[device.Id] {
+			ids = append(ids, device.Id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// overlaps reports whether the JSON merge patch sets or removes any key of state.
+func overlaps(state, patch interface{}) bool {
+	stateObject, ok := state.(map[string]interface{})
+	patchObject, ok2 := patch.(map[string]interface{})
+	if !ok || !ok2 {
+		return true
+	}
+	for key, value := range patchObject {
+		current, ok := stateObject[key]
+		if !ok {
+			continue
+		}
+		_, patchesObject := value.(map[string]interface{})
+		_, isObject := current.(map[string]interface{})
+		if !patchesObject || !isObject || overlaps(current, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasTags(tags, required []string) bool {
+	for _, tag := range required {
+		found := false
+		for _, t := range tags {
+			if t == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func patchDevice(ctx context.Context, shadows shadowpb.ShadowsClient, id string, patch interface{}) error {
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+	_, err = shadows.PatchDesiredState(ctx, &shadowpb.PatchDesiredStateRequest{Id: id, Data: &shadowpb.Value{JSON: data}})
+	return err
+}
+
+func desiredState(shadow *shadowpb.Shadow) (interface{}, error) {
+	if shadow == nil {
+		return nil, nil
+	}
+	return decodeState(shadow.Desired)
+}
+
+func reportedState(shadow *shadowpb.Shadow) (interface{}, error) {
+	if shadow == nil {
+		return nil, nil
+	}
+	return decodeState(shadow.Reported)
+}
+
+func decodeState(value *shadowpb.VersionedValue) (interface{}, error) {
+	if value == nil || value.Data == nil || len(value.Data.JSON) == 0 {
+		return nil, nil
+	}
+	var state interface{}
+	err := json.Unmarshal(value.Data.JSON, &state)
+	return state, err
+}
+
+// matches reports whether applying the JSON merge patch to state wouldn't change it.
+func matches(state, patch interface{}) bool {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return reflect.DeepEqual(state, patch)
+	}
+	stateObject, _ := state.(map[string]interface{})
+	for key, value := range patchObject {
+		current, ok := stateObject[key]
+		if value == nil {
+			if ok {
+				return false
+			}
+			continue
+		}
+		if !ok || !matches(current, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// rollbackPatch returns the JSON merge patch restoring the parts of state that patch changes.
+func rollbackPatch(state, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return state
+	}
+	stateObject, _ := state.(map[string]interface{})
+	result := map[string]interface{}{}
+	for key, value := range patchObject {
+		current, ok := stateObject[key]
+		if !ok {
+			result[key] = nil
+			continue
+		}
+		_, patchesObject := value.(map[string]interface{})
+		_, isObject := current.(map[string]interface{})
+		if patchesObject && isObject {
+			result[key] = rollbackPatch(current, value)
+		} else {
+			result[key] = current
+		}
+	}
+	return result
+}
@@ -0,0 +1,448 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fleetrollout
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	infinimeshv1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1"
+	"github.com/infinimesh/operator/pkg/clients/fake"
+	"github.com/infinimesh/operator/pkg/controller/controllertest"
+)
+
+func decode(t *testing.T, s string) interface{} {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+// apply applies the JSON merge patch to state.
+func apply(state, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	stateObject, ok := state.(map[string]interface{})
+	if !ok {
+		stateObject = map[string]interface{}{}
+	}
+	result := map[string]interface{}{}
+	for key, value := range stateObject {
+		result[key] = value
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(result, key)
+		} else {
+			result[key] = apply(result[key], value)
+		}
+	}
+	return result
+}
+
+func TestMatches(t *testing.T) {
+	for _, c := range []struct {
+		state, patch string
+		want         bool
+	}{
+		{`{"a":1,"b":{"c":2,"d":3}}`, `{"b":{"c":2}}`, true},
+		{`{"a":1}`, `{"a":2}`, false},
+		{`{"a":1}`, `{"b":null}`, true},
+		{`{"a":1}`, `{"a":null}`, false},
+		{`null`, `{"a":1}`, false},
+		{`{"a":[1,2]}`, `{"a":[1,2]}`, true},
+		{`{"a":[1,2]}`, `{"a":[1]}`, false},
+	} {
+		if got := matches(decode(t, c.state), decode(t, c.patch)); got != c.want {
+			t.Errorf("matches(%v, %v) = %v, want %v", c.state, c.patch, got, c.want)
+		}
+	}
+}
+
+func TestRollbackPatch(t *testing.T) {
+	for _, c := range []struct {
+		state, patch string
+	}{
+		{`{"a":1,"b":{"c":2,"d":3}}`, `{"b":{"c":4,"e":5}}`},
+		{`{"a":1}`, `{"a":{"b":2}}`},
+		{`{"a":{"b":2}}`, `{"a":3,"c":null}`},
+		{`null`, `{"a":1}`},
+		{`{"a":1,"b":2}`, `{"b":null}`},
+	} {
+		state := decode(t, c.state)
+		patch := decode(t, c.patch)
+
+		patched := apply(state, patch)
+		if !matches(patched, patch) {
+			t.Fatalf("%v patched with %v doesn't match the patch", c.state, c.patch)
+		}
+		restored := apply(patched, rollbackPatch(state, patch))
+		want := apply(state, map[string]interface{}{})
+		got, _ := json.Marshal(restored)
+		wantJSON, _ := json.Marshal(want)
+		if string(got) != string(wantJSON) {
+			t.Errorf("rolling back %v on %v gave %s, want %s", c.patch, c.state, got, wantJSON)
+		}
+	}
+}
+
+var request = reconcile.Request{NamespacedName: types.NamespacedName{Name: "firmware", Namespace: "default"}}
+
+// newTestReconciler returns a reconciler for the rollout firmware of patch to devices of the
+// infinimesh namespace joe of the platform foo, which has a device for each initial desired
+// state in devices.
+func newTestReconciler(t *testing.T, patch string, batches []infinimeshv1.FleetRolloutBatch, devices ...string) (*ReconcileFleetRollout, *fake.Platform, []string) {
+	env := controllertest.New(t)
+	var ids []string
+	for _, desired := range devices {
+		id := env.RegisterDevice(t, "sensor")
+		patchDesired(t, env.Data, id, desired)
+		ids = append(ids, id)
+	}
+	env.Create(t, &infinimeshv1.FleetRollout{
+		ObjectMeta: metav1.ObjectMeta{Name: "firmware", Namespace: controllertest.Namespace},
+		Spec: infinimeshv1.FleetRolloutSpec{
+			Platform: controllertest.PlatformName,
+			Selector: infinimeshv1.FleetRolloutSelector{Namespace: controllertest.InfinimeshNamespace},
+			Patch:    runtime.RawExtension{Raw: []byte(patch)},
+			Batches:  batches,
+		},
+	})
+	r := &ReconcileFleetRollout{Client: env.Client, scheme: scheme.Scheme, recorder: env.Recorder, clients: env.Clients}
+	return r, env.Data, ids
+}
+
+func patchDesired(t *testing.T, data *fake.Platform, id, patch string) {
+	if err := patchDevice(context.TODO(), data.Shadows(), id, decode(t, patch)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func getRollout(t *testing.T, r *ReconcileFleetRollout) *infinimeshv1.FleetRollout {
+	rollout := &infinimeshv1.FleetRollout{}
+	controllertest.Get(t, r, "firmware", rollout)
+	return rollout
+}
+
+func reconcileRollout(t *testing.T, r *ReconcileFleetRollout) *infinimeshv1.FleetRollout {
+	if _, err := r.Reconcile(request); err != nil {
+		t.Fatal(err)
+	}
+	return getRollout(t, r)
+}
+
+func TestRollout(t *testing.T) {
+	r, data, ids := newTestReconciler(t, `{"firmware":"2.0"}`, []infinimeshv1.FleetRolloutBatch{{Size: intstr.FromInt(1)}}, `{"firmware":"1.0"}`, `{"firmware":"1.0"}`)
+
+	rollout := reconcileRollout(t, r)
+	if len(rollout.Status.BatchDevices) != 1 || rollout.Status.BatchDevices[0] != ids[0] || rollout.Status.Patched != 1 {
+		t.Fatalf("first batch %+v", rollout.Status)
+	}
+	if desired := string(data.DesiredState(ids[1])); desired != `{"firmware":"1.0"}` {
+		t.Errorf("second device patched early: %v", desired)
+	}
+
+	for _, id := range ids {
+		if rollout.Status.Phase != phaseProgressing {
+			t.Fatalf("phase %v", rollout.Status.Phase)
+		}
+		if desired := string(data.DesiredState(id)); desired != `{"firmware":"2.0"}` {
+			t.Errorf("desired state of %v: %v", id, desired)
+		}
+		data.ReportState(id, []byte(`{"firmware":"2.0"}`))
+		reconcileRollout(t, r)
+		rollout = reconcileRollout(t, r)
+	}
+	if rollout.Status.Phase != phaseSucceeded || rollout.Status.Succeeded != 2 || rollout.Status.Failed != 0 {
+		t.Errorf("status %+v", rollout.Status)
+	}
+}
+
+// reportBatch has the devices of the current batch report the desired state.
+func reportBatch(data *fake.Platform, rollout *infinimeshv1.FleetRollout) {
+	for _, id := range rollout.Status.BatchDevices {
+		data.ReportState(id, data.DesiredState(id))
+	}
+}
+
+// timeOutBatch moves the start of the current batch back by d.
+func timeOutBatch(t *testing.T, r *ReconcileFleetRollout, d time.Duration) {
+	rollout := getRollout(t, r)
+	startedAt := metav1.NewTime(rollout.Status.BatchStartedAt.Add(-d))
+	rollout.Status.BatchStartedAt = &startedAt
+	if err := r.Status().Update(context.TODO(), rollout); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBatches(t *testing.T) {
+	pause := &metav1.Duration{Duration: time.Hour}
+	batches := []infinimeshv1.FleetRolloutBatch{
+		{Size: intstr.FromInt(1), Pause: pause},
+		{Size: intstr.FromString("50%")},
+	}
+	r, data, ids := newTestReconciler(t, `{"firmware":"2.0"}`, batches, `{}`, `{}`, `{}`, `{}`)
+
+	rollout := reconcileRollout(t, r)
+	if !reflect.DeepEqual(rollout.Status.BatchDevices, ids[:1]) || rollout.Status.Selected != 4 {
+		t.Fatalf("first batch %+v", rollout.Status)
+	}
+	reportBatch(data, rollout)
+
+	// The next batch waits for the pause
+	rollout = reconcileRollout(t, r)
+	if rollout.Status.Batch != 1 || rollout.Status.NextBatchAt == nil || len(rollout.Status.BatchDevices) != 0 {
+		t.Fatalf("pause %+v", rollout.Status)
+	}
+	result, err := r.Reconcile(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RequeueAfter <= 0 || result.RequeueAfter > time.Hour || len(getRollout(t, r).Status.BatchDevices) != 0 {
+		t.Fatalf("batch started during the pause, requeued after %v", result.RequeueAfter)
+	}
+	if desired := string(data.DesiredState(ids[1])); desired != `{}` {
+		t.Errorf("device patched during the pause: %v", desired)
+	}
+
+	// The rollout resumes after the pause, the last batch is repeated
+	rollout = getRollout(t, r)
+	past := metav1.NewTime(time.Now().Add(-time.Minute))
+	rollout.Status.NextBatchAt = &past
+	if err := r.Status().Update(context.TODO(), rollout); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range [][]string{ids[1:3], ids[3:]} {
+		rollout = reconcileRollout(t, r)
+		if !reflect.DeepEqual(rollout.Status.BatchDevices, want) {
+			t.Fatalf("batch %v has devices %v, want %v", rollout.Status.Batch, rollout.Status.BatchDevices, want)
+		}
+		reportBatch(data, rollout)
+		reconcileRollout(t, r)
+	}
+	rollout = reconcileRollout(t, r)
+	if rollout.Status.Phase != phaseSucceeded || rollout.Status.Batch != 3 || rollout.Status.Patched != 4 || rollout.Status.Succeeded != 4 {
+		t.Errorf("status %+v", rollout.Status)
+	}
+}
+
+func TestHalt(t *testing.T) {
+	for _, c := range []struct {
+		threshold intstr.IntOrString
+		phase     string
+	}{
+		{intstr.FromInt(0), phaseHalted},
+		{intstr.FromString("50%"), phaseSucceeded},
+	} {
+		threshold := c.threshold
+		batches := []infinimeshv1.FleetRolloutBatch{{Size: intstr.FromInt(2), FailureThreshold: &threshold}}
+		r, data, ids := newTestReconciler(t, `{"firmware":"2.0"}`, batches, `{}`, `{}`)
+
+		reconcileRollout(t, r)
+		data.ReportState(ids[0], []byte(`{"firmware":"2.0"}`))
+		if rollout := reconcileRollout(t, r); rollout.Status.Phase != phaseProgressing {
+			t.Fatalf("phase %v before the timeout", rollout.Status.Phase)
+		}
+
+		timeOutBatch(t, r, defaultBatchTimeout)
+		reconcileRollout(t, r)
+		rollout := reconcileRollout(t, r)
+		if rollout.Status.Phase != c.phase || rollout.Status.Succeeded != 1 || rollout.Status.Failed != 1 {
+			t.Errorf("threshold %v: status %+v", c.threshold.String(), rollout.Status)
+		}
+		if c.phase == phaseHalted && rollout.Status.Message == "" {
+			t.Error("halted without a message")
+		}
+		// Without autoRollback the devices keep the patch
+		if desired := string(data.DesiredState(ids[1])); desired != `{"firmware":"2.0"}` {
+			t.Errorf("threshold %v: desired state %v", c.threshold.String(), desired)
+		}
+	}
+}
+
+func TestRollback(t *testing.T) {
+	r, data, ids := newTestReconciler(t, `{"firmware":"2.0","led":null}`, []infinimeshv1.FleetRolloutBatch{{Size: intstr.FromInt(1)}},
+		`{"firmware":"1.0","interval":10,"led":"red"}`, `{"interval":5}`)
+
+	rollout := reconcileRollout(t, r)
+	if desired := string(data.DesiredState(ids[0])); desired != `{"firmware":"2.0","interval":10}` {
+		t.Fatalf("desired state %v", desired)
+	}
+	rollout.Spec.Rollback = true
+	if err := r.Update(context.TODO(), rollout); err != nil {
+		t.Fatal(err)
+	}
+	rollout = reconcileRollout(t, r)
+	if rollout.Status.Phase != phaseRolledBack || len(rollout.Status.BatchDevices) != 0 {
+		t.Errorf("status %+v", rollout.Status)
+	}
+	if desired := string(data.DesiredState(ids[0])); desired != `{"firmware":"1.0","interval":10,"led":"red"}` {
+		t.Errorf("desired state %v wasn't restored", desired)
+	}
+	if desired := string(data.DesiredState(ids[1])); desired != `{"interval":5}` {
+		t.Errorf("device of no batch rolled back to %v", desired)
+	}
+
+	// Rolled back rollouts stay rolled back
+	rollout = reconcileRollout(t, r)
+	if rollout.Status.Phase != phaseRolledBack {
+		t.Errorf("phase %v", rollout.Status.Phase)
+	}
+}
+
+func TestAutoRollback(t *testing.T) {
+	r, data, ids := newTestReconciler(t, `{"firmware":"2.0"}`, []infinimeshv1.FleetRolloutBatch{{Size: intstr.FromInt(1)}}, `{"firmware":"1.0"}`, `{"firmware":"1.0"}`)
+	rollout := getRollout(t, r)
+	rollout.Spec.AutoRollback = true
+	if err := r.Update(context.TODO(), rollout); err != nil {
+		t.Fatal(err)
+	}
+
+	reconcileRollout(t, r)
+	timeOutBatch(t, r, defaultBatchTimeout)
+	result, err := r.Reconcile(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if phase := getRollout(t, r).Status.Phase; phase != phaseHalted || !result.Requeue {
+		t.Fatalf("phase %v, requeue %v", phase, result.Requeue)
+	}
+	rollout = reconcileRollout(t, r)
+	if rollout.Status.Phase != phaseRolledBack {
+		t.Errorf("phase %v", rollout.Status.Phase)
+	}
+	for _, id := range ids {
+		if desired := string(data.DesiredState(id)); desired != `{"firmware":"1.0"}` {
+			t.Errorf("desired state of %v: %v", id, desired)
+		}
+	}
+}
+
+func TestResumeAfterFailedStatusUpdate(t *testing.T) {
+	r, data, ids := newTestReconciler(t, `{"firmware":"2.0"}`, []infinimeshv1.FleetRolloutBatch{{Size: intstr.FromInt(1)}}, `{"firmware":"1.0"}`, `{"firmware":"1.0"}`)
+	c := r.Client
+	r.Client = controllertest.FailingStatus{Client: c}
+	if _, err := r.Reconcile(request); err == nil {
+		t.Fatal("status update didn't fail")
+	}
+	r.Client = c
+	if desired := string(data.DesiredState(ids[0])); desired != `{"firmware":"1.0"}` {
+		t.Errorf("device patched without a batch: %v", desired)
+	}
+
+	rollout := reconcileRollout(t, r)
+	if !reflect.DeepEqual(rollout.Status.BatchDevices, ids[:1]) || rollout.Status.Patched != 1 {
+		t.Fatalf("status %+v", rollout.Status)
+	}
+	if desired := string(data.DesiredState(ids[0])); desired != `{"firmware":"2.0"}` {
+		t.Errorf("desired state %v", desired)
+	}
+	previous := &corev1.ConfigMap{}
+	if err := r.Get(context.TODO(), types.NamespacedName{Name: "firmware-rollback-0", Namespace: "default"}, previous); err != nil {
+		t.Fatal(err)
+	}
+	if rollback := previous.Data[ids[0]]; rollback != `{"firmware":"1.0"}` {
+		t.Errorf("rollback %v", rollback)
+	}
+}
+
+func TestSkipDevicesOfDeviceStates(t *testing.T) {
+	r, data, ids := newTestReconciler(t, `{"led":{"color":"green"}}`, nil, `{"led":{"color":"red"}}`, `{"led":{"color":"red"}}`, `{}`)
+	for i, applied := range []string{`{"led":{"color":"red"}}`, `{"interval":10,"led":{"brightness":5}}`} {
+		state := &infinimeshv1.InfinimeshDeviceState{
+			ObjectMeta: metav1.ObjectMeta{Name: ids[i], Namespace: "default"},
+			Spec:       infinimeshv1.InfinimeshDeviceStateSpec{Platform: "foo", Device: ids[i]},
+			Status: infinimeshv1.InfinimeshDeviceStateStatus{
+				Device:  ids[i],
+				Applied: &runtime.RawExtension{Raw: []byte(applied)},
+			},
+		}
+		if err := r.Create(context.TODO(), state); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The device state of the first device manages the patched key, the other one doesn't
+	rollout := reconcileRollout(t, r)
+	if !reflect.DeepEqual(rollout.Status.BatchDevices, ids[1:]) || rollout.Status.Selected != 2 {
+		t.Errorf("status %+v", rollout.Status)
+	}
+	if desired := string(data.DesiredState(ids[0])); desired != `{"led":{"color":"red"}}` {
+		t.Errorf("managed device patched: %v", desired)
+	}
+}
+
+func TestRollbackBatches(t *testing.T) {
+	r, data, ids := newTestReconciler(t, `{"firmware":"2.0"}`, []infinimeshv1.FleetRolloutBatch{{Size: intstr.FromInt(1)}}, `{"firmware":"1.0"}`, `{"firmware":"1.1"}`)
+
+	for range ids {
+		reportBatch(data, reconcileRollout(t, r))
+		reconcileRollout(t, r)
+	}
+	for i, id := range ids {
+		previous := &corev1.ConfigMap{}
+		if err := r.Get(context.TODO(), types.NamespacedName{Name: fmt.Sprintf("firmware-rollback-%v", i), Namespace: "default"}, previous); err != nil {
+			t.Fatal(err)
+		}
+		if len(previous.Data) != 1 || previous.Data[id] == "" {
+			t.Errorf("batch %v recorded %v", i, previous.Data)
+		}
+	}
+
+	rollout := getRollout(t, r)
+	rollout.Spec.Rollback = true
+	if err := r.Update(context.TODO(), rollout); err != nil {
+		t.Fatal(err)
+	}
+	reconcileRollout(t, r)
+	for id, want := range map[string]string{ids[0]: `{"firmware":"1.0"}`, ids[1]: `{"firmware":"1.1"}`} {
+		if desired := string(data.DesiredState(id)); desired != want {
+			t.Errorf("desired state %v, want %v", desired, want)
+		}
+	}
+}
+
+func TestRollbackTooLarge(t *testing.T) {
+	blob := strings.Repeat("x", rollbackMaxSize)
+	r, data, ids := newTestReconciler(t, `{"blob":null}`, []infinimeshv1.FleetRolloutBatch{{Size: intstr.FromInt(1)}}, `{"blob":"`+blob+`"}`)
+
+	if _, err := r.Reconcile(request); err == nil {
+		t.Fatal("recorded a rollback larger than a ConfigMap")
+	}
+	if rollout := getRollout(t, r); rollout.Status.Message == "" {
+		t.Error("the rollout doesn't report the failure")
+	}
+	if desired := string(data.DesiredState(ids[0])); desired != `{"blob":"`+blob+`"}` {
+		t.Error("device patched without a rollback")
+	}
+}
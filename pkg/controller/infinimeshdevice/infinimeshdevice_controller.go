@@ -0,0 +1,508 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package infinimeshdevice
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/genproto/protobuf/field_mask"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	infinimeshv1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1"
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+	"github.com/infinimesh/operator/pkg/clients"
+	"github.com/infinimesh/operator/pkg/controller/finalizers"
+	"github.com/infinimesh/operator/pkg/controller/platform"
+	"github.com/infinimesh/operator/pkg/pki"
+	"github.com/infinimesh/operator/pkg/registrypb"
+)
+
+var logger = logf.Log.WithName("infinimeshdevice-controller")
+
+const (
+	// finalizer removes the device from the registry before the object is deleted
+	finalizer = "infinimesh.io/device-registry"
+	// registryTimeout bounds each call to the device registry
+	registryTimeout = 10 * time.Second
+)
+
+// Add creates a new InfinimeshDevice Controller and adds it to the Manager. The Manager will set
+// fields on the Controller and Start it when the Manager is Started.
+func Add(mgr manager.Manager, opts controller.Options) error {
+	opts.Reconciler = newReconciler(mgr)
+	return add(mgr, opts)
+}
+
+// newReconciler returns a new reconcile.Reconciler
+func newReconciler(mgr manager.Manager) *ReconcileInfinimeshDevice {
+	return &ReconcileInfinimeshDevice{
+		Client:   mgr.GetClient(),
+		scheme:   mgr.GetScheme(),
+		recorder: mgr.GetRecorder("infinimeshdevice-controller"),
+		clients:  clients.NewFactory(mgr.GetClient()),
+	}
+}
+
+// add adds a new Controller to mgr with opts.Reconciler as the reconcile.Reconciler
+func add(mgr manager.Manager, opts controller.Options) error {
+	c, err := controller.New("infinimeshdevice-controller", mgr, opts)
+	if err != nil {
+		return err
+	}
+
+	err = c.Watch(&source.Kind{Type: &infinimeshv1.InfinimeshDevice{}}, &handler.EnqueueRequestForObject{})
+	if err != nil {
+		return err
+	}
+
+	// Generated certificates
+	err = c.Watch(&source.Kind{Type: &corev1.Secret{}}, &handler.EnqueueRequestForOwner{
+		IsController: true,
+		OwnerType:    &infinimeshv1.InfinimeshDevice{},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Certificates provided by the user and the device CA
+	return c.Watch(&source.Kind{Type: &corev1.Secret{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(func(o handler.MapObject) []reconcile.Request {
+			return devicesUsingSecret(mgr.GetClient(), o.Meta)
+		}),
+	})
+}
+
+// devicesUsingSecret returns the devices whose certificate is read from secret or issued by the
+// device CA in secret.
+func devicesUsingSecret(c client.Client, secret metav1.Object) []reconcile.Request {
+	devices := &infinimeshv1.InfinimeshDeviceList{}
+	if err := c.List(context.TODO(), &client.ListOptions{Namespace: secret.GetNamespace()}, devices); err != nil {
+		logger.Error(err, "Failed to list devices", "namespace", secret.GetNamespace())
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, device := range devices.Items {
+		source := device.Spec.Certificate
+		if (source.Secret != nil && source.Secret.Name == secret.GetName()) ||
+			(source.Generate != nil && platform.DeviceCASecretName(device.Spec.Platform) == secret.GetName()) {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: device.Name, Namespace: device.Namespace},
+			})
+		}
+	}
+	return requests
+}
+
+var _ reconcile.Reconciler = &ReconcileInfinimeshDevice{}
+
+// ReconcileInfinimeshDevice reconciles an InfinimeshDevice object
+type ReconcileInfinimeshDevice struct {
+	client.Client
+	scheme   *runtime.Scheme
+	recorder record.EventRecorder
+	// clients connects to the device registry of a platform
+	clients clients.Factory
+}
+
+// Reconcile registers the device with the device registry of its platform and keeps the
+// registration up to date with the spec.
+// +kubebuilder:rbac:groups=infinimesh.infinimesh.io,resources=infinimeshdevices,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=infinimesh.infinimesh.io,resources=infinimeshdevices/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+func (r *ReconcileInfinimeshDevice) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	instance := &infinimeshv1.InfinimeshDevice{}
+	err := r.Get(context.TODO(), request.NamespacedName, instance)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	if instance.DeletionTimestamp != nil {
+		return reconcile.Result{}, r.finalize(instance)
+	}
+
+	if !finalizers.Has(instance, finalizer) {
+		finalizers.Add(instance, finalizer)
+		if err := r.Update(context.TODO(), instance); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	status := instance.Status.DeepCopy()
+
+	result, err := r.register(instance)
+	if err != nil {
+		instance.Status.Message = err.Error()
+		r.recorder.Eventf(instance, corev1.EventTypeWarning, "RegistrationFailed", "Failed to register device: %v", err)
+	} else {
+		instance.Status.Message = ""
+		instance.Status.ObservedGeneration = instance.Generation
+	}
+
+	if !reflect.DeepEqual(*status, instance.Status) {
+		if err := r.Status().Update(context.TODO(), instance); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+	return result, err
+}
+
+// register creates the device in the registry, or updates it if the spec or the certificate
+// changed since it was last registered. Generated certificates are renewed once they are due.
+func (r *ReconcileInfinimeshDevice) register(instance *infinimeshv1.InfinimeshDevice) (reconcile.Result, error) {
+	log := logger.WithValues("namespace", instance.Namespace, "name", instance.Name)
+
+	p := &infinimeshv1beta1.Platform{}
+	err := r.Get(context.TODO(), types.NamespacedName{Name: instance.Spec.Platform, Namespace: instance.Namespace}, p)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	cert, err := r.certificate(instance, p)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	fp, err := pki.Fingerprint(cert)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	fingerprint := hex.EncodeToString(fp)
+
+	result := reconcile.Result{}
+	if instance.Spec.Certificate.Generate != nil {
+		issued, err := pki.ParseCertificate(cert)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		result.RequeueAfter = time.Until(renewalTime(issued))
+	}
+
+	registry, conn, err := r.clients.DeviceRegistry(p)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), registryTimeout)
+	defer cancel()
+
+	if instance.Status.ID != "" {
+		resp, err := registry.Get(ctx, &registrypb.GetRequest{Id: instance.Status.ID})
+		switch {
+		case status.Code(err) == codes.NotFound:
+			log.Info("Device is gone from the registry, registering it again", "id", instance.Status.ID)
+			instance.Status.ID = ""
+		case err != nil:
+			return reconcile.Result{}, err
+		case resp.Device != nil && resp.Device.Namespace != "" && resp.Device.Namespace != instance.Spec.Namespace:
+			// Devices can't be moved between namespaces
+			log.Info("Namespace changed, registering the device again", "id", instance.Status.ID)
+			_, err := registry.Delete(ctx, &registrypb.DeleteRequest{Id: instance.Status.ID})
+			if err != nil && status.Code(err) != codes.NotFound {
+				return reconcile.Result{}, err
+			}
+			instance.Status.ID = ""
+		}
+	}
+
+	device := &registrypb.Device{
+		Id:        instance.Status.ID,
+		Name:      deviceName(instance),
+		Namespace: instance.Spec.Namespace,
+		Tags:      instance.Spec.Tags,
+		Enabled:   &wrappers.BoolValue{Value: enabled(instance)},
+		Certificate: &registrypb.Certificate{
+			PemData:     string(cert),
+			Fingerprint: fp,
+		},
+	}
+
+	if device.Id == "" {
+		// The id is only kept in the status, a registration whose status update failed is
+		// found in the registry instead of registering the device twice
+		id, err := findRegistered(ctx, registry, device)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if id != "" {
+			log.Info("Found the device in the registry", "id", id)
+			instance.Status.ID = id
+			device.Id = id
+		}
+	}
+
+	if device.Id == "" {
+		resp, err := registry.Create(ctx, &registrypb.CreateRequest{Device: device})
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if resp.Device == nil || resp.Device.Id == "" {
+			return reconcile.Result{}, fmt.Errorf("registry returned no device id")
+		}
+		instance.Status.ID = resp.Device.Id
+		instance.Status.Fingerprint = fingerprint
+		log.Info("Registered device", "id", instance.Status.ID)
+		r.recorder.Eventf(instance, corev1.EventTypeNormal, "Registered", "Registered device %v", instance.Status.ID)
+		return result, nil
+	}
+
+	if instance.Status.ObservedGeneration == instance.Generation && instance.Status.Fingerprint == fingerprint {
+		return result, nil
+	}
+	_, err = registry.Update(ctx, &registrypb.UpdateRequest{
+		Device:    device,
+		FieldMask: &field_mask.FieldMask{Paths: []string{"name", "enabled", "tags", "certificate"}},
+	})
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	instance.Status.Fingerprint = fingerprint
+	log.Info("Updated device", "id", instance.Status.ID)
+	r.recorder.Eventf(instance, corev1.EventTypeNormal, "Updated", "Updated device %v", instance.Status.ID)
+	return result, nil
+}
+
+// findRegistered returns the id of the device in the registry with the name and the certificate
+// of device, or "" if there is none.
+func findRegistered(ctx context.Context, registry registrypb.DevicesClient, device *registrypb.Device) (string, error) {
+	resp, err := registry.List(ctx, &registrypb.ListDevicesRequest{Namespace: device.Namespace})
+	if err != nil {
+		return "", err
+	}
+	for _, registered := range resp.Devices {
+		if registered.Name == device.Name && registered.Certificate != nil && bytes.Equal(registered.Certificate.Fingerprint, device.Certificate.Fingerprint) {
+			return registered.Id, nil
+		}
+	}
+	return "", nil
+}
+
+// finalize deletes the device from the registry, revokes its certificate if it was issued by
+// the operator and releases the object. Nothing is done if the platform is gone, its registry
+// and CA go with it.
+func (r *ReconcileInfinimeshDevice) finalize(instance *infinimeshv1.InfinimeshDevice) error {
+	if !finalizers.Has(instance, finalizer) {
+		return nil
+	}
+
+	p := &infinimeshv1beta1.Platform{}
+	err := r.Get(context.TODO(), types.NamespacedName{Name: instance.Spec.Platform, Namespace: instance.Namespace}, p)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if err == nil && p.DeletionTimestamp == nil {
+		if instance.Status.ID != "" {
+			if err := r.deregister(instance, p); err != nil {
+				return err
+			}
+		}
+		if err := r.revokeCertificate(instance, p); err != nil {
+			return err
+		}
+	}
+
+	finalizers.Remove(instance, finalizer)
+	return r.Update(context.TODO(), instance)
+}
+
+// deregister deletes the device from the registry of p.
+func (r *ReconcileInfinimeshDevice) deregister(instance *infinimeshv1.InfinimeshDevice, p *infinimeshv1beta1.Platform) error {
+	registry, conn, err := r.clients.DeviceRegistry(p)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), registryTimeout)
+	defer cancel()
+	_, err = registry.Delete(ctx, &registrypb.DeleteRequest{Id: instance.Status.ID})
+	if err != nil && status.Code(err) != codes.NotFound {
+		r.recorder.Eventf(instance, corev1.EventTypeWarning, "DeletionFailed", "Failed to delete device %v: %v", instance.Status.ID, err)
+		return err
+	}
+	logger.Info("Deleted device", "namespace", instance.Namespace, "name", instance.Name, "id", instance.Status.ID)
+	return nil
+}
+
+// revokeCertificate puts the certificate the operator issued for the device on the revocation
+// lists of p.
+func (r *ReconcileInfinimeshDevice) revokeCertificate(instance *infinimeshv1.InfinimeshDevice, p *infinimeshv1beta1.Platform) error {
+	if instance.Spec.Certificate.Generate == nil {
+		return nil
+	}
+	secret := &corev1.Secret{}
+	err := r.Get(context.TODO(), types.NamespacedName{Name: certificateSecretName(instance), Namespace: instance.Namespace}, secret)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	cert, err := pki.ParseCertificate(secret.Data[corev1.TLSCertKey])
+	if err != nil {
+		return nil
+	}
+	ca, err := pki.ParseCertificate(secret.Data["ca.crt"])
+	if err != nil {
+		return nil
+	}
+	serial := cert.SerialNumber.Text(16)
+	if err := platform.RevokeDeviceCertificate(r.Client, r.scheme, p, pki.HexFingerprint(ca), serial, cert.NotAfter); err != nil {
+		return err
+	}
+	logger.Info("Revoked certificate", "namespace", instance.Namespace, "name", instance.Name, "serial", serial)
+	return nil
+}
+
+// certificate returns the PEM encoded certificate of the device, issuing it first if it is
+// generated by the operator.
+func (r *ReconcileInfinimeshDevice) certificate(instance *infinimeshv1.InfinimeshDevice, p *infinimeshv1beta1.Platform) ([]byte, error) {
+	source := instance.Spec.Certificate
+	if (source.Secret == nil) == (source.Generate == nil) {
+		return nil, fmt.Errorf("exactly one of certificate.secret and certificate.generate must be set")
+	}
+
+	if source.Secret != nil {
+		key := source.Secret.Key
+		if key == "" {
+			key = corev1.TLSCertKey
+		}
+		secret := &corev1.Secret{}
+		err := r.Get(context.TODO(), types.NamespacedName{Name: source.Secret.Name, Namespace: instance.Namespace}, secret)
+		if err != nil {
+			return nil, err
+		}
+		cert, ok := secret.Data[key]
+		if !ok {
+			return nil, fmt.Errorf("secret %v has no key %v", source.Secret.Name, key)
+		}
+		return cert, nil
+	}
+
+	name := certificateSecretName(instance)
+	found := &corev1.Secret{}
+	err := r.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: instance.Namespace}, found)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	exists := err == nil
+
+	if !p.Spec.DeviceCA.Enabled {
+		return nil, fmt.Errorf("the device CA of platform %v is not enabled", p.Name)
+	}
+	caSecret := &corev1.Secret{}
+	err = r.Get(context.TODO(), types.NamespacedName{Name: platform.DeviceCASecretName(p.Name), Namespace: p.Namespace}, caSecret)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := pki.LoadCA(caSecret.Data[corev1.TLSCertKey], caSecret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return nil, err
+	}
+
+	// The certificate is issued again once it is due for renewal or the CA was rotated, the
+	// previous one stays valid until it or the previous CA expires
+	if exists {
+		if cert, err := pki.ParseCertificate(found.Data[corev1.TLSCertKey]); err == nil && cert.CheckSignatureFrom(ca.Cert) == nil && time.Now().Before(renewalTime(cert)) {
+			return found.Data[corev1.TLSCertKey], nil
+		}
+	}
+	validity := pki.DefaultValidity
+	if source.Generate.Validity != nil {
+		validity = source.Generate.Validity.Duration
+	}
+	cert, key, err := ca.Issue(deviceName(instance), validity)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: instance.Namespace,
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       cert,
+			corev1.TLSPrivateKeyKey: key,
+			"ca.crt":                caSecret.Data[corev1.TLSCertKey],
+		},
+	}
+	if err := controllerutil.SetControllerReference(instance, secret, r.scheme); err != nil {
+		return nil, err
+	}
+	if !exists {
+		logger.Info("Creating Secret", "namespace", secret.Namespace, "name", secret.Name)
+		err = r.Create(context.TODO(), secret)
+	} else {
+		found.Type = secret.Type
+		found.Data = secret.Data
+		logger.Info("Updating Secret", "namespace", secret.Namespace, "name", secret.Name)
+		err = r.Update(context.TODO(), found)
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.recorder.Eventf(instance, corev1.EventTypeNormal, "CertificateIssued", "Issued a certificate into Secret %v", name)
+	return cert, nil
+}
+
+// renewalTime returns when cert is renewed, once two thirds of its validity passed.
+func renewalTime(cert *x509.Certificate) time.Time {
+	return cert.NotAfter.Add(-cert.NotAfter.Sub(cert.NotBefore) / 3)
+}
+
+// certificateSecretName returns the name of the Secret of a generated certificate.
+func certificateSecretName(instance *infinimeshv1.InfinimeshDevice) string {
+	return instance.Name + "-device-cert"
+}
+
+func deviceName(instance *infinimeshv1.InfinimeshDevice) string {
+	if instance.Spec.Name != "" {
+		return instance.Spec.Name
+	}
+	return instance.Name
+}
+
+func enabled(instance *infinimeshv1.InfinimeshDevice) bool {
+	return instance.Spec.Enabled == nil || *instance.Spec.Enabled
+}
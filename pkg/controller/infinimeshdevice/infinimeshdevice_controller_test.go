@@ -0,0 +1,237 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package infinimeshdevice
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	infinimeshv1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1"
+	"github.com/infinimesh/operator/pkg/controller/controllertest"
+	"github.com/infinimesh/operator/pkg/controller/platform"
+	"github.com/infinimesh/operator/pkg/pki"
+	"github.com/infinimesh/operator/pkg/registrypb"
+)
+
+var request = reconcile.Request{NamespacedName: types.NamespacedName{Name: "sensor", Namespace: "default"}}
+
+// newTestReconciler returns a reconciler for the device sensor, which has a certificate issued
+// by the device CA of the platform and belongs to its infinimesh namespace.
+func newTestReconciler(t *testing.T) (*ReconcileInfinimeshDevice, *controllertest.Env) {
+	env := controllertest.New(t, &infinimeshv1.InfinimeshDevice{
+		ObjectMeta: metav1.ObjectMeta{Name: "sensor", Namespace: controllertest.Namespace},
+		Spec: infinimeshv1.InfinimeshDeviceSpec{
+			Platform:    controllertest.PlatformName,
+			Namespace:   controllertest.InfinimeshNamespace,
+			Certificate: infinimeshv1.InfinimeshDeviceCertificate{Generate: &infinimeshv1.InfinimeshDeviceCertificateGenerate{}},
+		},
+	})
+	env.EnableDeviceCA(t)
+	r := &ReconcileInfinimeshDevice{Client: env.Client, scheme: scheme.Scheme, recorder: env.Recorder, clients: env.Clients}
+	return r, env
+}
+
+func getDevice(t *testing.T, r *ReconcileInfinimeshDevice) *infinimeshv1.InfinimeshDevice {
+	device := &infinimeshv1.InfinimeshDevice{}
+	controllertest.Get(t, r, "sensor", device)
+	return device
+}
+
+func TestRegister(t *testing.T) {
+	r, env := newTestReconciler(t)
+	registry := env.Data.DeviceRegistry()
+
+	if _, err := r.Reconcile(request); err != nil {
+		t.Fatal(err)
+	}
+	device := getDevice(t, r)
+	if device.Status.ID == "" {
+		t.Fatalf("device isn't registered: %+v", device.Status)
+	}
+	registered, err := registry.Get(context.TODO(), &registrypb.GetRequest{Id: device.Status.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if registered.Device.Name != "sensor" || registered.Device.Namespace != "joe" || !registered.Device.Enabled.Value {
+		t.Errorf("registered %v", registered.Device)
+	}
+	if hex.EncodeToString(registered.Device.Certificate.Fingerprint) != device.Status.Fingerprint {
+		t.Errorf("registered fingerprint %x, status %v", registered.Device.Certificate.Fingerprint, device.Status.Fingerprint)
+	}
+
+	// Disabling the device updates it in place
+	disabled := false
+	device.Spec.Enabled = &disabled
+	device.Generation++
+	if err := r.Update(context.TODO(), device); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(request); err != nil {
+		t.Fatal(err)
+	}
+	if id := getDevice(t, r).Status.ID; id != device.Status.ID {
+		t.Errorf("device registered again as %v", id)
+	}
+	registered, err = registry.Get(context.TODO(), &registrypb.GetRequest{Id: device.Status.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if registered.Device.Enabled.Value {
+		t.Error("device is still enabled")
+	}
+
+	// Deleting the object deletes the device and revokes its certificate
+	device = getDevice(t, r)
+	secret := &corev1.Secret{}
+	if err := r.Get(context.TODO(), types.NamespacedName{Name: "sensor-device-cert", Namespace: "default"}, secret); err != nil {
+		t.Fatal(err)
+	}
+	cert, err := pki.ParseCertificate(secret.Data[corev1.TLSCertKey])
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := pki.ParseCertificate(secret.Data["ca.crt"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := metav1.Now()
+	device.DeletionTimestamp = &now
+	if err := r.Update(context.TODO(), device); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(request); err != nil {
+		t.Fatal(err)
+	}
+	if len(getDevice(t, r).Finalizers) != 0 {
+		t.Error("finalizer wasn't removed")
+	}
+	list, err := registry.List(context.TODO(), &registrypb.ListDevicesRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Devices) != 0 {
+		t.Errorf("devices left in the registry: %v", list.Devices)
+	}
+	revocations := &corev1.ConfigMap{}
+	if err := r.Get(context.TODO(), types.NamespacedName{Name: platform.DeviceRevocationsName("foo"), Namespace: "default"}, revocations); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := revocations.Data[pki.HexFingerprint(ca)+"."+cert.SerialNumber.Text(16)]; !ok {
+		t.Errorf("certificate isn't revoked: %v", revocations.Data)
+	}
+}
+
+func TestRegisterAfterFailedStatusUpdate(t *testing.T) {
+	r, env := newTestReconciler(t)
+	c := r.Client
+	r.Client = controllertest.FailingStatus{Client: c}
+	if _, err := r.Reconcile(request); err == nil {
+		t.Fatal("status update didn't fail")
+	}
+	r.Client = c
+	if getDevice(t, r).Status.ID != "" {
+		t.Fatal("status was updated")
+	}
+
+	if _, err := r.Reconcile(request); err != nil {
+		t.Fatal(err)
+	}
+	list, err := env.Data.DeviceRegistry().List(context.TODO(), &registrypb.ListDevicesRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Devices) != 1 || list.Devices[0].Id != getDevice(t, r).Status.ID {
+		t.Errorf("%v devices registered, status %+v", len(list.Devices), getDevice(t, r).Status)
+	}
+}
+
+func TestRenewCertificate(t *testing.T) {
+	r, env := newTestReconciler(t)
+	result, err := r.Reconcile(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RequeueAfter <= 0 || result.RequeueAfter > time.Hour {
+		t.Errorf("renewal is due in %v", result.RequeueAfter)
+	}
+
+	// A certificate in the last third of its validity is issued again
+	caSecret := &corev1.Secret{}
+	if err := r.Get(context.TODO(), types.NamespacedName{Name: platform.DeviceCASecretName("foo"), Namespace: "default"}, caSecret); err != nil {
+		t.Fatal(err)
+	}
+	ca, err := pki.LoadCA(caSecret.Data[corev1.TLSCertKey], caSecret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		t.Fatal(err)
+	}
+	due, key, err := ca.Issue("sensor", 20*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := &corev1.Secret{}
+	name := types.NamespacedName{Name: "sensor-device-cert", Namespace: "default"}
+	if err := r.Get(context.TODO(), name, secret); err != nil {
+		t.Fatal(err)
+	}
+	secret.Data[corev1.TLSCertKey] = due
+	secret.Data[corev1.TLSPrivateKeyKey] = key
+	if err := r.Update(context.TODO(), secret); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Reconcile(request); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(context.TODO(), name, secret); err != nil {
+		t.Fatal(err)
+	}
+	if string(secret.Data[corev1.TLSCertKey]) == string(due) {
+		t.Fatal("certificate wasn't renewed")
+	}
+	fp, err := pki.Fingerprint(secret.Data[corev1.TLSCertKey])
+	if err != nil {
+		t.Fatal(err)
+	}
+	device := getDevice(t, r)
+	registered, err := env.Data.DeviceRegistry().Get(context.TODO(), &registrypb.GetRequest{Id: device.Status.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(registered.Device.Certificate.Fingerprint) != hex.EncodeToString(fp) || device.Status.Fingerprint != hex.EncodeToString(fp) {
+		t.Error("renewed certificate isn't registered")
+	}
+
+	// The renewed certificate is kept
+	renewed := secret.Data[corev1.TLSCertKey]
+	if _, err := r.Reconcile(request); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Get(context.TODO(), name, secret); err != nil {
+		t.Fatal(err)
+	}
+	if string(secret.Data[corev1.TLSCertKey]) != string(renewed) {
+		t.Error("certificate was issued again")
+	}
+}
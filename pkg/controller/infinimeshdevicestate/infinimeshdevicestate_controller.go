@@ -0,0 +1,298 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package infinimeshdevicestate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	infinimeshv1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1"
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+	"github.com/infinimesh/operator/pkg/clients"
+	"github.com/infinimesh/operator/pkg/shadowpb"
+)
+
+var logger = logf.Log.WithName("infinimeshdevicestate-controller")
+
+const (
+	// shadowTimeout bounds each call to the shadow API
+	shadowTimeout = 10 * time.Second
+	// defaultSyncInterval is how often the reported state is read by default
+	defaultSyncInterval = time.Minute
+)
+
+// Add creates a new InfinimeshDeviceState Controller and adds it to the Manager. The Manager will
+// set fields on the Controller and Start it when the Manager is Started.
+func Add(mgr manager.Manager, opts controller.Options) error {
+	opts.Reconciler = newReconciler(mgr)
+	return add(mgr, opts)
+}
+
+// newReconciler returns a new reconcile.Reconciler
+func newReconciler(mgr manager.Manager) *ReconcileInfinimeshDeviceState {
+	return &ReconcileInfinimeshDeviceState{
+		Client:   mgr.GetClient(),
+		scheme:   mgr.GetScheme(),
+		recorder: mgr.GetRecorder("infinimeshdevicestate-controller"),
+		clients:  clients.NewFactory(mgr.GetClient()),
+	}
+}
+
+// add adds a new Controller to mgr with opts.Reconciler as the reconcile.Reconciler
+func add(mgr manager.Manager, opts controller.Options) error {
+	c, err := controller.New("infinimeshdevicestate-controller", mgr, opts)
+	if err != nil {
+		return err
+	}
+
+	err = c.Watch(&source.Kind{Type: &infinimeshv1.InfinimeshDeviceState{}}, &handler.EnqueueRequestForObject{})
+	if err != nil {
+		return err
+	}
+
+	// The id of a device is known once it is registered
+	return c.Watch(&source.Kind{Type: &infinimeshv1.InfinimeshDevice{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(func(o handler.MapObject) []reconcile.Request {
+			return statesOfDevice(mgr.GetClient(), o.Meta)
+		}),
+	})
+}
+
+// statesOfDevice returns the device states referring to device.
+func statesOfDevice(c client.Client, device metav1.Object) []reconcile.Request {
+	states := &infinimeshv1.InfinimeshDeviceStateList{}
+	if err := c.List(context.TODO(), &client.ListOptions{Namespace: device.GetNamespace()}, states); err != nil {
+		logger.Error(err, "Failed to list device states", "namespace", device.GetNamespace())
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, state := range states.Items {
+		if state.Spec.InfinimeshDevice == device.GetName() {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: state.Name, Namespace: state.Namespace},
+			})
+		}
+	}
+	return requests
+}
+
+var _ reconcile.Reconciler = &ReconcileInfinimeshDeviceState{}
+
+// ReconcileInfinimeshDeviceState reconciles an InfinimeshDeviceState object
+type ReconcileInfinimeshDeviceState struct {
+	client.Client
+	scheme   *runtime.Scheme
+	recorder record.EventRecorder
+	// clients connects to the shadow API of a platform
+	clients clients.Factory
+}
+
+// Reconcile pushes the desired state to the shadow API of the platform and mirrors the reported
+// state of the device into the status.
+// +kubebuilder:rbac:groups=infinimesh.infinimesh.io,resources=infinimeshdevicestates,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=infinimesh.infinimesh.io,resources=infinimeshdevicestates/status,verbs=get;update;patch
+func (r *ReconcileInfinimeshDeviceState) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	instance := &infinimeshv1.InfinimeshDeviceState{}
+	err := r.Get(context.TODO(), request.NamespacedName, instance)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	status := instance.Status.DeepCopy()
+
+	err = r.sync(instance)
+	if err != nil {
+		instance.Status.Message = err.Error()
+		r.recorder.Eventf(instance, corev1.EventTypeWarning, "SyncFailed", "Failed to sync device state: %v", err)
+	} else {
+		instance.Status.Message = ""
+		instance.Status.ObservedGeneration = instance.Generation
+	}
+
+	if !reflect.DeepEqual(*status, instance.Status) {
+		if err := r.Status().Update(context.TODO(), instance); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	interval := defaultSyncInterval
+	if instance.Spec.SyncInterval != nil && instance.Spec.SyncInterval.Duration > 0 {
+		interval = instance.Spec.SyncInterval.Duration
+	}
+	return reconcile.Result{RequeueAfter: interval}, nil
+}
+
+// sync patches the desired state of the device where it differs from the spec and reads the
+// reported state.
+func (r *ReconcileInfinimeshDeviceState) sync(instance *infinimeshv1.InfinimeshDeviceState) error {
+	log := logger.WithValues("namespace", instance.Namespace, "name", instance.Name)
+
+	id, err := r.deviceID(instance)
+	if err != nil {
+		return err
+	}
+	instance.Status.Device = id
+
+	var desired interface{}
+	if err := json.Unmarshal(instance.Spec.Desired.Raw, &desired); err != nil {
+		return fmt.Errorf("invalid desired state: %v", err)
+	}
+
+	p := &infinimeshv1beta1.Platform{}
+	err = r.Get(context.TODO(), types.NamespacedName{Name: instance.Spec.Platform, Namespace: instance.Namespace}, p)
+	if err != nil {
+		return err
+	}
+
+	shadows, conn, err := r.clients.Shadows(p)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), shadowTimeout)
+	defer cancel()
+
+	resp, err := shadows.Get(ctx, &shadowpb.GetRequest{Id: id})
+	if err != nil {
+		return err
+	}
+	shadow := resp.Shadow
+	if shadow == nil {
+		shadow = &shadowpb.Shadow{}
+	}
+
+	var current interface{}
+	if shadow.Desired != nil && shadow.Desired.Data != nil && len(shadow.Desired.Data.JSON) > 0 {
+		if err := json.Unmarshal(shadow.Desired.Data.JSON, &current); err != nil {
+			return err
+		}
+		instance.Status.DesiredVersion = int64(shadow.Desired.Version)
+	}
+
+	var applied interface{}
+	if instance.Status.Applied != nil && len(instance.Status.Applied.Raw) > 0 {
+		if err := json.Unmarshal(instance.Status.Applied.Raw, &applied); err != nil {
+			return err
+		}
+	}
+
+	if patch, changed := mergePatch(current, desired, applied); changed {
+		data, err := json.Marshal(patch)
+		if err != nil {
+			return err
+		}
+		_, err = shadows.PatchDesiredState(ctx, &shadowpb.PatchDesiredStateRequest{Id: id, Data: &shadowpb.Value{JSON: data}})
+		if err != nil {
+			return err
+		}
+		log.Info("Patched desired state", "device", id)
+		r.recorder.Eventf(instance, corev1.EventTypeNormal, "DesiredStatePatched", "Patched the desired state of device %v", id)
+	}
+	instance.Status.Applied = &runtime.RawExtension{Raw: instance.Spec.Desired.Raw}
+
+	if reported := shadow.Reported; reported != nil {
+		if reported.Data != nil && len(reported.Data.JSON) > 0 {
+			instance.Status.Reported = &runtime.RawExtension{Raw: reported.Data.JSON}
+		}
+		instance.Status.ReportedVersion = int64(reported.Version)
+		if reported.Timestamp != nil {
+			t, err := ptypes.Timestamp(reported.Timestamp)
+			if err != nil {
+				return err
+			}
+			lastSeen := metav1.NewTime(t.Local())
+			instance.Status.LastSeen = &lastSeen
+		}
+	}
+	return nil
+}
+
+// deviceID returns the registry id of the device of instance.
+func (r *ReconcileInfinimeshDeviceState) deviceID(instance *infinimeshv1.InfinimeshDeviceState) (string, error) {
+	if (instance.Spec.Device == "") == (instance.Spec.InfinimeshDevice == "") {
+		return "", fmt.Errorf("exactly one of device and infinimeshDevice must be set")
+	}
+	if instance.Spec.Device != "" {
+		return instance.Spec.Device, nil
+	}
+
+	device := &infinimeshv1.InfinimeshDevice{}
+	err := r.Get(context.TODO(), types.NamespacedName{Name: instance.Spec.InfinimeshDevice, Namespace: instance.Namespace}, device)
+	if err != nil {
+		return "", err
+	}
+	if device.Status.ID == "" {
+		return "", fmt.Errorf("device %v is not registered yet", device.Name)
+	}
+	return device.Status.ID, nil
+}
+
+// mergePatch returns the JSON merge patch (RFC 7386) turning from into to, and whether they
+// differ at all. Keys missing from to are only removed if they are in applied, the document
+// previously patched in, so keys set by the API or other controllers are kept.
+func mergePatch(from, to, applied interface{}) (interface{}, bool) {
+	fromObject, ok := from.(map[string]interface{})
+	toObject, ok2 := to.(map[string]interface{})
+	if !ok || !ok2 {
+		return to, !reflect.DeepEqual(from, to)
+	}
+	appliedObject, _ := applied.(map[string]interface{})
+
+	patch := map[string]interface{}{}
+	for key, value := range toObject {
+		if previous, ok := fromObject[key]; ok {
+			if sub, changed := mergePatch(previous, value, appliedObject[key]); changed {
+				patch[key] = sub
+			}
+		} else {
+			patch[key] = value
+		}
+	}
+	for key := range fromObject {
+		if _, ok := toObject[key]; !ok {
+			if _, managed := appliedObject[key]; managed {
+				patch[key] = nil
+			}
+		}
+	}
+	return patch, len(patch) > 0
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package infinimeshdevicestate
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	infinimeshv1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1"
+	"github.com/infinimesh/operator/pkg/clients/fake"
+	"github.com/infinimesh/operator/pkg/controller/controllertest"
+	"github.com/infinimesh/operator/pkg/shadowpb"
+)
+
+func TestMergePatch(t *testing.T) {
+	for _, c := range []struct {
+		from, to, applied, patch string
+	}{
+		{`null`, `{"a":1}`, `null`, `{"a":1}`},
+		{`{"a":1}`, `{"a":1}`, `{"a":1}`, ``},
+		{`{"a":1,"b":2}`, `{"a":1}`, `{"a":1,"b":2}`, `{"b":null}`},
+		{`{"a":{"b":1,"c":2}}`, `{"a":{"b":1,"c":3}}`, `{"a":{"b":1,"c":2}}`, `{"a":{"c":3}}`},
+		{`{"a":[1,2]}`, `{"a":[1]}`, `{"a":[1,2]}`, `{"a":[1]}`},
+		{`{"a":"x"}`, `{"a":{"b":1}}`, `{"a":"x"}`, `{"a":{"b":1}}`},
+		// Keys the device state never applied are kept
+		{`{"a":1,"b":2}`, `{"a":1}`, `{"a":1}`, ``},
+		{`{"a":1,"b":2}`, `{"a":1}`, `null`, ``},
+		{`{"a":{"b":1,"c":2}}`, `{"a":{"b":1}}`, `{"a":{"b":1}}`, ``},
+		{`{"a":{"b":1,"c":2}}`, `{}`, `{"a":{"b":1}}`, `{"a":null}`},
+	} {
+		var from, to, applied interface{}
+		json.Unmarshal([]byte(c.from), &from)
+		json.Unmarshal([]byte(c.to), &to)
+		json.Unmarshal([]byte(c.applied), &applied)
+
+		patch, changed := mergePatch(from, to, applied)
+		if changed != (c.patch != "") {
+			t.Errorf("mergePatch(%v, %v, %v) changed = %v", c.from, c.to, c.applied, changed)
+			continue
+		}
+		if !changed {
+			continue
+		}
+		data, _ := json.Marshal(patch)
+		if string(data) != c.patch {
+			t.Errorf("mergePatch(%v, %v, %v) = %s, want %v", c.from, c.to, c.applied, data, c.patch)
+		}
+	}
+}
+
+var request = reconcile.Request{NamespacedName: types.NamespacedName{Name: "sensor", Namespace: "default"}}
+
+// newTestReconciler returns a reconciler for the device state sensor of a device registered with
+// the platform, and the data plane of the platform.
+func newTestReconciler(t *testing.T, desired string) (*ReconcileInfinimeshDeviceState, *fake.Platform, string) {
+	env := controllertest.New(t)
+	id := env.RegisterDevice(t, "sensor")
+	env.Create(t, &infinimeshv1.InfinimeshDeviceState{
+		ObjectMeta: metav1.ObjectMeta{Name: "sensor", Namespace: controllertest.Namespace},
+		Spec: infinimeshv1.InfinimeshDeviceStateSpec{
+			Platform: controllertest.PlatformName,
+			Device:   id,
+			Desired:  runtime.RawExtension{Raw: []byte(desired)},
+		},
+	})
+	r := &ReconcileInfinimeshDeviceState{Client: env.Client, scheme: scheme.Scheme, recorder: env.Recorder, clients: env.Clients}
+	return r, env.Data, id
+}
+
+func getState(t *testing.T, r *ReconcileInfinimeshDeviceState) *infinimeshv1.InfinimeshDeviceState {
+	state := &infinimeshv1.InfinimeshDeviceState{}
+	controllertest.Get(t, r, "sensor", state)
+	return state
+}
+
+func TestReconcile(t *testing.T) {
+	r, data, id := newTestReconciler(t, `{"interval":10,"led":{"color":"red"}}`)
+
+	if _, err := r.Reconcile(request); err != nil {
+		t.Fatal(err)
+	}
+	if desired := string(data.DesiredState(id)); desired != `{"interval":10,"led":{"color":"red"}}` {
+		t.Errorf("desired state %v", desired)
+	}
+
+	data.ReportState(id, []byte(`{"interval":10}`))
+	if _, err := r.Reconcile(request); err != nil {
+		t.Fatal(err)
+	}
+	state := getState(t, r)
+	if state.Status.Device != id || state.Status.Reported == nil || string(state.Status.Reported.Raw) != `{"interval":10}` || state.Status.LastSeen == nil {
+		t.Errorf("status %+v", state.Status)
+	}
+	if state.Status.DesiredVersion != 1 || state.Status.ReportedVersion != 1 {
+		t.Errorf("versions %v and %v, want 1", state.Status.DesiredVersion, state.Status.ReportedVersion)
+	}
+}
+
+func TestReconcileKeepsOtherKeys(t *testing.T) {
+	r, data, id := newTestReconciler(t, `{"interval":10,"led":{"color":"red"}}`)
+	if _, err := r.Reconcile(request); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another writer sets keys of its own next to the managed ones
+	_, err := data.Shadows().PatchDesiredState(context.TODO(), &shadowpb.PatchDesiredStateRequest{
+		Id:   id,
+		Data: &shadowpb.Value{JSON: []byte(`{"firmware":"1.2","led":{"brightness":5}}`)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(request); err != nil {
+		t.Fatal(err)
+	}
+	if desired := string(data.DesiredState(id)); desired != `{"firmware":"1.2","interval":10,"led":{"brightness":5,"color":"red"}}` {
+		t.Errorf("desired state %v", desired)
+	}
+
+	// Removing a managed key removes it from the shadow only
+	state := getState(t, r)
+	state.Spec.Desired = runtime.RawExtension{Raw: []byte(`{"led":{}}`)}
+	if err := r.Update(context.TODO(), state); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(request); err != nil {
+		t.Fatal(err)
+	}
+	if desired := string(data.DesiredState(id)); desired != `{"firmware":"1.2","led":{"brightness":5}}` {
+		t.Errorf("desired state %v", desired)
+	}
+	if applied := getState(t, r).Status.Applied; applied == nil || string(applied.Raw) != `{"led":{}}` {
+		t.Errorf("applied %v", applied)
+	}
+}
@@ -0,0 +1,364 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package infinimeshobjecttree
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/infinimesh/infinimesh/pkg/node"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	infinimeshv1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1"
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+	"github.com/infinimesh/operator/pkg/controller/finalizers"
+)
+
+var logger = logf.Log.WithName("infinimeshobjecttree-controller")
+
+const (
+	// finalizer deletes the objects of the tree from dgraph before the object is deleted
+	finalizer = "infinimesh.io/object-tree"
+	// dgraphTimeout bounds a convergence of the tree
+	dgraphTimeout = 30 * time.Second
+	// resyncInterval is how often the tree is checked for objects deleted outside the operator
+	resyncInterval = 10 * time.Minute
+)
+
+// Add creates a new InfinimeshObjectTree Controller and adds it to the Manager. The Manager will
+// set fields on the Controller and Start it when the Manager is Started.
+func Add(mgr manager.Manager, opts controller.Options) error {
+	opts.Reconciler = newReconciler(mgr)
+	return add(mgr, opts)
+}
+
+// newReconciler returns a new reconcile.Reconciler
+func newReconciler(mgr manager.Manager) *ReconcileInfinimeshObjectTree {
+	return &ReconcileInfinimeshObjectTree{
+		Client:   mgr.GetClient(),
+		scheme:   mgr.GetScheme(),
+		recorder: mgr.GetRecorder("infinimeshobjecttree-controller"),
+		dial:     dialDgraph,
+	}
+}
+
+// add adds a new Controller to mgr with opts.Reconciler as the reconcile.Reconciler
+func add(mgr manager.Manager, opts controller.Options) error {
+	c, err := controller.New("infinimeshobjecttree-controller", mgr, opts)
+	if err != nil {
+		return err
+	}
+
+	return c.Watch(&source.Kind{Type: &infinimeshv1.InfinimeshObjectTree{}}, &handler.EnqueueRequestForObject{})
+}
+
+var _ reconcile.Reconciler = &ReconcileInfinimeshObjectTree{}
+
+// ReconcileInfinimeshObjectTree reconciles an InfinimeshObjectTree object
+type ReconcileInfinimeshObjectTree struct {
+	client.Client
+	scheme   *runtime.Scheme
+	recorder record.EventRecorder
+	// dial connects to the dgraph of a platform
+	dial func(client.Client, *infinimeshv1beta1.Platform) (objectStore, io.Closer, error)
+}
+
+// Reconcile converges the object hierarchy in dgraph to the tree: missing objects are created
+// and objects that were removed from the tree are deleted.
+// +kubebuilder:rbac:groups=infinimesh.infinimesh.io,resources=infinimeshobjecttrees,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=infinimesh.infinimesh.io,resources=infinimeshobjecttrees/status,verbs=get;update;patch
+func (r *ReconcileInfinimeshObjectTree) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	instance := &infinimeshv1.InfinimeshObjectTree{}
+	err := r.Get(context.TODO(), request.NamespacedName, instance)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	if instance.DeletionTimestamp != nil {
+		return reconcile.Result{}, r.finalize(instance)
+	}
+
+	if !finalizers.Has(instance, finalizer) {
+		finalizers.Add(instance, finalizer)
+		if err := r.Update(context.TODO(), instance); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	status := instance.Status.DeepCopy()
+
+	err = r.reconcileTree(instance)
+	if err != nil {
+		instance.Status.Message = err.Error()
+		r.recorder.Eventf(instance, corev1.EventTypeWarning, "ConvergeFailed", "Failed to converge the object tree: %v", err)
+	} else {
+		instance.Status.Message = ""
+		instance.Status.ObservedGeneration = instance.Generation
+	}
+
+	// The status is written even if the convergence failed half way, it holds the uids of the
+	// objects created so far
+	if !reflect.DeepEqual(*status, instance.Status) {
+		if err := r.Status().Update(context.TODO(), instance); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	return reconcile.Result{RequeueAfter: resyncInterval}, nil
+}
+
+// reconcileTree connects to the dgraph of the platform of the tree and converges it.
+func (r *ReconcileInfinimeshObjectTree) reconcileTree(instance *infinimeshv1.InfinimeshObjectTree) error {
+	desired, err := flatten(instance.Spec.Objects)
+	if err != nil {
+		return err
+	}
+
+	p := &infinimeshv1beta1.Platform{}
+	err = r.Get(context.TODO(), types.NamespacedName{Name: instance.Spec.Platform, Namespace: instance.Namespace}, p)
+	if err != nil {
+		return err
+	}
+
+	store, conn, err := r.dial(r, p)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), dgraphTimeout)
+	defer cancel()
+
+	created, deleted, err := converge(ctx, store, instance.Spec.Namespace, desired, &instance.Status)
+	if created > 0 || deleted > 0 {
+		logger.Info("Converged object tree", "namespace", instance.Namespace, "name", instance.Name, "created", created, "deleted", deleted)
+		r.recorder.Eventf(instance, corev1.EventTypeNormal, "Converged", "Created %v and deleted %v objects", created, deleted)
+	}
+	return err
+}
+
+// finalize deletes the top level objects of the tree, and with them their children, and releases
+// the object. Nothing is deleted if the platform is gone, its dgraph goes with it.
+func (r *ReconcileInfinimeshObjectTree) finalize(instance *infinimeshv1.InfinimeshObjectTree) error {
+	if !finalizers.Has(instance, finalizer) {
+		return nil
+	}
+
+	if len(instance.Status.Objects) > 0 {
+		p := &infinimeshv1beta1.Platform{}
+		err := r.Get(context.TODO(), types.NamespacedName{Name: instance.Spec.Platform, Namespace: instance.Namespace}, p)
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		if err == nil && p.DeletionTimestamp == nil {
+			store, conn, err := r.dial(r, p)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), dgraphTimeout)
+			defer cancel()
+			for _, object := range instance.Status.Objects {
+				if strings.Contains(object.Path, "/") {
+					continue
+				}
+				if err := store.DeleteObject(ctx, object.UID); err != nil {
+					r.recorder.Eventf(instance, corev1.EventTypeWarning, "DeletionFailed", "Failed to delete object %v: %v", object.Path, err)
+					return err
+				}
+			}
+			logger.Info("Deleted object tree", "namespace", instance.Namespace, "name", instance.Name)
+		}
+	}
+
+	finalizers.Remove(instance, finalizer)
+	return r.Update(context.TODO(), instance)
+}
+
+// object is an object of the tree with its path
+type object struct {
+	path   string
+	parent string
+	name   string
+	kind   string
+}
+
+// flatten returns the objects of the tree, parents before their children.
+func flatten(objects []infinimeshv1.InfinimeshObject) ([]object, error) {
+	var result []object
+	var walk func(parent string, objects []infinimeshv1.InfinimeshObject) error
+	walk = func(parent string, objects []infinimeshv1.InfinimeshObject) error {
+		names := map[string]bool{}
+		for _, o := range objects {
+			if o.Name == "" || strings.Contains(o.Name, "/") {
+				return fmt.Errorf("invalid object name %q under %q", o.Name, parent)
+			}
+			if names[o.Name] {
+				return fmt.Errorf("duplicate object name %q under %q", o.Name, parent)
+			}
+			names[o.Name] = true
+
+			kind := o.Kind
+			if kind == "" {
+				kind = node.KindAsset
+			}
+			if kind != node.KindAsset && kind != node.KindDevice {
+				return fmt.Errorf("invalid kind %q of object %q", o.Kind, o.Name)
+			}
+
+			path := o.Name
+			if parent != "" {
+				path = parent + "/" + o.Name
+			}
+			result = append(result, object{path: path, parent: parent, name: o.Name, kind: kind})
+			if err := walk(path, o.Objects); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return result, walk("", objects)
+}
+
+// converge creates the desired objects missing from status and deletes the objects of status that
+// are not desired any more, recording the changes in status. Objects that were deleted from
+// dgraph behind the back of the operator are created again. Objects that were created but not
+// recorded, because the status update failed, are recorded instead of created twice.
+func converge(ctx context.Context, store objectStore, namespace string, desired []object, status *infinimeshv1.InfinimeshObjectTreeStatus) (created, deleted int, err error) {
+	namespaceID, err := store.NamespaceID(ctx, namespace)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Objects can't be moved between namespaces
+	if status.NamespaceID != "" && status.NamespaceID != namespaceID {
+		for len(status.Objects) > 0 {
+			if err := store.DeleteObject(ctx, status.Objects[0].UID); err != nil {
+				return created, deleted, err
+			}
+			status.Objects = dropSubtree(status.Objects, status.Objects[0].Path)
+			deleted++
+		}
+	}
+	status.NamespaceID = namespaceID
+
+	uids := make([]string, 0, len(status.Objects))
+	for _, o := range status.Objects {
+		uids = append(uids, o.UID)
+	}
+	existing, err := store.Existing(ctx, uids)
+	if err != nil {
+		return created, deleted, err
+	}
+	var kept []infinimeshv1.InfinimeshObjectStatus
+	for _, o := range status.Objects {
+		if existing[o.UID] {
+			kept = append(kept, o)
+		}
+	}
+	status.Objects = kept
+
+	kinds := map[string]string{}
+	for _, o := range desired {
+		kinds[o.path] = o.kind
+	}
+	for i := 0; i < len(status.Objects); {
+		o := status.Objects[i]
+		if kind, ok := kinds[o.Path]; ok && kind == o.Kind && hasParent(status.Objects, o.Path) {
+			i++
+			continue
+		}
+		// Deleting an object deletes its children. An object whose kind changed, or whose parent
+		// is gone, is created again.
+		if err := store.DeleteObject(ctx, o.UID); err != nil {
+			return created, deleted, err
+		}
+		status.Objects = dropSubtree(status.Objects, o.Path)
+		deleted++
+	}
+
+	uidOf := map[string]string{}
+	for _, o := range status.Objects {
+		uidOf[o.Path] = o.UID
+	}
+	for _, o := range desired {
+		if _, ok := uidOf[o.path]; ok {
+			continue
+		}
+		uid, err := store.FindObject(ctx, o.name, uidOf[o.parent], o.kind, namespaceID)
+		if err != nil {
+			return created, deleted, fmt.Errorf("find %v: %v", o.path, err)
+		}
+		if uid == "" {
+			uid, err = store.CreateObject(ctx, o.name, uidOf[o.parent], o.kind, namespaceID)
+			if err != nil {
+				return created, deleted, fmt.Errorf("create %v: %v", o.path, err)
+			}
+			created++
+		}
+		uidOf[o.path] = uid
+		status.Objects = append(status.Objects, infinimeshv1.InfinimeshObjectStatus{Path: o.path, Kind: o.kind, UID: uid})
+	}
+
+	return created, deleted, nil
+}
+
+// hasParent reports whether the parent of the object at path is in objects.
+func hasParent(objects []infinimeshv1.InfinimeshObjectStatus, path string) bool {
+	i := strings.LastIndex(path, "/")
+	if i < 0 {
+		return true
+	}
+	for _, o := range objects {
+		if o.Path == path[:i] {
+			return true
+		}
+	}
+	return false
+}
+
+// dropSubtree removes the object at path and its descendants from objects.
+func dropSubtree(objects []infinimeshv1.InfinimeshObjectStatus, path string) []infinimeshv1.InfinimeshObjectStatus {
+	var result []infinimeshv1.InfinimeshObjectStatus
+	for _, o := range objects {
+		if o.Path != path && !strings.HasPrefix(o.Path, path+"/") {
+			result = append(result, o)
+		}
+	}
+	return result
+}
@@ -0,0 +1,198 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package infinimeshobjecttree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	infinimeshv1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1"
+)
+
+// memoryStore is an objectStore keeping the objects of a single namespace in memory
+type memoryStore struct {
+	next     int
+	parents  map[string]string
+	children map[string][]string
+	// keys are name/kind of the objects
+	keys map[string]string
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{parents: map[string]string{}, children: map[string][]string{}, keys: map[string]string{}}
+}
+
+func (s *memoryStore) NamespaceID(ctx context.Context, name string) (string, error) {
+	if name != "tenant" {
+		return "", errors.New("The Namespace is not found")
+	}
+	return "0x1", nil
+}
+
+func (s *memoryStore) Existing(ctx context.Context, uids []string) (map[string]bool, error) {
+	existing := map[string]bool{}
+	for _, uid := range uids {
+		if _, ok := s.parents[uid]; ok {
+			existing[uid] = true
+		}
+	}
+	return existing, nil
+}
+
+func (s *memoryStore) FindObject(ctx context.Context, name, parentID, kind, namespaceID string) (string, error) {
+	for _, uid := range s.children[parentID] {
+		if s.keys[uid] == name+"/"+kind {
+			return uid, nil
+		}
+	}
+	return "", nil
+}
+
+func (s *memoryStore) CreateObject(ctx context.Context, name, parentID, kind, namespaceID string) (string, error) {
+	if _, ok := s.parents[parentID]; parentID != "" && !ok {
+		return "", errors.New("Invalid parent")
+	}
+	s.next++
+	uid := fmt.Sprintf("0x%x", 0x100+s.next)
+	s.parents[uid] = parentID
+	s.children[parentID] = append(s.children[parentID], uid)
+	s.keys[uid] = name + "/" + kind
+	return uid, nil
+}
+
+func (s *memoryStore) DeleteObject(ctx context.Context, uid string) error {
+	for _, child := range s.children[uid] {
+		s.DeleteObject(ctx, child)
+	}
+	if parent, ok := s.parents[uid]; ok {
+		var siblings []string
+		for _, sibling := range s.children[parent] {
+			if sibling != uid {
+				siblings = append(siblings, sibling)
+			}
+		}
+		s.children[parent] = siblings
+	}
+	delete(s.parents, uid)
+	delete(s.children, uid)
+	delete(s.keys, uid)
+	return nil
+}
+
+func paths(status *infinimeshv1.InfinimeshObjectTreeStatus) map[string]string {
+	result := map[string]string{}
+	for _, o := range status.Objects {
+		result[o.Path] = o.UID
+	}
+	return result
+}
+
+func TestConverge(t *testing.T) {
+	store := newMemoryStore()
+	status := &infinimeshv1.InfinimeshObjectTreeStatus{}
+	tree := []infinimeshv1.InfinimeshObject{
+		{Name: "building", Objects: []infinimeshv1.InfinimeshObject{
+			{Name: "floor-1", Objects: []infinimeshv1.InfinimeshObject{
+				{Name: "thermostat", Kind: "device"},
+			}},
+			{Name: "floor-2"},
+		}},
+	}
+
+	desired, err := flatten(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, deleted, err := converge(context.TODO(), store, "tenant", desired, status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created != 4 || deleted != 0 || len(store.parents) != 4 {
+		t.Fatalf("created %v, deleted %v, %v objects in dgraph", created, deleted, len(store.parents))
+	}
+	uids := paths(status)
+	if store.parents[uids["building/floor-1/thermostat"]] != uids["building/floor-1"] {
+		t.Errorf("thermostat is not a child of floor-1: %v", status.Objects)
+	}
+
+	// Converged trees are left alone
+	created, deleted, err = converge(context.TODO(), store, "tenant", desired, status)
+	if err != nil || created != 0 || deleted != 0 {
+		t.Fatalf("created %v, deleted %v: %v", created, deleted, err)
+	}
+
+	// Objects whose creation wasn't recorded because the status update failed are recorded
+	// instead of created twice
+	lost := &infinimeshv1.InfinimeshObjectTreeStatus{}
+	created, deleted, err = converge(context.TODO(), store, "tenant", desired, lost)
+	if err != nil || created != 0 || deleted != 0 || len(store.parents) != 4 {
+		t.Fatalf("created %v, deleted %v, %v objects in dgraph: %v", created, deleted, len(store.parents), err)
+	}
+	if !reflect.DeepEqual(paths(lost), uids) {
+		t.Errorf("recorded %v, want %v", paths(lost), uids)
+	}
+
+	// Removed objects are deleted with their children, objects deleted from dgraph are created
+	// again
+	store.DeleteObject(context.TODO(), uids["building/floor-2"])
+	tree[0].Objects[0].Name = "ground-floor"
+	desired, err = flatten(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, deleted, err = converge(context.TODO(), store, "tenant", desired, status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created != 3 || deleted != 1 || len(store.parents) != 4 {
+		t.Fatalf("created %v, deleted %v, %v objects in dgraph", created, deleted, len(store.parents))
+	}
+	uids = paths(status)
+	if _, ok := uids["building/floor-1"]; ok {
+		t.Errorf("floor-1 is still in the status: %v", status.Objects)
+	}
+	if store.parents[uids["building/ground-floor/thermostat"]] != uids["building/ground-floor"] {
+		t.Errorf("thermostat is not a child of ground-floor: %v", status.Objects)
+	}
+
+	// Changing the kind of an object creates it again
+	tree[0].Objects[1].Kind = "device"
+	desired, _ = flatten(tree)
+	previous := uids["building/floor-2"]
+	if _, _, err := converge(context.TODO(), store, "tenant", desired, status); err != nil {
+		t.Fatal(err)
+	}
+	if uid := paths(status)["building/floor-2"]; uid == previous || uid == "" {
+		t.Errorf("floor-2 was not created again: %v", status.Objects)
+	}
+}
+
+func TestFlattenRejectsInvalidTrees(t *testing.T) {
+	for _, tree := range [][]infinimeshv1.InfinimeshObject{
+		{{Name: "a"}, {Name: "a"}},
+		{{Name: "a/b"}},
+		{{Name: ""}},
+		{{Name: "a", Kind: "sensor"}},
+	} {
+		if _, err := flatten(tree); err == nil {
+			t.Errorf("flatten(%v) succeeded", tree)
+		}
+	}
+}
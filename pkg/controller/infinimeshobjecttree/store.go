@@ -0,0 +1,165 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package infinimeshobjecttree
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/dgraph-io/dgo"
+	"github.com/infinimesh/infinimesh/pkg/node"
+	"github.com/infinimesh/infinimesh/pkg/node/dgraph"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+	"github.com/infinimesh/operator/pkg/clients"
+)
+
+// objectStore is the part of the dgraph of a platform an object tree is converged with
+type objectStore interface {
+	// NamespaceID returns the uid of the infinimesh namespace name
+	NamespaceID(ctx context.Context, name string) (string, error)
+	// Existing returns the subset of uids that are objects
+	Existing(ctx context.Context, uids []string) (map[string]bool, error)
+	// FindObject returns the uid of the object of kind named name below parentID, or of the
+	// top level object if parentID is empty, or an empty uid if there is none
+	FindObject(ctx context.Context, name, parentID, kind, namespaceID string) (string, error)
+	CreateObject(ctx context.Context, name, parentID, kind, namespaceID string) (string, error)
+	// DeleteObject deletes the object and its children, it doesn't fail if the object is gone
+	DeleteObject(ctx context.Context, uid string) error
+}
+
+var uidPattern = regexp.MustCompile(`^0x[0-9a-f]+$`)
+
+// dgraphStore is an objectStore on the node repository of infinimesh
+type dgraphStore struct {
+	repo node.Repo
+	dg   *dgo.Dgraph
+}
+
+// dialDgraph connects to the dgraph of instance.
+func dialDgraph(c client.Client, instance *infinimeshv1beta1.Platform) (objectStore, io.Closer, error) {
+	dg, conn, err := clients.DgraphClient(c, instance)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &dgraphStore{repo: dgraph.NewDGraphRepo(dg), dg: dg}, conn, nil
+}
+
+func (s *dgraphStore) NamespaceID(ctx context.Context, name string) (string, error) {
+	namespace, err := s.repo.GetNamespace(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("namespace %v: %v", name, err)
+	}
+	return namespace.Id, nil
+}
+
+func (s *dgraphStore) Existing(ctx context.Context, uids []string) (map[string]bool, error) {
+	existing := map[string]bool{}
+	if len(uids) == 0 {
+		return existing, nil
+	}
+	for _, uid := range uids {
+		// The uids are read from the status, they are not passed to the query unchecked
+		if !uidPattern.MatchString(uid) {
+			return nil, fmt.Errorf("invalid uid %q", uid)
+		}
+	}
+
+	q := `{
+		objects(func: uid(` + strings.Join(uids, ", ") + `)) @filter(eq(type, "object")) {
+			uid
+		}
+	}`
+	res, err := s.dg.NewReadOnlyTxn().Query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Objects []struct {
+			UID string `json:"uid"`
+		} `json:"objects"`
+	}
+	if err := json.Unmarshal(res.Json, &result); err != nil {
+		return nil, err
+	}
+	for _, object := range result.Objects {
+		existing[object.UID] = true
+	}
+	return existing, nil
+}
+
+func (s *dgraphStore) FindObject(ctx context.Context, name, parentID, kind, namespaceID string) (string, error) {
+	q := `query objects($name: string, $kind: string) {
+		objects(func: eq(name, $name)) @filter(eq(type, "object") AND eq(kind, $kind)) {
+			uid
+			~owns {
+				uid
+			}
+			~children {
+				uid
+			}
+		}
+	}`
+	res, err := s.dg.NewReadOnlyTxn().QueryWithVars(ctx, q, map[string]string{"$name": name, "$kind": kind})
+	if err != nil {
+		return "", err
+	}
+	type ref struct {
+		UID string `json:"uid"`
+	}
+	var result struct {
+		Objects []struct {
+			UID     string `json:"uid"`
+			Owners  []ref  `json:"~owns"`
+			Parents []ref  `json:"~children"`
+		} `json:"objects"`
+	}
+	if err := json.Unmarshal(res.Json, &result); err != nil {
+		return "", err
+	}
+	for _, object := range result.Objects {
+		owned := false
+		for _, owner := range object.Owners {
+			owned = owned || owner.UID == namespaceID
+		}
+		parent := ""
+		if len(object.Parents) > 0 {
+			parent = object.Parents[0].UID
+		}
+		if owned && parent == parentID {
+			return object.UID, nil
+		}
+	}
+	return "", nil
+}
+
+func (s *dgraphStore) CreateObject(ctx context.Context, name, parentID, kind, namespaceID string) (string, error) {
+	return s.repo.CreateObject(ctx, name, parentID, kind, namespaceID)
+}
+
+func (s *dgraphStore) DeleteObject(ctx context.Context, uid string) error {
+	err := s.repo.DeleteObject(ctx, uid)
+	if err != nil && err.Error() == "The Object is not found" {
+		return nil
+	}
+	return err
+}
@@ -20,6 +20,9 @@ import (
 	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
 )
 
+// grpcBackendAnnotation has the ingress controller talk gRPC to the apiserver
+const grpcBackendAnnotation = "nginx.ingress.kubernetes.io/backend-protocol"
+
 // GenerateRandomBytes returns securely generated random bytes.
 // It will return an error if the system's secure random
 // number generator fails to function correctly, in which
@@ -90,6 +93,7 @@ func (r *ReconcilePlatform) reconcileApiserver(request reconcile.Request, instan
 			Namespace: instance.Namespace,
 		},
 		Spec: appsv1.DeploymentSpec{
+			Replicas: ingressReplicas(instance),
 			Selector: &metav1.LabelSelector{
 				MatchLabels: map[string]string{"deployment": deploymentName},
 			},
@@ -99,8 +103,8 @@ func (r *ReconcilePlatform) reconcileApiserver(request reconcile.Request, instan
 					Containers: []corev1.Container{
 						{
 							Name:            "apiserver",
-							Image:           "quay.io/infinimesh/apiserver:latest",
-							ImagePullPolicy: corev1.PullAlways,
+							Image:           image(instance, "apiserver"),
+							ImagePullPolicy: imagePullPolicy(instance, "apiserver"),
 							Env: []corev1.EnvVar{
 								{
 									Name:  "NODE_HOST",
@@ -133,6 +137,10 @@ func (r *ReconcilePlatform) reconcileApiserver(request reconcile.Request, instan
 		},
 	}
 
+	if err := r.secureWorkload(instance, deploy.Name, &deploy.Spec.Template); err != nil {
+		return err
+	}
+
 	if err := controllerutil.SetControllerReference(instance, deploy, r.scheme); err != nil {
 		return err
 	}
@@ -191,14 +199,18 @@ func (r *ReconcilePlatform) reconcileApiserver(request reconcile.Request, instan
 		return err
 	}
 
+	// The maintenance page answers gRPC clients over HTTP, they see it as unavailable
+	annotations := map[string]string{
+		"nginx.ingress.kubernetes.io/proxy-read-timeout": "3600",
+	}
+	if !instance.Spec.Maintenance.Enabled {
+		annotations[grpcBackendAnnotation] = "GRPC"
+	}
 	ingress := &extensionsv1beta1.Ingress{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      deploymentName,
-			Namespace: instance.Namespace,
-			Annotations: map[string]string{
-				"nginx.ingress.kubernetes.io/backend-protocol":   "GRPC",
-				"nginx.ingress.kubernetes.io/proxy-read-timeout": "3600",
-			},
+			Name:        deploymentName,
+			Namespace:   instance.Namespace,
+			Annotations: annotations,
 		},
 		Spec: extensionsv1beta1.IngressSpec{
 			TLS: instance.Spec.Apiserver.GRPC.TLS,
@@ -209,10 +221,7 @@ func (r *ReconcilePlatform) reconcileApiserver(request reconcile.Request, instan
 						HTTP: &extensionsv1beta1.HTTPIngressRuleValue{
 							Paths: []extensionsv1beta1.HTTPIngressPath{
 								{
-									Backend: extensionsv1beta1.IngressBackend{
-										ServiceName: instance.Name + "-apiserver",
-										ServicePort: intstr.FromInt(8080),
-									},
+									Backend: ingressBackend(instance, instance.Name+"-apiserver", 8080),
 								},
 							},
 						},
@@ -235,6 +244,21 @@ func (r *ReconcilePlatform) reconcileApiserver(request reconcile.Request, instan
 		}
 	} else if err != nil {
 		return err
+	} else if !reflect.DeepEqual(ingress.Spec, foundIngress.Spec) || foundIngress.Annotations[grpcBackendAnnotation] != annotations[grpcBackendAnnotation] {
+		foundIngress.Spec = ingress.Spec
+		if foundIngress.Annotations == nil {
+			foundIngress.Annotations = map[string]string{}
+		}
+		if protocol, ok := annotations[grpcBackendAnnotation]; ok {
+			foundIngress.Annotations[grpcBackendAnnotation] = protocol
+		} else {
+			delete(foundIngress.Annotations, grpcBackendAnnotation)
+		}
+		log.Info("Updating Ingress", "namespace", ingress.Namespace, "name", ingress.Name)
+		err = r.Update(context.TODO(), foundIngress)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
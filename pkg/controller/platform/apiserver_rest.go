@@ -29,6 +29,8 @@ func (r *ReconcilePlatform) reconcileApiserverRest(request reconcile.Request, in
 			Namespace: instance.Namespace,
 		},
 		Spec: appsv1.DeploymentSpec{
+			// Scaled down while the maintenance page is served
+			Replicas: ingressReplicas(instance),
 			Selector: &metav1.LabelSelector{
 				MatchLabels: map[string]string{"deployment": deploymentName},
 			},
@@ -38,8 +40,8 @@ func (r *ReconcilePlatform) reconcileApiserverRest(request reconcile.Request, in
 					Containers: []corev1.Container{
 						{
 							Name:            "apiserver-rest",
-							Image:           "quay.io/infinimesh/apiserver-rest:latest",
-							ImagePullPolicy: corev1.PullAlways,
+							Image:           image(instance, "apiserver-rest"),
+							ImagePullPolicy: imagePullPolicy(instance, "apiserver-rest"),
 							Env: []corev1.EnvVar{
 								{
 									Name:  "APISERVER_ENDPOINT",
@@ -53,6 +55,10 @@ func (r *ReconcilePlatform) reconcileApiserverRest(request reconcile.Request, in
 		},
 	}
 
+	if err := r.secureWorkload(instance, deploy.Name, &deploy.Spec.Template); err != nil {
+		return err
+	}
+
 	if err := controllerutil.SetControllerReference(instance, deploy, r.scheme); err != nil {
 		return err
 	}
@@ -130,10 +136,7 @@ func (r *ReconcilePlatform) reconcileApiserverRest(request reconcile.Request, in
 						HTTP: &extensionsv1beta1.HTTPIngressRuleValue{
 							Paths: []extensionsv1beta1.HTTPIngressPath{
 								{
-									Backend: extensionsv1beta1.IngressBackend{
-										ServiceName: instance.Name + "-apiserver-rest",
-										ServicePort: intstr.FromInt(8080),
-									},
+									Backend: ingressBackend(instance, instance.Name+"-apiserver-rest", 8080),
 								},
 							},
 						},
@@ -156,6 +159,13 @@ func (r *ReconcilePlatform) reconcileApiserverRest(request reconcile.Request, in
 		}
 	} else if err != nil {
 		return err
+	} else if !reflect.DeepEqual(ingress.Spec, foundIngress.Spec) {
+		foundIngress.Spec = ingress.Spec
+		log.Info("Updating Ingress", "namespace", ingress.Namespace, "name", ingress.Name)
+		err = r.Update(context.TODO(), foundIngress)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -0,0 +1,511 @@
+package platform
+
+import (
+	"context"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	infinimeshv1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1"
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+	"github.com/infinimesh/operator/pkg/pki"
+)
+
+const (
+	certManagerAPIVersion = "cert-manager.io/v1"
+
+	defaultDeviceCARenewBefore = 90 * 24 * time.Hour
+	// crlValidity is how long a revocation list is valid, it is renewed after half of it
+	crlValidity = 7 * 24 * time.Hour
+	// deviceCARequeueInterval is how often the CA and the revocation lists are checked for renewal
+	deviceCARequeueInterval = time.Hour
+
+	// deviceCAFile and deviceCRLFile are the keys of the trust Secret mounted into the MQTT bridge
+	deviceCAFile  = "ca.crt"
+	deviceCRLFile = "crl.pem"
+	// deviceCAKeys are the keys of the trusted CAs, in the order of deviceCAFile
+	deviceCAKeys = "ca.key"
+	// deviceTrustMountPath is where the MQTT bridge finds the trust Secret
+	deviceTrustMountPath = "/device-ca"
+)
+
+// DeviceCASecretName returns the name of the Secret holding the CA the operator issues device
+// certificates from.
+func DeviceCASecretName(platform string) string {
+	return platform + "-device-ca"
+}
+
+// DeviceRevocationsName returns the name of the ConfigMap with the revoked device certificates
+// whose requests or devices are gone.
+func DeviceRevocationsName(platform string) string {
+	return platform + "-device-revocations"
+}
+
+// RevokeDeviceCertificate puts the certificate with the hex encoded serial number issued by the
+// CA with the fingerprint issuer on the revocation lists of instance until it expires. The
+// revocation is kept in the ConfigMap DeviceRevocationsName, so the object the certificate was
+// issued for can be deleted right away.
+func RevokeDeviceCertificate(c client.Client, scheme *runtime.Scheme, instance *infinimeshv1beta1.Platform, issuer, serial string, notAfter time.Time) error {
+	if !time.Now().Before(notAfter) {
+		return nil
+	}
+	key := issuer + "." + serial
+	value := notAfter.UTC().Format(time.RFC3339)
+
+	found := &corev1.ConfigMap{}
+	err := c.Get(context.TODO(), types.NamespacedName{Name: DeviceRevocationsName(instance.Name), Namespace: instance.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      DeviceRevocationsName(instance.Name),
+				Namespace: instance.Namespace,
+			},
+			Data: map[string]string{key: value},
+		}
+		if err := controllerutil.SetControllerReference(instance, cm, scheme); err != nil {
+			return err
+		}
+		logger.Info("Creating ConfigMap", "namespace", cm.Namespace, "name", cm.Name)
+		return c.Create(context.TODO(), cm)
+	} else if err != nil {
+		return err
+	}
+
+	if found.Data[key] == value {
+		return nil
+	}
+	if found.Data == nil {
+		found.Data = map[string]string{}
+	}
+	found.Data[key] = value
+	logger.Info("Updating ConfigMap", "namespace", found.Namespace, "name", found.Name)
+	return c.Update(context.TODO(), found)
+}
+
+// DeviceTrustSecretName returns the name of the Secret with the CAs the MQTT bridge accepts
+// device certificates of and their revocation lists.
+func DeviceTrustSecretName(platform string) string {
+	return platform + "-device-trust"
+}
+
+// mountDeviceTrust mounts the trusted device CAs and their revocation lists into the MQTT bridge
+// and points it at them. The files are updated in place, the keys of the CAs are left out.
+func mountDeviceTrust(instance *infinimeshv1beta1.Platform, spec *corev1.PodSpec) {
+	spec.Volumes = append(spec.Volumes, corev1.Volume{
+		Name: "device-trust",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: DeviceTrustSecretName(instance.Name),
+				Items: []corev1.KeyToPath{
+					{Key: deviceCAFile, Path: deviceCAFile},
+					{Key: deviceCRLFile, Path: deviceCRLFile},
+				},
+			},
+		},
+	})
+
+	container := &spec.Containers[0]
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name:      "device-trust",
+		MountPath: deviceTrustMountPath,
+		ReadOnly:  true,
+	})
+	container.Env = append(container.Env,
+		corev1.EnvVar{Name: "CLIENT_CA_FILE", Value: deviceTrustMountPath + "/" + deviceCAFile},
+		corev1.EnvVar{Name: "CLIENT_CRL_FILE", Value: deviceTrustMountPath + "/" + deviceCRLFile},
+	)
+}
+
+// platformForDeviceCA maps the device CA Secret written by cert-manager to its platform.
+func platformForDeviceCA(o handler.MapObject) []reconcile.Request {
+	name := o.Meta.GetName()
+	const suffix = "-device-ca"
+	if len(name) <= len(suffix) || name[len(name)-len(suffix):] != suffix {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: name[:len(name)-len(suffix)], Namespace: o.Meta.GetNamespace()}}}
+}
+
+// platformForCertificateRequest maps a DeviceCertificateRequest to the platform whose revocation
+// lists it may be on.
+func platformForCertificateRequest(o handler.MapObject) []reconcile.Request {
+	request, ok := o.Object.(*infinimeshv1.DeviceCertificateRequest)
+	if !ok {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: request.Spec.Platform, Namespace: request.Namespace}}}
+}
+
+// reconcileDeviceCA maintains the device CA of the platform and the trust Secret of the MQTT
+// bridge. The CA is replaced RenewBefore it expires, either by the operator or by cert-manager.
+// The trust Secret keeps previous CAs until they expire so that devices can be issued new
+// certificates in the meantime.
+func (r *ReconcilePlatform) reconcileDeviceCA(request reconcile.Request, instance *infinimeshv1beta1.Platform) error {
+	if !instance.Spec.DeviceCA.Enabled {
+		instance.Status.DeviceCA = nil
+		return nil
+	}
+
+	var ca *pki.CA
+	var err error
+	if instance.Spec.DeviceCA.Issuer != "" {
+		ca, err = r.reconcileDeviceCACertificate(instance)
+	} else {
+		ca, err = r.reconcileSelfSignedDeviceCA(instance)
+	}
+	if err != nil || ca == nil {
+		return err
+	}
+	return r.reconcileDeviceTrust(instance, ca)
+}
+
+func deviceCAValidity(instance *infinimeshv1beta1.Platform) time.Duration {
+	if v := instance.Spec.DeviceCA.Validity; v != nil && v.Duration > 0 {
+		return v.Duration
+	}
+	return pki.DefaultCAValidity
+}
+
+func deviceCARenewBefore(instance *infinimeshv1beta1.Platform) time.Duration {
+	renewBefore := defaultDeviceCARenewBefore
+	if v := instance.Spec.DeviceCA.RenewBefore; v != nil && v.Duration > 0 {
+		renewBefore = v.Duration
+	}
+	// A CA renewed right away would be replaced on every reconcile
+	if validity := deviceCAValidity(instance); renewBefore > validity/2 {
+		renewBefore = validity / 2
+	}
+	return renewBefore
+}
+
+func (r *ReconcilePlatform) reconcileSelfSignedDeviceCA(instance *infinimeshv1beta1.Platform) (*pki.CA, error) {
+	log := logger.WithName("device-ca")
+	name := DeviceCASecretName(instance.Name)
+
+	found := &corev1.Secret{}
+	err := r.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: instance.Namespace}, found)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	exists := err == nil
+	if exists {
+		ca, err := pki.LoadCA(found.Data[corev1.TLSCertKey], found.Data[corev1.TLSPrivateKeyKey])
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the device CA: %v", err)
+		}
+		if time.Until(ca.Cert.NotAfter) > deviceCARenewBefore(instance) {
+			return ca, nil
+		}
+	}
+
+	cert, key, err := pki.NewCA(name, deviceCAValidity(instance))
+	if err != nil {
+		return nil, err
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: instance.Namespace,
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       cert,
+			corev1.TLSPrivateKeyKey: key,
+		},
+	}
+	if err := controllerutil.SetControllerReference(instance, secret, r.scheme); err != nil {
+		return nil, err
+	}
+	if !exists {
+		log.Info("Creating Secret", "namespace", secret.Namespace, "name", secret.Name)
+		err = r.Create(context.TODO(), secret)
+	} else {
+		found.Data = secret.Data
+		log.Info("Rotating device CA", "namespace", secret.Namespace, "name", secret.Name)
+		err = r.Update(context.TODO(), found)
+		if err == nil {
+			r.recorder.Event(instance, corev1.EventTypeNormal, "DeviceCARotated", "Replaced the device CA, the previous one stays trusted until it expires")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pki.LoadCA(cert, key)
+}
+
+// reconcileDeviceCACertificate has cert-manager issue the CA from the configured issuer. It
+// returns nil until cert-manager wrote the Secret.
+func (r *ReconcilePlatform) reconcileDeviceCACertificate(instance *infinimeshv1beta1.Platform) (*pki.CA, error) {
+	log := logger.WithName("device-ca")
+	name := DeviceCASecretName(instance.Name)
+
+	issuerKind := instance.Spec.DeviceCA.IssuerKind
+	if issuerKind == "" {
+		issuerKind = "Issuer"
+	}
+	spec := map[string]interface{}{
+		"secretName":  name,
+		"commonName":  name,
+		"isCA":        true,
+		"duration":    deviceCAValidity(instance).String(),
+		"renewBefore": deviceCARenewBefore(instance).String(),
+		"privateKey": map[string]interface{}{
+			"algorithm": "ECDSA",
+			"size":      int64(256),
+		},
+		"usages": []interface{}{"cert sign", "crl sign", "digital signature"},
+		"issuerRef": map[string]interface{}{
+			"name":  instance.Spec.DeviceCA.Issuer,
+			"kind":  issuerKind,
+			"group": "cert-manager.io",
+		},
+	}
+	certificate := &unstructured.Unstructured{}
+	certificate.Object = map[string]interface{}{
+		"kind":       "Certificate",
+		"apiVersion": certManagerAPIVersion,
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": instance.Namespace,
+		},
+		"spec": spec,
+	}
+	if err := controllerutil.SetControllerReference(instance, certificate, r.scheme); err != nil {
+		return nil, err
+	}
+
+	found := &unstructured.Unstructured{}
+	found.SetAPIVersion(certManagerAPIVersion)
+	found.SetKind("Certificate")
+	err := r.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: instance.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		log.Info("Creating Certificate", "namespace", instance.Namespace, "name", name)
+		if err := r.Create(context.TODO(), certificate); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	} else {
+		// cert-manager defaults further fields, only the ones set here are compared
+		foundSpec, _, _ := unstructured.NestedMap(found.Object, "spec")
+		if foundSpec == nil {
+			foundSpec = map[string]interface{}{}
+		}
+		changed := false
+		for k, v := range spec {
+			if !reflect.DeepEqual(foundSpec[k], v) {
+				foundSpec[k] = v
+				changed = true
+			}
+		}
+		if changed {
+			found.Object["spec"] = foundSpec
+			log.Info("Updating Certificate", "namespace", instance.Namespace, "name", name)
+			if err := r.Update(context.TODO(), found); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	secret := &corev1.Secret{}
+	err = r.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: instance.Namespace}, secret)
+	if err != nil && errors.IsNotFound(err) {
+		log.Info("Waiting for cert-manager to issue the device CA", "namespace", instance.Namespace, "name", name)
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return pki.LoadCA(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+}
+
+// reconcileDeviceTrust writes the CAs the MQTT bridge trusts, ca first, and a revocation list
+// for each of them.
+func (r *ReconcilePlatform) reconcileDeviceTrust(instance *infinimeshv1beta1.Platform, ca *pki.CA) error {
+	log := logger.WithName("device-ca")
+	name := DeviceTrustSecretName(instance.Name)
+
+	found := &corev1.Secret{}
+	err := r.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: instance.Namespace}, found)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	exists := err == nil
+
+	cas := []*pki.CA{ca}
+	if exists {
+		previous, err := pki.LoadCAs(found.Data[deviceCAFile], found.Data[deviceCAKeys])
+		if err != nil {
+			return fmt.Errorf("failed to load the trusted device CAs: %v", err)
+		}
+		for _, p := range previous {
+			if pki.HexFingerprint(p.Cert) != pki.HexFingerprint(ca.Cert) && time.Now().Before(p.Cert.NotAfter) {
+				cas = append(cas, p)
+			}
+		}
+	}
+
+	revoked, err := r.revokedDeviceCertificates(instance)
+	if err != nil {
+		return err
+	}
+	var crls []byte
+	for _, c := range cas {
+		crl, err := deviceCRL(c, revoked[pki.HexFingerprint(c.Cert)], found.Data[deviceCRLFile])
+		if err != nil {
+			return err
+		}
+		crls = append(crls, crl...)
+	}
+
+	certs, keys, err := pki.EncodeCAs(cas)
+	if err != nil {
+		return err
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: instance.Namespace,
+		},
+		Data: map[string][]byte{
+			deviceCAFile:  certs,
+			deviceCAKeys:  keys,
+			deviceCRLFile: crls,
+		},
+	}
+	if err := controllerutil.SetControllerReference(instance, secret, r.scheme); err != nil {
+		return err
+	}
+	if !exists {
+		log.Info("Creating Secret", "namespace", secret.Namespace, "name", secret.Name)
+		err = r.Create(context.TODO(), secret)
+	} else if !reflect.DeepEqual(found.Data, secret.Data) {
+		found.Data = secret.Data
+		log.Info("Updating Secret", "namespace", secret.Namespace, "name", secret.Name)
+		err = r.Update(context.TODO(), found)
+	}
+	if err != nil {
+		return err
+	}
+
+	status := &infinimeshv1beta1.PlatformDeviceCAStatus{
+		Fingerprint: pki.HexFingerprint(ca.Cert),
+		NotAfter:    metav1.NewTime(ca.Cert.NotAfter.Local()),
+	}
+	for _, c := range cas {
+		status.Trusted = append(status.Trusted, pki.HexFingerprint(c.Cert))
+	}
+	instance.Status.DeviceCA = status
+	return nil
+}
+
+// revokedDeviceCertificates returns the serial numbers of the revoked certificates of the
+// platform that have not expired yet, by the fingerprint of their CA. These are the revoked
+// requests and the revocations in the ConfigMap DeviceRevocationsName, expired ones are dropped
+// from it.
+func (r *ReconcilePlatform) revokedDeviceCertificates(instance *infinimeshv1beta1.Platform) (map[string][]*big.Int, error) {
+	serials := map[string]map[string]bool{}
+	add := func(issuer, serial string) {
+		if serials[issuer] == nil {
+			serials[issuer] = map[string]bool{}
+		}
+		serials[issuer][serial] = true
+	}
+
+	requests := &infinimeshv1.DeviceCertificateRequestList{}
+	if err := r.List(context.TODO(), &client.ListOptions{Namespace: instance.Namespace}, requests); err != nil {
+		return nil, err
+	}
+	for _, request := range requests.Items {
+		if request.Spec.Platform != instance.Name || request.Status.SerialNumber == "" {
+			continue
+		}
+		if !request.Spec.Revoked && request.DeletionTimestamp == nil {
+			continue
+		}
+		if request.Status.NotAfter != nil && time.Now().After(request.Status.NotAfter.Time) {
+			continue
+		}
+		add(request.Status.Issuer, request.Status.SerialNumber)
+	}
+
+	revocations := &corev1.ConfigMap{}
+	err := r.Get(context.TODO(), types.NamespacedName{Name: DeviceRevocationsName(instance.Name), Namespace: instance.Namespace}, revocations)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	expired := false
+	for key, value := range revocations.Data {
+		notAfter, err := time.Parse(time.RFC3339, value)
+		dot := strings.LastIndex(key, ".")
+		if err != nil || dot < 0 || time.Now().After(notAfter) {
+			delete(revocations.Data, key)
+			expired = true
+			continue
+		}
+		add(key[:dot], key[dot+1:])
+	}
+	if expired {
+		logger.Info("Updating ConfigMap", "namespace", revocations.Namespace, "name", revocations.Name)
+		if err := r.Update(context.TODO(), revocations); err != nil {
+			return nil, err
+		}
+	}
+
+	revoked := map[string][]*big.Int{}
+	for issuer := range serials {
+		for serial := range serials[issuer] {
+			if n, ok := new(big.Int).SetString(serial, 16); ok {
+				revoked[issuer] = append(revoked[issuer], n)
+			}
+		}
+		sort.Slice(revoked[issuer], func(i, j int) bool { return revoked[issuer][i].Cmp(revoked[issuer][j]) < 0 })
+	}
+	return revoked, nil
+}
+
+// deviceCRL returns the revocation list of ca. The list found in current is kept unless the
+// revoked certificates changed or it is about to expire, so that the trust Secret only changes
+// when it has to.
+func deviceCRL(ca *pki.CA, revoked []*big.Int, current []byte) ([]byte, error) {
+	crls, err := pki.ParseCRLs(current)
+	if err != nil {
+		crls = nil
+	}
+	for _, crl := range crls {
+		if ca.Cert.CheckCRLSignature(crl.CertificateList) != nil {
+			continue
+		}
+		if time.Until(crl.TBSCertList.NextUpdate) < crlValidity/2 || !sameSerials(crl.TBSCertList.RevokedCertificates, revoked) {
+			break
+		}
+		return crl.PEM, nil
+	}
+	return ca.CRL(revoked, time.Now().Add(crlValidity))
+}
+
+func sameSerials(entries []pkix.RevokedCertificate, serials []*big.Int) bool {
+	if len(entries) != len(serials) {
+		return false
+	}
+	for i := range entries {
+		if entries[i].SerialNumber.Cmp(serials[i]) != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package platform
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+
+	infinimeshv1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1"
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+	"github.com/infinimesh/operator/pkg/clients/fake"
+	"github.com/infinimesh/operator/pkg/pki"
+)
+
+func TestDeviceCRL(t *testing.T) {
+	var cas []*pki.CA
+	for _, name := range []string{"current", "previous"} {
+		cert, key, err := pki.NewCA(name, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ca, err := pki.LoadCA(cert, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cas = append(cas, ca)
+	}
+	revoked := []*big.Int{big.NewInt(1), big.NewInt(2)}
+
+	current, err := deviceCRL(cas[0], revoked, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous, err := deviceCRL(cas[1], nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle := append(append([]byte{}, previous...), current...)
+
+	// Unchanged lists are kept as they are
+	crl, err := deviceCRL(cas[0], revoked, bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(crl, current) {
+		t.Error("unchanged CRL of the current CA was issued again")
+	}
+	crl, err = deviceCRL(cas[1], nil, bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(crl, previous) {
+		t.Error("unchanged CRL of the previous CA was issued again")
+	}
+
+	// A newly revoked certificate issues a new list
+	crl, err = deviceCRL(cas[0], append(revoked, big.NewInt(3)), bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crls, err := pki.ParseCRLs(crl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(crls) != 1 || len(crls[0].TBSCertList.RevokedCertificates) != 3 {
+		t.Errorf("expected a CRL with 3 revoked certificates, got %v", crls)
+	}
+	if err := cas[0].Cert.CheckCRLSignature(crls[0].CertificateList); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDeviceCARenewBefore(t *testing.T) {
+	instance := &infinimeshv1beta1.Platform{}
+	if got := deviceCARenewBefore(instance); got != defaultDeviceCARenewBefore {
+		t.Errorf("default renewBefore = %v, want %v", got, defaultDeviceCARenewBefore)
+	}
+
+	instance.Spec.DeviceCA.Validity = &metav1.Duration{Duration: 24 * time.Hour}
+	if got := deviceCARenewBefore(instance); got != 12*time.Hour {
+		t.Errorf("renewBefore = %v, want it capped at half the validity", got)
+	}
+
+	instance.Spec.DeviceCA.RenewBefore = &metav1.Duration{Duration: time.Hour}
+	if got := deviceCARenewBefore(instance); got != time.Hour {
+		t.Errorf("renewBefore = %v, want 1h", got)
+	}
+}
+
+func TestRevokedDeviceCertificates(t *testing.T) {
+	c := newMemoryClient(scheme.Scheme)
+	r := &ReconcilePlatform{Client: c, scheme: scheme.Scheme, recorder: record.NewFakeRecorder(100), clients: fake.NewFactory()}
+	instance := &infinimeshv1beta1.Platform{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"}}
+
+	notAfter := metav1.NewTime(time.Now().Add(time.Hour))
+	request := &infinimeshv1.DeviceCertificateRequest{
+		ObjectMeta: metav1.ObjectMeta{Name: "revoked", Namespace: "default"},
+		Spec:       infinimeshv1.DeviceCertificateRequestSpec{Platform: "foo", Revoked: true},
+		Status:     infinimeshv1.DeviceCertificateRequestStatus{SerialNumber: "a", Issuer: "ca", NotAfter: &notAfter},
+	}
+	if err := c.Create(context.TODO(), request); err != nil {
+		t.Fatal(err)
+	}
+
+	// Certificates of deleted objects are revoked until they expire
+	if err := RevokeDeviceCertificate(c, scheme.Scheme, instance, "ca", "b", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := RevokeDeviceCertificate(c, scheme.Scheme, instance, "previous", "c", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := RevokeDeviceCertificate(c, scheme.Scheme, instance, "ca", "d", time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	revocations := &corev1.ConfigMap{}
+	name := types.NamespacedName{Name: DeviceRevocationsName("foo"), Namespace: "default"}
+	if err := c.Get(context.TODO(), name, revocations); err != nil {
+		t.Fatal(err)
+	}
+	if len(revocations.Data) != 2 {
+		t.Errorf("revocations %v, the expired certificate shouldn't be recorded", revocations.Data)
+	}
+	revocations.Data["ca.e"] = time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	if err := c.Update(context.TODO(), revocations); err != nil {
+		t.Fatal(err)
+	}
+
+	revoked, err := r.revokedDeviceCertificates(instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(revoked); got != "map[ca:[10 11] previous:[12]]" {
+		t.Errorf("revoked %v", got)
+	}
+	if err := c.Get(context.TODO(), name, revocations); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := revocations.Data["ca.e"]; ok || len(revocations.Data) != 2 {
+		t.Errorf("expired revocations are kept: %v", revocations.Data)
+	}
+}
@@ -35,18 +35,9 @@ func (r *ReconcilePlatform) reconcileRegistry(request reconcile.Request, instanc
 					Containers: []corev1.Container{
 						{
 							Name:            "device-registry",
-							Image:           "quay.io/infinimesh/device-registry:latest",
-							ImagePullPolicy: corev1.PullAlways,
-							Env: []corev1.EnvVar{
-								{
-									Name:  "DGRAPH_HOST",
-									Value: instance.Name + "-dgraph-alpha:9080", // TODO
-								},
-								{
-									Name:  "DB_ADDR2",
-									Value: instance.Name + "-redis-device-details:6379", // TODO
-								},
-							},
+							Image:           image(instance, "device-registry"),
+							ImagePullPolicy: imagePullPolicy(instance, "device-registry"),
+							Env: append(dgraphEnv(instance), redisEnv(instance.Name+"-redis-device-details", instance.Spec.Redis.DeviceDetails, "2")...),
 						},
 					},
 				},
@@ -54,6 +45,10 @@ func (r *ReconcilePlatform) reconcileRegistry(request reconcile.Request, instanc
 		},
 	}
 
+	if err := r.secureWorkload(instance, deploy.Name, &deploy.Spec.Template); err != nil {
+		return err
+	}
+
 	if err := controllerutil.SetControllerReference(instance, deploy, r.scheme); err != nil {
 		return err
 	}
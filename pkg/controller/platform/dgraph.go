@@ -3,10 +3,8 @@ package platform
 import (
 	"context"
 	"encoding/base64"
-	"fmt"
 	"strings"
 
-	"google.golang.org/grpc"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -17,12 +15,9 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
-	"github.com/dgraph-io/dgo"
-	"github.com/dgraph-io/dgo/protos/api"
 	"github.com/go-logr/logr"
 
 	"github.com/infinimesh/infinimesh/pkg/node"
-	"github.com/infinimesh/infinimesh/pkg/node/dgraph"
 	"github.com/infinimesh/infinimesh/pkg/node/nodepb"
 	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
 )
@@ -31,6 +26,50 @@ const (
 	defaultStorage = "10Gi"
 )
 
+// dgraphEnv returns the environment the infinimesh services need to reach dgraph.
+func dgraphEnv(instance *infinimeshv1beta1.Platform) []corev1.EnvVar {
+	external := instance.Spec.DGraph.External
+	if external == nil {
+		return []corev1.EnvVar{
+			{
+				Name:  "DGRAPH_HOST",
+				Value: instance.Name + "-dgraph-alpha:9080", // TODO
+			},
+		}
+	}
+
+	env := []corev1.EnvVar{
+		{
+			Name:  "DGRAPH_HOST",
+			Value: external.Address,
+		},
+	}
+	if external.CredentialsSecret != "" {
+		env = append(env, corev1.EnvVar{
+			Name: "DGRAPH_USERNAME",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: external.CredentialsSecret,
+					},
+					Key: "username",
+				},
+			},
+		}, corev1.EnvVar{
+			Name: "DGRAPH_PASSWORD",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: external.CredentialsSecret,
+					},
+					Key: "password",
+				},
+			},
+		})
+	}
+	return env
+}
+
 func setPassword(instance *infinimeshv1beta1.Platform, username, pw string, nodeserverClient nodepb.AccountServiceClient, log logr.Logger, repo node.Repo) error {
 	// Try to login
 	rootAccount, err := repo.GetAccount(context.TODO(), "0x2")
@@ -46,6 +85,7 @@ func setPassword(instance *infinimeshv1beta1.Platform, username, pw string, node
 			log.Info("Failed to Authenticate with root. Try to update the password for root", "error", err)
 		} else {
 			log.Info("Logged in with root, password is up to date")
+			observeRootPasswordSync(instance, "up-to-date")
 			return nil
 		}
 
@@ -58,6 +98,7 @@ func setPassword(instance *infinimeshv1beta1.Platform, username, pw string, node
 			log.Info("Failed to set password. Have to create account", "err", err.Error())
 		} else {
 			log.Info("Set Password to content of secret")
+			observeRootPasswordSync(instance, "updated")
 		}
 
 	}
@@ -66,6 +107,7 @@ func setPassword(instance *infinimeshv1beta1.Platform, username, pw string, node
 		accid, err := repo.CreateUserAccount(context.TODO(), "root", pw, true, true, true)
 		if err != nil {
 			log.Error(err, "Failed to create root account")
+			observeRootPasswordSync(instance, "failed")
 			return err
 		}
 
@@ -76,32 +118,27 @@ func setPassword(instance *infinimeshv1beta1.Platform, username, pw string, node
 
 		// Write event
 		log.Info("Created admin account", "ID", respCreate.Uid)
+		observeRootPasswordSync(instance, "created")
 	}
 	return nil
 }
 
-func (r *ReconcilePlatform) syncRootPassword(request reconcile.Request, instance *infinimeshv1beta1.Platform, repo node.Repo) error {
+// reconcileRootAccountSecret creates the Secret with the password of the root account with a
+// random one, and returns the password in it. It is empty if the Secret has none.
+func (r *ReconcilePlatform) reconcileRootAccountSecret(instance *infinimeshv1beta1.Platform) (string, error) {
 	log := logger.WithName("rootpw")
-	hostNodeserver := instance.Name + "-nodeserver." + instance.Namespace + ".svc.cluster.local:8080"
-	nodeserverConn, err := grpc.Dial(hostNodeserver, grpc.WithInsecure())
-	if err != nil {
-		return err
-	}
-
-	nodeserverClient := nodepb.NewAccountServiceClient(nodeserverConn)
-
-	randomKey, err := GenerateRandomBytes(32)
-	if err != nil {
-		return err
-	}
-
-	pw := base64.StdEncoding.EncodeToString([]byte(randomKey))
 
 	foundAdminSecret := &corev1.Secret{}
-	err = r.Get(context.TODO(), types.NamespacedName{Name: instance.Name + "-root-account", Namespace: instance.Namespace}, foundAdminSecret)
+	err := r.Get(context.TODO(), types.NamespacedName{Name: instance.Name + "-root-account", Namespace: instance.Namespace}, foundAdminSecret)
 	if err != nil && errors.IsNotFound(err) {
 		log.Info("Creating admin secret", "namespace", instance.Namespace, "name", instance.Name+"-root-account")
 
+		randomKey, err := GenerateRandomBytes(32)
+		if err != nil {
+			return "", err
+		}
+		pw := base64.StdEncoding.EncodeToString([]byte(randomKey))
+
 		secretAdmin := &corev1.Secret{
 			ObjectMeta: metav1.ObjectMeta{
 				Name:      instance.Name + "-root-account",
@@ -112,47 +149,41 @@ func (r *ReconcilePlatform) syncRootPassword(request reconcile.Request, instance
 				"password": pw,
 			},
 		}
-
-		log.Info("gRPC dial OK")
-		nodeserverClient := nodepb.NewAccountServiceClient(nodeserverConn)
-
-		err = setPassword(instance, "root", pw, nodeserverClient, log.WithName("setPassword"), repo)
-		if err != nil {
-			return err
-		}
-
 		if err := controllerutil.SetControllerReference(instance, secretAdmin, r.scheme); err != nil {
-			return err
-		}
-
-		err = r.Create(context.TODO(), secretAdmin)
-		if err != nil {
-			return err
+			return "", err
 		}
+		return pw, r.Create(context.TODO(), secretAdmin)
 	} else if err != nil {
-		return err
-	} else {
-		// Exists, sync password in secret to password in dgraph
-
-		secretB64, ok := foundAdminSecret.Data["password"]
-		if !ok {
-			log.Info("No password field present in secret, ignoring")
-			return nil
-		}
+		return "", err
+	}
 
-		secretStr := strings.Trim(string(secretB64), "\n")
+	secretB64, ok := foundAdminSecret.Data["password"]
+	if !ok {
+		log.Info("No password field present in secret, ignoring")
+		return "", nil
+	}
+	return strings.Trim(string(secretB64), "\n"), nil
+}
 
-		err = setPassword(instance, "root", secretStr, nodeserverClient, log.WithName("setPassword"), repo)
-		if err != nil {
-			return err
-		}
+// syncRootPassword sets the password of the root account in dgraph to pw, the one of the Secret.
+func (r *ReconcilePlatform) syncRootPassword(request reconcile.Request, instance *infinimeshv1beta1.Platform, repo node.Repo, pw string) error {
+	log := logger.WithName("rootpw")
+	nodeserverClient, conn, err := r.clients.Nodeserver(instance)
+	if err != nil {
+		return err
 	}
-	return nil
+	defer conn.Close()
+
+	return setPassword(instance, "root", pw, nodeserverClient, log.WithName("setPassword"), repo)
 }
 
 func (r *ReconcilePlatform) reconcileDgraph(request reconcile.Request, instance *infinimeshv1beta1.Platform) error {
 	log := logger.WithName("dgraph")
 
+	if instance.Spec.DGraph.External != nil {
+		return r.reconcileDgraphSchema(request, instance)
+	}
+
 	replicas := int32(3)
 
 	svc := &corev1.Service{
@@ -323,6 +354,10 @@ fi
 		},
 	}
 
+	if err := r.secureWorkload(instance, statefulSetZero.Name, &statefulSetZero.Spec.Template); err != nil {
+		return err
+	}
+
 	if err := controllerutil.SetControllerReference(instance, statefulSetZero, r.scheme); err != nil {
 		return err
 	}
@@ -508,6 +543,10 @@ dgraph alpha --my=$(hostname -f):7080 --lru_mb 2048 --zero ` + instance.Name + `
 		},
 	}
 
+	if err := r.secureWorkload(instance, statefulSetAlpha.Name, &statefulSetAlpha.Spec.Template); err != nil {
+		return err
+	}
+
 	if err := controllerutil.SetControllerReference(instance, statefulSetAlpha, r.scheme); err != nil {
 		return err
 	}
@@ -524,28 +563,45 @@ dgraph alpha --my=$(hostname -f):7080 --lru_mb 2048 --zero ` + instance.Name + `
 		return err
 	}
 
+	return r.reconcileDgraphSchema(request, instance)
+}
+
+// reconcileDgraphSchema imports the schema into the platform's dgraph, in-cluster or external,
+// and syncs the root account password.
+func (r *ReconcilePlatform) reconcileDgraphSchema(request reconcile.Request, instance *infinimeshv1beta1.Platform) error {
+	log := logger.WithName("dgraph")
+
+	// The Secret is rendered as well, the password is set once dgraph is reachable
+	pw, err := r.reconcileRootAccountSecret(instance)
+	if err != nil {
+		return err
+	}
+
+	if r.offline {
+		return nil
+	}
+
 	// TODO: install schema; then update status with that info
 	// TODO do this only if necessary -- commit to build
-	host := instance.Name + "-dgraph-alpha." + instance.Namespace + ".svc.cluster.local:9080"
-	conn, err := grpc.Dial(host, grpc.WithInsecure())
+	repo, conn, err := r.clients.Dgraph(instance)
 	if err != nil {
-		fmt.Println("Failed to connect to dg", err)
+		log.Error(err, "Failed to connect to dgraph")
+		return nil
 	}
+	defer conn.Close()
 
-	dg := dgo.NewDgraphClient(api.NewDgraphClient(conn))
-	repo := dgraph.NewDGraphRepo(dg)
-
-	err = dgraph.ImportSchema(dg, false)
+	err = repo.ImportSchema()
 	if err != nil {
 		log.Error(err, "Failed to import schema")
 	}
 	log.Info("Imported schema")
 
-	err = r.syncRootPassword(request, instance, repo)
-	if err != nil {
-		log.Error(err, "Failed to sync password")
+	if pw != "" {
+		err = r.syncRootPassword(request, instance, repo, pw)
+		if err != nil {
+			log.Error(err, "Failed to sync password")
+		}
 	}
 
 	return nil
-
 }
@@ -0,0 +1,336 @@
+package platform
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/yaml"
+
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+)
+
+// ObjectDiff is a change the reconcilers would make to an object.
+type ObjectDiff struct {
+	// Action is one of create, update or delete
+	Action    string
+	Kind      string
+	Namespace string
+	Name      string
+	// Diff of the live object and the object as the apiserver would store it, in YAML
+	Diff string
+}
+
+func (d ObjectDiff) String() string {
+	return fmt.Sprintf("%v %v %v/%v", d.Action, d.Kind, d.Namespace, d.Name)
+}
+
+// DryRun makes the controller report the changes it would make to each platform as events
+// instead of making them. Set it before Add.
+var DryRun bool
+
+// Diff returns the changes the reconcilers would make to the objects of instance, without
+// changing anything. Reads go to c, writes are sent to the apiserver as dry-runs so defaulting
+// and admission don't show up as changes.
+func Diff(c client.Client, dyn dynamic.Interface, mapper meta.RESTMapper, scheme *runtime.Scheme, instance *infinimeshv1beta1.Platform) ([]ObjectDiff, error) {
+	var diffs []ObjectDiff
+	r := &ReconcilePlatform{
+		Client: &dryRunClient{
+			Client:  c,
+			dynamic: dyn,
+			mapper:  mapper,
+			scheme:  scheme,
+			report:  func(obj runtime.Object, d ObjectDiff) { diffs = append(diffs, d) },
+		},
+		scheme:   scheme,
+		recorder: &record.FakeRecorder{},
+		offline:  true,
+	}
+
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: instance.Name, Namespace: instance.Namespace}}
+	for _, comp := range r.components(instance) {
+		if unmanaged(instance, comp.name) {
+			continue
+		}
+		if err := comp.reconcile(request, instance); err != nil {
+			return diffs, fmt.Errorf("%v: %v", comp.name, err)
+		}
+	}
+	return diffs, nil
+}
+
+// dryRunClient reads from the cluster and reports writes instead of making them.
+type dryRunClient struct {
+	client.Client
+	dynamic dynamic.Interface
+	mapper  meta.RESTMapper
+	scheme  *runtime.Scheme
+	report  func(runtime.Object, ObjectDiff)
+}
+
+// enableDryRun replaces the client of r by a dryRunClient recording diffs as events.
+func (r *ReconcilePlatform) enableDryRun(mgr manager.Manager) error {
+	dyn, err := dynamic.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return err
+	}
+	r.offline = true
+	r.Client = &dryRunClient{
+		Client:  mgr.GetClient(),
+		dynamic: dyn,
+		mapper:  mgr.GetRESTMapper(),
+		scheme:  mgr.GetScheme(),
+		report:  r.reportDiff,
+	}
+	return nil
+}
+
+// maxEventDiff is the length of the diffs in events, the full diff is logged.
+const maxEventDiff = 768
+
+func (r *ReconcilePlatform) reportDiff(obj runtime.Object, d ObjectDiff) {
+	logger.Info("Dry-run", "action", d.Action, "kind", d.Kind, "namespace", d.Namespace, "name", d.Name, "diff", d.Diff)
+
+	platform := ownerPlatform(obj)
+	if platform == nil {
+		return
+	}
+	diff := d.Diff
+	if len(diff) > maxEventDiff {
+		diff = diff[:maxEventDiff] + "\n..."
+	}
+	r.recorder.Eventf(platform, corev1.EventTypeNormal, "DryRun", "Would %v %v %v:\n%v", d.Action, d.Kind, d.Name, diff)
+}
+
+var dryRunAll = []string{metav1.DryRunAll}
+
+func (c *dryRunClient) resource(obj runtime.Object) (dynamic.ResourceInterface, *unstructured.Unstructured, error) {
+	gvk, err := apiutil.GVKForObject(obj, c.scheme)
+	if err != nil {
+		return nil, nil, err
+	}
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	u := &unstructured.Unstructured{}
+	u.Object, err = runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, nil, err
+	}
+	u.SetGroupVersionKind(gvk)
+
+	if mapping.Scope.Name() == meta.RESTScopeNameRoot {
+		return c.dynamic.Resource(mapping.Resource), u, nil
+	}
+	return c.dynamic.Resource(mapping.Resource).Namespace(u.GetNamespace()), u, nil
+}
+
+func (c *dryRunClient) Create(ctx context.Context, obj runtime.Object) error {
+	res, u, err := c.resource(obj)
+	if err != nil {
+		return err
+	}
+	created, err := res.Create(u, metav1.CreateOptions{DryRun: dryRunAll})
+	if err != nil {
+		return err
+	}
+	c.report(obj, objectDiff("create", nil, created))
+	return nil
+}
+
+func (c *dryRunClient) Update(ctx context.Context, obj runtime.Object) error {
+	res, u, err := c.resource(obj)
+	if err != nil {
+		return err
+	}
+	live, err := res.Get(u.GetName(), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	updated, err := res.Update(u, metav1.UpdateOptions{DryRun: dryRunAll})
+	if err != nil {
+		return err
+	}
+	if d := objectDiff("update", live, updated); d.Diff != "" {
+		c.report(obj, d)
+	}
+	return nil
+}
+
+func (c *dryRunClient) Delete(ctx context.Context, obj runtime.Object, opts ...client.DeleteOptionFunc) error {
+	res, u, err := c.resource(obj)
+	if err != nil {
+		return err
+	}
+	live, err := res.Get(u.GetName(), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	err = res.Delete(u.GetName(), &metav1.DeleteOptions{DryRun: dryRunAll})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	c.report(obj, objectDiff("delete", live, nil))
+	return nil
+}
+
+// Status discards status updates.
+func (c *dryRunClient) Status() client.StatusWriter {
+	return noopStatusWriter{}
+}
+
+type noopStatusWriter struct{}
+
+func (noopStatusWriter) Update(ctx context.Context, obj runtime.Object) error {
+	return nil
+}
+
+// objectDiff compares the live object with the one the apiserver would store, either may be nil.
+func objectDiff(action string, live, desired *unstructured.Unstructured) ObjectDiff {
+	obj := desired
+	if obj == nil {
+		obj = live
+	}
+	return ObjectDiff{
+		Action:    action,
+		Kind:      obj.GetKind(),
+		Namespace: obj.GetNamespace(),
+		Name:      obj.GetName(),
+		Diff:      lineDiff(diffableYAML(live), diffableYAML(desired)),
+	}
+}
+
+// diffableYAML returns obj without the fields set by the apiserver, with secret values hashed.
+func diffableYAML(obj *unstructured.Unstructured) string {
+	if obj == nil {
+		return ""
+	}
+	obj = obj.DeepCopy()
+	delete(obj.Object, "status")
+	for _, field := range []string{"uid", "resourceVersion", "generation", "creationTimestamp", "selfLink", "managedFields"} {
+		unstructured.RemoveNestedField(obj.Object, "metadata", field)
+	}
+	unstructured.RemoveNestedField(obj.Object, "metadata", "annotations", "deployment.kubernetes.io/revision")
+	if len(obj.GetAnnotations()) == 0 {
+		unstructured.RemoveNestedField(obj.Object, "metadata", "annotations")
+	}
+
+	if obj.GetKind() == "Secret" {
+		for _, field := range []string{"data", "stringData"} {
+			values, _, _ := unstructured.NestedMap(obj.Object, field)
+			for k, v := range values {
+				values[k] = fmt.Sprintf("REDACTED-%x", sha256.Sum256([]byte(fmt.Sprint(v))))[:17]
+			}
+			if values != nil {
+				unstructured.SetNestedMap(obj.Object, values, field)
+			}
+		}
+	}
+
+	b, err := yaml.Marshal(obj.Object)
+	if err != nil {
+		return err.Error()
+	}
+	return string(b)
+}
+
+// lineDiff returns the lines of a and b that differ, prefixed by - and + and surrounded by
+// diffContext unchanged lines, or an empty string if a and b are equal.
+func lineDiff(a, b string) string {
+	if a == b {
+		return ""
+	}
+	x := splitLines(a)
+	y := splitLines(b)
+
+	// Longest common subsequence of lines
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	type line struct {
+		op   byte
+		text string
+	}
+	var lines []line
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			lines = append(lines, line{' ', x[i]})
+			i++
+			j++
+		case i < len(x) && (j == len(y) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, line{'-', x[i]})
+			i++
+		default:
+			lines = append(lines, line{'+', y[j]})
+			j++
+		}
+	}
+
+	const diffContext = 3
+	var out strings.Builder
+	last := -1
+	for k, l := range lines {
+		if l.op == ' ' || k <= last {
+			continue
+		}
+		start := k - diffContext
+		if start < last+1 {
+			start = last + 1
+		}
+		if start > last+1 {
+			out.WriteString("...\n")
+		}
+		end := k + diffContext
+		for n := k + 1; n < len(lines) && n <= end; n++ {
+			if lines[n].op != ' ' {
+				end = n + diffContext
+			}
+		}
+		if end >= len(lines) {
+			end = len(lines) - 1
+		}
+		for n := start; n <= end; n++ {
+			fmt.Fprintf(&out, "%c %v\n", lines[n].op, lines[n].text)
+		}
+		last = end
+	}
+	return out.String()
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
@@ -0,0 +1,260 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package platform
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+	"github.com/infinimesh/operator/pkg/clients/fake"
+)
+
+// readOnlyClient fails the test on writes.
+type readOnlyClient struct {
+	client.Client
+	t *testing.T
+}
+
+func (c *readOnlyClient) Create(ctx context.Context, obj runtime.Object) error {
+	c.t.Errorf("create reached the client: %T", obj)
+	return nil
+}
+
+func (c *readOnlyClient) Update(ctx context.Context, obj runtime.Object) error {
+	c.t.Errorf("update reached the client: %T", obj)
+	return nil
+}
+
+func (c *readOnlyClient) Delete(ctx context.Context, obj runtime.Object, opts ...client.DeleteOptionFunc) error {
+	c.t.Errorf("delete reached the client: %T", obj)
+	return nil
+}
+
+func (c *readOnlyClient) Status() client.StatusWriter {
+	return c
+}
+
+// dryRunAPI is a dynamic.Interface serving the objects of a memoryClient. It fails the test on
+// writes that aren't dry-runs and returns what they would have stored.
+type dryRunAPI struct {
+	t      *testing.T
+	live   *memoryClient
+	mapper meta.RESTMapper
+	writes int
+}
+
+type dryRunResource struct {
+	dynamic.ResourceInterface
+	api       *dryRunAPI
+	resource  schema.GroupVersionResource
+	namespace string
+}
+
+func (a *dryRunAPI) Resource(resource schema.GroupVersionResource) dynamic.NamespaceableResourceInterface {
+	return &dryRunResource{api: a, resource: resource}
+}
+
+func (r *dryRunResource) Namespace(namespace string) dynamic.ResourceInterface {
+	return &dryRunResource{api: r.api, resource: r.resource, namespace: namespace}
+}
+
+func (r *dryRunResource) dryRun(verb string, dryRun []string) {
+	r.api.writes++
+	if len(dryRun) != 1 || dryRun[0] != metav1.DryRunAll {
+		r.api.t.Errorf("%v %v isn't a dry-run", verb, r.resource)
+	}
+}
+
+func (r *dryRunResource) Create(obj *unstructured.Unstructured, options metav1.CreateOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	r.dryRun("create", options.DryRun)
+	return obj, nil
+}
+
+func (r *dryRunResource) Update(obj *unstructured.Unstructured, options metav1.UpdateOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	r.dryRun("update", options.DryRun)
+	return obj, nil
+}
+
+func (r *dryRunResource) Delete(name string, options *metav1.DeleteOptions, subresources ...string) error {
+	r.dryRun("delete", options.DryRun)
+	return nil
+}
+
+func (r *dryRunResource) Get(name string, options metav1.GetOptions, subresources ...string) (*unstructured.Unstructured, error) {
+	kind, err := r.api.mapper.KindFor(r.resource)
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range r.api.live.objects {
+		accessor, _ := meta.Accessor(obj)
+		if obj.GetObjectKind().GroupVersionKind() != kind || accessor.GetNamespace() != r.namespace || accessor.GetName() != name {
+			continue
+		}
+		u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return nil, err
+		}
+		return &unstructured.Unstructured{Object: u}, nil
+	}
+	return nil, errors.NewNotFound(r.resource.GroupResource(), name)
+}
+
+// testRESTMapper maps the kinds of scheme as namespaced resources.
+func testRESTMapper(s *runtime.Scheme) meta.RESTMapper {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	for gvk := range s.AllKnownTypes() {
+		mapper.Add(gvk, meta.RESTScopeNamespace)
+	}
+	return mapper
+}
+
+func TestDiff(t *testing.T) {
+	instance := &infinimeshv1beta1.Platform{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default", UID: "foo"}}
+	instance.Spec.Apiserver.Restful.Host = "api.example.com"
+
+	live := newMemoryClient(scheme.Scheme)
+	mapper := testRESTMapper(scheme.Scheme)
+	api := &dryRunAPI{t: t, live: live, mapper: mapper}
+	c := &readOnlyClient{Client: live, t: t}
+
+	// An empty cluster gets everything created
+	diffs, err := Diff(c, api, mapper, scheme.Scheme, instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) == 0 || len(diffs) != api.writes {
+		t.Fatalf("%v diffs for %v dry-runs", len(diffs), api.writes)
+	}
+	for _, d := range diffs {
+		if d.Action != "create" {
+			t.Errorf("%v on an empty cluster", d)
+		}
+	}
+	if len(live.objects) != 0 {
+		t.Errorf("%v objects were created", len(live.objects))
+	}
+
+	// A deployed platform only shows what changed
+	objs, err := Render(instance, scheme.Scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	live.objects = objs
+	instance.Spec.Version = "v0.2.0"
+	api.writes = 0
+	diffs, err = Diff(c, api, mapper, scheme.Scheme, instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) == 0 {
+		t.Fatal("no diffs for a new version")
+	}
+	for _, d := range diffs {
+		if d.Action != "update" || !strings.Contains(d.Diff, "+ ") || !strings.Contains(d.Diff, ":v0.2.0") {
+			t.Errorf("unexpected %v:\n%v", d, d.Diff)
+		}
+	}
+	deployment := &appsv1.Deployment{}
+	if err := live.Get(context.TODO(), types.NamespacedName{Name: "foo-apiserver", Namespace: "default"}, deployment); err != nil {
+		t.Fatal(err)
+	}
+	if image := deployment.Spec.Template.Spec.Containers[0].Image; strings.HasSuffix(image, ":v0.2.0") {
+		t.Errorf("live deployment was updated to %v", image)
+	}
+}
+
+func TestReconcileDryRun(t *testing.T) {
+	instance := &infinimeshv1beta1.Platform{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default", UID: "foo"}}
+	instance.Spec.Controller.Timeseries = true
+
+	// Grafana would be synced with its admin and a root account in dgraph
+	live := newMemoryClient(scheme.Scheme)
+	for _, obj := range []runtime.Object{instance, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: grafanaAdminSecret(instance), Namespace: instance.Namespace},
+		Data:       map[string][]byte{"username": []byte("admin"), "password": []byte("admin")},
+	}} {
+		if err := live.Create(context.TODO(), obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mapper := testRESTMapper(scheme.Scheme)
+	api := &dryRunAPI{t: t, live: live, mapper: mapper}
+	fakes := fake.NewFactory()
+	p := fakes.Platform(instance)
+	if _, err := p.Dgraph().CreateUserAccount(context.TODO(), "root", "pw", true, true, true); err != nil {
+		t.Fatal(err)
+	}
+	r := &ReconcilePlatform{
+		scheme:   scheme.Scheme,
+		recorder: record.NewFakeRecorder(1000),
+		offline:  true,
+		clients:  fakes,
+	}
+	r.Client = &dryRunClient{
+		Client:  &readOnlyClient{Client: live, t: t},
+		dynamic: api,
+		mapper:  mapper,
+		scheme:  scheme.Scheme,
+		report:  r.reportDiff,
+	}
+
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: "foo", Namespace: "default"}}
+	if _, err := r.Reconcile(request); err != nil {
+		t.Fatal(err)
+	}
+	if api.writes == 0 {
+		t.Error("no dry-runs")
+	}
+	if len(live.objects) != 2 {
+		t.Errorf("%v objects were created", len(live.objects)-2)
+	}
+
+	// Neither dgraph nor Grafana are reached
+	if p.SchemaImports() != 0 {
+		t.Error("schema was imported")
+	}
+	if _, ok := p.GrafanaUser("root"); ok {
+		t.Error("grafana was synced")
+	}
+}
+
+func TestLineDiff(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	g.Expect(lineDiff("a\nb\n", "a\nb\n")).To(gomega.BeEmpty())
+	g.Expect(lineDiff("", "a\n")).To(gomega.Equal("+ a\n"))
+	g.Expect(lineDiff("a\nb\nc\nd\ne\nf\ng\nh\ni\n", "a\nb\nc\nd\nE\nf\ng\nh\ni\n")).To(gomega.Equal(
+		"...\n  b\n  c\n  d\n- e\n+ E\n  f\n  g\n  h\n"))
+}
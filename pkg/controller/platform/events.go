@@ -0,0 +1,87 @@
+package platform
+
+import (
+	"context"
+	"reflect"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+)
+
+// eventingClient records an event on the owning Platform for every object the controller
+// creates, updates or deletes, so they show up in kubectl describe platform.
+type eventingClient struct {
+	client.Client
+	recorder record.EventRecorder
+}
+
+func (c *eventingClient) Create(ctx context.Context, obj runtime.Object) error {
+	err := c.Client.Create(ctx, obj)
+	c.record(obj, "Created", "create", err)
+	return err
+}
+
+func (c *eventingClient) Update(ctx context.Context, obj runtime.Object) error {
+	var version string
+	if accessor, err := meta.Accessor(obj); err == nil {
+		version = accessor.GetResourceVersion()
+	}
+	err := c.Client.Update(ctx, obj)
+	// The apiserver keeps the resourceVersion of updates that change nothing
+	if accessor, aerr := meta.Accessor(obj); err == nil && aerr == nil && version != "" && accessor.GetResourceVersion() == version {
+		return nil
+	}
+	c.record(obj, "Updated", "update", err)
+	return err
+}
+
+func (c *eventingClient) Delete(ctx context.Context, obj runtime.Object, opts ...client.DeleteOptionFunc) error {
+	err := c.Client.Delete(ctx, obj, opts...)
+	c.record(obj, "Deleted", "delete", err)
+	return err
+}
+
+// ownerPlatform returns a reference to the Platform controlling obj, or nil.
+func ownerPlatform(obj runtime.Object) *infinimeshv1beta1.Platform {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return nil
+	}
+	owner := metav1.GetControllerOf(accessor)
+	if owner == nil || owner.Kind != "Platform" {
+		return nil
+	}
+
+	return &infinimeshv1beta1.Platform{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      owner.Name,
+			Namespace: accessor.GetNamespace(),
+			UID:       owner.UID,
+		},
+	}
+}
+
+func (c *eventingClient) record(obj runtime.Object, reason, action string, err error) {
+	platform := ownerPlatform(obj)
+	if platform == nil {
+		return
+	}
+	accessor, _ := meta.Accessor(obj)
+
+	kind := obj.GetObjectKind().GroupVersionKind().Kind
+	if kind == "" {
+		kind = reflect.Indirect(reflect.ValueOf(obj)).Type().Name()
+	}
+
+	if err != nil {
+		c.recorder.Eventf(platform, corev1.EventTypeWarning, "Failed", "Failed to %v %v %v: %v", action, kind, accessor.GetName(), err)
+		return
+	}
+	c.recorder.Eventf(platform, corev1.EventTypeNormal, reason, "%v %v %v", reason, kind, accessor.GetName())
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package platform
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// versioningClient sets the resourceVersion of updated objects to version, like the apiserver does
+// for updates that change them.
+type versioningClient struct {
+	client.Client
+	version string
+}
+
+func (c versioningClient) Update(ctx context.Context, obj runtime.Object) error {
+	if err := c.Client.Update(ctx, obj); err != nil {
+		return err
+	}
+	obj.(metav1.Object).SetResourceVersion(c.version)
+	return nil
+}
+
+func TestEventingClientSkipsNoopUpdates(t *testing.T) {
+	recorder := record.NewFakeRecorder(100)
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "foo-config",
+			Namespace:       "default",
+			ResourceVersion: "1",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "Platform", Name: "foo", Controller: func() *bool { b := true; return &b }()}},
+		},
+	}
+	memory := newMemoryClient(scheme.Scheme)
+	if err := memory.Create(context.TODO(), cm); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		version string
+		events  int
+	}{
+		{"1", 0},
+		{"2", 1},
+	} {
+		client := &eventingClient{Client: versioningClient{Client: memory, version: c.version}, recorder: recorder}
+		if err := client.Update(context.TODO(), cm); err != nil {
+			t.Fatal(err)
+		}
+		if len(recorder.Events) != c.events {
+			t.Errorf("resourceVersion %v: %v events, want %v", c.version, len(recorder.Events), c.events)
+		}
+		for len(recorder.Events) > 0 {
+			<-recorder.Events
+		}
+	}
+}
@@ -29,6 +29,8 @@ func (r *ReconcilePlatform) reconcileFrontend(request reconcile.Request, instanc
 			Namespace: instance.Namespace,
 		},
 		Spec: appsv1.DeploymentSpec{
+			// Scaled down while the maintenance page is served
+			Replicas: ingressReplicas(instance),
 			Selector: &metav1.LabelSelector{
 				MatchLabels: map[string]string{"deployment": deploymentName},
 			},
@@ -38,8 +40,8 @@ func (r *ReconcilePlatform) reconcileFrontend(request reconcile.Request, instanc
 					Containers: []corev1.Container{
 						{
 							Name:            "frontend",
-							Image:           "quay.io/infinimesh/frontend:latest",
-							ImagePullPolicy: corev1.PullAlways,
+							Image:           image(instance, "frontend"),
+							ImagePullPolicy: imagePullPolicy(instance, "frontend"),
 							Env: []corev1.EnvVar{
 								{
 									Name:  "APISERVER_URL",
@@ -53,6 +55,10 @@ func (r *ReconcilePlatform) reconcileFrontend(request reconcile.Request, instanc
 		},
 	}
 
+	if err := r.secureWorkload(instance, deploy.Name, &deploy.Spec.Template); err != nil {
+		return err
+	}
+
 	if err := controllerutil.SetControllerReference(instance, deploy, r.scheme); err != nil {
 		return err
 	}
@@ -127,10 +133,7 @@ func (r *ReconcilePlatform) reconcileFrontend(request reconcile.Request, instanc
 						HTTP: &extensionsv1beta1.HTTPIngressRuleValue{
 							Paths: []extensionsv1beta1.HTTPIngressPath{
 								{
-									Backend: extensionsv1beta1.IngressBackend{
-										ServiceName: instance.Name + "-frontend",
-										ServicePort: intstr.FromInt(8080),
-									},
+									Backend: ingressBackend(instance, instance.Name+"-frontend", 8080),
 								},
 							},
 						},
@@ -153,6 +156,13 @@ func (r *ReconcilePlatform) reconcileFrontend(request reconcile.Request, instanc
 		}
 	} else if err != nil {
 		return err
+	} else if !reflect.DeepEqual(ingress.Spec, foundIngress.Spec) {
+		foundIngress.Spec = ingress.Spec
+		log.Info("Updating Ingress", "namespace", ingress.Namespace, "name", ingress.Name)
+		err = r.Update(context.TODO(), foundIngress)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
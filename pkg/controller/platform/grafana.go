@@ -0,0 +1,554 @@
+package platform
+
+import (
+	"context"
+	"reflect"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+)
+
+const (
+	// grafanaDashboardLabel selects the ConfigMaps whose keys are provisioned as dashboards
+	grafanaDashboardLabel = "infinimesh.io/grafana-dashboard"
+
+	grafanaDashboardsPath = "/etc/grafana/dashboards"
+	grafanaDefaultStorage = "1Gi"
+)
+
+// grafanaDatasource is the TimescaleDB datasource of an org. It logs in as the role of the
+// org, see grafanaRolesSQL, and is provisioned from a Secret.
+const grafanaDatasource = `- name: TimescaleDB
+  isDefault: true
+  type: postgres
+  access: proxy
+  orgId: %v
+  url: %v
+  user: %v
+  database: postgres
+  jsonData:
+    sslmode: "disable"
+  secureJsonData:
+    password: "%v"
+  version: 1
+  editable: false
+`
+
+// grafanaDashboardProvider loads the dashboards of grafanaDashboardsPath into an org.
+const grafanaDashboardProvider = `- name: infinimesh-org-%v
+  orgId: %v
+  type: file
+  disableDeletion: true
+  updateIntervalSeconds: 30
+  options:
+    path: ` + grafanaDashboardsPath + `
+`
+
+// deviceTelemetryDashboard is the default dashboard shipped with the operator, it plots the
+// telemetry the timescale-connector writes for a device.
+const deviceTelemetryDashboard = `{
+  "uid": "infinimesh-device-telemetry",
+  "title": "Device Telemetry",
+  "tags": ["infinimesh"],
+  "timezone": "browser",
+  "schemaVersion": 22,
+  "version": 1,
+  "refresh": "30s",
+  "time": {"from": "now-6h", "to": "now"},
+  "templating": {
+    "list": [
+      {
+        "name": "device",
+        "label": "Device",
+        "type": "query",
+        "datasource": "TimescaleDB",
+        "query": "SELECT DISTINCT device_id FROM data",
+        "refresh": 2,
+        "includeAll": false,
+        "multi": false
+      }
+    ]
+  },
+  "panels": [
+    {
+      "id": 1,
+      "title": "Telemetry of $device",
+      "type": "graph",
+      "datasource": "TimescaleDB",
+      "gridPos": {"h": 12, "w": 24, "x": 0, "y": 0},
+      "lines": true,
+      "linewidth": 1,
+      "targets": [
+        {
+          "refId": "A",
+          "format": "time_series",
+          "rawQuery": true,
+          "rawSql": "SELECT $__timeGroupAlias(time, $__interval), property AS metric, avg(value) AS value FROM data WHERE $__timeFilter(time) AND device_id = '$device' GROUP BY 1, 2 ORDER BY 1"
+        }
+      ],
+      "xaxis": {"mode": "time", "show": true},
+      "yaxes": [
+        {"format": "short", "show": true},
+        {"format": "short", "show": false}
+      ]
+    }
+  ]
+}
+`
+
+// reconcileGrafana deploys Grafana with its datasources, the dashboards from labeled
+// ConfigMaps and, if a host is configured, an Ingress in front of the auth proxy.
+func (r *ReconcilePlatform) reconcileGrafana(instance *infinimeshv1beta1.Platform) error {
+	log := logger.WithName("grafana")
+	deploymentName := instance.Name + "-grafana"
+
+	if err := r.reconcileGrafanaAdminSecret(instance); err != nil {
+		return err
+	}
+
+	// Every user is a Viewer of the main org, it has no access to the telemetry
+	err := r.deleteLegacyObjects(instance, &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: deploymentName + "-provision", Namespace: instance.Namespace}})
+	if err != nil {
+		return err
+	}
+
+	dashboard := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      deploymentName + "-dashboard-device-telemetry",
+			Namespace: instance.Namespace,
+			Labels: map[string]string{
+				grafanaDashboardLabel: "true",
+			},
+		},
+		Data: map[string]string{
+			"device-telemetry.json": deviceTelemetryDashboard,
+		},
+	}
+
+	if err := controllerutil.SetControllerReference(instance, dashboard, r.scheme); err != nil {
+		return err
+	}
+
+	foundCm := &corev1.ConfigMap{}
+	err = r.Get(context.TODO(), types.NamespacedName{Name: dashboard.Name, Namespace: dashboard.Namespace}, foundCm)
+	if err != nil && errors.IsNotFound(err) {
+		log.Info("Creating ConfigMap", "namespace", dashboard.Namespace, "name", dashboard.Name)
+		err = r.Create(context.TODO(), dashboard)
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	} else if !reflect.DeepEqual(dashboard.Data, foundCm.Data) || !reflect.DeepEqual(dashboard.Labels, foundCm.Labels) {
+		foundCm.Data = dashboard.Data
+		foundCm.Labels = dashboard.Labels
+		log.Info("Updating ConfigMap", "namespace", dashboard.Namespace, "name", dashboard.Name)
+		err = r.Update(context.TODO(), foundCm)
+		if err != nil {
+			return err
+		}
+	}
+
+	pvcSpec := corev1.PersistentVolumeClaimSpec{
+		AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(grafanaDefaultStorage)},
+		},
+	}
+	if instance.Spec.Grafana.Storage != nil {
+		pvcSpec = *instance.Spec.Grafana.Storage
+	}
+
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      deploymentName,
+			Namespace: instance.Namespace,
+		},
+		Spec: pvcSpec,
+	}
+
+	if err := controllerutil.SetControllerReference(instance, pvc, r.scheme); err != nil {
+		return err
+	}
+
+	foundPvc := &corev1.PersistentVolumeClaim{}
+	err = r.Get(context.TODO(), types.NamespacedName{Name: pvc.Name, Namespace: pvc.Namespace}, foundPvc)
+	if err != nil && errors.IsNotFound(err) {
+		log.Info("Creating PersistentVolumeClaim", "namespace", pvc.Namespace, "name", pvc.Name)
+		err = r.Create(context.TODO(), pvc)
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	dashboards := &corev1.ConfigMapList{}
+	err = r.List(context.TODO(), client.InNamespace(instance.Namespace).MatchingLabels(map[string]string{grafanaDashboardLabel: "true"}), dashboards)
+	if err != nil {
+		return err
+	}
+	// The cache may not have seen the default dashboard yet
+	if !containsConfigMap(dashboards.Items, dashboard.Name) {
+		dashboards.Items = append(dashboards.Items, *dashboard)
+	}
+
+	deploy := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      deploymentName,
+			Namespace: instance.Namespace,
+		},
+		Spec: appsv1.DeploymentSpec{
+			// Scaled down while the maintenance page is served
+			Replicas: ingressReplicas(instance),
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"deployment": deploymentName},
+			},
+			// grafana.db lives on a ReadWriteOnce volume
+			Strategy: appsv1.DeploymentStrategy{
+				Type: appsv1.RecreateDeploymentStrategyType,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"deployment": deploymentName}},
+				Spec: corev1.PodSpec{
+					Volumes: []corev1.Volume{
+						{
+							Name: "data",
+							VolumeSource: corev1.VolumeSource{
+								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+									ClaimName: pvc.Name,
+								},
+							},
+						},
+						{
+							Name: "datasources",
+							VolumeSource: corev1.VolumeSource{
+								Secret: &corev1.SecretVolumeSource{
+									SecretName: grafanaOrgsSecret(instance),
+									Items:      []corev1.KeyToPath{{Key: "orgs_timescaledb.yaml", Path: "orgs_timescaledb.yaml"}},
+									Optional:   func() *bool { val := true; return &val }(),
+								},
+							},
+						},
+						{
+							Name: "dashboard-providers",
+							VolumeSource: corev1.VolumeSource{
+								ConfigMap: &corev1.ConfigMapVolumeSource{
+									LocalObjectReference: corev1.LocalObjectReference{Name: grafanaOrgsConfigMap(instance)},
+									Items:                []corev1.KeyToPath{{Key: "orgs_dashboards.yaml", Path: "orgs_dashboards.yaml"}},
+									Optional:             func() *bool { val := true; return &val }(),
+								},
+							},
+						},
+						grafanaDashboardsVolume(dashboards.Items),
+					},
+					// Grafana runs as uid 472 and needs to own its data volume
+					SecurityContext: &corev1.PodSecurityContext{
+						FSGroup: func() *int64 { val := int64(472); return &val }(),
+					},
+					Containers: []corev1.Container{
+						{
+							Name:  "grafana",
+							Image: "grafana/grafana:latest",
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "data",
+									MountPath: "/var/lib/grafana",
+								},
+								{
+									Name:      "datasources",
+									MountPath: "/etc/grafana/provisioning/datasources",
+									ReadOnly:  true,
+								},
+								{
+									Name:      "dashboard-providers",
+									MountPath: "/etc/grafana/provisioning/dashboards",
+									ReadOnly:  true,
+								},
+								{
+									Name:      "dashboards",
+									MountPath: grafanaDashboardsPath,
+									ReadOnly:  true,
+								},
+							},
+							Env: []corev1.EnvVar{
+								{
+									Name: "GF_SECURITY_ADMIN_USER",
+									ValueFrom: &corev1.EnvVarSource{
+										SecretKeyRef: &corev1.SecretKeySelector{
+											LocalObjectReference: corev1.LocalObjectReference{
+												Name: grafanaAdminSecret(instance),
+											},
+											Key: "username",
+										},
+									},
+								},
+								{
+									Name: "GF_SECURITY_ADMIN_PASSWORD",
+									ValueFrom: &corev1.EnvVarSource{
+										SecretKeyRef: &corev1.SecretKeySelector{
+											LocalObjectReference: corev1.LocalObjectReference{
+												Name: grafanaAdminSecret(instance),
+											},
+											Key: "password",
+										},
+									},
+								},
+								{
+									Name:  "GF_AUTH_PROXY_ENABLED",
+									Value: "true",
+								},
+								{
+									Name:  "GF_AUTH_PROXY_HEADER_NAME",
+									Value: "X-WEBAUTH-USER",
+								},
+								{
+									Name:  "GF_AUTH_PROXY_AUTO_SIGN_UP",
+									Value: "true",
+								},
+								{
+									Name:  "GF_AUTH_PROXY_HEADER_PROPERTY",
+									Value: "username",
+								},
+								{
+									Name:  "GF_USERS_AUTO_ASSIGN_ORG",
+									Value: "true",
+								},
+								{
+									Name:  "GF_USERS_AUTO_ASSIGN_ORG_ROLE",
+									Value: "Viewer",
+								},
+								{
+									Name:  "GF_ALERTING_ENABLED",
+									Value: "false",
+								},
+							},
+						},
+						{
+							Name:  "proxy",
+							Image: image(instance, "grafana-proxy"),
+							Ports: []corev1.ContainerPort{
+								{
+									ContainerPort: 8080,
+									Name:          "proxy",
+								},
+							},
+							Env: []corev1.EnvVar{
+								{
+									Name:  "NODE_HOST",
+									Value: instance.Name + "-nodeserver:8080",
+								},
+								{
+									Name:  "GRAFANA_URL",
+									Value: "http://" + instance.Name + "-grafana:3000",
+								},
+								{
+									Name: "JWT_SIGNING_KEY",
+									ValueFrom: &corev1.EnvVarSource{
+										SecretKeyRef: &corev1.SecretKeySelector{
+											LocalObjectReference: corev1.LocalObjectReference{
+												Name: instance.Name + "-apiserver",
+											},
+											Key: "signing-key",
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	if err := r.secureWorkload(instance, deploy.Name, &deploy.Spec.Template, "/var/log/grafana"); err != nil {
+		return err
+	}
+
+	if err := controllerutil.SetControllerReference(instance, deploy, r.scheme); err != nil {
+		return err
+	}
+
+	found := &appsv1.Deployment{}
+	err = r.Get(context.TODO(), types.NamespacedName{Name: deploy.Name, Namespace: deploy.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		log.Info("Creating Grafana", "namespace", deploy.Namespace, "name", deploy.Name)
+		err = r.Create(context.TODO(), deploy)
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	} else {
+		if !reflect.DeepEqual(deploy.Spec, found.Spec) {
+			found.Spec = deploy.Spec
+			log.Info("Updating Grafana", "namespace", deploy.Namespace, "name", deploy.Name)
+			err = r.Update(context.TODO(), found)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      deploymentName,
+			Namespace: instance.Namespace,
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{"deployment": deploymentName},
+			Type:     corev1.ServiceTypeClusterIP,
+			Ports: []corev1.ServicePort{
+				{
+					Protocol:   corev1.ProtocolTCP,
+					Port:       3000,
+					TargetPort: intstr.FromInt(3000),
+					Name:       "grafana",
+				},
+				{
+					Protocol:   corev1.ProtocolTCP,
+					Port:       8080,
+					TargetPort: intstr.FromInt(8080),
+					Name:       "proxy",
+				},
+			},
+		},
+	}
+
+	if err := controllerutil.SetControllerReference(instance, svc, r.scheme); err != nil {
+		return err
+	}
+
+	foundSvc := &corev1.Service{}
+	err = r.Get(context.TODO(), types.NamespacedName{Name: svc.Name, Namespace: svc.Namespace}, foundSvc)
+	if err != nil && errors.IsNotFound(err) {
+		err = r.Create(context.TODO(), svc)
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	} else if len(foundSvc.Spec.Ports) != len(svc.Spec.Ports) {
+		foundSvc.Spec.Ports = svc.Spec.Ports
+		log.Info("Updating Service", "namespace", svc.Namespace, "name", svc.Name)
+		err = r.Update(context.TODO(), foundSvc)
+		if err != nil {
+			return err
+		}
+	}
+
+	if instance.Spec.Grafana.Host == "" {
+		return nil
+	}
+
+	// Grafana trusts the auth proxy header, so only the proxy may be exposed
+	ingress := &extensionsv1beta1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      deploymentName,
+			Namespace: instance.Namespace,
+		},
+		Spec: extensionsv1beta1.IngressSpec{
+			TLS: instance.Spec.Grafana.TLS,
+			Rules: []extensionsv1beta1.IngressRule{
+				{
+					Host: instance.Spec.Grafana.Host,
+					IngressRuleValue: extensionsv1beta1.IngressRuleValue{
+						HTTP: &extensionsv1beta1.HTTPIngressRuleValue{
+							Paths: []extensionsv1beta1.HTTPIngressPath{
+								{
+									Backend: ingressBackend(instance, svc.Name, 8080),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	if err := controllerutil.SetControllerReference(instance, ingress, r.scheme); err != nil {
+		return err
+	}
+
+	foundIngress := &extensionsv1beta1.Ingress{}
+	err = r.Get(context.TODO(), types.NamespacedName{Name: ingress.Name, Namespace: ingress.Namespace}, foundIngress)
+	if err != nil && errors.IsNotFound(err) {
+		log.Info("Creating Ingress", "namespace", ingress.Namespace, "name", ingress.Name)
+		err = r.Create(context.TODO(), ingress)
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	} else if !reflect.DeepEqual(ingress.Spec, foundIngress.Spec) {
+		foundIngress.Spec = ingress.Spec
+		log.Info("Updating Ingress", "namespace", ingress.Namespace, "name", ingress.Name)
+		err = r.Update(context.TODO(), foundIngress)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// grafanaDashboardsVolume projects every key of the dashboard ConfigMaps into a directory
+// named after its ConfigMap, so keys of different ConfigMaps do not collide.
+func grafanaDashboardsVolume(configMaps []corev1.ConfigMap) corev1.Volume {
+	sort.Slice(configMaps, func(i, j int) bool { return configMaps[i].Name < configMaps[j].Name })
+
+	var sources []corev1.VolumeProjection
+	for _, cm := range configMaps {
+		var keys []string
+		for key := range cm.Data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var items []corev1.KeyToPath
+		for _, key := range keys {
+			items = append(items, corev1.KeyToPath{
+				Key:  key,
+				Path: cm.Name + "/" + key,
+			})
+		}
+
+		sources = append(sources, corev1.VolumeProjection{
+			ConfigMap: &corev1.ConfigMapProjection{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: cm.Name,
+				},
+				Items: items,
+			},
+		})
+	}
+
+	return corev1.Volume{
+		Name: "dashboards",
+		VolumeSource: corev1.VolumeSource{
+			Projected: &corev1.ProjectedVolumeSource{
+				Sources: sources,
+			},
+		},
+	}
+}
+
+func containsConfigMap(configMaps []corev1.ConfigMap, name string) bool {
+	for _, cm := range configMaps {
+		if cm.Name == name {
+			return true
+		}
+	}
+	return false
+}
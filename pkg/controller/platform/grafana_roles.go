@@ -0,0 +1,166 @@
+package platform
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+)
+
+const (
+	grafanaRolesHashAnnotation = "infinimesh.io/roles-hash"
+	grafanaRolesMountPath      = "/grafana-roles"
+)
+
+// grafanaOrgRole is the TimescaleDB role the datasource of an org logs in as.
+func grafanaOrgRole(orgID int) string {
+	return fmt.Sprintf("grafana_org_%v", orgID)
+}
+
+// sqlLiteral quotes s as an SQL string literal.
+func sqlLiteral(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// grafanaRolesSQL renders the SQL giving every org a login role which only reads the telemetry
+// of the devices of its namespace. The role's data view in a schema of its own shadows the
+// data table, so dashboards query it unchanged. Roles of removed orgs are dropped.
+func grafanaRolesSQL(namespaces map[int]string, passwords map[int]string, devices map[string][]string) string {
+	var ids []int
+	for id := range namespaces {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	var names []string
+	for namespace := range devices {
+		names = append(names, namespace)
+	}
+	sort.Strings(names)
+
+	sql := `CREATE SCHEMA IF NOT EXISTS infinimesh;
+REVOKE ALL ON SCHEMA infinimesh FROM PUBLIC;
+REVOKE CREATE ON SCHEMA public FROM PUBLIC;
+CREATE TABLE IF NOT EXISTS infinimesh.device_namespaces (device_id text PRIMARY KEY, namespace text NOT NULL);
+BEGIN;
+TRUNCATE infinimesh.device_namespaces;
+`
+	for _, namespace := range names {
+		var literals []string
+		for _, id := range devices[namespace] {
+			literals = append(literals, sqlLiteral(id))
+		}
+		sql += fmt.Sprintf("INSERT INTO infinimesh.device_namespaces SELECT unnest(ARRAY[%v]::text[]), %v;\n", strings.Join(literals, ","), sqlLiteral(namespace))
+	}
+	sql += "COMMIT;\n"
+
+	var roles []string
+	for _, id := range ids {
+		role := grafanaOrgRole(id)
+		roles = append(roles, sqlLiteral(role))
+		sql += fmt.Sprintf(`DO $$ BEGIN CREATE ROLE %[1]v; EXCEPTION WHEN duplicate_object THEN NULL; END $$;
+ALTER ROLE %[1]v LOGIN NOSUPERUSER NOCREATEDB NOCREATEROLE NOINHERIT PASSWORD %[2]v;
+CREATE SCHEMA IF NOT EXISTS %[1]v;
+REVOKE ALL ON SCHEMA %[1]v FROM PUBLIC;
+CREATE OR REPLACE VIEW %[1]v.data WITH (security_barrier) AS SELECT data.* FROM public.data JOIN infinimesh.device_namespaces USING (device_id) WHERE device_namespaces.namespace = %[3]v;
+GRANT USAGE ON SCHEMA %[1]v TO %[1]v;
+GRANT SELECT ON %[1]v.data TO %[1]v;
+ALTER ROLE %[1]v SET search_path = %[1]v;
+`, role, sqlLiteral(passwords[id]), sqlLiteral(namespaces[id]))
+	}
+
+	sql += fmt.Sprintf(`DO $$
+DECLARE r record;
+BEGIN
+  FOR r IN SELECT rolname FROM pg_roles WHERE rolname LIKE 'grafana\_org\_%%' AND rolname <> ALL (ARRAY[%v]::text[]) LOOP
+    EXECUTE format('DROP SCHEMA IF EXISTS %%I CASCADE', r.rolname);
+    EXECUTE format('DROP ROLE %%I', r.rolname);
+  END LOOP;
+END $$;
+`, strings.Join(roles, ","))
+	return sql
+}
+
+// reconcileGrafanaRolesJob runs the SQL in the roles.sql key of the orgs Secret against
+// TimescaleDB as its superuser, once the timescale-connector created the data table.
+func (r *ReconcilePlatform) reconcileGrafanaRolesJob(instance *infinimeshv1beta1.Platform, sql string) error {
+	jobName := instance.Name + "-grafana-roles"
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(sql)))[:16]
+	backoffLimit := int32(6)
+	script := `until psql -tAc "SELECT to_regclass('public.data')" | grep -q data; do echo "Waiting for the data table"; sleep 10; done
+psql -v ON_ERROR_STOP=1 -f ` + grafanaRolesMountPath + `/roles.sql
+`
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      jobName,
+			Namespace: instance.Namespace,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"job": jobName}},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyOnFailure,
+					Containers: []corev1.Container{
+						{
+							Name:            "psql",
+							Image:           timescaleDBImage,
+							ImagePullPolicy: corev1.PullIfNotPresent,
+							Env: []corev1.EnvVar{
+								{Name: "PGHOST", Value: instance.Name + "-timescaledb"},
+								{Name: "PGDATABASE", Value: "postgres"},
+								timescaleDBAuthEnv(instance, "PGUSER", "POSTGRES_USER"),
+								timescaleDBAuthEnv(instance, "PGPASSWORD", "POSTGRES_PASSWORD"),
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "roles",
+									MountPath: grafanaRolesMountPath,
+									ReadOnly:  true,
+								},
+							},
+							Command: []string{
+								"/bin/sh", "-c", script,
+							},
+						},
+					},
+					Volumes: []corev1.Volume{
+						{
+							Name: "roles",
+							VolumeSource: corev1.VolumeSource{
+								Secret: &corev1.SecretVolumeSource{
+									SecretName: grafanaOrgsSecret(instance),
+									Items:      []corev1.KeyToPath{{Key: "roles.sql", Path: "roles.sql"}},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	_, err := r.reconcileScriptJob(instance, job, grafanaRolesHashAnnotation, hash)
+	return err
+}
+
+func timescaleDBAuthEnv(instance *infinimeshv1beta1.Platform, name, key string) corev1.EnvVar {
+	return corev1.EnvVar{
+		Name: name,
+		ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: instance.Name + "-timescaledb-auth",
+				},
+				Key: key,
+			},
+		},
+	}
+}
@@ -0,0 +1,378 @@
+package platform
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/infinimesh/infinimesh/pkg/node/nodepb"
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+	"github.com/infinimesh/operator/pkg/registrypb"
+)
+
+// grafanaSyncInterval is how often namespaces and accounts are mirrored into Grafana.
+const grafanaSyncInterval = 5 * time.Minute
+
+func grafanaAdminSecret(instance *infinimeshv1beta1.Platform) string {
+	return instance.Name + "-grafana-admin"
+}
+
+func grafanaOrgsConfigMap(instance *infinimeshv1beta1.Platform) string {
+	return instance.Name + "-grafana-orgs"
+}
+
+// grafanaOrgsSecret holds the datasources of the orgs and the SQL creating their roles.
+func grafanaOrgsSecret(instance *infinimeshv1beta1.Platform) string {
+	return instance.Name + "-grafana-orgs"
+}
+
+// grafanaOrgsMaxSize leaves room below the size limit of a Secret.
+const grafanaOrgsMaxSize = 900 * 1024
+
+// grafanaRole maps a namespace permission to the role of the account in the namespace's org.
+func grafanaRole(action nodepb.Action) string {
+	switch action {
+	case nodepb.Action_WRITE:
+		return "Editor"
+	case nodepb.Action_READ:
+		return "Viewer"
+	default:
+		return ""
+	}
+}
+
+func (r *ReconcilePlatform) reconcileGrafanaAdminSecret(instance *infinimeshv1beta1.Platform) error {
+	log := logger.WithName("grafana")
+
+	randomKey, err := GenerateRandomBytes(32)
+	if err != nil {
+		return err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      grafanaAdminSecret(instance),
+			Namespace: instance.Namespace,
+		},
+		StringData: map[string]string{
+			"username": "admin",
+			"password": base64.RawURLEncoding.EncodeToString(randomKey),
+		},
+	}
+
+	if err := controllerutil.SetControllerReference(instance, secret, r.scheme); err != nil {
+		return err
+	}
+
+	found := &corev1.Secret{}
+	err = r.Get(context.TODO(), types.NamespacedName{Name: secret.Name, Namespace: secret.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		log.Info("Creating Secret", "namespace", secret.Namespace, "name", secret.Name)
+		err = r.Create(context.TODO(), secret)
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// syncGrafana mirrors infinimesh namespaces into Grafana orgs and accounts into Grafana users.
+// Accounts become members of the orgs of the namespaces they have permissions on, and every
+// org gets a TimescaleDB datasource reading the telemetry of the devices of its namespace.
+func (r *ReconcilePlatform) syncGrafana(request reconcile.Request, instance *infinimeshv1beta1.Platform) error {
+	log := logger.WithName("grafana-sync")
+
+	adminSecret := &corev1.Secret{}
+	err := r.Get(context.TODO(), types.NamespacedName{Name: grafanaAdminSecret(instance), Namespace: instance.Namespace}, adminSecret)
+	if err != nil {
+		return err
+	}
+	adminUser := string(adminSecret.Data["username"])
+	adminPassword := string(adminSecret.Data["password"])
+	client := r.clients.Grafana(instance, adminUser, adminPassword)
+
+	repo, conn, err := r.clients.Dgraph(instance)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	accounts, err := repo.ListAccounts(context.TODO())
+	if err != nil {
+		return err
+	}
+
+	userIDs := map[string]int{}
+	var roots []string
+	for _, account := range accounts {
+		if !account.Enabled {
+			continue
+		}
+
+		userID, err := client.GetUserID(account.Name)
+		if err != nil {
+			return err
+		}
+		if userID == 0 {
+			log.Info("Creating user", "name", account.Name)
+			if err := client.CreateUser(account.Name); err != nil {
+				return err
+			}
+			userID, err = client.GetUserID(account.Name)
+			if err != nil {
+				return err
+			}
+
+			// Users sign in through the auth proxy, the vendored client creates them with a
+			// fixed password which must not stay usable for basic auth
+			randomKey, err := GenerateRandomBytes(32)
+			if err != nil {
+				return err
+			}
+			err = client.SetUserPassword(userID, base64.RawURLEncoding.EncodeToString(randomKey))
+			if err != nil {
+				return err
+			}
+		}
+
+		if account.IsRoot {
+			if err := client.MakeUserAdmin(userID); err != nil {
+				return err
+			}
+			roots = append(roots, account.Name)
+		}
+		userIDs[account.Name] = userID
+	}
+
+	namespaces, err := repo.ListNamespaces(context.TODO())
+	if err != nil {
+		return err
+	}
+
+	orgIDs := map[string]int{}
+	for _, namespace := range namespaces {
+		if namespace.Markfordeletion {
+			continue
+		}
+
+		orgID, err := client.GetOrgID(namespace.Name)
+		if err != nil {
+			return err
+		}
+		if orgID == 0 {
+			log.Info("Creating org", "name", namespace.Name)
+			if err := client.CreateOrg(namespace.Name); err != nil {
+				return err
+			}
+			orgID, err = client.GetOrgID(namespace.Name)
+			if err != nil {
+				return err
+			}
+		}
+		orgIDs[namespace.Name] = orgID
+
+		permissions, err := repo.ListPermissionsInNamespace(context.TODO(), namespace.Id)
+		if err != nil {
+			return err
+		}
+
+		members := map[string]string{}
+		for _, root := range roots {
+			members[root] = "Admin"
+		}
+		for _, permission := range permissions {
+			if role := grafanaRole(permission.Action); role != "" && members[permission.AccountName] == "" {
+				members[permission.AccountName] = role
+			}
+		}
+
+		current, err := client.OrgMembers(orgID)
+		if err != nil {
+			return err
+		}
+		for name, role := range members {
+			userID, ok := userIDs[name]
+			if !ok {
+				continue
+			}
+			switch current[name] {
+			case role:
+			case "":
+				log.Info("Adding user to org", "user", name, "org", namespace.Name, "role", role)
+				if err := client.AddUserToOrg(orgID, name, role); err != nil {
+					return err
+				}
+			default:
+				log.Info("Changing role in org", "user", name, "org", namespace.Name, "role", role)
+				if err := client.SetOrgUserRole(orgID, userID, role); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for _, account := range accounts {
+		userID, ok := userIDs[account.Name]
+		if !ok {
+			continue
+		}
+
+		details, err := repo.GetAccount(context.TODO(), account.Uid)
+		if err != nil {
+			return err
+		}
+		if details.DefaultNamespace == nil {
+			continue
+		}
+
+		if orgID, ok := orgIDs[details.DefaultNamespace.Name]; ok {
+			if err := client.SwitchUserOrg(userID, orgID); err != nil {
+				return err
+			}
+		}
+	}
+
+	registry, registryConn, err := r.clients.DeviceRegistry(instance)
+	if err != nil {
+		return err
+	}
+	defer registryConn.Close()
+	list, err := registry.List(context.TODO(), &registrypb.ListDevicesRequest{})
+	if err != nil {
+		return err
+	}
+	devices := map[string][]string{}
+	for _, device := range list.Devices {
+		if _, ok := orgIDs[device.Namespace]; ok {
+			devices[device.Namespace] = append(devices[device.Namespace], device.Id)
+		}
+	}
+
+	if err := r.reconcileGrafanaOrgDatasources(instance, orgIDs, devices); err != nil {
+		return err
+	}
+
+	return client.ReloadDatasources()
+}
+
+// reconcileGrafanaOrgDatasources provisions a TimescaleDB datasource and the dashboards in every
+// org. Each datasource logs in as a role of its org, which only reads the telemetry of the
+// devices of its namespace; devices maps namespaces to the ids of their devices.
+func (r *ReconcilePlatform) reconcileGrafanaOrgDatasources(instance *infinimeshv1beta1.Platform, orgIDs map[string]int, devices map[string][]string) error {
+	log := logger.WithName("grafana-sync")
+
+	found := &corev1.Secret{}
+	err := r.Get(context.TODO(), types.NamespacedName{Name: grafanaOrgsSecret(instance), Namespace: instance.Namespace}, found)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	exists := err == nil
+
+	var ids []int
+	namespaces := map[int]string{}
+	for namespace, id := range orgIDs {
+		ids = append(ids, id)
+		namespaces[id] = namespace
+	}
+	sort.Ints(ids)
+
+	// Passwords are kept, every org gets a random one once
+	passwords := map[int]string{}
+	ds := "apiVersion: 1\ndatasources:\n"
+	providers := "apiVersion: 1\nproviders:\n"
+	for _, id := range ids {
+		password := string(found.Data[grafanaOrgRole(id)])
+		if password == "" {
+			randomKey, err := GenerateRandomBytes(32)
+			if err != nil {
+				return err
+			}
+			password = base64.RawURLEncoding.EncodeToString(randomKey)
+		}
+		passwords[id] = password
+		ds += fmt.Sprintf(grafanaDatasource, id, instance.Name+"-timescaledb", grafanaOrgRole(id), password)
+		providers += fmt.Sprintf(grafanaDashboardProvider, id, id)
+	}
+
+	sql := grafanaRolesSQL(namespaces, passwords, devices)
+	if size := len(sql) + len(ds); size > grafanaOrgsMaxSize {
+		return fmt.Errorf("the roles of %v orgs and their devices take %v bytes, more than the %v a Secret holds", len(ids), size, grafanaOrgsMaxSize)
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      grafanaOrgsSecret(instance),
+			Namespace: instance.Namespace,
+		},
+		Data: map[string][]byte{
+			"orgs_timescaledb.yaml": []byte(ds),
+			"roles.sql":             []byte(sql),
+		},
+	}
+	for id, password := range passwords {
+		secret.Data[grafanaOrgRole(id)] = []byte(password)
+	}
+	if err := controllerutil.SetControllerReference(instance, secret, r.scheme); err != nil {
+		return err
+	}
+
+	if !exists {
+		log.Info("Creating Secret", "namespace", secret.Namespace, "name", secret.Name)
+		if err := r.Create(context.TODO(), secret); err != nil {
+			return err
+		}
+	} else if !reflect.DeepEqual(secret.Data, found.Data) {
+		found.Data = secret.Data
+		log.Info("Updating Secret", "namespace", secret.Namespace, "name", secret.Name)
+		if err := r.Update(context.TODO(), found); err != nil {
+			return err
+		}
+	}
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      grafanaOrgsConfigMap(instance),
+			Namespace: instance.Namespace,
+		},
+		Data: map[string]string{
+			"orgs_dashboards.yaml": providers,
+		},
+	}
+
+	if err := controllerutil.SetControllerReference(instance, cm, r.scheme); err != nil {
+		return err
+	}
+
+	foundCm := &corev1.ConfigMap{}
+	err = r.Get(context.TODO(), types.NamespacedName{Name: cm.Name, Namespace: cm.Namespace}, foundCm)
+	if err != nil && errors.IsNotFound(err) {
+		log.Info("Creating ConfigMap", "namespace", cm.Namespace, "name", cm.Name)
+		err = r.Create(context.TODO(), cm)
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	} else if !reflect.DeepEqual(cm.Data, foundCm.Data) {
+		foundCm.Data = cm.Data
+		log.Info("Updating ConfigMap", "namespace", cm.Namespace, "name", cm.Name)
+		err = r.Update(context.TODO(), foundCm)
+		if err != nil {
+			return err
+		}
+	}
+
+	return r.reconcileGrafanaRolesJob(instance, sql)
+}
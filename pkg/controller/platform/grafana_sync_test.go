@@ -0,0 +1,205 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package platform
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/infinimesh/infinimesh/pkg/node/nodepb"
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+	"github.com/infinimesh/operator/pkg/clients/fake"
+	"github.com/infinimesh/operator/pkg/registrypb"
+)
+
+func TestSyncGrafana(t *testing.T) {
+	ctx := context.TODO()
+	instance := &infinimeshv1beta1.Platform{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"}}
+	instance.Spec.Controller.Timeseries = true
+
+	c := newMemoryClient(scheme.Scheme)
+	err := c.Create(ctx, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: grafanaAdminSecret(instance), Namespace: instance.Namespace},
+		Data:       map[string][]byte{"username": []byte("admin"), "password": []byte("admin")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fakes := fake.NewFactory()
+	p := fakes.Platform(instance)
+	dg := p.Dgraph()
+	if _, err := dg.CreateUserAccount(ctx, "root", "pw", true, true, true); err != nil {
+		t.Fatal(err)
+	}
+	joe, err := dg.CreateUserAccount(ctx, "joe", "pw", false, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dg.CreateUserAccount(ctx, "disabled", "pw", false, false, false); err != nil {
+		t.Fatal(err)
+	}
+	shared, err := dg.CreateNamespace(ctx, "shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dg.AuthorizeNamespace(ctx, joe, shared, nodepb.Action_READ); err != nil {
+		t.Fatal(err)
+	}
+	gone, err := dg.CreateNamespace(ctx, "gone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dg.SoftDeleteNamespace(ctx, gone); err != nil {
+		t.Fatal(err)
+	}
+
+	sensor, err := p.DeviceRegistry().Create(ctx, &registrypb.CreateRequest{Device: &registrypb.Device{Name: "sensor", Namespace: "shared"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &ReconcilePlatform{Client: c, scheme: scheme.Scheme, recorder: record.NewFakeRecorder(100), clients: fakes}
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: instance.Name, Namespace: instance.Namespace}}
+	// The second sync finds everything in place
+	for i := 0; i < 2; i++ {
+		if err := r.syncGrafana(request, instance); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if root, ok := p.GrafanaUser("root"); !ok || !root.Admin {
+		t.Errorf("root = %+v", root)
+	}
+	user, ok := p.GrafanaUser("joe")
+	if !ok {
+		t.Fatal("joe is missing")
+	}
+	if user.Admin || user.Password == "" {
+		t.Errorf("joe = %+v", user)
+	}
+	if _, ok := p.GrafanaUser("disabled"); ok {
+		t.Error("disabled account got a user")
+	}
+
+	own, _ := p.GrafanaOrg("joe")
+	sharedOrg, _ := p.GrafanaOrg("shared")
+	if user.Orgs[own.ID] != "Editor" || user.Orgs[sharedOrg.ID] != "Viewer" {
+		t.Errorf("orgs of joe = %v", user.Orgs)
+	}
+	if user.OrgID != own.ID {
+		t.Errorf("joe is in org %v, want its default %v", user.OrgID, own.ID)
+	}
+	if root, _ := p.GrafanaUser("root"); root.Orgs[sharedOrg.ID] != "Admin" {
+		t.Errorf("orgs of root = %v", root.Orgs)
+	}
+	if _, ok := p.GrafanaOrg("gone"); ok {
+		t.Error("namespace marked for deletion got an org")
+	}
+	if p.DatasourceReloads() != 2 {
+		t.Errorf("datasources reloaded %v times, want 2", p.DatasourceReloads())
+	}
+
+	// Role changes reach existing members
+	if err := dg.AuthorizeNamespace(ctx, joe, shared, nodepb.Action_WRITE); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.syncGrafana(request, instance); err != nil {
+		t.Fatal(err)
+	}
+	if user, _ := p.GrafanaUser("joe"); user.Orgs[sharedOrg.ID] != "Editor" {
+		t.Errorf("joe is %v in shared, want Editor", user.Orgs[sharedOrg.ID])
+	}
+
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Name: grafanaOrgsSecret(instance), Namespace: instance.Namespace}, secret); err != nil {
+		t.Fatal(err)
+	}
+	// One datasource for each namespace not marked for deletion: root, joe, disabled and shared
+	datasources := string(secret.Data["orgs_timescaledb.yaml"])
+	if n := strings.Count(datasources, "- name: TimescaleDB"); n != 4 {
+		t.Errorf("%v datasources, want 4", n)
+	}
+	// Each logs in as the role of its org, never as the superuser
+	role := grafanaOrgRole(sharedOrg.ID)
+	password := string(secret.Data[role])
+	if password == "" || !strings.Contains(datasources, "user: "+role+"\n") || !strings.Contains(datasources, `password: "`+password+`"`) {
+		t.Errorf("datasource of shared doesn't log in as %v:\n%v", role, datasources)
+	}
+	if strings.Contains(datasources, "TIMESCALEDB_USER") {
+		t.Error("datasources log in as the superuser")
+	}
+
+	// The role of shared only reads the data of the devices of shared
+	sql := string(secret.Data["roles.sql"])
+	for _, statement := range []string{
+		"INSERT INTO infinimesh.device_namespaces SELECT unnest(ARRAY['" + sensor.Device.Id + "']::text[]), 'shared';",
+		"ALTER ROLE " + role + " LOGIN NOSUPERUSER NOCREATEDB NOCREATEROLE NOINHERIT PASSWORD '" + password + "';",
+		"CREATE OR REPLACE VIEW " + role + ".data WITH (security_barrier) AS SELECT data.* FROM public.data JOIN infinimesh.device_namespaces USING (device_id) WHERE device_namespaces.namespace = 'shared';",
+		"GRANT SELECT ON " + role + ".data TO " + role + ";",
+	} {
+		if !strings.Contains(sql, statement) {
+			t.Errorf("roles.sql lacks %v:\n%v", statement, sql)
+		}
+	}
+	if strings.Contains(sql, "GRANT SELECT ON public") {
+		t.Error("roles read the data table")
+	}
+	job := &batchv1.Job{}
+	if err := c.Get(ctx, types.NamespacedName{Name: "foo-grafana-roles", Namespace: instance.Namespace}, job); err != nil {
+		t.Fatal(err)
+	}
+
+	// Passwords stay the same, a new device changes the roles
+	if _, err := p.DeviceRegistry().Create(ctx, &registrypb.CreateRequest{Device: &registrypb.Device{Name: "other", Namespace: "joe"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.syncGrafana(request, instance); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Get(ctx, types.NamespacedName{Name: grafanaOrgsSecret(instance), Namespace: instance.Namespace}, secret); err != nil {
+		t.Fatal(err)
+	}
+	if string(secret.Data[role]) != password {
+		t.Error("password changed")
+	}
+	if string(secret.Data["roles.sql"]) == sql {
+		t.Error("new device isn't mapped to its namespace")
+	}
+	hash := job.Annotations[grafanaRolesHashAnnotation]
+	if err := c.Get(ctx, types.NamespacedName{Name: "foo-grafana-roles", Namespace: instance.Namespace}, job); err != nil {
+		t.Fatal(err)
+	}
+	if job.Annotations[grafanaRolesHashAnnotation] == hash {
+		t.Error("roles job wasn't recreated")
+	}
+}
+
+func TestSQLLiteral(t *testing.T) {
+	if got := sqlLiteral("it's"); got != "'it''s'" {
+		t.Errorf("sqlLiteral(it's) = %v", got)
+	}
+}
@@ -2,6 +2,7 @@ package platform
 
 import (
 	"context"
+	"reflect"
 
 	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
 	batchv1 "k8s.io/api/batch/v1"
@@ -19,8 +20,8 @@ func (r *ReconcilePlatform) reconcileHardDeleteNamespace(request reconcile.Reque
 	log := logger.WithName("HardDeleteNamespace")
 	cronjob := &v1beta1.CronJob{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "harddeletenamespace",
-			Namespace: "default",
+			Name:      instance.Name + "-harddeletenamespace",
+			Namespace: instance.Namespace,
 		},
 
 		Spec: v1beta1.CronJobSpec{
@@ -66,6 +67,10 @@ func (r *ReconcilePlatform) reconcileHardDeleteNamespace(request reconcile.Reque
 			},
 		},
 	}
+	if err := r.secureWorkload(instance, cronjob.Name, &cronjob.Spec.JobTemplate.Spec.Template); err != nil {
+		return err
+	}
+
 	if err := controllerutil.SetControllerReference(instance, cronjob, r.scheme); err != nil {
 		return err
 	}
@@ -80,7 +85,14 @@ func (r *ReconcilePlatform) reconcileHardDeleteNamespace(request reconcile.Reque
 		}
 	} else if err != nil {
 		return err
+	} else if !reflect.DeepEqual(cronjob.Spec, foundS.Spec) {
+		foundS.Spec = cronjob.Spec
+		log.Info("Updating cronjob for hard delete namespace", "namespace", cronjob.Namespace, "name", cronjob.Name)
+		if err := r.Update(context.TODO(), foundS); err != nil {
+			return err
+		}
 	}
-	return nil
-	//dummy commit to build
+
+	// Releases before objects were prefixed by the platform name created them in default
+	return r.deleteLegacyObjects(instance, &v1beta1.CronJob{ObjectMeta: legacyObjectMeta("harddeletenamespace")})
 }
@@ -0,0 +1,59 @@
+package platform
+
+import (
+	"context"
+
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+)
+
+// reconcileScriptJob creates job, which runs a script whose hash is in the annotation, and
+// replaces it once the hash changed. It returns the job as found.
+func (r *ReconcilePlatform) reconcileScriptJob(instance *infinimeshv1beta1.Platform, job *batchv1.Job, annotation, hash string) (*batchv1.Job, error) {
+	log := logger.WithName("jobs")
+	if job.Annotations == nil {
+		job.Annotations = map[string]string{}
+	}
+	job.Annotations[annotation] = hash
+
+	if err := r.secureWorkload(instance, job.Name, &job.Spec.Template); err != nil {
+		return nil, err
+	}
+	if err := controllerutil.SetControllerReference(instance, job, r.scheme); err != nil {
+		return nil, err
+	}
+
+	found := &batchv1.Job{}
+	err := r.Get(context.TODO(), types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		log.Info("Creating Job", "namespace", job.Namespace, "name", job.Name)
+		if err := r.Create(context.TODO(), job); err != nil {
+			return nil, err
+		}
+		return job, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if found.Annotations[annotation] == hash {
+		return found, nil
+	}
+
+	// The pod template of a job is immutable, recreate it with the new script
+	log.Info("Recreating Job", "namespace", job.Namespace, "name", job.Name)
+	err = r.Delete(context.TODO(), found, client.PropagationPolicy(metav1.DeletePropagationBackground))
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+	// A job still being deleted is created again on the next pass
+	err = r.Create(context.TODO(), job)
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return nil, err
+	}
+	return job, nil
+}
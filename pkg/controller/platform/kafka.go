@@ -0,0 +1,196 @@
+package platform
+
+import (
+	corev1 "k8s.io/api/core/v1"
+
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+)
+
+const (
+	kafkaCAMountPath   = "/kafka/ca"
+	kafkaCertMountPath = "/kafka/cert"
+)
+
+// kafkaBootstrapServers returns the bootstrap address of the managed Kafka if enabled,
+// and the configured bootstrap servers otherwise.
+func kafkaBootstrapServers(instance *infinimeshv1beta1.Platform) string {
+	if instance.Spec.Kafka.Managed != nil {
+		return instance.Name + "-kafka:9092"
+	}
+	return instance.Spec.Kafka.BootstrapServers
+}
+
+// kafkaTLS returns the TLS settings of the Kafka clients, the managed Kafka only serves PLAINTEXT.
+func kafkaTLS(instance *infinimeshv1beta1.Platform) *infinimeshv1beta1.PlatformKafkaTLS {
+	if instance.Spec.Kafka.Managed != nil {
+		return nil
+	}
+	return instance.Spec.Kafka.TLS
+}
+
+// kafkaSASL returns the SASL settings of the Kafka clients, the managed Kafka doesn't
+// authenticate them.
+func kafkaSASL(instance *infinimeshv1beta1.Platform) *infinimeshv1beta1.PlatformKafkaSASL {
+	if instance.Spec.Kafka.Managed != nil {
+		return nil
+	}
+	return instance.Spec.Kafka.SASL
+}
+
+// kafkaEnv returns the environment every Kafka client of the platform needs to reach the brokers.
+func kafkaEnv(instance *infinimeshv1beta1.Platform) []corev1.EnvVar {
+	env := []corev1.EnvVar{
+		{
+			Name:  "KAFKA_HOST",
+			Value: kafkaBootstrapServers(instance),
+		},
+	}
+
+	if tls := kafkaTLS(instance); tls != nil {
+		env = append(env, corev1.EnvVar{
+			Name:  "KAFKA_TLS",
+			Value: "true",
+		})
+		if tls.CASecret != "" {
+			env = append(env, corev1.EnvVar{
+				Name:  "KAFKA_TLS_CA_FILE",
+				Value: kafkaCAMountPath + "/ca.crt",
+			})
+		}
+		if tls.CertSecret != "" {
+			env = append(env, corev1.EnvVar{
+				Name:  "KAFKA_TLS_CERT_FILE",
+				Value: kafkaCertMountPath + "/" + corev1.TLSCertKey,
+			}, corev1.EnvVar{
+				Name:  "KAFKA_TLS_KEY_FILE",
+				Value: kafkaCertMountPath + "/" + corev1.TLSPrivateKeyKey,
+			})
+		}
+	}
+
+	if sasl := kafkaSASL(instance); sasl != nil {
+		env = append(env, corev1.EnvVar{
+			Name:  "KAFKA_SASL_MECHANISM",
+			Value: sasl.Mechanism,
+		}, corev1.EnvVar{
+			Name: "KAFKA_SASL_USERNAME",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: sasl.CredentialsSecret,
+					},
+					Key: "username",
+				},
+			},
+		}, corev1.EnvVar{
+			Name: "KAFKA_SASL_PASSWORD",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: sasl.CredentialsSecret,
+					},
+					Key: "password",
+				},
+			},
+		})
+	}
+
+	return env
+}
+
+// kafkaVolumes returns the volumes holding the Kafka CA and client certificate, if configured.
+func kafkaVolumes(instance *infinimeshv1beta1.Platform) []corev1.Volume {
+	var volumes []corev1.Volume
+	tls := kafkaTLS(instance)
+	if tls == nil {
+		return volumes
+	}
+
+	if tls.CASecret != "" {
+		volumes = append(volumes, corev1.Volume{
+			Name: "kafka-ca",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: tls.CASecret,
+				},
+			},
+		})
+	}
+	if tls.CertSecret != "" {
+		volumes = append(volumes, corev1.Volume{
+			Name: "kafka-cert",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: tls.CertSecret,
+				},
+			},
+		})
+	}
+	return volumes
+}
+
+// kafkaVolumeMounts mounts the volumes returned by kafkaVolumes.
+func kafkaVolumeMounts(instance *infinimeshv1beta1.Platform) []corev1.VolumeMount {
+	var mounts []corev1.VolumeMount
+	tls := kafkaTLS(instance)
+	if tls == nil {
+		return mounts
+	}
+
+	if tls.CASecret != "" {
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:      "kafka-ca",
+			MountPath: kafkaCAMountPath,
+			ReadOnly:  true,
+		})
+	}
+	if tls.CertSecret != "" {
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:      "kafka-cert",
+			MountPath: kafkaCertMountPath,
+			ReadOnly:  true,
+		})
+	}
+	return mounts
+}
+
+// kafkaClientImage runs the Kafka CLI with the config of kafkaCommandConfig. Its PEM key and
+// trust stores need Kafka 2.7 (KIP-651).
+const kafkaClientImage = "bitnami/kafka:2.7.0"
+
+// kafkaCommandConfig renders a shell snippet writing a Kafka CLI client config to path,
+// based on the environment returned by kafkaEnv.
+func kafkaCommandConfig(instance *infinimeshv1beta1.Platform, path string) string {
+	tls := kafkaTLS(instance)
+	sasl := kafkaSASL(instance)
+	if tls == nil && sasl == nil {
+		return ": > " + path + "\n"
+	}
+
+	protocol := "SASL_PLAINTEXT"
+	if tls != nil && sasl != nil {
+		protocol = "SASL_SSL"
+	} else if tls != nil {
+		protocol = "SSL"
+	}
+
+	script := "echo security.protocol=" + protocol + " > " + path + "\n"
+	if tls != nil && tls.CASecret != "" {
+		script += "echo ssl.truststore.type=PEM >> " + path + "\n"
+		script += "echo ssl.truststore.location=$KAFKA_TLS_CA_FILE >> " + path + "\n"
+	}
+	if tls != nil && tls.CertSecret != "" {
+		script += "cat $KAFKA_TLS_KEY_FILE $KAFKA_TLS_CERT_FILE > " + path + ".pem\n"
+		script += "echo ssl.keystore.type=PEM >> " + path + "\n"
+		script += "echo ssl.keystore.location=" + path + ".pem >> " + path + "\n"
+	}
+	if sasl != nil {
+		module := "org.apache.kafka.common.security.scram.ScramLoginModule"
+		if sasl.Mechanism == "PLAIN" {
+			module = "org.apache.kafka.common.security.plain.PlainLoginModule"
+		}
+		script += "echo sasl.mechanism=$KAFKA_SASL_MECHANISM >> " + path + "\n"
+		script += "echo \"sasl.jaas.config=" + module + " required username=\\\"$KAFKA_SASL_USERNAME\\\" password=\\\"$KAFKA_SASL_PASSWORD\\\";\" >> " + path + "\n"
+	}
+	return script
+}
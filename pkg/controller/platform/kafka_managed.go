@@ -0,0 +1,391 @@
+package platform
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+)
+
+// managedKafkaReplicas returns the number of nodes of the managed Kafka.
+func managedKafkaReplicas(instance *infinimeshv1beta1.Platform) int32 {
+	if instance.Spec.Kafka.Managed == nil || instance.Spec.Kafka.Managed.Replicas == 0 {
+		return 1
+	}
+	return instance.Spec.Kafka.Managed.Replicas
+}
+
+// kafkaQuorumVoters returns the KRaft controller quorum, one voter per StatefulSet pod.
+func kafkaQuorumVoters(instance *infinimeshv1beta1.Platform) string {
+	var voters []string
+	for i := int32(0); i < managedKafkaReplicas(instance); i++ {
+		voters = append(voters, fmt.Sprintf("%v@%v-kafka-%v.%v-kafka-headless.%v.svc.cluster.local:9093",
+			i, instance.Name, i, instance.Name, instance.Namespace))
+	}
+	return strings.Join(voters, ",")
+}
+
+func (r *ReconcilePlatform) reconcileManagedKafka(request reconcile.Request, instance *infinimeshv1beta1.Platform) error {
+	log := logger.WithName("kafka")
+
+	if instance.Spec.Kafka.Managed == nil {
+		return nil
+	}
+
+	name := instance.Name + "-kafka"
+	replicas := managedKafkaReplicas(instance)
+	replicationFactor := fmt.Sprint(replicas)
+	minISR := "1"
+	if replicas > 1 {
+		minISR = "2"
+	}
+
+	// The KRaft cluster id has to stay stable for the lifetime of the data directories
+	randomKey, err := GenerateRandomBytes(16)
+	if err != nil {
+		return err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: instance.Namespace,
+		},
+		Data: map[string][]byte{
+			"cluster-id": []byte(base64.RawURLEncoding.EncodeToString(randomKey)),
+		},
+	}
+
+	if err := controllerutil.SetControllerReference(instance, secret, r.scheme); err != nil {
+		return err
+	}
+
+	foundSecret := &corev1.Secret{}
+	err = r.Get(context.TODO(), types.NamespacedName{Name: secret.Name, Namespace: secret.Namespace}, foundSecret)
+	if err != nil && errors.IsNotFound(err) {
+		log.Info("Creating Secret", "namespace", secret.Namespace, "name", secret.Name)
+		err = r.Create(context.TODO(), secret)
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	headless := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name + "-headless",
+			Namespace: instance.Namespace,
+			Labels: map[string]string{
+				"app": name,
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP:                "None",
+			PublishNotReadyAddresses: true,
+			Selector:                 map[string]string{"app": name},
+			Ports: []corev1.ServicePort{
+				{
+					Port:       9092,
+					TargetPort: intstr.FromInt(9092),
+					Name:       "client",
+				},
+				{
+					Port:       9093,
+					TargetPort: intstr.FromInt(9093),
+					Name:       "controller",
+				},
+			},
+		},
+	}
+
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: instance.Namespace,
+			Labels: map[string]string{
+				"app": name,
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			Type:     corev1.ServiceTypeClusterIP,
+			Selector: map[string]string{"app": name},
+			Ports: []corev1.ServicePort{
+				{
+					Port:       9092,
+					TargetPort: intstr.FromInt(9092),
+					Name:       "client",
+				},
+			},
+		},
+	}
+
+	for _, s := range []*corev1.Service{headless, svc} {
+		if err := controllerutil.SetControllerReference(instance, s, r.scheme); err != nil {
+			return err
+		}
+
+		found := &corev1.Service{}
+		err = r.Get(context.TODO(), types.NamespacedName{Name: s.Name, Namespace: s.Namespace}, found)
+		if err != nil && errors.IsNotFound(err) {
+			log.Info("Creating Service", "namespace", s.Namespace, "name", s.Name)
+			err = r.Create(context.TODO(), s)
+			if err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+	}
+
+	var pvcSpec corev1.PersistentVolumeClaimSpec
+	if instance.Spec.Kafka.Managed.Storage == nil {
+		pvcSpec = corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(defaultStorage)},
+			},
+		}
+	} else {
+		pvcSpec = *instance.Spec.Kafka.Managed.Storage
+	}
+
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: instance.Namespace,
+		},
+		Spec: appsv1.StatefulSetSpec{
+			ServiceName:         name + "-headless",
+			Replicas:            &replicas,
+			PodManagementPolicy: appsv1.ParallelPodManagement,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": name},
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": name}},
+				Spec: corev1.PodSpec{
+					Affinity: &corev1.Affinity{
+						PodAntiAffinity: &corev1.PodAntiAffinity{
+							PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{
+								{
+									Weight: 100,
+									PodAffinityTerm: corev1.PodAffinityTerm{
+										LabelSelector: &metav1.LabelSelector{
+											MatchExpressions: []metav1.LabelSelectorRequirement{
+												{
+													Key:      "app",
+													Operator: metav1.LabelSelectorOpIn,
+													Values: []string{
+														name,
+													},
+												},
+											},
+										},
+										TopologyKey: "kubernetes.io/hostname",
+									},
+								},
+							},
+						},
+					},
+					Containers: []corev1.Container{
+						{
+							Name:            "kafka",
+							Image:           "bitnami/kafka:3.3.2",
+							ImagePullPolicy: corev1.PullIfNotPresent,
+							Ports: []corev1.ContainerPort{
+								{
+									ContainerPort: 9092,
+									Name:          "client",
+								},
+								{
+									ContainerPort: 9093,
+									Name:          "controller",
+								},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "datadir",
+									MountPath: "/bitnami/kafka",
+								},
+							},
+							Env: []corev1.EnvVar{
+								{
+									Name: "KAFKA_KRAFT_CLUSTER_ID",
+									ValueFrom: &corev1.EnvVarSource{
+										SecretKeyRef: &corev1.SecretKeySelector{
+											LocalObjectReference: corev1.LocalObjectReference{
+												Name: name,
+											},
+											Key: "cluster-id",
+										},
+									},
+								},
+								{
+									Name:  "KAFKA_ENABLE_KRAFT",
+									Value: "yes",
+								},
+								{
+									Name:  "ALLOW_PLAINTEXT_LISTENER",
+									Value: "yes",
+								},
+								{
+									Name:  "KAFKA_CFG_PROCESS_ROLES",
+									Value: "broker,controller",
+								},
+								{
+									Name:  "KAFKA_CFG_LISTENERS",
+									Value: "PLAINTEXT://:9092,CONTROLLER://:9093",
+								},
+								{
+									Name:  "KAFKA_CFG_LISTENER_SECURITY_PROTOCOL_MAP",
+									Value: "CONTROLLER:PLAINTEXT,PLAINTEXT:PLAINTEXT",
+								},
+								{
+									Name:  "KAFKA_CFG_CONTROLLER_LISTENER_NAMES",
+									Value: "CONTROLLER",
+								},
+								{
+									Name:  "KAFKA_CFG_INTER_BROKER_LISTENER_NAME",
+									Value: "PLAINTEXT",
+								},
+								{
+									Name:  "KAFKA_CFG_CONTROLLER_QUORUM_VOTERS",
+									Value: kafkaQuorumVoters(instance),
+								},
+								{
+									Name:  "KAFKA_CFG_OFFSETS_TOPIC_REPLICATION_FACTOR",
+									Value: replicationFactor,
+								},
+								{
+									Name:  "KAFKA_CFG_TRANSACTION_STATE_LOG_REPLICATION_FACTOR",
+									Value: replicationFactor,
+								},
+								{
+									Name:  "KAFKA_CFG_DEFAULT_REPLICATION_FACTOR",
+									Value: replicationFactor,
+								},
+								{
+									Name:  "KAFKA_CFG_MIN_INSYNC_REPLICAS",
+									Value: minISR,
+								},
+							},
+							Command: []string{
+								"bash",
+								"-c",
+								`set -ex
+export KAFKA_CFG_NODE_ID=${HOSTNAME##*-}
+export KAFKA_CFG_ADVERTISED_LISTENERS=PLAINTEXT://$(hostname -f):9092
+exec /opt/bitnami/scripts/kafka/entrypoint.sh /opt/bitnami/scripts/kafka/run.sh`,
+							},
+							ReadinessProbe: &corev1.Probe{
+								Handler: corev1.Handler{
+									TCPSocket: &corev1.TCPSocketAction{
+										Port: intstr.FromInt(9092),
+									},
+								},
+								InitialDelaySeconds: 10,
+								PeriodSeconds:       10,
+							},
+						},
+					},
+					TerminationGracePeriodSeconds: func() *int64 { val := int64(60); return &val }(),
+				},
+			},
+			UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
+				Type: "RollingUpdate",
+			},
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "datadir",
+					},
+					Spec: pvcSpec,
+				},
+			},
+		},
+	}
+
+	if err := r.secureWorkload(instance, sts.Name, &sts.Spec.Template); err != nil {
+		return err
+	}
+	// Kafka writes its configuration into the image when it starts
+	for _, c := range sts.Spec.Template.Spec.Containers {
+		if c.SecurityContext != nil {
+			c.SecurityContext.ReadOnlyRootFilesystem = nil
+		}
+	}
+
+	if err := controllerutil.SetControllerReference(instance, sts, r.scheme); err != nil {
+		return err
+	}
+
+	foundS := &appsv1.StatefulSet{}
+	err = r.Get(context.TODO(), types.NamespacedName{Name: sts.Name, Namespace: sts.Namespace}, foundS)
+	if err != nil && errors.IsNotFound(err) {
+		log.Info("Creating statefulset", "namespace", sts.Namespace, "name", sts.Name)
+		err = r.Create(context.TODO(), sts)
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	} else {
+		// Volume claim templates are immutable, only roll out replica and pod changes
+		if !reflect.DeepEqual(sts.Spec.Replicas, foundS.Spec.Replicas) || !reflect.DeepEqual(sts.Spec.Template, foundS.Spec.Template) {
+			foundS.Spec.Replicas = sts.Spec.Replicas
+			foundS.Spec.Template = sts.Spec.Template
+			log.Info("Updating statefulset", "namespace", sts.Namespace, "name", sts.Name)
+			err = r.Update(context.TODO(), foundS)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	maxUnavailable := intstr.FromInt(1)
+	pdb := &policyv1beta1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: instance.Namespace,
+		},
+		Spec: policyv1beta1.PodDisruptionBudgetSpec{
+			MaxUnavailable: &maxUnavailable,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": name},
+			},
+		},
+	}
+
+	if err := controllerutil.SetControllerReference(instance, pdb, r.scheme); err != nil {
+		return err
+	}
+
+	foundPdb := &policyv1beta1.PodDisruptionBudget{}
+	err = r.Get(context.TODO(), types.NamespacedName{Name: pdb.Name, Namespace: pdb.Namespace}, foundPdb)
+	if err != nil && errors.IsNotFound(err) {
+		log.Info("Creating PodDisruptionBudget", "namespace", pdb.Namespace, "name", pdb.Name)
+		err = r.Create(context.TODO(), pdb)
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	return nil
+}
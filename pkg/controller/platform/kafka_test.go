@@ -0,0 +1,54 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package platform
+
+import (
+	"strings"
+	"testing"
+
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+)
+
+func TestKafkaClientSecurity(t *testing.T) {
+	instance := &infinimeshv1beta1.Platform{}
+	instance.Spec.Kafka.BootstrapServers = "kafka.example.com:9093"
+	instance.Spec.Kafka.TLS = &infinimeshv1beta1.PlatformKafkaTLS{CASecret: "kafka-ca"}
+	instance.Spec.Kafka.SASL = &infinimeshv1beta1.PlatformKafkaSASL{Mechanism: "PLAIN", CredentialsSecret: "kafka-user"}
+
+	if n := len(kafkaEnv(instance)); n != 6 {
+		t.Errorf("external Kafka: %v variables, want 6", n)
+	}
+	if len(kafkaVolumes(instance)) != 1 || len(kafkaVolumeMounts(instance)) != 1 {
+		t.Error("external Kafka: CA isn't mounted")
+	}
+	if config := kafkaCommandConfig(instance, "/tmp/client.properties"); !strings.Contains(config, "SASL_SSL") {
+		t.Errorf("external Kafka: config %q", config)
+	}
+
+	// The managed Kafka only serves PLAINTEXT
+	instance.Spec.Kafka.Managed = &infinimeshv1beta1.PlatformKafkaManaged{}
+	env := kafkaEnv(instance)
+	if len(env) != 1 || env[0].Name != "KAFKA_HOST" {
+		t.Errorf("managed Kafka: env %+v", env)
+	}
+	if len(kafkaVolumes(instance)) != 0 || len(kafkaVolumeMounts(instance)) != 0 {
+		t.Error("managed Kafka: CA is mounted")
+	}
+	if config := kafkaCommandConfig(instance, "/tmp/client.properties"); strings.Contains(config, "security.protocol") {
+		t.Errorf("managed Kafka: config %q", config)
+	}
+}
@@ -0,0 +1,280 @@
+package platform
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+)
+
+const (
+	defaultKafkaPartitions = int32(3)
+	defaultKafkaReplicas   = int32(1)
+
+	strimziAPIVersion = "kafka.strimzi.io/v1beta1"
+
+	kafkaTopicsHashAnnotation = "infinimesh.io/topics-hash"
+)
+
+// defaultKafkaTopics are the topics the infinimesh components produce to and consume from.
+var defaultKafkaTopics = []string{
+	"mqtt.messages.incoming",
+	"mqtt.messages.outgoing",
+	"shadow.reported-state.delta",
+	"shadow.reported-state.full",
+	"shadow.desired-state.delta",
+	"shadow.desired-state.full",
+}
+
+// kafkaTopics returns the default topics merged with the ones from the spec,
+// with partitions and replicas filled in.
+func kafkaTopics(instance *infinimeshv1beta1.Platform) []infinimeshv1beta1.PlatformKafkaTopic {
+	byName := map[string]infinimeshv1beta1.PlatformKafkaTopic{}
+	for _, name := range defaultKafkaTopics {
+		byName[name] = infinimeshv1beta1.PlatformKafkaTopic{Name: name}
+	}
+	for _, topic := range instance.Spec.Kafka.Topics {
+		byName[topic.Name] = topic
+	}
+
+	replicas := defaultKafkaReplicas
+	if instance.Spec.Kafka.Managed != nil {
+		replicas = managedKafkaReplicas(instance)
+	}
+
+	var topics []infinimeshv1beta1.PlatformKafkaTopic
+	for _, topic := range byName {
+		if topic.Partitions == 0 {
+			topic.Partitions = defaultKafkaPartitions
+		}
+		if topic.Replicas == 0 {
+			topic.Replicas = replicas
+		}
+		topics = append(topics, topic)
+	}
+	sort.Slice(topics, func(i, j int) bool { return topics[i].Name < topics[j].Name })
+	return topics
+}
+
+// strimziCluster returns the name of the Strimzi cluster serving the bootstrap servers.
+func strimziCluster(instance *infinimeshv1beta1.Platform) string {
+	if instance.Spec.Kafka.StrimziCluster != "" {
+		return instance.Spec.Kafka.StrimziCluster
+	}
+	host := strings.Split(kafkaBootstrapServers(instance), ",")[0]
+	host = strings.Split(host, ":")[0]
+	host = strings.Split(host, ".")[0]
+	return strings.TrimSuffix(host, "-kafka-bootstrap")
+}
+
+// kafkaTopicResourceName returns a DNS compatible name for the KafkaTopic resource of a topic.
+func kafkaTopicResourceName(instance *infinimeshv1beta1.Platform, topic string) string {
+	return instance.Name + "-" + strings.Replace(topic, "_", "-", -1)
+}
+
+func (r *ReconcilePlatform) reconcileKafkaTopics(request reconcile.Request, instance *infinimeshv1beta1.Platform) error {
+	log := logger.WithName("kafka-topics")
+
+	if kafkaBootstrapServers(instance) == "" {
+		log.Info("No bootstrap servers configured, skipping topic management")
+		return nil
+	}
+
+	topics := kafkaTopics(instance)
+
+	// The managed Kafka has no topic operator
+	if instance.Spec.Kafka.Managed != nil {
+		return r.reconcileKafkaTopicsJob(instance, topics)
+	}
+
+	// Probe for the Strimzi CRDs, fall back to the admin job if they are missing
+	probe := &unstructured.Unstructured{}
+	probe.SetAPIVersion(strimziAPIVersion)
+	probe.SetKind("KafkaTopic")
+	err := r.Get(context.TODO(), types.NamespacedName{Name: kafkaTopicResourceName(instance, topics[0].Name), Namespace: instance.Namespace}, probe)
+	if err != nil && meta.IsNoMatchError(err) {
+		return r.reconcileKafkaTopicsJob(instance, topics)
+	} else if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	return r.reconcileStrimziTopics(instance, topics)
+}
+
+func (r *ReconcilePlatform) reconcileStrimziTopics(instance *infinimeshv1beta1.Platform, topics []infinimeshv1beta1.PlatformKafkaTopic) error {
+	log := logger.WithName("kafka-topics")
+
+	var status []infinimeshv1beta1.PlatformKafkaTopicStatus
+	for _, topic := range topics {
+		spec := map[string]interface{}{
+			"topicName":  topic.Name,
+			"partitions": int64(topic.Partitions),
+			"replicas":   int64(topic.Replicas),
+		}
+		if topic.RetentionMs != 0 {
+			spec["config"] = map[string]interface{}{
+				"retention.ms": topic.RetentionMs,
+			}
+		}
+
+		kt := &unstructured.Unstructured{}
+		kt.Object = map[string]interface{}{
+			"kind":       "KafkaTopic",
+			"apiVersion": strimziAPIVersion,
+			"metadata": map[string]interface{}{
+				"name":      kafkaTopicResourceName(instance, topic.Name),
+				"namespace": instance.Namespace,
+				"labels": map[string]interface{}{
+					"strimzi.io/cluster": strimziCluster(instance),
+				},
+			},
+			"spec": spec,
+		}
+		if err := controllerutil.SetControllerReference(instance, kt, r.scheme); err != nil {
+			return err
+		}
+
+		found := &unstructured.Unstructured{}
+		found.SetAPIVersion(strimziAPIVersion)
+		found.SetKind("KafkaTopic")
+		err := r.Get(context.TODO(), types.NamespacedName{Name: kt.GetName(), Namespace: kt.GetNamespace()}, found)
+		if err != nil && errors.IsNotFound(err) {
+			log.Info("Creating KafkaTopic", "namespace", kt.GetNamespace(), "name", kt.GetName())
+			err = r.Create(context.TODO(), kt)
+			if err != nil {
+				return err
+			}
+			status = append(status, infinimeshv1beta1.PlatformKafkaTopicStatus{Name: topic.Name, Message: "Created"})
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		foundSpec, _, _ := unstructured.NestedMap(found.Object, "spec")
+		if !reflect.DeepEqual(foundSpec, spec) {
+			found.Object["spec"] = spec
+			log.Info("Updating KafkaTopic", "namespace", found.GetNamespace(), "name", found.GetName())
+			err = r.Update(context.TODO(), found)
+			if err != nil {
+				return err
+			}
+		}
+
+		status = append(status, strimziTopicStatus(topic.Name, found))
+	}
+
+	instance.Status.KafkaTopics = status
+	return nil
+}
+
+// strimziTopicStatus reads the Ready condition the Strimzi topic operator sets on a KafkaTopic.
+func strimziTopicStatus(name string, kt *unstructured.Unstructured) infinimeshv1beta1.PlatformKafkaTopicStatus {
+	status := infinimeshv1beta1.PlatformKafkaTopicStatus{Name: name, Message: "Waiting for topic operator"}
+	conditions, _, _ := unstructured.NestedSlice(kt.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok || condition["type"] != "Ready" {
+			continue
+		}
+		status.Ready = condition["status"] == "True"
+		status.Message, _ = condition["message"].(string)
+	}
+	return status
+}
+
+// kafkaTopicsScript renders the kafka-topics.sh invocations that create the topics via the admin protocol.
+func kafkaTopicsScript(instance *infinimeshv1beta1.Platform, topics []infinimeshv1beta1.PlatformKafkaTopic) string {
+	script := "set -e\n" + kafkaCommandConfig(instance, "/tmp/client.properties")
+	for _, topic := range topics {
+		script += fmt.Sprintf("kafka-topics.sh --bootstrap-server %v --command-config /tmp/client.properties --create --if-not-exists --topic %v --partitions %v --replication-factor %v",
+			kafkaBootstrapServers(instance), topic.Name, topic.Partitions, topic.Replicas)
+		if topic.RetentionMs != 0 {
+			script += fmt.Sprintf(" --config retention.ms=%v", topic.RetentionMs)
+			script += fmt.Sprintf("\nkafka-configs.sh --bootstrap-server %v --command-config /tmp/client.properties --alter --entity-type topics --entity-name %v --add-config retention.ms=%v",
+				kafkaBootstrapServers(instance), topic.Name, topic.RetentionMs)
+		}
+		script += "\n"
+	}
+	return script
+}
+
+func (r *ReconcilePlatform) reconcileKafkaTopicsJob(instance *infinimeshv1beta1.Platform, topics []infinimeshv1beta1.PlatformKafkaTopic) error {
+	jobName := instance.Name + "-kafka-topics"
+
+	script := kafkaTopicsScript(instance, topics)
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(script)))[:16]
+	backoffLimit := int32(6)
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      jobName,
+			Namespace: instance.Namespace,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"job": jobName}},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyOnFailure,
+					Containers: []corev1.Container{
+						{
+							Name:            "kafka-topics",
+							Image:           kafkaClientImage,
+							ImagePullPolicy: corev1.PullIfNotPresent,
+							Env:             kafkaEnv(instance),
+							VolumeMounts:    kafkaVolumeMounts(instance),
+							Command: []string{
+								"/bin/bash", "-c", script,
+							},
+						},
+					},
+					Volumes: kafkaVolumes(instance),
+				},
+			},
+		},
+	}
+
+	found, err := r.reconcileScriptJob(instance, job, kafkaTopicsHashAnnotation, hash)
+	if err != nil {
+		return err
+	}
+
+	var status []infinimeshv1beta1.PlatformKafkaTopicStatus
+	for _, topic := range topics {
+		topicStatus := infinimeshv1beta1.PlatformKafkaTopicStatus{Name: topic.Name, Message: "Waiting for job " + jobName}
+		if found.Status.Succeeded > 0 {
+			topicStatus.Ready = true
+			topicStatus.Message = ""
+		} else if found.Status.Failed > backoffLimit {
+			topicStatus.Message = "Job " + jobName + " failed"
+		}
+		status = append(status, topicStatus)
+	}
+
+	instance.Status.KafkaTopics = status
+	return nil
+}
+
+// kafkaTopicsReady reports whether all topics in the status are ready.
+func kafkaTopicsReady(instance *infinimeshv1beta1.Platform) bool {
+	for _, topic := range instance.Status.KafkaTopics {
+		if !topic.Ready {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package platform
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+)
+
+func TestKafkaTopicsJobRecreated(t *testing.T) {
+	instance := &infinimeshv1beta1.Platform{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"}}
+	instance.Spec.Kafka.Managed = &infinimeshv1beta1.PlatformKafkaManaged{}
+
+	c := newMemoryClient(scheme.Scheme)
+	r := &ReconcilePlatform{Client: c, scheme: scheme.Scheme, recorder: record.NewFakeRecorder(100)}
+	key := types.NamespacedName{Name: "foo-kafka-topics", Namespace: "default"}
+
+	if err := r.reconcileKafkaTopicsJob(instance, kafkaTopics(instance)); err != nil {
+		t.Fatal(err)
+	}
+	job := &batchv1.Job{}
+	if err := c.Get(context.TODO(), key, job); err != nil {
+		t.Fatal(err)
+	}
+	hash := job.Annotations[kafkaTopicsHashAnnotation]
+	job.Status.Succeeded = 1
+	if err := c.Update(context.TODO(), job); err != nil {
+		t.Fatal(err)
+	}
+
+	// A changed topic list replaces the finished job in the same pass
+	instance.Spec.Kafka.Topics = []infinimeshv1beta1.PlatformKafkaTopic{{Name: "extra", Partitions: 3}}
+	if err := r.reconcileKafkaTopicsJob(instance, kafkaTopics(instance)); err != nil {
+		t.Fatal(err)
+	}
+	job = &batchv1.Job{}
+	if err := c.Get(context.TODO(), key, job); err != nil {
+		t.Fatal(err)
+	}
+	if job.Annotations[kafkaTopicsHashAnnotation] == hash {
+		t.Error("job wasn't recreated with the new topics")
+	}
+	if job.Status.Succeeded != 0 || kafkaTopicsReady(instance) {
+		t.Error("topics are ready before the new job ran")
+	}
+}
+
+func TestKafkaTopicsJobImage(t *testing.T) {
+	instance := &infinimeshv1beta1.Platform{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"}}
+	instance.Spec.Kafka.BootstrapServers = "kafka.example.com:9093"
+	instance.Spec.Kafka.TLS = &infinimeshv1beta1.PlatformKafkaTLS{CASecret: "kafka-ca", CertSecret: "kafka-client"}
+
+	c := newMemoryClient(scheme.Scheme)
+	r := &ReconcilePlatform{Client: c, scheme: scheme.Scheme, recorder: record.NewFakeRecorder(100)}
+	if err := r.reconcileKafkaTopicsJob(instance, kafkaTopics(instance)); err != nil {
+		t.Fatal(err)
+	}
+	job := &batchv1.Job{}
+	if err := c.Get(context.TODO(), types.NamespacedName{Name: "foo-kafka-topics", Namespace: "default"}, job); err != nil {
+		t.Fatal(err)
+	}
+	container := job.Spec.Template.Spec.Containers[0]
+	script := strings.Join(container.Command, " ")
+	if !strings.Contains(script, "ssl.truststore.type=PEM") || !strings.Contains(script, "ssl.keystore.type=PEM") {
+		t.Fatalf("script doesn't use PEM stores: %v", script)
+	}
+
+	// PEM stores need a 2.7 client
+	var major, minor int
+	if _, err := fmt.Sscanf(container.Image[strings.LastIndex(container.Image, ":")+1:], "%d.%d", &major, &minor); err != nil {
+		t.Fatalf("image %v: %v", container.Image, err)
+	}
+	if major < 2 || major == 2 && minor < 7 {
+		t.Errorf("image %v can't load PEM stores", container.Image)
+	}
+}
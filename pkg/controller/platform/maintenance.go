@@ -0,0 +1,271 @@
+package platform
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"reflect"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+)
+
+const (
+	// pausedAnnotation stops all reconciliation of a platform if set to true
+	pausedAnnotation = "infinimesh.io/paused"
+	// unmanagedAnnotationPrefix followed by a component name skips that component if set to true
+	unmanagedAnnotationPrefix = "infinimesh.io/unmanaged-"
+
+	defaultMaintenanceMessage = "The platform is under maintenance, please try again later."
+)
+
+const maintenanceNginxConfig = `server {
+    listen 8080;
+    root /usr/share/nginx/html;
+    error_page 503 /maintenance.html;
+    location = /maintenance.html {
+        internal;
+    }
+    location / {
+        return 503;
+    }
+}
+`
+
+const maintenancePage = `<!DOCTYPE html>
+<html>
+<head><title>Maintenance</title></head>
+<body><p>%v</p></body>
+</html>
+`
+
+func paused(instance *infinimeshv1beta1.Platform) bool {
+	return instance.Annotations[pausedAnnotation] == "true"
+}
+
+func unmanaged(instance *infinimeshv1beta1.Platform, component string) bool {
+	return instance.Annotations[unmanagedAnnotationPrefix+component] == "true"
+}
+
+func maintenanceName(instance *infinimeshv1beta1.Platform) string {
+	return instance.Name + "-maintenance"
+}
+
+// ingressReplicas returns the replicas of the deployments behind an ingress, none while in
+// maintenance and the default otherwise.
+func ingressReplicas(instance *infinimeshv1beta1.Platform) *int32 {
+	if !instance.Spec.Maintenance.Enabled {
+		return nil
+	}
+	replicas := int32(0)
+	return &replicas
+}
+
+// ingressBackend returns the backend an ingress of the platform routes to, the maintenance
+// page while in maintenance and the given service otherwise.
+func ingressBackend(instance *infinimeshv1beta1.Platform, serviceName string, port int) extensionsv1beta1.IngressBackend {
+	if instance.Spec.Maintenance.Enabled {
+		return extensionsv1beta1.IngressBackend{
+			ServiceName: maintenanceName(instance),
+			ServicePort: intstr.FromInt(8080),
+		}
+	}
+	return extensionsv1beta1.IngressBackend{
+		ServiceName: serviceName,
+		ServicePort: intstr.FromInt(port),
+	}
+}
+
+// reconcileMaintenance serves the maintenance page while the platform is in maintenance and
+// removes it afterwards.
+func (r *ReconcilePlatform) reconcileMaintenance(request reconcile.Request, instance *infinimeshv1beta1.Platform) error {
+	log := logger.WithName("maintenance")
+
+	name := maintenanceName(instance)
+
+	if !instance.Spec.Maintenance.Enabled {
+		for _, obj := range []runtime.Object{&appsv1.Deployment{}, &corev1.Service{}, &corev1.ConfigMap{}} {
+			err := r.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: instance.Namespace}, obj)
+			if err != nil && errors.IsNotFound(err) {
+				continue
+			} else if err != nil {
+				return err
+			}
+			log.Info("Deleting maintenance page", "namespace", instance.Namespace, "name", name)
+			if err := r.Delete(context.TODO(), obj); err != nil && !errors.IsNotFound(err) {
+				return err
+			}
+		}
+		return nil
+	}
+
+	message := instance.Spec.Maintenance.Message
+	if message == "" {
+		message = defaultMaintenanceMessage
+	}
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: instance.Namespace,
+		},
+		Data: map[string]string{
+			"default.conf":     maintenanceNginxConfig,
+			"maintenance.html": fmt.Sprintf(maintenancePage, html.EscapeString(message)),
+		},
+	}
+
+	if err := controllerutil.SetControllerReference(instance, cm, r.scheme); err != nil {
+		return err
+	}
+
+	foundCm := &corev1.ConfigMap{}
+	err := r.Get(context.TODO(), types.NamespacedName{Name: cm.Name, Namespace: cm.Namespace}, foundCm)
+	if err != nil && errors.IsNotFound(err) {
+		log.Info("Creating ConfigMap", "namespace", cm.Namespace, "name", cm.Name)
+		err = r.Create(context.TODO(), cm)
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	} else if !reflect.DeepEqual(cm.Data, foundCm.Data) {
+		foundCm.Data = cm.Data
+		log.Info("Updating ConfigMap", "namespace", cm.Namespace, "name", cm.Name)
+		err = r.Update(context.TODO(), foundCm)
+		if err != nil {
+			return err
+		}
+	}
+
+	deploy := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: instance.Namespace,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"deployment": name},
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{"deployment": name},
+					// Restart nginx when the page changes
+					Annotations: map[string]string{"infinimesh.io/maintenance-message": message},
+				},
+				Spec: corev1.PodSpec{
+					Volumes: []corev1.Volume{
+						{
+							Name: "page",
+							VolumeSource: corev1.VolumeSource{
+								ConfigMap: &corev1.ConfigMapVolumeSource{
+									LocalObjectReference: corev1.LocalObjectReference{Name: cm.Name},
+								},
+							},
+						},
+					},
+					Containers: []corev1.Container{
+						{
+							Name:            "nginx",
+							Image:           "nginx:1.19-alpine",
+							ImagePullPolicy: corev1.PullIfNotPresent,
+							Ports: []corev1.ContainerPort{
+								{
+									ContainerPort: 8080,
+									Name:          "http",
+								},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "page",
+									MountPath: "/etc/nginx/conf.d/default.conf",
+									SubPath:   "default.conf",
+									ReadOnly:  true,
+								},
+								{
+									Name:      "page",
+									MountPath: "/usr/share/nginx/html/maintenance.html",
+									SubPath:   "maintenance.html",
+									ReadOnly:  true,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	if err := r.secureWorkload(instance, deploy.Name, &deploy.Spec.Template, "/var/cache/nginx", "/var/run"); err != nil {
+		return err
+	}
+
+	if err := controllerutil.SetControllerReference(instance, deploy, r.scheme); err != nil {
+		return err
+	}
+
+	found := &appsv1.Deployment{}
+	err = r.Get(context.TODO(), types.NamespacedName{Name: deploy.Name, Namespace: deploy.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		log.Info("Creating Deployment", "namespace", deploy.Namespace, "name", deploy.Name)
+		err = r.Create(context.TODO(), deploy)
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	} else if !reflect.DeepEqual(deploy.Spec.Template, found.Spec.Template) {
+		found.Spec.Template = deploy.Spec.Template
+		log.Info("Updating Deployment", "namespace", deploy.Namespace, "name", deploy.Name)
+		err = r.Update(context.TODO(), found)
+		if err != nil {
+			return err
+		}
+	}
+
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: instance.Namespace,
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{"deployment": name},
+			Type:     corev1.ServiceTypeClusterIP,
+			Ports: []corev1.ServicePort{
+				{
+					Protocol:   corev1.ProtocolTCP,
+					Port:       8080,
+					TargetPort: intstr.FromInt(8080),
+				},
+			},
+		},
+	}
+
+	if err := controllerutil.SetControllerReference(instance, svc, r.scheme); err != nil {
+		return err
+	}
+
+	foundSvc := &corev1.Service{}
+	err = r.Get(context.TODO(), types.NamespacedName{Name: svc.Name, Namespace: svc.Namespace}, foundSvc)
+	if err != nil && errors.IsNotFound(err) {
+		log.Info("Creating Service", "namespace", svc.Namespace, "name", svc.Name)
+		err = r.Create(context.TODO(), svc)
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package platform
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+)
+
+func TestMaintenanceGRPCIngress(t *testing.T) {
+	ctx := context.TODO()
+	instance := &infinimeshv1beta1.Platform{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"}}
+	instance.Spec.Apiserver.GRPC.Host = "grpc.example.com"
+	r := &ReconcilePlatform{Client: newMemoryClient(scheme.Scheme), scheme: scheme.Scheme, recorder: record.NewFakeRecorder(100)}
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: "foo", Namespace: "default"}}
+	key := types.NamespacedName{Name: "foo-apiserver", Namespace: "default"}
+
+	for _, c := range []struct {
+		maintenance bool
+		service     string
+		protocol    string
+	}{
+		{false, "foo-apiserver", "GRPC"},
+		// gRPC clients get the 503 of the maintenance page over HTTP
+		{true, "foo-maintenance", ""},
+		{false, "foo-apiserver", "GRPC"},
+	} {
+		instance.Spec.Maintenance.Enabled = c.maintenance
+		if err := r.reconcileApiserver(request, instance); err != nil {
+			t.Fatal(err)
+		}
+
+		ingress := &extensionsv1beta1.Ingress{}
+		if err := r.Get(ctx, key, ingress); err != nil {
+			t.Fatal(err)
+		}
+		if backend := ingress.Spec.Rules[0].HTTP.Paths[0].Backend.ServiceName; backend != c.service {
+			t.Errorf("maintenance %v: routed to %v, want %v", c.maintenance, backend, c.service)
+		}
+		if protocol := ingress.Annotations[grpcBackendAnnotation]; protocol != c.protocol {
+			t.Errorf("maintenance %v: backend protocol %q, want %q", c.maintenance, protocol, c.protocol)
+		}
+
+		deploy := &appsv1.Deployment{}
+		if err := r.Get(ctx, key, deploy); err != nil {
+			t.Fatal(err)
+		}
+		if running := deploy.Spec.Replicas == nil || *deploy.Spec.Replicas > 0; running == c.maintenance {
+			t.Errorf("maintenance %v: apiserver replicas %v", c.maintenance, deploy.Spec.Replicas)
+		}
+	}
+}
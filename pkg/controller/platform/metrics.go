@@ -0,0 +1,61 @@
+package platform
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+)
+
+// Platforms are labeled by platform_namespace, Prometheus would rename a namespace label to
+// exported_namespace when scraping the operator.
+var (
+	componentReconcileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "infinimesh_operator_component_reconcile_duration_seconds",
+		Help: "Duration of the reconciliation of a platform component",
+	}, []string{"platform_namespace", "platform", "component"})
+
+	componentReconcileErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "infinimesh_operator_component_reconcile_errors_total",
+		Help: "Number of failed reconciliations of a platform component",
+	}, []string{"platform_namespace", "platform", "component"})
+
+	managedPlatforms = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "infinimesh_operator_managed_platforms",
+		Help: "Number of platforms managed by the operator",
+	})
+
+	lastSuccessfulReconcile = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "infinimesh_operator_last_successful_reconcile_timestamp_seconds",
+		Help: "Unix time of the last reconciliation of a platform that succeeded for all components",
+	}, []string{"platform_namespace", "platform"})
+
+	rootPasswordSyncs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "infinimesh_operator_root_password_syncs_total",
+		Help: "Number of root password syncs by result, one of up-to-date, updated, created or failed",
+	}, []string{"platform_namespace", "platform", "result"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		componentReconcileDuration,
+		componentReconcileErrors,
+		managedPlatforms,
+		lastSuccessfulReconcile,
+		rootPasswordSyncs,
+	)
+}
+
+// observeComponent records the duration and outcome of the reconciliation of a component.
+func observeComponent(instance *infinimeshv1beta1.Platform, component string, start time.Time, err error) {
+	componentReconcileDuration.WithLabelValues(instance.Namespace, instance.Name, component).Observe(time.Since(start).Seconds())
+	if err != nil {
+		componentReconcileErrors.WithLabelValues(instance.Namespace, instance.Name, component).Inc()
+	}
+}
+
+func observeRootPasswordSync(instance *infinimeshv1beta1.Platform, result string) {
+	rootPasswordSyncs.WithLabelValues(instance.Namespace, instance.Name, result).Inc()
+}
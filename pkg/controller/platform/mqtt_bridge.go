@@ -37,31 +37,24 @@ func (r *ReconcilePlatform) reconcileMqtt(request reconcile.Request, instance *i
 					Containers: []corev1.Container{
 						{
 							Name:            "mqtt-bridge",
-							Image:           "quay.io/infinimesh/mqtt-bridge:latest",
-							ImagePullPolicy: corev1.PullAlways,
-							VolumeMounts: []corev1.VolumeMount{
+							Image:           image(instance, "mqtt-bridge"),
+							ImagePullPolicy: imagePullPolicy(instance, "mqtt-bridge"),
+							VolumeMounts: append([]corev1.VolumeMount{
 								{
 									Name:      "cert",
 									MountPath: "/cert",
 								},
-							},
-							Env: []corev1.EnvVar{
-								{
-									Name:  "KAFKA_HOST",
-									Value: instance.Spec.Kafka.BootstrapServers,
-								},
-								{
+							}, kafkaVolumeMounts(instance)...),
+							Env: append(append(kafkaEnv(instance),
+								redisEnv(instance.Name+"-redis-device-details", instance.Spec.Redis.DeviceDetails, "2")...),
+								corev1.EnvVar{
 									Name:  "DEVICE_REGISTRY_URL",
 									Value: request.Name + "-device-registry:8080",
 								},
-								{
-									Name:  "DB_ADDR2",
-									Value: instance.Name + "-redis-device-details:6379",
-								},
-							},
+							),
 						},
 					},
-					Volumes: []corev1.Volume{
+					Volumes: append([]corev1.Volume{
 						{
 							Name: "cert",
 							VolumeSource: corev1.VolumeSource{
@@ -70,12 +63,20 @@ func (r *ReconcilePlatform) reconcileMqtt(request reconcile.Request, instance *i
 								},
 							},
 						},
-					},
+					}, kafkaVolumes(instance)...),
 				},
 			},
 		},
 	}
 
+	if instance.Spec.DeviceCA.Enabled {
+		mountDeviceTrust(instance, &deploy.Spec.Template.Spec)
+	}
+
+	if err := r.secureWorkload(instance, deploy.Name, &deploy.Spec.Template); err != nil {
+		return err
+	}
+
 	if err := controllerutil.SetControllerReference(instance, deploy, r.scheme); err != nil {
 		return err
 	}
@@ -0,0 +1,121 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package platform
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/onsi/gomega"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1beta1 "k8s.io/api/rbac/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+)
+
+func TestPlatformsInDifferentNamespaces(t *testing.T) {
+	testIndependentPlatforms(t,
+		types.NamespacedName{Name: "foo", Namespace: "tenant-a"},
+		types.NamespacedName{Name: "foo", Namespace: "tenant-b"},
+	)
+}
+
+func TestPlatformsInSameNamespace(t *testing.T) {
+	testIndependentPlatforms(t,
+		types.NamespacedName{Name: "foo", Namespace: "shared"},
+		types.NamespacedName{Name: "bar", Namespace: "shared"},
+	)
+}
+
+// testIndependentPlatforms reconciles the namespaced components of two platforms and expects
+// each platform to own its own objects in its own namespace.
+func testIndependentPlatforms(t *testing.T, keys ...types.NamespacedName) {
+	g := gomega.NewGomegaWithT(t)
+
+	c, err := client.New(cfg, client.Options{Scheme: scheme.Scheme})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	r := &ReconcilePlatform{Client: c, scheme: scheme.Scheme, recorder: record.NewFakeRecorder(100)}
+
+	var instances []*infinimeshv1beta1.Platform
+	for _, key := range keys {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: key.Namespace}}
+		if err := c.Create(context.TODO(), ns); err != nil && !apierrors.IsAlreadyExists(err) {
+			t.Fatal(err)
+		}
+
+		instance := &infinimeshv1beta1.Platform{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
+		instance.Spec.Apiserver.Restful.Host = key.Name + "." + key.Namespace + ".example.com"
+		g.Expect(c.Create(context.TODO(), instance)).NotTo(gomega.HaveOccurred())
+		defer c.Delete(context.TODO(), instance)
+		instances = append(instances, instance)
+	}
+
+	// Reconcile twice to make sure the second platform doesn't take over the objects of the first
+	for i := 0; i < 2; i++ {
+		for _, instance := range instances {
+			request := reconcile.Request{NamespacedName: types.NamespacedName{Name: instance.Name, Namespace: instance.Namespace}}
+			g.Expect(r.reconcileResetRootAccountPwd(request, instance)).NotTo(gomega.HaveOccurred())
+			g.Expect(r.reconcileHardDeleteNamespace(request, instance)).NotTo(gomega.HaveOccurred())
+		}
+	}
+
+	for _, instance := range instances {
+		owned := map[string]runtime.Object{
+			instance.Name + "-reset-pwd":                  &rbacv1beta1.Role{},
+			instance.Name + "-reset-root-account-pwd":     &corev1.ServiceAccount{},
+			instance.Name + "-delete-root-account-secret": &batchv1beta1.CronJob{},
+			instance.Name + "-harddeletenamespace":        &batchv1beta1.CronJob{},
+		}
+		for name, obj := range owned {
+			key := types.NamespacedName{Name: name, Namespace: instance.Namespace}
+			g.Expect(c.Get(context.TODO(), key, obj)).NotTo(gomega.HaveOccurred(), name)
+			accessor := obj.(metav1.Object)
+			g.Expect(metav1.IsControlledBy(accessor, instance)).To(gomega.BeTrue(), name)
+		}
+
+		binding := &rbacv1beta1.RoleBinding{}
+		key := types.NamespacedName{Name: instance.Name + "-reset-pwd", Namespace: instance.Namespace}
+		g.Expect(c.Get(context.TODO(), key, binding)).NotTo(gomega.HaveOccurred())
+		g.Expect(metav1.IsControlledBy(binding, instance)).To(gomega.BeTrue())
+		g.Expect(binding.Subjects).To(gomega.HaveLen(1))
+		g.Expect(binding.Subjects[0].Name).To(gomega.Equal(instance.Name + "-reset-root-account-pwd"))
+		g.Expect(binding.Subjects[0].Namespace).To(gomega.Equal(instance.Namespace))
+
+		cronjob := &batchv1beta1.CronJob{}
+		key = types.NamespacedName{Name: instance.Name + "-delete-root-account-secret", Namespace: instance.Namespace}
+		g.Expect(c.Get(context.TODO(), key, cronjob)).NotTo(gomega.HaveOccurred())
+		command := strings.Join(cronjob.Spec.JobTemplate.Spec.Template.Spec.Containers[0].Command, " ")
+		g.Expect(command).To(gomega.ContainSubstring(instance.Name + "-root-account -n " + instance.Namespace + ";"))
+	}
+
+	// Nothing is left in default
+	for _, name := range []string{"delete-root-account-secret", "harddeletenamespace"} {
+		err := c.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: "default"}, &batchv1beta1.CronJob{})
+		g.Expect(apierrors.IsNotFound(err)).To(gomega.BeTrue(), name)
+	}
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package platform
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"k8s.io/api/batch/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+)
+
+// namespacedClient fails to read objects outside of its namespaces like the cache of a manager
+// watching several namespaces.
+type namespacedClient struct {
+	client.Client
+	namespaces []string
+}
+
+func (c *namespacedClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	for _, ns := range c.namespaces {
+		if ns == key.Namespace {
+			return c.Client.Get(ctx, key, obj)
+		}
+	}
+	return fmt.Errorf("namespace %v is not watched", key.Namespace)
+}
+
+func TestLegacyObjectsInUnwatchedNamespace(t *testing.T) {
+	defer func() { Namespaces = nil }()
+
+	instance := &infinimeshv1beta1.Platform{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "infinimesh", UID: "foo"}}
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: "foo", Namespace: "infinimesh"}}
+	mem := newMemoryClient(scheme.Scheme)
+	legacy := &v1beta1.CronJob{ObjectMeta: legacyObjectMeta("harddeletenamespace")}
+	if err := controllerutil.SetControllerReference(instance, legacy, scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := mem.Create(context.TODO(), legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	Namespaces = []string{"infinimesh", "other"}
+	r := &ReconcilePlatform{
+		Client:   &namespacedClient{Client: mem, namespaces: Namespaces},
+		scheme:   scheme.Scheme,
+		recorder: record.NewFakeRecorder(100),
+	}
+	if err := r.reconcileHardDeleteNamespace(request, instance); err != nil {
+		t.Fatal(err)
+	}
+	if err := mem.Get(context.TODO(), types.NamespacedName{Name: "harddeletenamespace", Namespace: "default"}, &v1beta1.CronJob{}); err != nil {
+		t.Errorf("legacy object in an unwatched namespace: %v", err)
+	}
+
+	// Once default is watched the legacy object is cleaned up
+	Namespaces = []string{"infinimesh", "default"}
+	r.Client = &namespacedClient{Client: mem, namespaces: Namespaces}
+	if err := r.reconcileHardDeleteNamespace(request, instance); err != nil {
+		t.Fatal(err)
+	}
+	err := mem.Get(context.TODO(), types.NamespacedName{Name: "harddeletenamespace", Namespace: "default"}, &v1beta1.CronJob{})
+	if !errors.IsNotFound(err) {
+		t.Errorf("legacy object wasn't deleted: %v", err)
+	}
+}
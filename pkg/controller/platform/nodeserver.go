@@ -34,14 +34,9 @@ func (r *ReconcilePlatform) reconcileNodeserver(request reconcile.Request, insta
 					Containers: []corev1.Container{
 						{
 							Name:            "nodeserver",
-							Image:           "quay.io/infinimesh/nodeserver:latest",
-							ImagePullPolicy: corev1.PullAlways,
-							Env: []corev1.EnvVar{
-								{
-									Name:  "DGRAPH_HOST",
-									Value: instance.Name + "-dgraph-alpha:9080", // TODO
-								},
-							},
+							Image:           image(instance, "nodeserver"),
+							ImagePullPolicy: imagePullPolicy(instance, "nodeserver"),
+							Env:             dgraphEnv(instance),
 						},
 					},
 				},
@@ -49,6 +44,10 @@ func (r *ReconcilePlatform) reconcileNodeserver(request reconcile.Request, insta
 		},
 	}
 
+	if err := r.secureWorkload(instance, deploy.Name, &deploy.Spec.Template); err != nil {
+		return err
+	}
+
 	if err := controllerutil.SetControllerReference(instance, deploy, r.scheme); err != nil {
 		return err
 	}
@@ -0,0 +1,345 @@
+package platform
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+)
+
+const (
+	prometheusAPIVersion = "monitoring.coreos.com/v1"
+
+	// metricsLabel marks the services ServiceMonitors select, its value is the scrape target
+	metricsLabel = "infinimesh.io/metrics"
+
+	defaultScrapeInterval = "30s"
+	redisExporterPort     = 9121
+)
+
+// metricsTarget is a component scraped by a ServiceMonitor.
+type metricsTarget struct {
+	name string
+	path string
+}
+
+// metricsTargets returns the components of the platform exposing metrics.
+func metricsTargets(instance *infinimeshv1beta1.Platform) []metricsTarget {
+	var targets []metricsTarget
+	if instance.Spec.DGraph.External == nil {
+		targets = append(targets,
+			metricsTarget{name: instance.Name + "-dgraph-zero", path: "/debug/prometheus_metrics"},
+			metricsTarget{name: instance.Name + "-dgraph-alpha", path: "/debug/prometheus_metrics"},
+		)
+	}
+	for _, store := range redisStores(instance) {
+		if redisMode(store.store) != redisModeExternal {
+			targets = append(targets, metricsTarget{name: store.name, path: "/metrics"})
+		}
+	}
+	return targets
+}
+
+// redisStoreRef is a redis store of the platform together with its name.
+type redisStoreRef struct {
+	name  string
+	store infinimeshv1beta1.PlatformRedisStore
+}
+
+func redisStores(instance *infinimeshv1beta1.Platform) []redisStoreRef {
+	return []redisStoreRef{
+		{name: instance.Name + "-redis-device-details", store: instance.Spec.Redis.DeviceDetails},
+		{name: instance.Name + "-twin-redis", store: instance.Spec.Redis.Twin},
+	}
+}
+
+// metricsService returns the service exposing the metrics port of the pods labeled app=name. Pods
+// that are not ready are scraped as well, so they count as down instead of disappearing.
+func metricsService(instance *infinimeshv1beta1.Platform, name string, port int) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name + "-metrics",
+			Namespace: instance.Namespace,
+			Labels: map[string]string{
+				"app":        name,
+				metricsLabel: name,
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			Type:                     corev1.ServiceTypeClusterIP,
+			Selector:                 map[string]string{"app": name},
+			PublishNotReadyAddresses: true,
+			Ports: []corev1.ServicePort{
+				{
+					Protocol:   corev1.ProtocolTCP,
+					Port:       int32(port),
+					TargetPort: intstr.FromInt(port),
+					Name:       "metrics",
+				},
+			},
+		},
+	}
+}
+
+// redisExporterContainer returns the sidecar exporting the metrics of a redis node.
+func redisExporterContainer(name string, store infinimeshv1beta1.PlatformRedisStore) corev1.Container {
+	return corev1.Container{
+		Name:            "exporter",
+		Image:           "oliver006/redis_exporter:v1.20.0",
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		Ports: []corev1.ContainerPort{
+			{
+				ContainerPort: redisExporterPort,
+				Name:          "metrics",
+			},
+		},
+		Env: []corev1.EnvVar{
+			{
+				Name: "REDIS_PASSWORD",
+				ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: redisAuthSecret(name, store),
+						},
+						Key: "password",
+					},
+				},
+			},
+		},
+	}
+}
+
+// reconcileObservability creates the ServiceMonitors and alerting rules of the platform if
+// Prometheus is enabled and the prometheus-operator CRDs are installed.
+func (r *ReconcilePlatform) reconcileObservability(request reconcile.Request, instance *infinimeshv1beta1.Platform) error {
+	log := logger.WithName("observability")
+
+	prometheus := instance.Spec.Observability.Prometheus
+	if prometheus == nil {
+		return nil
+	}
+
+	probe := &unstructured.Unstructured{}
+	probe.SetAPIVersion(prometheusAPIVersion)
+	probe.SetKind("ServiceMonitor")
+	err := r.Get(context.TODO(), types.NamespacedName{Name: instance.Name, Namespace: instance.Namespace}, probe)
+	if err != nil && meta.IsNoMatchError(err) {
+		log.Info("prometheus-operator is not installed, skipping ServiceMonitors and PrometheusRules")
+		return nil
+	} else if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	if instance.Spec.DGraph.External == nil {
+		for _, svc := range []*corev1.Service{
+			metricsService(instance, instance.Name+"-dgraph-zero", 6080),
+			metricsService(instance, instance.Name+"-dgraph-alpha", 8080),
+		} {
+			if err := r.reconcileMetricsService(instance, svc); err != nil {
+				return err
+			}
+		}
+	}
+
+	interval := prometheus.Interval
+	if interval == "" {
+		interval = defaultScrapeInterval
+	}
+
+	for _, target := range metricsTargets(instance) {
+		spec := map[string]interface{}{
+			"selector": map[string]interface{}{
+				"matchLabels": map[string]interface{}{
+					metricsLabel: target.name,
+				},
+			},
+			"endpoints": []interface{}{
+				map[string]interface{}{
+					"port":     "metrics",
+					"path":     target.path,
+					"interval": interval,
+				},
+			},
+		}
+		if err := r.reconcilePrometheusResource(instance, "ServiceMonitor", target.name, spec); err != nil {
+			return err
+		}
+	}
+
+	return r.reconcilePrometheusResource(instance, "PrometheusRule", instance.Name+"-alerts", map[string]interface{}{
+		"groups": []interface{}{
+			map[string]interface{}{
+				"name":  "infinimesh-" + instance.Name,
+				"rules": prometheusRules(instance),
+			},
+		},
+	})
+}
+
+// prometheusRules returns the alerts of the platform.
+func prometheusRules(instance *infinimeshv1beta1.Platform) []interface{} {
+	ns := instance.Namespace
+	rule := func(alert, expr, duration, severity, summary string) interface{} {
+		return map[string]interface{}{
+			"alert": alert,
+			"expr":  expr,
+			"for":   duration,
+			"labels": map[string]interface{}{
+				"severity": severity,
+				"platform": instance.Name,
+			},
+			"annotations": map[string]interface{}{
+				"summary": summary,
+			},
+		}
+	}
+
+	// up has no series at all when every pod of a service is gone, absent covers that case.
+	var rules []interface{}
+	if instance.Spec.DGraph.External == nil {
+		for _, group := range []string{"zero", "alpha"} {
+			svc := instance.Name + "-dgraph-" + group + "-metrics"
+			rules = append(rules, rule(
+				"InfinimeshDgraph"+strings.Title(group)+"QuorumLoss",
+				fmt.Sprintf(`sum(up{namespace=%q, service=%q}) < 2 or absent(up{namespace=%q, service=%q})`, ns, svc, ns, svc),
+				"5m", "critical",
+				"Less than 2 of 3 dgraph "+group+" nodes of "+instance.Name+" are up",
+			))
+		}
+	}
+
+	var redisServices []string
+	for _, store := range redisStores(instance) {
+		if redisMode(store.store) != redisModeExternal {
+			redisServices = append(redisServices, store.name+"-metrics")
+		}
+	}
+	if len(redisServices) > 0 {
+		// redis_up is only exported while the exporter is scraped, a failed scrape or a missing
+		// service means the node is down as well.
+		selector := fmt.Sprintf(`namespace=%q, service=~%q`, ns, strings.Join(redisServices, "|"))
+		exprs := []string{
+			fmt.Sprintf(`redis_up{%v} == 0`, selector),
+			fmt.Sprintf(`up{%v} == 0`, selector),
+		}
+		for _, svc := range redisServices {
+			exprs = append(exprs, fmt.Sprintf(`absent(up{namespace=%q, service=%q})`, ns, svc))
+		}
+		rules = append(rules, rule(
+			"InfinimeshRedisDown",
+			strings.Join(exprs, " or "),
+			"2m", "critical",
+			"Redis {{ $labels.service }} of "+instance.Name+" is down",
+		))
+	}
+
+	rules = append(rules,
+		rule(
+			"InfinimeshMQTTBridgeUnavailable",
+			fmt.Sprintf(`kube_deployment_status_replicas_available{namespace=%q, deployment=%q} == 0`, ns, instance.Name+"-mqtt-bridge"),
+			"5m", "critical",
+			"No mqtt-bridge replica of "+instance.Name+" is available",
+		),
+		rule(
+			"InfinimeshCertificateExpiry",
+			fmt.Sprintf(`certmanager_certificate_expiration_timestamp_seconds{namespace=%q} - time() < 14 * 24 * 3600`, ns),
+			"1h", "warning",
+			"Certificate {{ $labels.name }} expires in less than 14 days",
+		),
+		rule(
+			"InfinimeshReconcileFailures",
+			fmt.Sprintf(`increase(infinimesh_operator_component_reconcile_errors_total{platform_namespace=%q, platform=%q}[15m]) > 0`, ns, instance.Name),
+			"15m", "warning",
+			"The operator keeps failing to reconcile {{ $labels.component }} of "+instance.Name,
+		),
+	)
+	return rules
+}
+
+func (r *ReconcilePlatform) reconcileMetricsService(instance *infinimeshv1beta1.Platform, svc *corev1.Service) error {
+	log := logger.WithName("observability")
+
+	if err := controllerutil.SetControllerReference(instance, svc, r.scheme); err != nil {
+		return err
+	}
+
+	found := &corev1.Service{}
+	err := r.Get(context.TODO(), types.NamespacedName{Name: svc.Name, Namespace: svc.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		log.Info("Creating Service", "namespace", svc.Namespace, "name", svc.Name)
+		err = r.Create(context.TODO(), svc)
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	} else if found.Spec.PublishNotReadyAddresses != svc.Spec.PublishNotReadyAddresses {
+		found.Spec.PublishNotReadyAddresses = svc.Spec.PublishNotReadyAddresses
+		log.Info("Updating Service", "namespace", svc.Namespace, "name", svc.Name)
+		err = r.Update(context.TODO(), found)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reconcilePrometheusResource creates or updates a prometheus-operator resource of the given kind.
+func (r *ReconcilePlatform) reconcilePrometheusResource(instance *infinimeshv1beta1.Platform, kind, name string, spec map[string]interface{}) error {
+	log := logger.WithName("observability")
+
+	labels := map[string]interface{}{
+		"app.kubernetes.io/part-of": instance.Name,
+	}
+	for k, v := range instance.Spec.Observability.Prometheus.Labels {
+		labels[k] = v
+	}
+
+	obj := &unstructured.Unstructured{}
+	obj.Object = map[string]interface{}{
+		"kind":       kind,
+		"apiVersion": prometheusAPIVersion,
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": instance.Namespace,
+			"labels":    labels,
+		},
+		"spec": spec,
+	}
+	if err := controllerutil.SetControllerReference(instance, obj, r.scheme); err != nil {
+		return err
+	}
+
+	found := &unstructured.Unstructured{}
+	found.SetAPIVersion(prometheusAPIVersion)
+	found.SetKind(kind)
+	err := r.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: instance.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		log.Info("Creating "+kind, "namespace", instance.Namespace, "name", name)
+		return r.Create(context.TODO(), obj)
+	} else if err != nil {
+		return err
+	}
+
+	foundSpec, _, _ := unstructured.NestedMap(found.Object, "spec")
+	foundLabels, _, _ := unstructured.NestedMap(found.Object, "metadata", "labels")
+	if !reflect.DeepEqual(foundSpec, spec) || !reflect.DeepEqual(foundLabels, labels) {
+		found.Object["spec"] = spec
+		found.SetLabels(obj.GetLabels())
+		log.Info("Updating "+kind, "namespace", instance.Namespace, "name", name)
+		return r.Update(context.TODO(), found)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package platform
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+)
+
+func TestPrometheusRules(t *testing.T) {
+	instance := &infinimeshv1beta1.Platform{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "infinimesh"}}
+
+	exprs := map[string]string{}
+	for _, rule := range prometheusRules(instance) {
+		rule := rule.(map[string]interface{})
+		exprs[rule["alert"].(string)] = rule["expr"].(string)
+	}
+
+	// Nodes that are scraped but down count as 0, absent fires once no node is left to scrape
+	want := map[string]string{
+		"InfinimeshDgraphZeroQuorumLoss":  `sum(up{namespace="infinimesh", service="foo-dgraph-zero-metrics"}) < 2 or absent(up{namespace="infinimesh", service="foo-dgraph-zero-metrics"})`,
+		"InfinimeshDgraphAlphaQuorumLoss": `sum(up{namespace="infinimesh", service="foo-dgraph-alpha-metrics"}) < 2 or absent(up{namespace="infinimesh", service="foo-dgraph-alpha-metrics"})`,
+		"InfinimeshRedisDown": `redis_up{namespace="infinimesh", service=~"foo-redis-device-details-metrics|foo-twin-redis-metrics"} == 0` +
+			` or up{namespace="infinimesh", service=~"foo-redis-device-details-metrics|foo-twin-redis-metrics"} == 0` +
+			` or absent(up{namespace="infinimesh", service="foo-redis-device-details-metrics"})` +
+			` or absent(up{namespace="infinimesh", service="foo-twin-redis-metrics"})`,
+		// The operator's metrics are scraped in the namespace of the operator
+		"InfinimeshReconcileFailures": `increase(infinimesh_operator_component_reconcile_errors_total{platform_namespace="infinimesh", platform="foo"}[15m]) > 0`,
+	}
+	for alert, expr := range want {
+		if exprs[alert] != expr {
+			t.Errorf("%v: got %q, want %q", alert, exprs[alert], expr)
+		}
+	}
+}
+
+func TestMetricsServiceAllNodesDown(t *testing.T) {
+	ctx := context.TODO()
+	instance := &infinimeshv1beta1.Platform{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "infinimesh"}}
+	c := newMemoryClient(scheme.Scheme)
+	r := &ReconcilePlatform{Client: c, scheme: scheme.Scheme, recorder: record.NewFakeRecorder(100)}
+
+	// Services of earlier releases only list ready pods, so nodes that are all down have no up
+	// series for sum to add up
+	svc := metricsService(instance, "foo-dgraph-zero", 6080)
+	svc.Spec.PublishNotReadyAddresses = false
+	if err := c.Create(ctx, svc); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.reconcileMetricsService(instance, metricsService(instance, "foo-dgraph-zero", 6080)); err != nil {
+		t.Fatal(err)
+	}
+	found := &corev1.Service{}
+	if err := c.Get(ctx, types.NamespacedName{Name: "foo-dgraph-zero-metrics", Namespace: "infinimesh"}, found); err != nil {
+		t.Fatal(err)
+	}
+	if !found.Spec.PublishNotReadyAddresses {
+		t.Error("pods that are not ready are not scraped")
+	}
+}
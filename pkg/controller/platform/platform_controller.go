@@ -18,11 +18,18 @@ package platform
 
 import (
 	"context"
+	"reflect"
+	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
@@ -33,7 +40,9 @@ import (
 
 	extensionsv1vbeta1 "k8s.io/api/extensions/v1beta1"
 
+	infinimeshv1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1"
 	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+	"github.com/infinimesh/operator/pkg/clients"
 )
 
 var logger = logf.Log.WithName("controller")
@@ -45,19 +54,32 @@ var logger = logf.Log.WithName("controller")
 
 // Add creates a new Platform Controller and adds it to the Manager with default RBAC. The Manager will set fields on the Controller
 // and Start it when the Manager is Started.
-func Add(mgr manager.Manager) error {
-	return add(mgr, newReconciler(mgr))
+func Add(mgr manager.Manager, opts controller.Options) error {
+	r := newReconciler(mgr)
+	if DryRun {
+		if err := r.enableDryRun(mgr); err != nil {
+			return err
+		}
+	}
+	opts.Reconciler = r
+	return add(mgr, opts)
 }
 
 // newReconciler returns a new reconcile.Reconciler
-func newReconciler(mgr manager.Manager) reconcile.Reconciler {
-	return &ReconcilePlatform{Client: mgr.GetClient(), scheme: mgr.GetScheme()}
+func newReconciler(mgr manager.Manager) *ReconcilePlatform {
+	recorder := mgr.GetRecorder("platform-controller")
+	return &ReconcilePlatform{
+		Client:   &eventingClient{Client: mgr.GetClient(), recorder: recorder},
+		scheme:   mgr.GetScheme(),
+		recorder: recorder,
+		clients:  clients.NewFactory(mgr.GetClient()),
+	}
 }
 
-// add adds a new Controller to mgr with r as the reconcile.Reconciler
-func add(mgr manager.Manager, r reconcile.Reconciler) error {
+// add adds a new Controller to mgr with opts.Reconciler as the reconcile.Reconciler
+func add(mgr manager.Manager, opts controller.Options) error {
 	// Create a new controller
-	c, err := controller.New("platform-controller", mgr, controller.Options{Reconciler: r})
+	c, err := controller.New("platform-controller", mgr, opts)
 	if err != nil {
 		return err
 	}
@@ -102,6 +124,39 @@ func add(mgr manager.Manager, r reconcile.Reconciler) error {
 		return err
 	}
 
+	err = c.Watch(&source.Kind{Type: &batchv1.Job{}}, &handler.EnqueueRequestForOwner{
+		IsController: true,
+		OwnerType:    &infinimeshv1beta1.Platform{},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Revoked device certificates whose objects are gone
+	err = c.Watch(&source.Kind{Type: &corev1.ConfigMap{}}, &handler.EnqueueRequestForOwner{
+		IsController: true,
+		OwnerType:    &infinimeshv1beta1.Platform{},
+	})
+	if err != nil {
+		return err
+	}
+
+	// The device CA Secret is written by cert-manager if the CA has an issuer
+	err = c.Watch(&source.Kind{Type: &corev1.Secret{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(platformForDeviceCA),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Revoked certificates are put on the revocation lists of the device CA
+	err = c.Watch(&source.Kind{Type: &infinimeshv1.DeviceCertificateRequest{}}, &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(platformForCertificateRequest),
+	})
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -110,7 +165,12 @@ var _ reconcile.Reconciler = &ReconcilePlatform{}
 // ReconcilePlatform reconciles a Platform object
 type ReconcilePlatform struct {
 	client.Client
-	scheme *runtime.Scheme
+	scheme   *runtime.Scheme
+	recorder record.EventRecorder
+	// offline skips the calls to the services of the platform, e.g. when rendering
+	offline bool
+	// clients connects to the services of the platform
+	clients clients.Factory
 }
 
 // Reconcile reads that state of the cluster for a Platform object and makes changes based on the state read
@@ -122,12 +182,27 @@ type ReconcilePlatform struct {
 // +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=secrets;services,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 // +kubebuilder:rbac:groups=extensions,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=apps,resources=deployments/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=infinimesh.infinimesh.io,resources=platforms,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=infinimesh.infinimesh.io,resources=platforms/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=kubedb.com,resources=postgreses,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=batch,resources=jobs;cronjobs,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=serviceaccounts,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles;rolebindings,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=policy,resources=poddisruptionbudgets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=kafka.strimzi.io,resources=kafkatopics,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=infinimesh.infinimesh.io,resources=devicecertificaterequests,verbs=get;list;watch
+// +kubebuilder:rbac:groups=monitoring.coreos.com,resources=servicemonitors;prometheusrules,verbs=get;list;watch;create;update;patch;delete
 func (r *ReconcilePlatform) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	platforms := &infinimeshv1beta1.PlatformList{}
+	if err := r.List(context.TODO(), &client.ListOptions{}, platforms); err == nil {
+		managedPlatforms.Set(float64(len(platforms.Items)))
+	}
+
 	// Fetch the Platform instance
 	instance := &infinimeshv1beta1.Platform{}
 
@@ -136,60 +211,183 @@ func (r *ReconcilePlatform) Reconcile(request reconcile.Request) (reconcile.Resu
 		if errors.IsNotFound(err) {
 			// Object not found, return.  Created objects are automatically garbage collected.
 			// For additional cleanup logic use finalizers.
+			lastSuccessfulReconcile.DeleteLabelValues(request.Namespace, request.Name)
 			return reconcile.Result{}, nil
 		}
 		// Error reading the object - requeue the request.
 		return reconcile.Result{}, err
 	}
 
-	if err := r.reconcileDgraph(request, instance); err != nil {
-		return reconcile.Result{}, err
+	status := instance.Status.DeepCopy()
+
+	instance.Status.Paused = paused(instance)
+	if instance.Status.Paused {
+		if !status.Paused {
+			r.recorder.Event(instance, corev1.EventTypeNormal, "Paused", "Reconciliation is paused")
+		}
+		if !reflect.DeepEqual(*status, instance.Status) {
+			if err := r.Status().Update(context.TODO(), instance); err != nil {
+				return reconcile.Result{}, err
+			}
+		}
+		return reconcile.Result{}, nil
 	}
 
-	if err := r.reconcileMqtt(request, instance); err != nil {
+	upgrading, err := r.reconcileUpgrade(instance)
+	if err != nil {
 		return reconcile.Result{}, err
 	}
+	if instance.Status.Paused {
+		// The upgrade failed and paused the platform
+		if err := r.Status().Update(context.TODO(), instance); err != nil {
+			return reconcile.Result{}, err
+		}
+		return reconcile.Result{}, nil
+	}
 
-	if err := r.reconcileRegistry(request, instance); err != nil {
-		return reconcile.Result{}, err
+	instance.Status.UnmanagedComponents = nil
+	instance.Status.Maintenance = instance.Spec.Maintenance.Enabled
+
+	for _, c := range r.components(instance) {
+		if err := r.reconcileComponent(request, instance, c); err != nil {
+			return reconcile.Result{}, err
+		}
 	}
 
-	if err := r.reconcileApiserver(request, instance); err != nil {
-		return reconcile.Result{}, err
+	// Dry-runs don't reach the services of the platform
+	if instance.Spec.Controller.Timeseries && !instance.Spec.Maintenance.Enabled && !r.offline {
+		// Grafana may not be up yet, the next periodic sync catches up
+		if err := r.reconcileComponent(request, instance, component{"grafana-sync", r.syncGrafana}); err != nil {
+			logger.Error(err, "Failed to sync grafana")
+		}
 	}
 
-	if err := r.reconcileApiserverRest(request, instance); err != nil {
-		return reconcile.Result{}, err
+	if !reflect.DeepEqual(*status, instance.Status) {
+		if err := r.Status().Update(context.TODO(), instance); err != nil {
+			return reconcile.Result{}, err
+		}
 	}
 
-	if err := r.reconcileNodeserver(request, instance); err != nil {
-		return reconcile.Result{}, err
+	lastSuccessfulReconcile.WithLabelValues(instance.Namespace, instance.Name).SetToCurrentTime()
+
+	if upgrading {
+		return reconcile.Result{RequeueAfter: upgradeRequeueInterval}, nil
 	}
 
-	if err := r.reconcileTelemetryRouter(request, instance); err != nil {
-		return reconcile.Result{}, err
+	if !kafkaTopicsReady(instance) {
+		return reconcile.Result{RequeueAfter: 30 * time.Second}, nil
 	}
 
-	if err := r.reconcileTwin(request, instance); err != nil {
-		return reconcile.Result{}, err
+	if instance.Spec.Controller.Timeseries {
+		return reconcile.Result{RequeueAfter: grafanaSyncInterval}, nil
 	}
 
-	if err := r.reconcileFrontend(request, instance); err != nil {
-		return reconcile.Result{}, err
+	if instance.Spec.DeviceCA.Enabled {
+		return reconcile.Result{RequeueAfter: deviceCARequeueInterval}, nil
 	}
-	if err := r.reconcileDeviceDetails(request, instance); err != nil {
-		return reconcile.Result{}, err
+
+	return reconcile.Result{}, nil
+}
+
+// component is a part of the platform reconciled on its own.
+type component struct {
+	name      string
+	reconcile func(reconcile.Request, *infinimeshv1beta1.Platform) error
+}
+
+// components returns the components of instance in the order they are reconciled.
+func (r *ReconcilePlatform) components(instance *infinimeshv1beta1.Platform) []component {
+	components := []component{
+		{"maintenance", r.reconcileMaintenance},
+		{"dgraph", r.reconcileDgraph},
+		{"kafka", r.reconcileManagedKafka},
+		{"kafka-topics", r.reconcileKafkaTopics},
+		{"device-ca", r.reconcileDeviceCA},
+		{"mqtt-bridge", r.reconcileMqtt},
+		{"device-registry", r.reconcileRegistry},
+		{"apiserver", r.reconcileApiserver},
+		{"apiserver-rest", r.reconcileApiserverRest},
+		{"nodeserver", r.reconcileNodeserver},
+		{"telemetry-router", r.reconcileTelemetryRouter},
+		{"twin", r.reconcileTwin},
+		{"frontend", r.reconcileFrontend},
+		{"device-details", r.reconcileDeviceDetails},
+		{"reset-root-account-pwd", r.reconcileResetRootAccountPwd},
+		{"hard-delete-namespace", r.reconcileHardDeleteNamespace},
+		{"observability", r.reconcileObservability},
 	}
-	if err := r.reconcileResetRootAccountPwd(request, instance); err != nil {
-		return reconcile.Result{}, err
+	if instance.Spec.Controller.Timeseries {
+		components = append(components, component{"timeseries", r.reconcileTimeseries})
 	}
-	if err := r.reconcileHardDeleteNamespace(request, instance); err != nil {
-		return reconcile.Result{}, err
+	return components
+}
+
+// reconcileComponent reconciles c unless it is annotated as unmanaged, recording its duration
+// and outcome as metrics and failures as events on the platform.
+func (r *ReconcilePlatform) reconcileComponent(request reconcile.Request, instance *infinimeshv1beta1.Platform, c component) error {
+	if unmanaged(instance, c.name) {
+		instance.Status.UnmanagedComponents = append(instance.Status.UnmanagedComponents, c.name)
+		return nil
+	}
+
+	start := time.Now()
+	err := c.reconcile(request, instance)
+	observeComponent(instance, c.name, start, err)
+	if err != nil {
+		r.recorder.Eventf(instance, corev1.EventTypeWarning, "ReconcileFailed", "Failed to reconcile %v: %v", c.name, err)
 	}
+	return err
+}
 
-	// if err := r.reconcileTimeseries(request, instance); err != nil {
-	// 	return reconcile.Result{}, err
-	// }
+// legacyObjectMeta returns the metadata of an object older releases created with a fixed name in
+// the default namespace.
+func legacyObjectMeta(name string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{Name: name, Namespace: "default"}
+}
 
-	return reconcile.Result{}, nil
+// Namespaces are the namespaces the operator watches, all of them if empty. Set it before Add.
+var Namespaces []string
+
+// watched returns whether the operator watches namespace, and can therefore read its objects.
+func watched(namespace string) bool {
+	if len(Namespaces) == 0 {
+		return true
+	}
+	for _, ns := range Namespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteLegacyObjects deletes the given objects if instance controls them. Objects of other
+// platforms are left alone, as are objects in namespaces the operator doesn't watch.
+func (r *ReconcilePlatform) deleteLegacyObjects(instance *infinimeshv1beta1.Platform, objs ...runtime.Object) error {
+	for _, obj := range objs {
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			return err
+		}
+		key := types.NamespacedName{Name: accessor.GetName(), Namespace: accessor.GetNamespace()}
+		if !watched(key.Namespace) {
+			continue
+		}
+
+		err = r.Get(context.TODO(), key, obj)
+		if err != nil && errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if !metav1.IsControlledBy(accessor, instance) {
+			continue
+		}
+		logger.Info("Deleting legacy object", "namespace", key.Namespace, "name", key.Name)
+		if err := r.Delete(context.TODO(), obj); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
 }
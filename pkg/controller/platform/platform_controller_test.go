@@ -17,65 +17,262 @@ limitations under the License.
 package platform
 
 import (
+	"context"
 	"testing"
 	"time"
 
+	"github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	extensionsv1beta1 "k8s.io/api/extensions/v1beta1"
+	rbacv1beta1 "k8s.io/api/rbac/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+	"github.com/infinimesh/operator/pkg/clients/fake"
 )
 
-var c client.Client
+const timeout = time.Second * 10
 
-var expectedRequest = reconcile.Request{NamespacedName: types.NamespacedName{Name: "foo", Namespace: "default"}}
-var depKey = types.NamespacedName{Name: "foo-deployment", Namespace: "default"}
+// ownedObjects returns the names of the objects the platform name creates, by list type.
+func ownedObjects(name string) map[runtime.Object][]string {
+	return map[runtime.Object][]string{
+		&appsv1.StatefulSetList{}: {
+			name + "-dgraph-zero", name + "-dgraph-alpha", name + "-twin-redis", name + "-redis-device-details",
+		},
+		&appsv1.DeploymentList{}: {
+			name + "-mqtt-bridge", name + "-device-registry", name + "-apiserver", name + "-apiserver-rest",
+			name + "-nodeserver", name + "-telemetry-router", name + "-shadow-delta-merger",
+			name + "-shadow-persister", name + "-shadow-api", name + "-frontend",
+		},
+		&corev1.ServiceList{}: {
+			name + "-dgraph-zero", name + "-dgraph-alpha", name + "-mqtt-bridge", name + "-device-registry",
+			name + "-apiserver", name + "-apiserver-rest", name + "-nodeserver", name + "-telemetry-router",
+			name + "-shadow-api", name + "-twin-redis-headless", name + "-twin-redis", name + "-frontend",
+			name + "-redis-device-details-headless", name + "-redis-device-details",
+		},
+		&corev1.SecretList{}: {
+			name + "-apiserver", name + "-twin-redis-auth", name + "-redis-device-details-auth", name + "-root-account",
+		},
+		&extensionsv1beta1.IngressList{}: {
+			name + "-apiserver", name + "-apiserver-rest", name + "-frontend",
+		},
+		&rbacv1beta1.RoleList{}:        {name + "-reset-pwd"},
+		&rbacv1beta1.RoleBindingList{}: {name + "-reset-pwd"},
+		&batchv1beta1.CronJobList{}:    {name + "-delete-root-account-secret", name + "-harddeletenamespace"},
+		// Every workload runs as a ServiceAccount of its own
+		&corev1.ServiceAccountList{}: {
+			name + "-dgraph-zero", name + "-dgraph-alpha", name + "-twin-redis", name + "-redis-device-details",
+			name + "-mqtt-bridge", name + "-device-registry", name + "-apiserver", name + "-apiserver-rest",
+			name + "-nodeserver", name + "-telemetry-router", name + "-shadow-delta-merger",
+			name + "-shadow-persister", name + "-shadow-api", name + "-frontend",
+			name + "-reset-root-account-pwd", name + "-harddeletenamespace",
+		},
+	}
+}
 
-const timeout = time.Second * 5
+// controlledBy lists the objects of list in the namespace of instance and returns the names of
+// those it controls.
+func controlledBy(c client.Client, instance *infinimeshv1beta1.Platform, list runtime.Object) func() ([]string, error) {
+	return func() ([]string, error) {
+		if err := c.List(context.TODO(), &client.ListOptions{Namespace: instance.Namespace}, list); err != nil {
+			return nil, err
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return nil, err
+		}
+		var names []string
+		for _, item := range items {
+			accessor, err := meta.Accessor(item)
+			if err != nil {
+				return nil, err
+			}
+			if metav1.IsControlledBy(accessor, instance) {
+				names = append(names, accessor.GetName())
+			}
+		}
+		return names, nil
+	}
+}
 
 func TestReconcile(t *testing.T) {
-	// g := gomega.NewGomegaWithT(t)
-	// instance := &infinimeshv1beta1.Platform{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"}}
-
-	// // Setup the Manager and Controller.  Wrap the Controller Reconcile function so it writes each request to a
-	// // channel when it is finished.
-	// mgr, err := manager.New(cfg, manager.Options{})
-	// g.Expect(err).NotTo(gomega.HaveOccurred())
-	// c = mgr.GetClient()
-
-	// recFn, requests := SetupTestReconcile(newReconciler(mgr))
-	// g.Expect(add(mgr, recFn)).NotTo(gomega.HaveOccurred())
-
-	// stopMgr, mgrStopped := StartTestManager(mgr, g)
-
-	// defer func() {
-	// 	close(stopMgr)
-	// 	mgrStopped.Wait()
-	// }()
-
-	// // Create the Platform object and expect the Reconcile and Deployment to be created
-	// err = c.Create(context.TODO(), instance)
-	// // The instance object may not be a valid object because it might be missing some required fields.
-	// // Please modify the instance object by adding required fields and then remove the following if statement.
-	// if apierrors.IsInvalid(err) {
-	// 	t.Logf("failed to create object, got an invalid object error: %v", err)
-	// 	return
-	// }
-	// g.Expect(err).NotTo(gomega.HaveOccurred())
-	// defer c.Delete(context.TODO(), instance)
-	// g.Eventually(requests, timeout).Should(gomega.Receive(gomega.Equal(expectedRequest)))
-
-	// deploy := &appsv1.Deployment{}
-	// g.Eventually(func() error { return c.Get(context.TODO(), depKey, deploy) }, timeout).
-	// 	Should(gomega.Succeed())
-
-	// // Delete the Deployment and expect Reconcile to be called for Deployment deletion
-	// g.Expect(c.Delete(context.TODO(), deploy)).NotTo(gomega.HaveOccurred())
-	// g.Eventually(requests, timeout).Should(gomega.Receive(gomega.Equal(expectedRequest)))
-	// g.Eventually(func() error { return c.Get(context.TODO(), depKey, deploy) }, timeout).
-	// 	Should(gomega.Succeed())
-
-	// // Manually delete Deployment since GC isn't enabled in the test control plane
-	// g.Eventually(func() error { return c.Delete(context.TODO(), deploy) }, timeout).
-	// 	Should(gomega.MatchError("deployments.apps \"foo-deployment\" not found"))
+	g := gomega.NewGomegaWithT(t)
+
+	mgr, err := manager.New(cfg, manager.Options{})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	c, err := client.New(cfg, client.Options{Scheme: scheme.Scheme})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	fakes := fake.NewFactory()
+	r := newReconciler(mgr)
+	r.clients = fakes
+	g.Expect(add(mgr, controller.Options{Reconciler: r})).NotTo(gomega.HaveOccurred())
+
+	stopMgr, mgrStopped := StartTestManager(mgr, g)
+	defer func() {
+		close(stopMgr)
+		mgrStopped.Wait()
+	}()
+
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "reconcile"}}
+	g.Expect(c.Create(context.TODO(), ns)).NotTo(gomega.HaveOccurred())
+
+	instance := &infinimeshv1beta1.Platform{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: ns.Name}}
+	instance.Spec.Apiserver.Restful.Host = "foo.example.com"
+	g.Expect(c.Create(context.TODO(), instance)).NotTo(gomega.HaveOccurred())
+	defer c.Delete(context.TODO(), instance)
+
+	key := func(name string) types.NamespacedName {
+		return types.NamespacedName{Name: name, Namespace: instance.Namespace}
+	}
+
+	t.Run("creates the components", func(t *testing.T) {
+		g := gomega.NewGomegaWithT(t)
+		for list, names := range ownedObjects(instance.Name) {
+			g.Eventually(controlledBy(c, instance, list), timeout).Should(gomega.ConsistOf(names), "%T", list)
+		}
+
+		g.Expect(fakes.Platform(instance).SchemaImports()).To(gomega.BeNumerically(">", 0))
+		secret := &corev1.Secret{}
+		g.Expect(c.Get(context.TODO(), key("foo-root-account"), secret)).NotTo(gomega.HaveOccurred())
+		g.Expect(string(secret.Data["username"])).To(gomega.Equal("root"))
+		root, ok := fakes.Platform(instance).Account("root")
+		g.Expect(ok).To(gomega.BeTrue())
+		g.Expect(root.IsRoot).To(gomega.BeTrue())
+		g.Expect(string(secret.Data["password"])).To(gomega.Equal(root.Password))
+	})
+
+	t.Run("syncs the root password", func(t *testing.T) {
+		g := gomega.NewGomegaWithT(t)
+		secret := &corev1.Secret{}
+		g.Eventually(func() error {
+			if err := c.Get(context.TODO(), key("foo-root-account"), secret); err != nil {
+				return err
+			}
+			secret.Data["password"] = []byte("rotated")
+			return c.Update(context.TODO(), secret)
+		}, timeout).Should(gomega.Succeed())
+
+		g.Eventually(func() string {
+			root, _ := fakes.Platform(instance).Account("root")
+			return root.GetPassword()
+		}, timeout).Should(gomega.Equal("rotated"))
+	})
+
+	t.Run("restores deleted objects", func(t *testing.T) {
+		g := gomega.NewGomegaWithT(t)
+		deploy := &appsv1.Deployment{}
+		g.Expect(c.Get(context.TODO(), key("foo-nodeserver"), deploy)).NotTo(gomega.HaveOccurred())
+		uid := deploy.UID
+		g.Expect(c.Delete(context.TODO(), deploy)).NotTo(gomega.HaveOccurred())
+
+		g.Eventually(func() (types.UID, error) {
+			err := c.Get(context.TODO(), key("foo-nodeserver"), deploy)
+			return deploy.UID, err
+		}, timeout).ShouldNot(gomega.Equal(uid))
+	})
+
+	t.Run("reverts drift", func(t *testing.T) {
+		g := gomega.NewGomegaWithT(t)
+		deploy := &appsv1.Deployment{}
+		var image string
+		g.Eventually(func() error {
+			if err := c.Get(context.TODO(), key("foo-apiserver-rest"), deploy); err != nil {
+				return err
+			}
+			image = deploy.Spec.Template.Spec.Containers[0].Image
+			deploy.Spec.Template.Spec.Containers[0].Image = "drifted"
+			return c.Update(context.TODO(), deploy)
+		}, timeout).Should(gomega.Succeed())
+
+		g.Eventually(func() (string, error) {
+			err := c.Get(context.TODO(), key("foo-apiserver-rest"), deploy)
+			return deploy.Spec.Template.Spec.Containers[0].Image, err
+		}, timeout).Should(gomega.Equal(image))
+	})
+
+	t.Run("applies spec changes", func(t *testing.T) {
+		g := gomega.NewGomegaWithT(t)
+		g.Eventually(func() error {
+			if err := c.Get(context.TODO(), key(instance.Name), instance); err != nil {
+				return err
+			}
+			instance.Spec.Apiserver.Restful.Host = "api.example.org"
+			return c.Update(context.TODO(), instance)
+		}, timeout).Should(gomega.Succeed())
+
+		ingress := &extensionsv1beta1.Ingress{}
+		g.Eventually(func() (string, error) {
+			if err := c.Get(context.TODO(), key("foo-apiserver-rest"), ingress); err != nil {
+				return "", err
+			}
+			return ingress.Spec.Rules[0].Host, nil
+		}, timeout).Should(gomega.Equal("api.example.org"))
+	})
+
+	t.Run("leaves unmanaged components alone", func(t *testing.T) {
+		g := gomega.NewGomegaWithT(t)
+		g.Eventually(func() error {
+			if err := c.Get(context.TODO(), key(instance.Name), instance); err != nil {
+				return err
+			}
+			instance.Annotations = map[string]string{unmanagedAnnotationPrefix + "frontend": "true"}
+			return c.Update(context.TODO(), instance)
+		}, timeout).Should(gomega.Succeed())
+
+		g.Eventually(func() ([]string, error) {
+			err := c.Get(context.TODO(), key(instance.Name), instance)
+			return instance.Status.UnmanagedComponents, err
+		}, timeout).Should(gomega.ConsistOf("frontend"))
+
+		g.Expect(c.Delete(context.TODO(), &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "foo-frontend", Namespace: instance.Namespace}})).NotTo(gomega.HaveOccurred())
+		g.Consistently(func() bool {
+			err := c.Get(context.TODO(), key("foo-frontend"), &appsv1.Deployment{})
+			return apierrors.IsNotFound(err)
+		}, 2*time.Second).Should(gomega.BeTrue())
+	})
+
+	t.Run("uses an external dgraph", func(t *testing.T) {
+		g := gomega.NewGomegaWithT(t)
+		external := &infinimeshv1beta1.Platform{ObjectMeta: metav1.ObjectMeta{Name: "ext", Namespace: ns.Name}}
+		external.Spec.Apiserver.Restful.Host = "ext.example.com"
+		external.Spec.DGraph.External = &infinimeshv1beta1.PlatformDgraphExternal{Address: "dgraph.example.com:9080"}
+		g.Expect(c.Create(context.TODO(), external)).NotTo(gomega.HaveOccurred())
+		defer c.Delete(context.TODO(), external)
+
+		g.Eventually(func() error {
+			return c.Get(context.TODO(), key("ext-root-account"), &corev1.Secret{})
+		}, timeout).Should(gomega.Succeed())
+		g.Expect(fakes.Platform(external).SchemaImports()).To(gomega.BeNumerically(">", 0))
+
+		g.Expect(controlledBy(c, external, &appsv1.StatefulSetList{})()).To(gomega.ConsistOf("ext-twin-redis", "ext-redis-device-details"))
+		g.Expect(controlledBy(c, external, &corev1.ServiceList{})()).NotTo(gomega.ContainElement("ext-dgraph-alpha"))
+	})
+
+	t.Run("stops after deletion", func(t *testing.T) {
+		g := gomega.NewGomegaWithT(t)
+		g.Expect(c.Delete(context.TODO(), instance)).NotTo(gomega.HaveOccurred())
+		g.Eventually(func() bool {
+			err := c.Get(context.TODO(), key(instance.Name), &infinimeshv1beta1.Platform{})
+			return apierrors.IsNotFound(err)
+		}, timeout).Should(gomega.BeTrue())
 
+		// GC isn't enabled in the test control plane, the owner references above let it collect
+		// the objects in a real cluster. Deleting one by hand must not bring it back.
+		g.Expect(c.Delete(context.TODO(), &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "foo-nodeserver", Namespace: instance.Namespace}})).NotTo(gomega.HaveOccurred())
+		g.Consistently(func() bool {
+			err := c.Get(context.TODO(), key("foo-nodeserver"), &appsv1.Deployment{})
+			return apierrors.IsNotFound(err)
+		}, 2*time.Second).Should(gomega.BeTrue())
+	})
 }
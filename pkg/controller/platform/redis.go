@@ -0,0 +1,486 @@
+package platform
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+)
+
+const (
+	redisModeStandalone = "standalone"
+	redisModeSentinel   = "sentinel"
+	redisModeExternal   = "external"
+
+	redisMasterName = "mymaster"
+)
+
+func redisMode(store infinimeshv1beta1.PlatformRedisStore) string {
+	switch {
+	case store.Mode != "":
+		return store.Mode
+	case store.External != nil:
+		return redisModeExternal
+	default:
+		return redisModeStandalone
+	}
+}
+
+func redisReplicas(store infinimeshv1beta1.PlatformRedisStore) int32 {
+	switch {
+	case redisMode(store) != redisModeSentinel:
+		return 1
+	case store.Replicas == 0:
+		return 3
+	default:
+		return store.Replicas
+	}
+}
+
+// redisAuthSecret returns the name of the Secret holding the password of a store, if any.
+func redisAuthSecret(name string, store infinimeshv1beta1.PlatformRedisStore) string {
+	if store.AuthSecret != "" || redisMode(store) == redisModeExternal {
+		return store.AuthSecret
+	}
+	return name + "-auth"
+}
+
+// redisPersistenceArgs returns the redis-server flags for the persistence setting of a store.
+func redisPersistenceArgs(store infinimeshv1beta1.PlatformRedisStore) string {
+	switch store.Persistence {
+	case "rdb":
+		return "--appendonly no --save 900 1 --save 300 10 --save 60 10000"
+	case "none":
+		return `--appendonly no --save ""`
+	default:
+		return "--appendonly yes"
+	}
+}
+
+// redisEnv returns the environment a client of the store named name needs, suffix
+// distinguishes the stores of components talking to more than one redis.
+func redisEnv(name string, store infinimeshv1beta1.PlatformRedisStore, suffix string) []corev1.EnvVar {
+	var env []corev1.EnvVar
+
+	switch redisMode(store) {
+	case redisModeExternal:
+		if store.External != nil {
+			env = append(env, corev1.EnvVar{
+				Name:  "DB_ADDR" + suffix,
+				Value: store.External.Address,
+			})
+			if len(store.External.SentinelAddresses) > 0 {
+				env = append(env, corev1.EnvVar{
+					Name:  "DB_SENTINEL_ADDR" + suffix,
+					Value: strings.Join(store.External.SentinelAddresses, ","),
+				}, corev1.EnvVar{
+					Name:  "DB_SENTINEL_MASTER" + suffix,
+					Value: store.External.MasterName,
+				})
+			}
+		}
+	case redisModeSentinel:
+		// The service of the store balances across the replicas as well, clients find the
+		// master through the sentinels instead
+		env = append(env, corev1.EnvVar{
+			Name:  "DB_SENTINEL_ADDR" + suffix,
+			Value: name + "-sentinel:26379",
+		}, corev1.EnvVar{
+			Name:  "DB_SENTINEL_MASTER" + suffix,
+			Value: redisMasterName,
+		})
+	default:
+		env = append(env, corev1.EnvVar{
+			Name:  "DB_ADDR" + suffix,
+			Value: name + ":6379",
+		})
+	}
+
+	if secret := redisAuthSecret(name, store); secret != "" {
+		env = append(env, corev1.EnvVar{
+			Name: "DB_PASSWORD" + suffix,
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: secret,
+					},
+					Key: "password",
+				},
+			},
+		})
+	}
+
+	return env
+}
+
+// reconcileRedis deploys the redis store named name, either as a single node or as a
+// replicated set watched by sentinels. Nothing is deployed for external stores.
+func (r *ReconcilePlatform) reconcileRedis(instance *infinimeshv1beta1.Platform, name string, store infinimeshv1beta1.PlatformRedisStore, defaultPvcSpec corev1.PersistentVolumeClaimSpec) error {
+	log := logger.WithName("redis").WithValues("store", name)
+
+	mode := redisMode(store)
+	if mode == redisModeExternal {
+		return nil
+	}
+
+	replicas := redisReplicas(store)
+	headless := name + "-headless"
+
+	if store.AuthSecret == "" {
+		randomKey, err := GenerateRandomBytes(32)
+		if err != nil {
+			return err
+		}
+
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      redisAuthSecret(name, store),
+				Namespace: instance.Namespace,
+			},
+			Data: map[string][]byte{
+				"password": []byte(base64.RawURLEncoding.EncodeToString(randomKey)),
+			},
+		}
+
+		if err := controllerutil.SetControllerReference(instance, secret, r.scheme); err != nil {
+			return err
+		}
+
+		foundSecret := &corev1.Secret{}
+		err = r.Get(context.TODO(), types.NamespacedName{Name: secret.Name, Namespace: secret.Namespace}, foundSecret)
+		if err != nil && errors.IsNotFound(err) {
+			log.Info("Creating Secret", "namespace", secret.Namespace, "name", secret.Name)
+			err = r.Create(context.TODO(), secret)
+			if err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+	}
+
+	// Statefulsets created by earlier versions of the operator keep their claim name and the
+	// labels they select their pods by, both are immutable
+	dataVolume := "datadir"
+	podLabels := map[string]string{"app": name}
+	foundS := &appsv1.StatefulSet{}
+	err := r.Get(context.TODO(), types.NamespacedName{Name: name, Namespace: instance.Namespace}, foundS)
+	exists := err == nil
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if exists && len(foundS.Spec.VolumeClaimTemplates) > 0 {
+		dataVolume = foundS.Spec.VolumeClaimTemplates[0].Name
+	}
+	if exists && foundS.Spec.Selector != nil && len(foundS.Spec.Selector.MatchLabels) > 0 {
+		podLabels = foundS.Spec.Selector.MatchLabels
+	}
+	// The first pod bootstraps as master, its host name is in the domain of the governing service
+	serviceName := headless
+	if exists && foundS.Spec.ServiceName != "" {
+		serviceName = foundS.Spec.ServiceName
+	}
+	master := name + "-0." + serviceName + "." + instance.Namespace + ".svc.cluster.local"
+
+	services := []*corev1.Service{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      headless,
+				Namespace: instance.Namespace,
+				Labels: map[string]string{
+					"app": name,
+				},
+			},
+			Spec: corev1.ServiceSpec{
+				ClusterIP:                "None",
+				PublishNotReadyAddresses: true,
+				Selector:                 podLabels,
+				Ports: []corev1.ServicePort{
+					{
+						Protocol:   corev1.ProtocolTCP,
+						Port:       6379,
+						TargetPort: intstr.FromInt(6379),
+						Name:       "redis",
+					},
+				},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: instance.Namespace,
+				Labels: map[string]string{
+					"app": name,
+				},
+			},
+			Spec: corev1.ServiceSpec{
+				Type:     corev1.ServiceTypeClusterIP,
+				Selector: podLabels,
+				Ports: []corev1.ServicePort{
+					{
+						Protocol:   corev1.ProtocolTCP,
+						Port:       6379,
+						TargetPort: intstr.FromInt(6379),
+						Name:       "redis",
+					},
+				},
+			},
+		},
+	}
+	if mode == redisModeSentinel {
+		services = append(services, &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name + "-sentinel",
+				Namespace: instance.Namespace,
+				Labels: map[string]string{
+					"app": name,
+				},
+			},
+			Spec: corev1.ServiceSpec{
+				Type:     corev1.ServiceTypeClusterIP,
+				Selector: podLabels,
+				Ports: []corev1.ServicePort{
+					{
+						Protocol:   corev1.ProtocolTCP,
+						Port:       26379,
+						TargetPort: intstr.FromInt(26379),
+						Name:       "sentinel",
+					},
+				},
+			},
+		})
+	}
+
+	if instance.Spec.Observability.Prometheus != nil {
+		metrics := metricsService(instance, name, redisExporterPort)
+		metrics.Spec.Selector = podLabels
+		services = append(services, metrics)
+	}
+
+	for _, svc := range services {
+		if err := controllerutil.SetControllerReference(instance, svc, r.scheme); err != nil {
+			return err
+		}
+
+		found := &corev1.Service{}
+		err := r.Get(context.TODO(), types.NamespacedName{Name: svc.Name, Namespace: svc.Namespace}, found)
+		if err != nil && errors.IsNotFound(err) {
+			log.Info("Creating Service", "namespace", svc.Namespace, "name", svc.Name)
+			err = r.Create(context.TODO(), svc)
+			if err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		} else if !reflect.DeepEqual(svc.Spec.Selector, found.Spec.Selector) || svc.Spec.PublishNotReadyAddresses != found.Spec.PublishNotReadyAddresses {
+			found.Spec.Selector = svc.Spec.Selector
+			found.Spec.PublishNotReadyAddresses = svc.Spec.PublishNotReadyAddresses
+			log.Info("Updating Service", "namespace", svc.Namespace, "name", svc.Name)
+			if err := r.Update(context.TODO(), found); err != nil {
+				return err
+			}
+		}
+	}
+
+	pvcSpec := defaultPvcSpec
+	if store.Storage != nil {
+		pvcSpec = *store.Storage
+	}
+
+	passwordEnv := []corev1.EnvVar{
+		{
+			Name: "REDIS_PASSWORD",
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: redisAuthSecret(name, store),
+					},
+					Key: "password",
+				},
+			},
+		},
+	}
+
+	// In sentinel mode every node asks the sentinels for the current master first,
+	// the first pod only bootstraps as master if no sentinel knows one yet
+	redisScript := `set -e
+exec redis-server ` + redisPersistenceArgs(store) + ` --requirepass "$REDIS_PASSWORD" --masterauth "$REDIS_PASSWORD"`
+	if mode == redisModeSentinel {
+		redisScript = `set -e
+HOST=$(hostname -f)
+MASTER=$(redis-cli -h ` + name + `-sentinel -p 26379 sentinel get-master-addr-by-name ` + redisMasterName + ` 2>/dev/null | head -n 1)
+if [ -z "$MASTER" ]; then MASTER=` + master + `; fi
+REPLICAOF=""
+if [ "$MASTER" != "$HOST" ]; then REPLICAOF="--replicaof $MASTER 6379"; fi
+exec redis-server ` + redisPersistenceArgs(store) + ` --requirepass "$REDIS_PASSWORD" --masterauth "$REDIS_PASSWORD" --replica-announce-ip $HOST $REPLICAOF`
+	}
+
+	containers := []corev1.Container{
+		{
+			Name:            "redis",
+			Image:           "redis:6.2",
+			ImagePullPolicy: corev1.PullIfNotPresent,
+			Ports: []corev1.ContainerPort{
+				{
+					ContainerPort: 6379,
+					Name:          "redis",
+				},
+			},
+			Env:       passwordEnv,
+			Resources: store.Resources,
+			VolumeMounts: []corev1.VolumeMount{
+				{
+					Name:      dataVolume,
+					MountPath: "/data",
+				},
+			},
+			Command: []string{
+				"sh", "-c", redisScript,
+			},
+			ReadinessProbe: &corev1.Probe{
+				Handler: corev1.Handler{
+					TCPSocket: &corev1.TCPSocketAction{
+						Port: intstr.FromInt(6379),
+					},
+				},
+				InitialDelaySeconds: 5,
+				PeriodSeconds:       10,
+			},
+		},
+	}
+	if mode == redisModeSentinel {
+		containers = append(containers, corev1.Container{
+			Name:            "sentinel",
+			Image:           "redis:6.2",
+			ImagePullPolicy: corev1.PullIfNotPresent,
+			Ports: []corev1.ContainerPort{
+				{
+					ContainerPort: 26379,
+					Name:          "sentinel",
+				},
+			},
+			Env: passwordEnv,
+			Command: []string{
+				"sh",
+				"-c",
+				`set -e
+HOST=$(hostname -f)
+MASTER=$(redis-cli -h ` + name + `-sentinel -p 26379 sentinel get-master-addr-by-name ` + redisMasterName + ` 2>/dev/null | head -n 1)
+if [ -z "$MASTER" ]; then MASTER=` + master + `; fi
+cat > /tmp/sentinel.conf <<EOF
+port 26379
+sentinel resolve-hostnames yes
+sentinel announce-hostnames yes
+sentinel announce-ip $HOST
+sentinel monitor ` + redisMasterName + ` $MASTER 6379 ` + fmt.Sprint(replicas/2+1) + `
+sentinel auth-pass ` + redisMasterName + ` $REDIS_PASSWORD
+sentinel down-after-milliseconds ` + redisMasterName + ` 5000
+sentinel failover-timeout ` + redisMasterName + ` 60000
+EOF
+exec redis-sentinel /tmp/sentinel.conf`,
+			},
+		})
+	}
+
+	if instance.Spec.Observability.Prometheus != nil {
+		containers = append(containers, redisExporterContainer(name, store))
+	}
+
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: instance.Namespace,
+		},
+		Spec: appsv1.StatefulSetSpec{
+			ServiceName: serviceName,
+			Replicas:    &replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: podLabels,
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: podLabels},
+				Spec: corev1.PodSpec{
+					Affinity: &corev1.Affinity{
+						PodAntiAffinity: &corev1.PodAntiAffinity{
+							PreferredDuringSchedulingIgnoredDuringExecution: []corev1.WeightedPodAffinityTerm{
+								{
+									Weight: 100,
+									PodAffinityTerm: corev1.PodAffinityTerm{
+										LabelSelector: &metav1.LabelSelector{
+											MatchLabels: podLabels,
+										},
+										TopologyKey: "kubernetes.io/hostname",
+									},
+								},
+							},
+						},
+					},
+					Containers:                    containers,
+					TerminationGracePeriodSeconds: func() *int64 { val := int64(60); return &val }(),
+				},
+			},
+			UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
+				Type: "RollingUpdate",
+			},
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: dataVolume,
+					},
+					Spec: pvcSpec,
+				},
+			},
+		},
+	}
+
+	if err := r.secureWorkload(instance, sts.Name, &sts.Spec.Template); err != nil {
+		return err
+	}
+
+	if err := controllerutil.SetControllerReference(instance, sts, r.scheme); err != nil {
+		return err
+	}
+
+	if !exists {
+		log.Info("Creating statefulset", "namespace", sts.Namespace, "name", sts.Name)
+		err = r.Create(context.TODO(), sts)
+		if err != nil {
+			return err
+		}
+	} else {
+		// Volume claim templates are immutable, only roll out replica and pod changes
+		if !reflect.DeepEqual(sts.Spec.Replicas, foundS.Spec.Replicas) || !reflect.DeepEqual(sts.Spec.Template, foundS.Spec.Template) {
+			foundS.Spec.Replicas = sts.Spec.Replicas
+			foundS.Spec.Template = sts.Spec.Template
+			log.Info("Updating statefulset", "namespace", sts.Namespace, "name", sts.Name)
+			err = r.Update(context.TODO(), foundS)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// redisDefaultStorage returns a PVC spec requesting size.
+func redisDefaultStorage(size string) corev1.PersistentVolumeClaimSpec {
+	return corev1.PersistentVolumeClaimSpec{
+		AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(size)},
+		},
+	}
+}
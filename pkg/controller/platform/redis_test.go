@@ -0,0 +1,147 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package platform
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+)
+
+func TestRedisKeepsLegacySelector(t *testing.T) {
+	ctx := context.TODO()
+	instance := &infinimeshv1beta1.Platform{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"}}
+	c := newMemoryClient(scheme.Scheme)
+	r := &ReconcilePlatform{Client: c, scheme: scheme.Scheme, recorder: record.NewFakeRecorder(100)}
+
+	// The twin redis of earlier releases selects its pods by the deployment label
+	legacy := map[string]string{"deployment": "foo-twin-redis"}
+	err := c.Create(ctx, &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo-twin-redis", Namespace: "default"},
+		Spec: appsv1.StatefulSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: legacy},
+			Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: legacy}},
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{
+				{ObjectMeta: metav1.ObjectMeta{Name: "redis-data"}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.Create(ctx, &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo-twin-redis", Namespace: "default"},
+		Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": "stale"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"foo-twin-redis", "foo-redis-device-details"} {
+		if err := r.reconcileRedis(instance, name, infinimeshv1beta1.PlatformRedisStore{}, redisDefaultStorage("1Gi")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, want := range map[string]map[string]string{
+		"foo-twin-redis":           legacy,
+		"foo-redis-device-details": {"app": "foo-redis-device-details"},
+	} {
+		key := types.NamespacedName{Name: name, Namespace: "default"}
+		sts := &appsv1.StatefulSet{}
+		if err := c.Get(ctx, key, sts); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(sts.Spec.Selector.MatchLabels, want) || !reflect.DeepEqual(sts.Spec.Template.Labels, want) {
+			t.Errorf("%v selects %v and labels its pods %v, want %v", name, sts.Spec.Selector.MatchLabels, sts.Spec.Template.Labels, want)
+		}
+		if len(sts.Spec.Template.Spec.Containers) == 0 {
+			t.Errorf("%v has no containers", name)
+		}
+
+		for _, svcName := range []string{name, name + "-headless"} {
+			svc := &corev1.Service{}
+			if err := c.Get(ctx, types.NamespacedName{Name: svcName, Namespace: "default"}, svc); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(svc.Spec.Selector, want) {
+				t.Errorf("service %v selects %v, want %v", svcName, svc.Spec.Selector, want)
+			}
+		}
+	}
+}
+
+func TestRedisSentinelMaster(t *testing.T) {
+	ctx := context.TODO()
+	instance := &infinimeshv1beta1.Platform{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"}}
+	c := newMemoryClient(scheme.Scheme)
+	r := &ReconcilePlatform{Client: c, scheme: scheme.Scheme, recorder: record.NewFakeRecorder(100)}
+	store := infinimeshv1beta1.PlatformRedisStore{Mode: "sentinel"}
+
+	// Statefulsets of earlier releases are governed by the service named like the store, the
+	// service name of a statefulset is immutable
+	err := c.Create(ctx, &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo-twin-redis", Namespace: "default"},
+		Spec:       appsv1.StatefulSetSpec{ServiceName: "foo-twin-redis"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{
+		"foo-twin-redis":           "foo-twin-redis-0.foo-twin-redis.default.svc.cluster.local",
+		"foo-redis-device-details": "foo-redis-device-details-0.foo-redis-device-details-headless.default.svc.cluster.local",
+	} {
+		if err := r.reconcileRedis(instance, name, store, redisDefaultStorage("1Gi")); err != nil {
+			t.Fatal(err)
+		}
+		sts := &appsv1.StatefulSet{}
+		if err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: "default"}, sts); err != nil {
+			t.Fatal(err)
+		}
+		if len(sts.Spec.Template.Spec.Containers) < 2 {
+			t.Fatalf("%v has no sentinel", name)
+		}
+		for _, container := range sts.Spec.Template.Spec.Containers[:2] {
+			if script := container.Command[len(container.Command)-1]; !strings.Contains(script, "MASTER="+want+";") {
+				t.Errorf("%v: %v does not bootstrap with master %v:\n%v", name, container.Name, want, script)
+			}
+		}
+	}
+
+	// The service of the store balances across all nodes, so clients only get the sentinels
+	env := map[string]string{}
+	for _, e := range redisEnv("foo-twin-redis", store, "") {
+		env[e.Name] = e.Value
+	}
+	if _, ok := env["DB_ADDR"]; ok {
+		t.Errorf("clients connect to %v instead of the master", env["DB_ADDR"])
+	}
+	if env["DB_SENTINEL_ADDR"] != "foo-twin-redis-sentinel:26379" || env["DB_SENTINEL_MASTER"] != redisMasterName {
+		t.Errorf("clients ask %v for %v", env["DB_SENTINEL_ADDR"], env["DB_SENTINEL_MASTER"])
+	}
+}
@@ -0,0 +1,190 @@
+package platform
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+)
+
+// Render returns the objects the reconcilers create for instance on an empty cluster, in the
+// order they are created. It runs the same reconcilers as the controller against an in-memory
+// client and doesn't call the services of the platform. groups are the API groups of other
+// operators installed in the cluster, e.g. kafka.strimzi.io, kubedb.com or
+// monitoring.coreos.com; without them the reconcilers fall back as if the operator was missing.
+func Render(instance *infinimeshv1beta1.Platform, scheme *runtime.Scheme, groups ...string) ([]runtime.Object, error) {
+	c := newMemoryClient(scheme, groups...)
+	r := &ReconcilePlatform{
+		Client:   c,
+		scheme:   scheme,
+		recorder: &record.FakeRecorder{},
+		offline:  true,
+	}
+
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: instance.Name, Namespace: instance.Namespace}}
+	for _, comp := range r.components(instance) {
+		if unmanaged(instance, comp.name) {
+			continue
+		}
+		if err := comp.reconcile(request, instance); err != nil {
+			return nil, fmt.Errorf("%v: %v", comp.name, err)
+		}
+	}
+	return c.objects, nil
+}
+
+// memoryClient is a client.Client keeping objects in memory, every object is created with its
+// kind set. Kinds of API groups neither in scheme nor in groups don't match, like those of
+// CRDs that aren't installed.
+type memoryClient struct {
+	scheme  *runtime.Scheme
+	groups  map[string]bool
+	objects []runtime.Object
+}
+
+var _ client.Client = &memoryClient{}
+
+// NewMemoryClient returns an empty in-memory client like the one Render uses, for testing
+// reconcilers without a cluster.
+func NewMemoryClient(scheme *runtime.Scheme) client.Client {
+	return newMemoryClient(scheme)
+}
+
+func newMemoryClient(scheme *runtime.Scheme, groups ...string) *memoryClient {
+	c := &memoryClient{scheme: scheme, groups: map[string]bool{}}
+	for _, group := range groups {
+		c.groups[group] = true
+	}
+	return c
+}
+
+// gvk returns the kind of obj, or a NoKindMatchError if the cluster doesn't serve it.
+func (c *memoryClient) gvk(obj runtime.Object) (schema.GroupVersionKind, error) {
+	gvk, err := apiutil.GVKForObject(obj, c.scheme)
+	if err != nil {
+		return gvk, err
+	}
+	if !c.scheme.IsGroupRegistered(gvk.Group) && !c.groups[gvk.Group] {
+		return gvk, &meta.NoKindMatchError{GroupKind: gvk.GroupKind(), SearchedVersions: []string{gvk.Version}}
+	}
+	return gvk, nil
+}
+
+// find returns the index of the object of kind gvk named key, or -1.
+func (c *memoryClient) find(gvk schema.GroupVersionKind, key client.ObjectKey) int {
+	for i, obj := range c.objects {
+		accessor, _ := meta.Accessor(obj)
+		if obj.GetObjectKind().GroupVersionKind() == gvk && accessor.GetNamespace() == key.Namespace && accessor.GetName() == key.Name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (c *memoryClient) key(obj runtime.Object) (schema.GroupVersionKind, client.ObjectKey, error) {
+	gvk, err := c.gvk(obj)
+	if err != nil {
+		return gvk, client.ObjectKey{}, err
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return gvk, client.ObjectKey{}, err
+	}
+	return gvk, client.ObjectKey{Namespace: accessor.GetNamespace(), Name: accessor.GetName()}, nil
+}
+
+func (c *memoryClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	gvk, err := c.gvk(obj)
+	if err != nil {
+		return err
+	}
+	i := c.find(gvk, key)
+	if i < 0 {
+		return errors.NewNotFound(schema.GroupResource{Group: gvk.Group, Resource: strings.ToLower(gvk.Kind)}, key.Name)
+	}
+	reflect.ValueOf(obj).Elem().Set(reflect.ValueOf(c.objects[i].DeepCopyObject()).Elem())
+	return nil
+}
+
+func (c *memoryClient) List(ctx context.Context, opts *client.ListOptions, list runtime.Object) error {
+	gvk, err := c.gvk(list)
+	if err != nil {
+		return err
+	}
+	gvk.Kind = strings.TrimSuffix(gvk.Kind, "List")
+
+	var items []runtime.Object
+	for _, obj := range c.objects {
+		accessor, _ := meta.Accessor(obj)
+		if obj.GetObjectKind().GroupVersionKind() != gvk {
+			continue
+		}
+		if opts != nil && opts.Namespace != "" && accessor.GetNamespace() != opts.Namespace {
+			continue
+		}
+		if opts != nil && opts.LabelSelector != nil && !opts.LabelSelector.Matches(labels.Set(accessor.GetLabels())) {
+			continue
+		}
+		items = append(items, obj.DeepCopyObject())
+	}
+	return meta.SetList(list, items)
+}
+
+func (c *memoryClient) Create(ctx context.Context, obj runtime.Object) error {
+	gvk, key, err := c.key(obj)
+	if err != nil {
+		return err
+	}
+	if c.find(gvk, key) >= 0 {
+		return errors.NewAlreadyExists(schema.GroupResource{Group: gvk.Group, Resource: strings.ToLower(gvk.Kind)}, key.Name)
+	}
+	stored := obj.DeepCopyObject()
+	stored.GetObjectKind().SetGroupVersionKind(gvk)
+	c.objects = append(c.objects, stored)
+	return nil
+}
+
+func (c *memoryClient) Update(ctx context.Context, obj runtime.Object) error {
+	gvk, key, err := c.key(obj)
+	if err != nil {
+		return err
+	}
+	i := c.find(gvk, key)
+	if i < 0 {
+		return errors.NewNotFound(schema.GroupResource{Group: gvk.Group, Resource: strings.ToLower(gvk.Kind)}, key.Name)
+	}
+	stored := obj.DeepCopyObject()
+	stored.GetObjectKind().SetGroupVersionKind(gvk)
+	c.objects[i] = stored
+	return nil
+}
+
+func (c *memoryClient) Delete(ctx context.Context, obj runtime.Object, opts ...client.DeleteOptionFunc) error {
+	gvk, key, err := c.key(obj)
+	if err != nil {
+		return err
+	}
+	i := c.find(gvk, key)
+	if i < 0 {
+		return errors.NewNotFound(schema.GroupResource{Group: gvk.Group, Resource: strings.ToLower(gvk.Kind)}, key.Name)
+	}
+	c.objects = append(c.objects[:i], c.objects[i+1:]...)
+	return nil
+}
+
+func (c *memoryClient) Status() client.StatusWriter {
+	return c
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package platform
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+)
+
+// rendered returns the names of the objects by kind.
+func rendered(objs []runtime.Object) map[string]map[string]bool {
+	names := map[string]map[string]bool{}
+	for _, obj := range objs {
+		kind := obj.GetObjectKind().GroupVersionKind().Kind
+		accessor, _ := meta.Accessor(obj)
+		if names[kind] == nil {
+			names[kind] = map[string]bool{}
+		}
+		names[kind][accessor.GetName()] = true
+	}
+	return names
+}
+
+func TestRenderRootAccountSecret(t *testing.T) {
+	objs, err := Render(securityTestPlatform(""), scheme.Scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, obj := range objs {
+		if secret, ok := obj.(*corev1.Secret); ok && secret.Name == "foo-root-account" {
+			if secret.StringData["username"] != "root" || secret.StringData["password"] == "" {
+				t.Errorf("root account secret without credentials: %v", secret.StringData)
+			}
+			return
+		}
+	}
+	t.Error("root account secret is not rendered")
+}
+
+func TestRenderAPIGroups(t *testing.T) {
+	instance := securityTestPlatform("")
+	instance.Spec.Kafka.Managed = nil
+	instance.Spec.Kafka.BootstrapServers = "kafka:9092"
+	instance.Spec.Timeseries.TimescaleDB = &infinimeshv1beta1.PlatformTimescaleDB{Backend: timescaleDBBackendKubeDB}
+
+	// Without the other operators the reconcilers fall back to what they deploy themselves
+	objs, err := Render(instance, scheme.Scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := rendered(objs)
+	if !names["Job"]["foo-kafka-topics"] {
+		t.Error("kafka topics job is not rendered")
+	}
+	if !names["StatefulSet"]["foo-timescaledb"] {
+		t.Error("native timescaledb is not rendered")
+	}
+	for _, kind := range []string{"KafkaTopic", "Postgres", "ServiceMonitor", "PrometheusRule"} {
+		if len(names[kind]) > 0 {
+			t.Errorf("%v rendered without its operator", kind)
+		}
+	}
+
+	objs, err = Render(instance, scheme.Scheme, "kafka.strimzi.io", "kubedb.com", "monitoring.coreos.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names = rendered(objs)
+	for _, kind := range []string{"KafkaTopic", "Postgres", "ServiceMonitor", "PrometheusRule"} {
+		if len(names[kind]) == 0 {
+			t.Errorf("no %v rendered", kind)
+		}
+	}
+	if names["Job"]["foo-kafka-topics"] {
+		t.Error("kafka topics job is rendered with the topic operator")
+	}
+}
@@ -2,6 +2,7 @@ package platform
 
 import (
 	"context"
+	"reflect"
 
 	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
 	batchv1 "k8s.io/api/batch/v1"
@@ -19,20 +20,25 @@ import (
 
 func (r *ReconcilePlatform) reconcileResetRootAccountPwd(request reconcile.Request, instance *infinimeshv1beta1.Platform) error {
 	log := logger.WithName("Reset root account pwd")
+
+	roleName := instance.Name + "-reset-pwd"
+	serviceAccountName := instance.Name + "-reset-root-account-pwd"
+
 	role := &v1beta1rbac.Role{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "Role",
 			APIVersion: "rbac.authorization.k8s.io",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "reset-pwd",
-			Namespace: "default",
+			Name:      roleName,
+			Namespace: instance.Namespace,
 		},
 		Rules: []v1beta1rbac.PolicyRule{
 			v1beta1rbac.PolicyRule{
-				APIGroups: []string{""},
-				Resources: []string{"secrets"},
-				Verbs:     []string{"delete", "get"},
+				APIGroups:     []string{""},
+				Resources:     []string{"secrets"},
+				ResourceNames: []string{instance.Name + "-root-account"},
+				Verbs:         []string{"delete", "get"},
 			},
 		},
 	}
@@ -42,33 +48,33 @@ func (r *ReconcilePlatform) reconcileResetRootAccountPwd(request reconcile.Reque
 			APIVersion: "rbac.authorization.k8s.io/v1beta1",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "reset-pwd",
-			Namespace: "default",
+			Name:      roleName,
+			Namespace: instance.Namespace,
 		},
 		Subjects: []v1beta1rbac.Subject{
 			v1beta1rbac.Subject{
 				Kind:      "ServiceAccount",
-				Name:      "reset-root-account-pwd",
-				Namespace: "default",
+				Name:      serviceAccountName,
+				Namespace: instance.Namespace,
 			},
 		},
 		RoleRef: v1beta1rbac.RoleRef{
 			APIGroup: "",
 			Kind:     "Role",
-			Name:     "reset-pwd",
+			Name:     roleName,
 		},
 	}
 
 	svc_account := &v1.ServiceAccount{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "reset-root-account-pwd",
-			Namespace: "default",
+			Name:      serviceAccountName,
+			Namespace: instance.Namespace,
 		},
 	}
 	cronjob := &v1beta1.CronJob{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "delete-root-account-secret",
-			Namespace: "default",
+			Name:      instance.Name + "-delete-root-account-secret",
+			Namespace: instance.Namespace,
 		},
 		Spec: v1beta1.CronJobSpec{
 			Schedule:          "0 0 * * *",
@@ -77,15 +83,14 @@ func (r *ReconcilePlatform) reconcileResetRootAccountPwd(request reconcile.Reque
 				Spec: batchv1.JobSpec{
 					Template: v1.PodTemplateSpec{
 						Spec: v1.PodSpec{
-							RestartPolicy:      corev1.RestartPolicyOnFailure,
-							ServiceAccountName: "reset-root-account-pwd",
+							RestartPolicy: corev1.RestartPolicyOnFailure,
 							Containers: []corev1.Container{
 								{
 									Name:            "kubectl",
 									Image:           "garland/kubectl:1.10.4",
 									ImagePullPolicy: corev1.PullAlways,
 									Command: []string{
-										"/bin/sh", "-c", "kubectl delete secret " + instance.Name + "-root-account -n default;",
+										"/bin/sh", "-c", "kubectl delete secret " + instance.Name + "-root-account -n " + instance.Namespace + ";",
 									},
 								},
 							},
@@ -144,6 +149,8 @@ func (r *ReconcilePlatform) reconcileResetRootAccountPwd(request reconcile.Reque
 		return err
 	}
 	//------Creating Cron Job-------//
+	// kubectl authenticates with the token of the service account bound to the role
+	secureWorkloadWithToken(instance, serviceAccountName, &cronjob.Spec.JobTemplate.Spec.Template)
 	if err := controllerutil.SetControllerReference(instance, cronjob, r.scheme); err != nil {
 		return err
 	}
@@ -157,7 +164,19 @@ func (r *ReconcilePlatform) reconcileResetRootAccountPwd(request reconcile.Reque
 		}
 	} else if err != nil {
 		return err
+	} else if !reflect.DeepEqual(cronjob.Spec, foundS.Spec) {
+		foundS.Spec = cronjob.Spec
+		log.Info("Updating cronjob for resetting root account password", "namespace", cronjob.Namespace, "name", cronjob.Name)
+		if err := r.Update(context.TODO(), foundS); err != nil {
+			return err
+		}
 	}
-	return nil
-	//dummy commit to build
+
+	// Releases before objects were prefixed by the platform name created them in default
+	return r.deleteLegacyObjects(instance,
+		&v1beta1rbac.Role{ObjectMeta: legacyObjectMeta("reset-pwd")},
+		&v1beta1rbac.RoleBinding{ObjectMeta: legacyObjectMeta("reset-pwd")},
+		&v1.ServiceAccount{ObjectMeta: legacyObjectMeta("reset-root-account-pwd")},
+		&v1beta1.CronJob{ObjectMeta: legacyObjectMeta("delete-root-account-secret")},
+	)
 }
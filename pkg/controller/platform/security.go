@@ -0,0 +1,148 @@
+package platform
+
+import (
+	"context"
+	"reflect"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+)
+
+const (
+	securityProfileBaseline   = "baseline"
+	securityProfileRestricted = "restricted"
+
+	// restrictedUser is the user pods run as in the restricted profile unless they have an
+	// fsGroup of their own, nobody in most images
+	restrictedUser int64 = 65534
+)
+
+// secureWorkload runs the pods of the workload called name as a ServiceAccount of the same
+// name and hardens them according to the security profile of instance. Besides /tmp, scratch
+// are the paths outside of their volumes the containers write to.
+func (r *ReconcilePlatform) secureWorkload(instance *infinimeshv1beta1.Platform, name string, template *corev1.PodTemplateSpec, scratch ...string) error {
+	if err := r.reconcileServiceAccount(instance, name); err != nil {
+		return err
+	}
+	template.Spec.ServiceAccountName = name
+	hardenPod(instance, template, scratch...)
+	return nil
+}
+
+// secureWorkloadWithToken hardens the pods of a workload talking to the Kubernetes API like
+// secureWorkload, but runs them as serviceAccount, which is bound to the workload's role, and
+// keeps mounting its token.
+func secureWorkloadWithToken(instance *infinimeshv1beta1.Platform, serviceAccount string, template *corev1.PodTemplateSpec, scratch ...string) {
+	template.Spec.ServiceAccountName = serviceAccount
+	hardenPod(instance, template, scratch...)
+	automount := true
+	template.Spec.AutomountServiceAccountToken = &automount
+}
+
+// reconcileServiceAccount creates the ServiceAccount called name. Workloads don't talk to the
+// Kubernetes API, so it doesn't mount a token into their pods.
+func (r *ReconcilePlatform) reconcileServiceAccount(instance *infinimeshv1beta1.Platform, name string) error {
+	automount := false
+	sa := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: instance.Namespace,
+		},
+		AutomountServiceAccountToken: &automount,
+	}
+	if err := controllerutil.SetControllerReference(instance, sa, r.scheme); err != nil {
+		return err
+	}
+
+	found := &corev1.ServiceAccount{}
+	err := r.Get(context.TODO(), types.NamespacedName{Name: sa.Name, Namespace: sa.Namespace}, found)
+	if err != nil && errors.IsNotFound(err) {
+		logger.Info("Creating ServiceAccount", "namespace", sa.Namespace, "name", sa.Name)
+		return r.Create(context.TODO(), sa)
+	} else if err != nil {
+		return err
+	}
+
+	if !reflect.DeepEqual(sa.AutomountServiceAccountToken, found.AutomountServiceAccountToken) {
+		found.AutomountServiceAccountToken = sa.AutomountServiceAccountToken
+		logger.Info("Updating ServiceAccount", "namespace", sa.Namespace, "name", sa.Name)
+		return r.Update(context.TODO(), found)
+	}
+	return nil
+}
+
+// hardenPod applies the security profile of instance to template. Both profiles use the
+// default seccomp profile of the runtime, forbid privilege escalation and make the root
+// filesystem read-only, mounting an emptyDir at /tmp and each of scratch instead. Baseline
+// drops NET_RAW and keeps the other default capabilities for images starting as root and
+// switching users, restricted drops all of them and runs the pod as a non-root user.
+func hardenPod(instance *infinimeshv1beta1.Platform, template *corev1.PodTemplateSpec, scratch ...string) {
+	profile := instance.Spec.Security.Profile
+	if profile != securityProfileBaseline && profile != securityProfileRestricted {
+		return
+	}
+
+	// The vendored API predates the seccompProfile field
+	if template.Annotations == nil {
+		template.Annotations = map[string]string{}
+	}
+	template.Annotations[corev1.SeccompPodAnnotationKey] = corev1.SeccompProfileRuntimeDefault
+
+	spec := &template.Spec
+	automount := false
+	spec.AutomountServiceAccountToken = &automount
+
+	drop := []corev1.Capability{"NET_RAW"}
+	if profile == securityProfileRestricted {
+		drop = []corev1.Capability{"ALL"}
+		if spec.SecurityContext == nil {
+			spec.SecurityContext = &corev1.PodSecurityContext{}
+		}
+		user := restrictedUser
+		if spec.SecurityContext.FSGroup != nil {
+			user = *spec.SecurityContext.FSGroup
+		}
+		nonRoot := true
+		spec.SecurityContext.RunAsNonRoot = &nonRoot
+		spec.SecurityContext.RunAsUser = &user
+		spec.SecurityContext.RunAsGroup = &user
+		spec.SecurityContext.FSGroup = &user
+	}
+
+	for _, path := range append([]string{"/tmp"}, scratch...) {
+		volume := "scratch" + strings.Replace(path, "/", "-", -1)
+		spec.Volumes = append(spec.Volumes, corev1.Volume{
+			Name:         volume,
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		})
+		for i := range spec.InitContainers {
+			spec.InitContainers[i].VolumeMounts = append(spec.InitContainers[i].VolumeMounts, corev1.VolumeMount{Name: volume, MountPath: path})
+		}
+		for i := range spec.Containers {
+			spec.Containers[i].VolumeMounts = append(spec.Containers[i].VolumeMounts, corev1.VolumeMount{Name: volume, MountPath: path})
+		}
+	}
+
+	for i := range spec.InitContainers {
+		spec.InitContainers[i].SecurityContext = containerSecurityContext(drop)
+	}
+	for i := range spec.Containers {
+		spec.Containers[i].SecurityContext = containerSecurityContext(drop)
+	}
+}
+
+func containerSecurityContext(drop []corev1.Capability) *corev1.SecurityContext {
+	escalation := false
+	readOnly := true
+	return &corev1.SecurityContext{
+		AllowPrivilegeEscalation: &escalation,
+		ReadOnlyRootFilesystem:   &readOnly,
+		Capabilities:             &corev1.Capabilities{Drop: drop},
+	}
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package platform
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	batchv1beta1 "k8s.io/api/batch/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+)
+
+// renderPods renders instance and returns the pod templates of its workloads by workload name,
+// and the names of its ServiceAccounts.
+func renderPods(t *testing.T, instance *infinimeshv1beta1.Platform) (map[string]corev1.PodTemplateSpec, map[string]bool) {
+	objs, err := Render(instance, scheme.Scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pods := map[string]corev1.PodTemplateSpec{}
+	accounts := map[string]bool{}
+	for _, obj := range objs {
+		switch obj := obj.(type) {
+		case *appsv1.Deployment:
+			pods[obj.Name] = obj.Spec.Template
+		case *appsv1.StatefulSet:
+			pods[obj.Name] = obj.Spec.Template
+		case *batchv1.Job:
+			pods[obj.Name] = obj.Spec.Template
+		case *batchv1beta1.CronJob:
+			pods[obj.Name] = obj.Spec.JobTemplate.Spec.Template
+		case *corev1.ServiceAccount:
+			accounts[obj.Name] = true
+		}
+	}
+	return pods, accounts
+}
+
+func securityTestPlatform(profile string) *infinimeshv1beta1.Platform {
+	instance := &infinimeshv1beta1.Platform{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"}}
+	instance.Spec.Apiserver.Restful.Host = "api.example.com"
+	instance.Spec.Controller.Timeseries = true
+	instance.Spec.Kafka.Managed = &infinimeshv1beta1.PlatformKafkaManaged{}
+	instance.Spec.Observability.Prometheus = &infinimeshv1beta1.PlatformPrometheus{}
+	instance.Spec.Security.Profile = profile
+	return instance
+}
+
+func TestServiceAccounts(t *testing.T) {
+	pods, accounts := renderPods(t, securityTestPlatform(""))
+	if len(pods) == 0 {
+		t.Fatal("no workloads rendered")
+	}
+
+	users := map[string]string{}
+	for name, pod := range pods {
+		account := pod.Spec.ServiceAccountName
+		if !accounts[account] {
+			t.Errorf("%v runs as %q, which isn't rendered", name, account)
+		}
+		if other, ok := users[account]; ok {
+			t.Errorf("%v and %v share the ServiceAccount %v", name, other, account)
+		}
+		users[account] = name
+
+		// Without a profile the security contexts are left alone
+		if _, ok := pod.Annotations[corev1.SeccompPodAnnotationKey]; ok {
+			t.Errorf("%v has a seccomp profile", name)
+		}
+		for _, c := range pod.Spec.Containers {
+			if c.SecurityContext != nil {
+				t.Errorf("%v/%v has a security context", name, c.Name)
+			}
+		}
+	}
+}
+
+func TestSecurityProfile(t *testing.T) {
+	for _, profile := range []string{securityProfileBaseline, securityProfileRestricted} {
+		pods, _ := renderPods(t, securityTestPlatform(profile))
+		for name, pod := range pods {
+			if pod.Annotations[corev1.SeccompPodAnnotationKey] != corev1.SeccompProfileRuntimeDefault {
+				t.Errorf("%v %v: seccomp profile %q", profile, name, pod.Annotations[corev1.SeccompPodAnnotationKey])
+			}
+			automount := pod.Spec.AutomountServiceAccountToken
+			if name == "foo-delete-root-account-secret" {
+				if automount == nil || !*automount || pod.Spec.ServiceAccountName != "foo-reset-root-account-pwd" {
+					t.Errorf("%v %v: kubectl doesn't get the token of the role's ServiceAccount", profile, name)
+				}
+			} else if automount == nil || *automount {
+				t.Errorf("%v %v: token is mounted", profile, name)
+			}
+
+			sc := pod.Spec.SecurityContext
+			if profile == securityProfileRestricted {
+				if sc == nil || sc.RunAsNonRoot == nil || !*sc.RunAsNonRoot || sc.RunAsUser == nil || *sc.RunAsUser == 0 {
+					t.Errorf("%v %v: pod may run as root: %+v", profile, name, sc)
+				}
+			} else if sc != nil && sc.RunAsNonRoot != nil {
+				t.Errorf("%v %v: runAsNonRoot is set", profile, name)
+			}
+
+			scratch := map[string]bool{}
+			for _, v := range pod.Spec.Volumes {
+				if v.EmptyDir != nil {
+					scratch[v.Name] = true
+				}
+			}
+			for _, c := range pod.Spec.Containers {
+				csc := c.SecurityContext
+				if csc == nil {
+					t.Errorf("%v %v/%v: no security context", profile, name, c.Name)
+					continue
+				}
+				if csc.AllowPrivilegeEscalation == nil || *csc.AllowPrivilegeEscalation {
+					t.Errorf("%v %v/%v: privilege escalation is allowed", profile, name, c.Name)
+				}
+				drop := corev1.Capability("NET_RAW")
+				if profile == securityProfileRestricted {
+					drop = "ALL"
+				}
+				if csc.Capabilities == nil || len(csc.Capabilities.Drop) != 1 || csc.Capabilities.Drop[0] != drop {
+					t.Errorf("%v %v/%v: capabilities %+v, want %v dropped", profile, name, c.Name, csc.Capabilities, drop)
+				}
+				if name == "foo-kafka" {
+					if csc.ReadOnlyRootFilesystem != nil {
+						t.Errorf("%v %v/%v: kafka can't write its configuration", profile, name, c.Name)
+					}
+				} else if csc.ReadOnlyRootFilesystem == nil || !*csc.ReadOnlyRootFilesystem {
+					t.Errorf("%v %v/%v: root filesystem is writable", profile, name, c.Name)
+				}
+
+				tmp := false
+				for _, m := range c.VolumeMounts {
+					tmp = tmp || m.MountPath == "/tmp" && scratch[m.Name]
+				}
+				if !tmp {
+					t.Errorf("%v %v/%v: /tmp is not a scratch volume", profile, name, c.Name)
+				}
+			}
+		}
+	}
+}
+
+func TestRestrictedProfileKeepsFSGroup(t *testing.T) {
+	pods, _ := renderPods(t, securityTestPlatform(securityProfileRestricted))
+	grafana, ok := pods["foo-grafana"]
+	if !ok {
+		t.Fatal("grafana is not rendered")
+	}
+	sc := grafana.Spec.SecurityContext
+	if *sc.FSGroup != 472 || *sc.RunAsUser != 472 {
+		t.Errorf("grafana runs as %v with fsGroup %v, want 472", *sc.RunAsUser, *sc.FSGroup)
+	}
+}
+
+func TestSecureWorkloadWithToken(t *testing.T) {
+	for _, profile := range []string{"", securityProfileRestricted} {
+		template := &corev1.PodTemplateSpec{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "kubectl"}}}}
+		secureWorkloadWithToken(securityTestPlatform(profile), "foo-kubectl", template)
+		if template.Spec.ServiceAccountName != "foo-kubectl" {
+			t.Errorf("%q: runs as %q", profile, template.Spec.ServiceAccountName)
+		}
+		if automount := template.Spec.AutomountServiceAccountToken; automount == nil || !*automount {
+			t.Errorf("%q: token isn't mounted", profile)
+		}
+		if hardened := template.Spec.Containers[0].SecurityContext != nil; hardened != (profile != "") {
+			t.Errorf("%q: hardened %v", profile, hardened)
+		}
+	}
+}
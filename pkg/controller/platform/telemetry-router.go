@@ -37,23 +37,18 @@ func (r *ReconcilePlatform) reconcileTelemetryRouter(request reconcile.Request,
 					Containers: []corev1.Container{
 						{
 							Name:            "telemetry-router",
-							Image:           "quay.io/infinimesh/telemetry-router:latest",
-							ImagePullPolicy: corev1.PullAlways,
-							VolumeMounts: []corev1.VolumeMount{
+							Image:           image(instance, "telemetry-router"),
+							ImagePullPolicy: imagePullPolicy(instance, "telemetry-router"),
+							VolumeMounts: append([]corev1.VolumeMount{
 								{
 									Name:      "cert",
 									MountPath: "/cert",
 								},
-							},
-							Env: []corev1.EnvVar{
-								{
-									Name:  "KAFKA_HOST",
-									Value: instance.Spec.Kafka.BootstrapServers,
-								},
-							},
+							}, kafkaVolumeMounts(instance)...),
+							Env: kafkaEnv(instance),
 						},
 					},
-					Volumes: []corev1.Volume{
+					Volumes: append([]corev1.Volume{
 						{
 							Name: "cert",
 							VolumeSource: corev1.VolumeSource{
@@ -62,12 +57,16 @@ func (r *ReconcilePlatform) reconcileTelemetryRouter(request reconcile.Request,
 								},
 							},
 						},
-					},
+					}, kafkaVolumes(instance)...),
 				},
 			},
 		},
 	}
 
+	if err := r.secureWorkload(instance, deploy.Name, &deploy.Spec.Template); err != nil {
+		return err
+	}
+
 	if err := controllerutil.SetControllerReference(instance, deploy, r.scheme); err != nil {
 		return err
 	}
@@ -0,0 +1,322 @@
+package platform
+
+import (
+	"context"
+	"encoding/base64"
+	"reflect"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+)
+
+const (
+	timescaleDBBackendNative = "native"
+	timescaleDBBackendKubeDB = "kubedb"
+
+	timescaleDBDefaultStorage = "50Gi"
+	// timescaleDBImage runs the native TimescaleDB and the psql jobs
+	timescaleDBImage = "timescale/timescaledb:2.1.0-pg12"
+)
+
+// kubedbVersions are the KubeDB API versions serving the Postgres kind, newest first.
+var kubedbVersions = []string{"v1alpha2", "v1alpha1"}
+
+func timescaleDB(instance *infinimeshv1beta1.Platform) infinimeshv1beta1.PlatformTimescaleDB {
+	if instance.Spec.Timeseries.TimescaleDB == nil {
+		return infinimeshv1beta1.PlatformTimescaleDB{}
+	}
+	return *instance.Spec.Timeseries.TimescaleDB
+}
+
+func timescaleDBStorage(instance *infinimeshv1beta1.Platform) corev1.PersistentVolumeClaimSpec {
+	if storage := timescaleDB(instance).Storage; storage != nil {
+		return *storage
+	}
+	return corev1.PersistentVolumeClaimSpec{
+		AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(timescaleDBDefaultStorage)},
+		},
+	}
+}
+
+// reconcileTimescaleDB deploys the database of the timeseries stack. Both backends expose
+// the database as the <platform>-timescaledb service with the credentials in the
+// <platform>-timescaledb-auth Secret.
+func (r *ReconcilePlatform) reconcileTimescaleDB(instance *infinimeshv1beta1.Platform) error {
+	log := logger.WithName("timescaledb")
+
+	if timescaleDB(instance).Backend == timescaleDBBackendKubeDB {
+		kubedbVersion, err := r.detectKubeDB(instance)
+		if err != nil {
+			return err
+		}
+		if kubedbVersion != "" {
+			return r.reconcileKubeDBTimescaleDB(instance, kubedbVersion)
+		}
+		log.Info("KubeDB is not installed, falling back to the native backend")
+	}
+
+	return r.reconcileNativeTimescaleDB(instance)
+}
+
+// detectKubeDB returns the KubeDB API version serving Postgres, or "" if KubeDB is not installed.
+func (r *ReconcilePlatform) detectKubeDB(instance *infinimeshv1beta1.Platform) (string, error) {
+	for _, version := range kubedbVersions {
+		probe := &unstructured.Unstructured{}
+		probe.SetAPIVersion("kubedb.com/" + version)
+		probe.SetKind("Postgres")
+		err := r.Get(context.TODO(), types.NamespacedName{Name: instance.Name + "-timescaledb", Namespace: instance.Namespace}, probe)
+		if err != nil && meta.IsNoMatchError(err) {
+			continue
+		} else if err != nil && !errors.IsNotFound(err) {
+			return "", err
+		}
+		return version, nil
+	}
+	return "", nil
+}
+
+func (r *ReconcilePlatform) reconcileKubeDBTimescaleDB(instance *infinimeshv1beta1.Platform, kubedbVersion string) error {
+	log := logger.WithName("timescaledb")
+
+	pvcSpec := timescaleDBStorage(instance)
+	storage, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&pvcSpec)
+	if err != nil {
+		return err
+	}
+	if _, ok := storage["storageClassName"]; !ok {
+		storage["storageClassName"] = "standard"
+	}
+
+	pg := &unstructured.Unstructured{}
+	pg.Object = map[string]interface{}{
+		"kind":       "Postgres",
+		"apiVersion": "kubedb.com/" + kubedbVersion,
+		"metadata": map[string]interface{}{
+			"name":      instance.Name + "-timescaledb",
+			"namespace": instance.Namespace,
+		},
+		"spec": map[string]interface{}{
+			"version":           "11.1-v1",
+			"storageType":       "Durable",
+			"storage":           storage,
+			"terminationPolicy": "DoNotTerminate",
+		},
+	}
+	if err := controllerutil.SetControllerReference(instance, pg, r.scheme); err != nil {
+		return err
+	}
+
+	foundPg := &unstructured.Unstructured{}
+	foundPg.Object = map[string]interface{}{
+		"apiVersion": "kubedb.com/" + kubedbVersion,
+		"kind":       "Postgres",
+	}
+
+	err = r.Get(context.TODO(), types.NamespacedName{Name: pg.GetName(), Namespace: pg.GetNamespace()}, foundPg)
+	if err != nil && errors.IsNotFound(err) {
+		log.Info("Creating Database", "namespace", pg.GetNamespace(), "name", pg.GetName())
+		err = r.Create(context.TODO(), pg)
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *ReconcilePlatform) reconcileNativeTimescaleDB(instance *infinimeshv1beta1.Platform) error {
+	log := logger.WithName("timescaledb")
+	name := instance.Name + "-timescaledb"
+
+	randomKey, err := GenerateRandomBytes(32)
+	if err != nil {
+		return err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name + "-auth",
+			Namespace: instance.Namespace,
+		},
+		StringData: map[string]string{
+			"POSTGRES_USER":     "postgres",
+			"POSTGRES_PASSWORD": base64.RawURLEncoding.EncodeToString(randomKey),
+		},
+	}
+
+	if err := controllerutil.SetControllerReference(instance, secret, r.scheme); err != nil {
+		return err
+	}
+
+	foundSecret := &corev1.Secret{}
+	err = r.Get(context.TODO(), types.NamespacedName{Name: secret.Name, Namespace: secret.Namespace}, foundSecret)
+	if err != nil && errors.IsNotFound(err) {
+		log.Info("Creating Secret", "namespace", secret.Namespace, "name", secret.Name)
+		err = r.Create(context.TODO(), secret)
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: instance.Namespace,
+			Labels: map[string]string{
+				"app": name,
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			Type:     corev1.ServiceTypeClusterIP,
+			Selector: map[string]string{"app": name},
+			Ports: []corev1.ServicePort{
+				{
+					Protocol:   corev1.ProtocolTCP,
+					Port:       5432,
+					TargetPort: intstr.FromInt(5432),
+					Name:       "postgres",
+				},
+			},
+		},
+	}
+
+	if err := controllerutil.SetControllerReference(instance, svc, r.scheme); err != nil {
+		return err
+	}
+
+	foundSvc := &corev1.Service{}
+	err = r.Get(context.TODO(), types.NamespacedName{Name: svc.Name, Namespace: svc.Namespace}, foundSvc)
+	if err != nil && errors.IsNotFound(err) {
+		log.Info("Creating Service", "namespace", svc.Namespace, "name", svc.Name)
+		err = r.Create(context.TODO(), svc)
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	replicas := int32(1)
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: instance.Namespace,
+		},
+		Spec: appsv1.StatefulSetSpec{
+			ServiceName: name,
+			Replicas:    &replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": name},
+			},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": name}},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name:            "timescaledb",
+							Image:           timescaleDBImage,
+							ImagePullPolicy: corev1.PullIfNotPresent,
+							Ports: []corev1.ContainerPort{
+								{
+									ContainerPort: 5432,
+									Name:          "postgres",
+								},
+							},
+							EnvFrom: []corev1.EnvFromSource{
+								{
+									SecretRef: &corev1.SecretEnvSource{
+										LocalObjectReference: corev1.LocalObjectReference{
+											Name: secret.Name,
+										},
+									},
+								},
+							},
+							Env: []corev1.EnvVar{
+								{
+									Name:  "PGDATA",
+									Value: "/var/lib/postgresql/data/pgdata",
+								},
+							},
+							VolumeMounts: []corev1.VolumeMount{
+								{
+									Name:      "datadir",
+									MountPath: "/var/lib/postgresql/data",
+								},
+							},
+							ReadinessProbe: &corev1.Probe{
+								Handler: corev1.Handler{
+									Exec: &corev1.ExecAction{
+										Command: []string{"sh", "-c", `pg_isready -U "$POSTGRES_USER"`},
+									},
+								},
+								InitialDelaySeconds: 5,
+								PeriodSeconds:       10,
+							},
+						},
+					},
+					TerminationGracePeriodSeconds: func() *int64 { val := int64(60); return &val }(),
+				},
+			},
+			UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
+				Type: "RollingUpdate",
+			},
+			VolumeClaimTemplates: []corev1.PersistentVolumeClaim{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "datadir",
+					},
+					Spec: timescaleDBStorage(instance),
+				},
+			},
+		},
+	}
+
+	if err := r.secureWorkload(instance, sts.Name, &sts.Spec.Template, "/var/run/postgresql"); err != nil {
+		return err
+	}
+
+	if err := controllerutil.SetControllerReference(instance, sts, r.scheme); err != nil {
+		return err
+	}
+
+	foundS := &appsv1.StatefulSet{}
+	err = r.Get(context.TODO(), types.NamespacedName{Name: sts.Name, Namespace: sts.Namespace}, foundS)
+	if err != nil && errors.IsNotFound(err) {
+		log.Info("Creating statefulset", "namespace", sts.Namespace, "name", sts.Name)
+		err = r.Create(context.TODO(), sts)
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	} else {
+		// Volume claim templates are immutable, only roll out pod changes
+		if !reflect.DeepEqual(sts.Spec.Template, foundS.Spec.Template) {
+			foundS.Spec.Template = sts.Spec.Template
+			log.Info("Updating statefulset", "namespace", sts.Namespace, "name", sts.Name)
+			err = r.Update(context.TODO(), foundS)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
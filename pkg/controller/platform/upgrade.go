@@ -0,0 +1,466 @@
+package platform
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+)
+
+const (
+	defaultVersion         = "latest"
+	defaultUpgradeTimeout  = 10 * time.Minute
+	upgradeRequeueInterval = 10 * time.Second
+	maxUpgradeHistory      = 10
+
+	upgradePhasePre     = "pre"
+	upgradePhaseRollout = "rollout"
+	upgradePhasePost    = "post"
+)
+
+// upgradeSteps are the steps of an upgrade in the order they are rolled out. No image belongs
+// to schema, it only runs its hooks, e.g. to migrate dgraph before anything is rolled out.
+var upgradeSteps = []string{"schema", "dgraph", "backends", "apis", "frontend"}
+
+// imageSteps maps the repositories of the platform's images to the step upgrading them. The
+// infinimesh images are tagged with the version of the platform.
+var imageSteps = map[string]string{
+	"dgraph/dgraph":                          "dgraph",
+	"quay.io/infinimesh/device-registry":     "backends",
+	"quay.io/infinimesh/nodeserver":          "backends",
+	"quay.io/infinimesh/telemetry-router":    "backends",
+	"quay.io/infinimesh/mqtt-bridge":         "backends",
+	"quay.io/infinimesh/timescale-connector": "backends",
+	"quay.io/infinimesh/shadow-delta-merger": "backends",
+	"quay.io/infinimesh/shadow-persister":    "backends",
+	"quay.io/infinimesh/shadow-api":          "backends",
+	"quay.io/infinimesh/apiserver":           "apis",
+	"quay.io/infinimesh/apiserver-rest":      "apis",
+	"quay.io/infinimesh/grafana-proxy":       "apis",
+	"quay.io/infinimesh/frontend":            "frontend",
+}
+
+// imageComponents maps the repositories of the platform's images to the component deploying
+// them.
+var imageComponents = map[string]string{
+	"dgraph/dgraph":                          "dgraph",
+	"quay.io/infinimesh/device-registry":     "device-registry",
+	"quay.io/infinimesh/nodeserver":          "nodeserver",
+	"quay.io/infinimesh/telemetry-router":    "telemetry-router",
+	"quay.io/infinimesh/mqtt-bridge":         "mqtt-bridge",
+	"quay.io/infinimesh/timescale-connector": "timeseries",
+	"quay.io/infinimesh/shadow-delta-merger": "twin",
+	"quay.io/infinimesh/shadow-persister":    "twin",
+	"quay.io/infinimesh/shadow-api":          "twin",
+	"quay.io/infinimesh/apiserver":           "apiserver",
+	"quay.io/infinimesh/apiserver-rest":      "apiserver-rest",
+	"quay.io/infinimesh/grafana-proxy":       "timeseries",
+	"quay.io/infinimesh/frontend":            "frontend",
+}
+
+// platformVersion returns the version instance should run.
+func platformVersion(instance *infinimeshv1beta1.Platform) string {
+	if instance.Spec.Version == "" {
+		return defaultVersion
+	}
+	return instance.Spec.Version
+}
+
+func stepIndex(step string) int {
+	for i, s := range upgradeSteps {
+		if s == step {
+			return i
+		}
+	}
+	return -1
+}
+
+// stepVersion returns the version the workloads of step run: the target version once an
+// upgrade rolled the step out, the current version before.
+func stepVersion(instance *infinimeshv1beta1.Platform, step string) string {
+	status := instance.Status
+	if status.CurrentVersion == "" {
+		return platformVersion(instance)
+	}
+	if status.TargetVersion == "" || status.Upgrade == nil {
+		return status.CurrentVersion
+	}
+	current := stepIndex(status.Upgrade.Step)
+	if i := stepIndex(step); i < current || i == current && status.Upgrade.Phase != upgradePhasePre {
+		return status.TargetVersion
+	}
+	return status.CurrentVersion
+}
+
+// image returns the image of the infinimesh component name, tagged with the version its
+// upgrade step is at.
+func image(instance *infinimeshv1beta1.Platform, name string) string {
+	repository := "quay.io/infinimesh/" + name
+	return repository + ":" + stepVersion(instance, imageSteps[repository])
+}
+
+// imagePullPolicy pulls the image of name on every start only while it is unversioned.
+func imagePullPolicy(instance *infinimeshv1beta1.Platform, name string) corev1.PullPolicy {
+	if stepVersion(instance, imageSteps["quay.io/infinimesh/"+name]) == defaultVersion {
+		return corev1.PullAlways
+	}
+	return corev1.PullIfNotPresent
+}
+
+// reconcileUpgrade moves the upgrade to the version of instance forward by at most one phase of
+// a step and reports whether it is still in progress. The components are reconciled afterwards
+// with the images of the steps rolled out so far. A failed step pauses the platform.
+func (r *ReconcilePlatform) reconcileUpgrade(instance *infinimeshv1beta1.Platform) (bool, error) {
+	status := &instance.Status
+	target := platformVersion(instance)
+
+	if status.CurrentVersion == "" {
+		// New platforms, and platforms created by older operators, start at their version
+		status.CurrentVersion = target
+		return false, nil
+	}
+
+	if status.TargetVersion != "" && status.TargetVersion != target {
+		r.finishUpgrade(instance, "Superseded", "Version changed to "+target)
+	}
+
+	if status.TargetVersion == "" {
+		if status.CurrentVersion == target {
+			return false, nil
+		}
+		now := metav1.Now()
+		status.TargetVersion = target
+		status.Upgrade = &infinimeshv1beta1.PlatformUpgradeStatus{
+			Step:          upgradeSteps[0],
+			Phase:         upgradePhasePre,
+			StartedAt:     now,
+			StepStartedAt: now,
+		}
+		r.recorder.Eventf(instance, corev1.EventTypeNormal, "UpgradeStarted", "Upgrading from %v to %v", status.CurrentVersion, target)
+	}
+
+	upgrade := status.Upgrade
+	if upgrade.Failed != "" {
+		// The platform was unpaused after the failure, retry the step
+		upgrade.Failed = ""
+		upgrade.Attempt++
+		upgrade.StepStartedAt = metav1.Now()
+		r.recorder.Eventf(instance, corev1.EventTypeNormal, "UpgradeResumed", "Retrying step %v of the upgrade to %v", upgrade.Step, target)
+		if err := r.deleteFailedUpgradeHooks(instance, upgrade.Step, upgrade.Phase); err != nil {
+			return true, err
+		}
+	}
+
+	timeout, err := upgradeStepTimeout(instance)
+	if err != nil {
+		return true, err
+	}
+
+	for {
+		var done bool
+		var err error
+		switch upgrade.Phase {
+		case upgradePhasePre, upgradePhasePost:
+			done, err = r.reconcileUpgradeHooks(instance, upgrade.Step, upgrade.Phase)
+		case upgradePhaseRollout:
+			done, err = r.upgradeStepReady(instance, upgrade.Step)
+		}
+		if err != nil {
+			if _, ok := err.(upgradeError); ok {
+				return true, r.failUpgrade(instance, err.Error())
+			}
+			return true, err
+		}
+		if !done {
+			if time.Since(upgrade.StepStartedAt.Time) > timeout {
+				return true, r.failUpgrade(instance, fmt.Sprintf("Step %v did not finish within %v", upgrade.Step, timeout))
+			}
+			return true, nil
+		}
+
+		switch upgrade.Phase {
+		case upgradePhasePre:
+			// Let the components roll the step out before checking it
+			upgrade.Phase = upgradePhaseRollout
+			logger.Info("Rolling out upgrade step", "namespace", instance.Namespace, "name", instance.Name, "step", upgrade.Step, "version", target)
+			return true, nil
+		case upgradePhaseRollout:
+			upgrade.Phase = upgradePhasePost
+		case upgradePhasePost:
+			next := stepIndex(upgrade.Step) + 1
+			if next == len(upgradeSteps) {
+				r.finishUpgrade(instance, "Succeeded", "")
+				return false, nil
+			}
+			upgrade.Step = upgradeSteps[next]
+			upgrade.Phase = upgradePhasePre
+			upgrade.StepStartedAt = metav1.Now()
+		}
+	}
+}
+
+func upgradeStepTimeout(instance *infinimeshv1beta1.Platform) (time.Duration, error) {
+	if instance.Spec.Upgrade.StepTimeout == "" {
+		return defaultUpgradeTimeout, nil
+	}
+	return time.ParseDuration(instance.Spec.Upgrade.StepTimeout)
+}
+
+// upgradeError fails the upgrade instead of being retried.
+type upgradeError string
+
+func (e upgradeError) Error() string {
+	return string(e)
+}
+
+// finishUpgrade records the upgrade to the target version in the history. Only a successful
+// upgrade changes the current version.
+func (r *ReconcilePlatform) finishUpgrade(instance *infinimeshv1beta1.Platform, result, message string) {
+	status := &instance.Status
+	record := recordUpgrade(status, result, message)
+	if result == "Succeeded" {
+		status.CurrentVersion = status.TargetVersion
+		r.recorder.Eventf(instance, corev1.EventTypeNormal, "UpgradeSucceeded", "Upgraded from %v to %v", record.From, record.To)
+	} else {
+		r.recorder.Eventf(instance, corev1.EventTypeNormal, "Upgrade"+result, "Upgrade from %v to %v: %v", record.From, record.To, message)
+	}
+	status.TargetVersion = ""
+	status.Upgrade = nil
+}
+
+// recordUpgrade appends the upgrade to the target version to the history of status.
+func recordUpgrade(status *infinimeshv1beta1.PlatformStatus, result, message string) infinimeshv1beta1.PlatformUpgradeRecord {
+	record := infinimeshv1beta1.PlatformUpgradeRecord{
+		From:       status.CurrentVersion,
+		To:         status.TargetVersion,
+		StartedAt:  status.Upgrade.StartedAt,
+		FinishedAt: metav1.Now(),
+		Result:     result,
+		Message:    message,
+	}
+	status.UpgradeHistory = append(status.UpgradeHistory, record)
+	if len(status.UpgradeHistory) > maxUpgradeHistory {
+		status.UpgradeHistory = status.UpgradeHistory[len(status.UpgradeHistory)-maxUpgradeHistory:]
+	}
+	return record
+}
+
+// failUpgrade pauses instance, the upgrade resumes at the failed step once it is unpaused.
+func (r *ReconcilePlatform) failUpgrade(instance *infinimeshv1beta1.Platform, reason string) error {
+	status := instance.Status.DeepCopy()
+	status.Upgrade.Failed = reason
+	status.Paused = true
+	recordUpgrade(status, "Failed", reason)
+
+	logger.Info("Upgrade failed, pausing the platform", "namespace", instance.Namespace, "name", instance.Name, "reason", reason)
+	r.recorder.Eventf(instance, corev1.EventTypeWarning, "UpgradeFailed", "Upgrade to %v failed, pausing the platform: %v", status.TargetVersion, reason)
+
+	if instance.Annotations == nil {
+		instance.Annotations = map[string]string{}
+	}
+	instance.Annotations[pausedAnnotation] = "true"
+	// Update returns the stored status, keep ours to be written by the caller
+	err := r.Update(context.TODO(), instance)
+	instance.Status = *status
+	return err
+}
+
+// upgradeHookJobName is unique per hook and upgrade so each upgrade runs its hooks once.
+func upgradeHookJobName(instance *infinimeshv1beta1.Platform, hook infinimeshv1beta1.PlatformUpgradeHook) string {
+	upgrade := fmt.Sprintf("%x", sha256.Sum256([]byte(instance.Status.CurrentVersion+"->"+instance.Status.TargetVersion)))[:8]
+	return fmt.Sprintf("%v-upgrade-%v-%v", instance.Name, hook.Name, upgrade)
+}
+
+// hookFailed returns the reason job failed, if it did.
+func hookFailed(job *batchv1.Job) (string, bool) {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue {
+			return condition.Message, true
+		}
+	}
+	return "", false
+}
+
+// deleteFailedUpgradeHooks deletes the failed Jobs of the hooks of step and phase so they are run
+// again.
+func (r *ReconcilePlatform) deleteFailedUpgradeHooks(instance *infinimeshv1beta1.Platform, step, phase string) error {
+	for _, hook := range instance.Spec.Upgrade.Hooks {
+		if hook.Step != step || hook.Phase != phase {
+			continue
+		}
+		found := &batchv1.Job{}
+		err := r.Get(context.TODO(), types.NamespacedName{Name: upgradeHookJobName(instance, hook), Namespace: instance.Namespace}, found)
+		if err != nil && errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if _, failed := hookFailed(found); !failed {
+			continue
+		}
+		logger.Info("Deleting failed Job", "namespace", found.Namespace, "name", found.Name)
+		err = r.Delete(context.TODO(), found, client.PropagationPolicy(metav1.DeletePropagationBackground))
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// reconcileUpgradeHooks runs the hooks of step and phase one after the other and reports
+// whether all of them succeeded.
+func (r *ReconcilePlatform) reconcileUpgradeHooks(instance *infinimeshv1beta1.Platform, step, phase string) (bool, error) {
+	log := logger.WithName("upgrade")
+	for _, hook := range instance.Spec.Upgrade.Hooks {
+		if hook.Step != step || hook.Phase != phase {
+			continue
+		}
+
+		jobName := upgradeHookJobName(instance, hook)
+		backoffLimit := int32(2)
+		env := append([]corev1.EnvVar{
+			{Name: "UPGRADE_FROM", Value: instance.Status.CurrentVersion},
+			{Name: "UPGRADE_TO", Value: instance.Status.TargetVersion},
+		}, hook.Env...)
+		job := &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      jobName,
+				Namespace: instance.Namespace,
+			},
+			Spec: batchv1.JobSpec{
+				BackoffLimit: &backoffLimit,
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"job": jobName}},
+					Spec: corev1.PodSpec{
+						RestartPolicy: corev1.RestartPolicyNever,
+						Containers: []corev1.Container{
+							{
+								Name:    hook.Name,
+								Image:   hook.Image,
+								Command: hook.Command,
+								Args:    hook.Args,
+								Env:     env,
+							},
+						},
+					},
+				},
+			},
+		}
+
+		if err := r.secureWorkload(instance, instance.Name+"-upgrade-hooks", &job.Spec.Template); err != nil {
+			return false, err
+		}
+
+		if err := controllerutil.SetControllerReference(instance, job, r.scheme); err != nil {
+			return false, err
+		}
+
+		found := &batchv1.Job{}
+		err := r.Get(context.TODO(), types.NamespacedName{Name: job.Name, Namespace: job.Namespace}, found)
+		if err != nil && errors.IsNotFound(err) {
+			log.Info("Creating Job", "namespace", job.Namespace, "name", job.Name)
+			return false, r.Create(context.TODO(), job)
+		} else if err != nil {
+			return false, err
+		}
+
+		if found.DeletionTimestamp != nil {
+			// A failed run being deleted before the retry
+			return false, nil
+		}
+		if message, failed := hookFailed(found); failed {
+			return false, upgradeError(fmt.Sprintf("Hook %v failed: %v", hook.Name, message))
+		}
+		if found.Status.Succeeded == 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// upgradeStepReady reports whether the Deployments and StatefulSets of instance running images
+// of step run the version of the step and are ready.
+func (r *ReconcilePlatform) upgradeStepReady(instance *infinimeshv1beta1.Platform, step string) (bool, error) {
+	opts := &client.ListOptions{Namespace: instance.Namespace}
+
+	deployments := &appsv1.DeploymentList{}
+	if err := r.List(context.TODO(), opts, deployments); err != nil {
+		return false, err
+	}
+	for _, deploy := range deployments.Items {
+		runs, updated := stepImages(instance, deploy.Spec.Template.Spec, step)
+		if !metav1.IsControlledBy(&deploy, instance) || !runs {
+			continue
+		}
+		if !updated {
+			return false, nil
+		}
+		replicas := int32(1)
+		if deploy.Spec.Replicas != nil {
+			replicas = *deploy.Spec.Replicas
+		}
+		if deploy.Status.ObservedGeneration < deploy.Generation ||
+			deploy.Status.UpdatedReplicas != replicas ||
+			deploy.Status.Replicas != replicas ||
+			deploy.Status.AvailableReplicas != replicas {
+			return false, nil
+		}
+	}
+
+	statefulSets := &appsv1.StatefulSetList{}
+	if err := r.List(context.TODO(), opts, statefulSets); err != nil {
+		return false, err
+	}
+	for _, sts := range statefulSets.Items {
+		runs, updated := stepImages(instance, sts.Spec.Template.Spec, step)
+		if !metav1.IsControlledBy(&sts, instance) || !runs {
+			continue
+		}
+		if !updated {
+			return false, nil
+		}
+		replicas := int32(1)
+		if sts.Spec.Replicas != nil {
+			replicas = *sts.Spec.Replicas
+		}
+		if sts.Status.ObservedGeneration < sts.Generation ||
+			sts.Status.UpdateRevision != sts.Status.CurrentRevision ||
+			sts.Status.ReadyReplicas != replicas {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// stepImages reports whether spec has containers upgraded by step, and whether their infinimesh
+// images are of the target version. An outdated image means the update isn't in the cache yet.
+// Unmanaged components aren't rolled out by the operator, so their containers are ignored.
+func stepImages(instance *infinimeshv1beta1.Platform, spec corev1.PodSpec, step string) (runs bool, updated bool) {
+	updated = true
+	for _, container := range spec.Containers {
+		repository := container.Image
+		if i := strings.LastIndex(repository, ":"); i > strings.LastIndex(repository, "/") {
+			repository = repository[:i]
+		}
+		if imageSteps[repository] != step || unmanaged(instance, imageComponents[repository]) {
+			continue
+		}
+		runs = true
+		if strings.HasPrefix(repository, "quay.io/infinimesh/") && container.Image != repository+":"+instance.Status.TargetVersion {
+			updated = false
+		}
+	}
+	return runs, updated
+}
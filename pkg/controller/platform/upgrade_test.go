@@ -0,0 +1,308 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package platform
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+)
+
+func TestStepVersion(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		status  infinimeshv1beta1.PlatformStatus
+		step    string
+		version string
+	}{
+		{"new platform", infinimeshv1beta1.PlatformStatus{}, "apis", "v2"},
+		{"no upgrade", infinimeshv1beta1.PlatformStatus{CurrentVersion: "v1"}, "apis", "v1"},
+		{"earlier step", upgradeStatus("backends", upgradePhasePre), "dgraph", "v2"},
+		{"step before rollout", upgradeStatus("backends", upgradePhasePre), "backends", "v1"},
+		{"step rolling out", upgradeStatus("backends", upgradePhaseRollout), "backends", "v2"},
+		{"step after rollout", upgradeStatus("backends", upgradePhasePost), "backends", "v2"},
+		{"later step", upgradeStatus("backends", upgradePhasePost), "apis", "v1"},
+	} {
+		instance := &infinimeshv1beta1.Platform{Status: test.status}
+		instance.Spec.Version = "v2"
+		if version := stepVersion(instance, test.step); version != test.version {
+			t.Errorf("%v: %v runs %v, want %v", test.name, test.step, version, test.version)
+		}
+	}
+}
+
+func upgradeStatus(step, phase string) infinimeshv1beta1.PlatformStatus {
+	return infinimeshv1beta1.PlatformStatus{
+		CurrentVersion: "v1",
+		TargetVersion:  "v2",
+		Upgrade:        &infinimeshv1beta1.PlatformUpgradeStatus{Step: step, Phase: phase},
+	}
+}
+
+// upgradeTestPlatform returns a reconciler and a platform at v1 being upgraded to v2, stored in
+// the reconciler's client.
+func upgradeTestPlatform(t *testing.T, hooks ...infinimeshv1beta1.PlatformUpgradeHook) (*ReconcilePlatform, *infinimeshv1beta1.Platform) {
+	instance := &infinimeshv1beta1.Platform{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default", UID: "foo"}}
+	instance.Spec.Version = "v2"
+	instance.Spec.Upgrade.Hooks = hooks
+	instance.Status.CurrentVersion = "v1"
+
+	c := newMemoryClient(scheme.Scheme)
+	if err := c.Create(context.TODO(), instance); err != nil {
+		t.Fatal(err)
+	}
+	return &ReconcilePlatform{Client: c, scheme: scheme.Scheme, recorder: record.NewFakeRecorder(100)}, instance
+}
+
+// expectUpgrade reconciles the upgrade of instance and expects it at step and phase.
+func expectUpgrade(t *testing.T, r *ReconcilePlatform, instance *infinimeshv1beta1.Platform, step, phase string) {
+	t.Helper()
+	upgrading, err := r.reconcileUpgrade(instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !upgrading || instance.Status.Upgrade == nil {
+		t.Fatalf("upgrade finished, want it at %v/%v", step, phase)
+	}
+	if upgrade := instance.Status.Upgrade; upgrade.Step != step || upgrade.Phase != phase {
+		t.Fatalf("upgrade at %v/%v, want %v/%v", upgrade.Step, upgrade.Phase, step, phase)
+	}
+}
+
+func hookJob(t *testing.T, r *ReconcilePlatform, instance *infinimeshv1beta1.Platform, hook infinimeshv1beta1.PlatformUpgradeHook) *batchv1.Job {
+	t.Helper()
+	job := &batchv1.Job{}
+	key := types.NamespacedName{Name: upgradeHookJobName(instance, hook), Namespace: instance.Namespace}
+	if err := r.Get(context.TODO(), key, job); err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+func TestReconcileUpgradeSteps(t *testing.T) {
+	r, instance := upgradeTestPlatform(t)
+
+	// Without hooks or workloads every pass rolls out a step
+	for _, step := range upgradeSteps {
+		expectUpgrade(t, r, instance, step, upgradePhaseRollout)
+		if instance.Status.TargetVersion != "v2" || instance.Status.CurrentVersion != "v1" {
+			t.Fatalf("upgrading from %v to %v", instance.Status.CurrentVersion, instance.Status.TargetVersion)
+		}
+	}
+	upgrading, err := r.reconcileUpgrade(instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upgrading || instance.Status.Upgrade != nil || instance.Status.TargetVersion != "" {
+		t.Fatalf("upgrade didn't finish: %+v", instance.Status)
+	}
+	if instance.Status.CurrentVersion != "v2" {
+		t.Errorf("current version is %v", instance.Status.CurrentVersion)
+	}
+	history := instance.Status.UpgradeHistory
+	if len(history) != 1 || history[0].From != "v1" || history[0].To != "v2" || history[0].Result != "Succeeded" {
+		t.Errorf("history = %+v", history)
+	}
+
+	// Nothing happens until the version changes again
+	upgrading, err = r.reconcileUpgrade(instance)
+	if err != nil || upgrading {
+		t.Errorf("upgrading %v: %v", upgrading, err)
+	}
+}
+
+func TestReconcileUpgradeNewPlatform(t *testing.T) {
+	r, instance := upgradeTestPlatform(t)
+	instance.Status.CurrentVersion = ""
+
+	upgrading, err := r.reconcileUpgrade(instance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if upgrading || instance.Status.CurrentVersion != "v2" || instance.Status.Upgrade != nil {
+		t.Errorf("new platform is upgraded: %+v", instance.Status)
+	}
+}
+
+func TestReconcileUpgradeHooks(t *testing.T) {
+	pre := infinimeshv1beta1.PlatformUpgradeHook{Name: "migrate", Step: "schema", Phase: upgradePhasePre, Image: "migrate"}
+	post := infinimeshv1beta1.PlatformUpgradeHook{Name: "check", Step: "schema", Phase: upgradePhasePost, Image: "check"}
+	r, instance := upgradeTestPlatform(t, pre, post)
+
+	// The pre hook runs before the step is rolled out
+	expectUpgrade(t, r, instance, "schema", upgradePhasePre)
+	job := hookJob(t, r, instance, pre)
+	env := job.Spec.Template.Spec.Containers[0].Env
+	if len(env) != 2 || env[0].Value != "v1" || env[1].Value != "v2" {
+		t.Errorf("hook env = %v", env)
+	}
+	expectUpgrade(t, r, instance, "schema", upgradePhasePre)
+
+	job.Status.Succeeded = 1
+	if err := r.Update(context.TODO(), job); err != nil {
+		t.Fatal(err)
+	}
+	expectUpgrade(t, r, instance, "schema", upgradePhaseRollout)
+
+	// The post hook runs once the step is ready
+	expectUpgrade(t, r, instance, "schema", upgradePhasePost)
+	job = hookJob(t, r, instance, post)
+	job.Status.Succeeded = 1
+	if err := r.Update(context.TODO(), job); err != nil {
+		t.Fatal(err)
+	}
+	expectUpgrade(t, r, instance, "dgraph", upgradePhaseRollout)
+}
+
+func TestReconcileUpgradeFailedHook(t *testing.T) {
+	pre := infinimeshv1beta1.PlatformUpgradeHook{Name: "migrate", Step: "backends", Phase: upgradePhasePre, Image: "migrate"}
+	r, instance := upgradeTestPlatform(t, pre)
+	for _, step := range []string{"schema", "dgraph"} {
+		expectUpgrade(t, r, instance, step, upgradePhaseRollout)
+	}
+	expectUpgrade(t, r, instance, "backends", upgradePhasePre)
+
+	job := hookJob(t, r, instance, pre)
+	job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Message: "BackoffLimitExceeded"}}
+	if err := r.Update(context.TODO(), job); err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed hook pauses the platform at its step
+	expectUpgrade(t, r, instance, "backends", upgradePhasePre)
+	if !instance.Status.Paused || instance.Status.Upgrade.Failed == "" {
+		t.Fatalf("upgrade isn't paused: %+v", instance.Status)
+	}
+	stored := &infinimeshv1beta1.Platform{}
+	if err := r.Get(context.TODO(), types.NamespacedName{Name: "foo", Namespace: "default"}, stored); err != nil {
+		t.Fatal(err)
+	}
+	if !paused(stored) {
+		t.Error("platform isn't annotated as paused")
+	}
+	history := instance.Status.UpgradeHistory
+	if len(history) != 1 || history[0].Result != "Failed" {
+		t.Errorf("history = %+v", history)
+	}
+	if stepVersion(instance, "backends") != "v1" {
+		t.Error("backends are rolled out although their pre hook failed")
+	}
+
+	// Unpausing retries the step with a new run of the hook
+	expectUpgrade(t, r, instance, "backends", upgradePhasePre)
+	if instance.Status.Upgrade.Failed != "" || instance.Status.Upgrade.Attempt != 1 {
+		t.Errorf("upgrade wasn't resumed: %+v", instance.Status.Upgrade)
+	}
+	if hookJob(t, r, instance, pre).Status.Conditions != nil {
+		t.Error("hook wasn't run again")
+	}
+}
+
+func TestReconcileUpgradeTimeout(t *testing.T) {
+	r, instance := upgradeTestPlatform(t)
+	instance.Spec.Upgrade.StepTimeout = "1m"
+	expectUpgrade(t, r, instance, "schema", upgradePhaseRollout)
+	expectUpgrade(t, r, instance, "dgraph", upgradePhaseRollout)
+
+	// A dgraph node that doesn't get ready
+	sts := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo-dgraph-alpha", Namespace: "default"},
+		Spec: appsv1.StatefulSetSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "alpha", Image: "dgraph/dgraph:v1.0.14"}},
+		}}},
+	}
+	if err := controllerutil.SetControllerReference(instance, sts, scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Create(context.TODO(), sts); err != nil {
+		t.Fatal(err)
+	}
+	expectUpgrade(t, r, instance, "dgraph", upgradePhaseRollout)
+	if instance.Status.Paused {
+		t.Fatal("paused before the timeout")
+	}
+
+	instance.Status.Upgrade.StepStartedAt = metav1.NewTime(time.Now().Add(-2 * time.Minute))
+	expectUpgrade(t, r, instance, "dgraph", upgradePhaseRollout)
+	if !instance.Status.Paused || instance.Status.Upgrade.Failed == "" {
+		t.Errorf("step didn't time out: %+v", instance.Status)
+	}
+}
+
+func TestReconcileUpgradeSuperseded(t *testing.T) {
+	r, instance := upgradeTestPlatform(t)
+	expectUpgrade(t, r, instance, "schema", upgradePhaseRollout)
+	expectUpgrade(t, r, instance, "dgraph", upgradePhaseRollout)
+
+	// A new version restarts the upgrade from the current version
+	instance.Spec.Version = "v3"
+	expectUpgrade(t, r, instance, "schema", upgradePhaseRollout)
+	if instance.Status.CurrentVersion != "v1" || instance.Status.TargetVersion != "v3" {
+		t.Errorf("upgrading from %v to %v", instance.Status.CurrentVersion, instance.Status.TargetVersion)
+	}
+	history := instance.Status.UpgradeHistory
+	if len(history) != 1 || history[0].To != "v2" || history[0].Result != "Superseded" {
+		t.Errorf("history = %+v", history)
+	}
+}
+
+func TestUpgradeStepReadySkipsUnmanaged(t *testing.T) {
+	r, instance := upgradeTestPlatform(t)
+	instance.Status = upgradeStatus("frontend", upgradePhaseRollout)
+
+	// The frontend is left at the old version by whoever manages it
+	deploy := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo-frontend", Namespace: "default"},
+		Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "frontend", Image: "quay.io/infinimesh/frontend:v1"}},
+		}}},
+	}
+	if err := controllerutil.SetControllerReference(instance, deploy, scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Create(context.TODO(), deploy); err != nil {
+		t.Fatal(err)
+	}
+
+	ready, err := r.upgradeStepReady(instance, "frontend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ready {
+		t.Error("outdated frontend is ready")
+	}
+
+	instance.Annotations = map[string]string{unmanagedAnnotationPrefix + "frontend": "true"}
+	ready, err = r.upgradeStepReady(instance, "frontend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ready {
+		t.Error("unmanaged frontend blocks the upgrade")
+	}
+}
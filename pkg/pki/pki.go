@@ -0,0 +1,337 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package pki issues the certificates devices authenticate with at the MQTT bridge.
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+const (
+	// DefaultCAValidity is the lifetime of a CA if none is configured
+	DefaultCAValidity = 10 * 365 * 24 * time.Hour
+	// DefaultValidity is the lifetime of a device certificate if none is requested
+	DefaultValidity = 365 * 24 * time.Hour
+)
+
+// CA is a certificate authority able to sign device certificates.
+type CA struct {
+	Cert *x509.Certificate
+	Key  crypto.Signer
+}
+
+// NewCA creates a self-signed CA valid for validity and returns its PEM encoded certificate and
+// key.
+func NewCA(commonName string, validity time.Duration) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName, Organization: []string{"infinimesh"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err = encodeKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), keyPEM, nil
+}
+
+// LoadCA parses the PEM encoded certificate and key of a CA.
+func LoadCA(certPEM, keyPEM []byte) (*CA, error) {
+	cert, err := ParseCertificate(certPEM)
+	if err != nil {
+		return nil, err
+	}
+	if !cert.IsCA {
+		return nil, errors.New("certificate is not a CA")
+	}
+
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("no PEM encoded key found")
+	}
+	signer, err := parseKey(block)
+	if err != nil {
+		return nil, err
+	}
+	return &CA{Cert: cert, Key: signer}, nil
+}
+
+// Issue signs a client certificate for commonName valid for validity and returns it along with
+// its key, both PEM encoded.
+func (ca *CA) Issue(commonName string, validity time.Duration) (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM, err = ca.IssueFor(commonName, key.Public(), validity)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err = encodeKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return certPEM, keyPEM, nil
+}
+
+// IssueFor signs a client certificate for the public key of commonName valid for validity and
+// returns it PEM encoded. The certificate never outlives the CA.
+func (ca *CA) IssueFor(commonName string, pub crypto.PublicKey, validity time.Duration) ([]byte, error) {
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	notAfter := now.Add(validity)
+	if notAfter.After(ca.Cert.NotAfter) {
+		notAfter = ca.Cert.NotAfter
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Cert, pub, ca.Key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
+
+// CRL returns a PEM encoded revocation list of the CA listing the serial numbers of revoked,
+// valid from now until nextUpdate. Its number is the current time so that a newer list always
+// has a higher number.
+func (ca *CA) CRL(revoked []*big.Int, nextUpdate time.Time) ([]byte, error) {
+	now := time.Now()
+	entries := make([]pkix.RevokedCertificate, len(revoked))
+	for i, serial := range revoked {
+		entries[i] = pkix.RevokedCertificate{SerialNumber: serial, RevocationTime: now}
+	}
+	template := &x509.RevocationList{
+		Number:              big.NewInt(now.Unix()),
+		ThisUpdate:          now,
+		NextUpdate:          nextUpdate,
+		RevokedCertificates: entries,
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, template, ca.Cert, ca.Key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), nil
+}
+
+// ParseCertificateRequest parses a PEM encoded certificate signing request and checks its
+// signature.
+func ParseCertificateRequest(data []byte) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, errors.New("no PEM encoded certificate request found")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	return csr, csr.CheckSignature()
+}
+
+// LoadCAs parses a bundle of PEM encoded CA certificates and their keys in the same order, as
+// written by EncodeCAs.
+func LoadCAs(certPEM, keyPEM []byte) ([]*CA, error) {
+	certs, err := ParseCertificates(certPEM)
+	if err != nil {
+		return nil, err
+	}
+	var keys []crypto.Signer
+	for {
+		var block *pem.Block
+		block, keyPEM = pem.Decode(keyPEM)
+		if block == nil {
+			break
+		}
+		key, err := parseKey(block)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) != len(certs) {
+		return nil, fmt.Errorf("found %v certificates but %v keys", len(certs), len(keys))
+	}
+
+	cas := make([]*CA, len(certs))
+	for i := range certs {
+		cas[i] = &CA{Cert: certs[i], Key: keys[i]}
+	}
+	return cas, nil
+}
+
+// EncodeCAs returns the PEM encoded certificates and keys of cas.
+func EncodeCAs(cas []*CA) (certPEM, keyPEM []byte, err error) {
+	for _, ca := range cas {
+		der, err := x509.MarshalPKCS8PrivateKey(ca.Key)
+		if err != nil {
+			return nil, nil, err
+		}
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Cert.Raw})...)
+		keyPEM = append(keyPEM, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})...)
+	}
+	return certPEM, keyPEM, nil
+}
+
+// ParseCertificate parses the first PEM encoded certificate of data.
+func ParseCertificate(data []byte) (*x509.Certificate, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("no PEM encoded certificate found")
+		}
+		if block.Type == "CERTIFICATE" {
+			return x509.ParseCertificate(block.Bytes)
+		}
+	}
+}
+
+// ParseCertificates parses all PEM encoded certificates of data.
+func ParseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return certs, nil
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+}
+
+// CRL is a parsed revocation list along with its PEM encoding.
+type CRL struct {
+	*pkix.CertificateList
+	PEM []byte
+}
+
+// ParseCRLs parses all PEM encoded revocation lists of data.
+func ParseCRLs(data []byte) ([]CRL, error) {
+	var crls []CRL
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return crls, nil
+		}
+		if block.Type != "X509 CRL" {
+			continue
+		}
+		crl, err := x509.ParseDERCRL(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		crls = append(crls, CRL{CertificateList: crl, PEM: pem.EncodeToMemory(block)})
+	}
+}
+
+// Fingerprint returns the SHA-256 digest of the DER encoding of the first certificate of data,
+// the fingerprint the device registry identifies devices by.
+func Fingerprint(data []byte) ([]byte, error) {
+	cert, err := ParseCertificate(data)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(cert.Raw)
+	return sum[:], nil
+}
+
+// HexFingerprint returns the hex encoded SHA-256 digest of the DER encoding of cert.
+func HexFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+func parseKey(block *pem.Block) (crypto.Signer, error) {
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported key type")
+	}
+	return signer, nil
+}
+
+func encodeKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+func serialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
@@ -0,0 +1,230 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestIssue(t *testing.T) {
+	caCert, caKey, err := NewCA("platform-device-ca", DefaultCAValidity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := LoadCA(caCert, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM, keyPEM, err := ca.Issue("sensor", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keyPEM) == 0 {
+		t.Fatal("no key returned")
+	}
+	cert, err := ParseCertificate(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Subject.CommonName != "sensor" {
+		t.Errorf("common name = %q, want sensor", cert.Subject.CommonName)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+	_, err = cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+	if err != nil {
+		t.Errorf("certificate does not verify against the CA: %v", err)
+	}
+
+	fp, err := Fingerprint(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := Fingerprint(caCert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fp) != 32 || bytes.Equal(fp, other) {
+		t.Errorf("unexpected fingerprint %x", fp)
+	}
+}
+
+func TestIssueCappedByCA(t *testing.T) {
+	caCert, caKey, err := NewCA("ca", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := LoadCA(caCert, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, _, err := ca.Issue("device", 2*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := ParseCertificate(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.NotAfter.After(ca.Cert.NotAfter) {
+		t.Errorf("certificate outlives its CA: %v > %v", cert.NotAfter, ca.Cert.NotAfter)
+	}
+}
+
+func TestLoadCARejectsLeaf(t *testing.T) {
+	caCert, caKey, err := NewCA("ca", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := LoadCA(caCert, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, keyPEM, err := ca.Issue("device", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCA(certPEM, keyPEM); err == nil {
+		t.Error("expected an error loading a leaf certificate as CA")
+	}
+}
+
+func TestIssueFor(t *testing.T) {
+	caCert, caKey, err := NewCA("ca", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := LoadCA(caCert, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "device"}}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := ParseCertificateRequest(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM, err := ca.IssueFor("device", csr.PublicKey, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := ParseCertificate(certPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pub, ok := cert.PublicKey.(*ecdsa.PublicKey); !ok || pub.X.Cmp(key.X) != 0 || pub.Y.Cmp(key.Y) != 0 {
+		t.Error("certificate is not issued for the key of the request")
+	}
+	if err := cert.CheckSignatureFrom(ca.Cert); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEncodeCAs(t *testing.T) {
+	var cas []*CA
+	for _, name := range []string{"current", "previous"} {
+		caCert, caKey, err := NewCA(name, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ca, err := LoadCA(caCert, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cas = append(cas, ca)
+	}
+
+	certPEM, keyPEM, err := EncodeCAs(cas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadCAs(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != len(cas) {
+		t.Fatalf("loaded %v CAs, want %v", len(loaded), len(cas))
+	}
+	for i := range cas {
+		if HexFingerprint(loaded[i].Cert) != HexFingerprint(cas[i].Cert) {
+			t.Errorf("CA %v changed order", i)
+		}
+		if _, _, err := loaded[i].Issue("device", time.Minute); err != nil {
+			t.Errorf("CA %v can't issue: %v", i, err)
+		}
+	}
+
+	if _, err := LoadCAs(certPEM, nil); err == nil {
+		t.Error("expected an error loading CAs without keys")
+	}
+}
+
+func TestCRL(t *testing.T) {
+	caCert, caKey, err := NewCA("ca", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := LoadCA(caCert, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := time.Now().Add(time.Hour)
+	data, err := ca.CRL([]*big.Int{big.NewInt(42), big.NewInt(7)}, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crls, err := ParseCRLs(append(append([]byte{}, caCert...), data...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(crls) != 1 {
+		t.Fatalf("parsed %v CRLs, want 1", len(crls))
+	}
+	if err := ca.Cert.CheckCRLSignature(crls[0].CertificateList); err != nil {
+		t.Error(err)
+	}
+	revoked := crls[0].TBSCertList.RevokedCertificates
+	if len(revoked) != 2 || revoked[0].SerialNumber.Int64() != 42 || revoked[1].SerialNumber.Int64() != 7 {
+		t.Errorf("unexpected revoked certificates %v", revoked)
+	}
+	if !bytes.Equal(crls[0].PEM, data) {
+		t.Error("PEM encoding of the CRL changed")
+	}
+	if crls[0].TBSCertList.NextUpdate.Unix() != next.Unix() {
+		t.Errorf("next update = %v, want %v", crls[0].TBSCertList.NextUpdate, next)
+	}
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package shadowpb is a client of the Shadows service of the infinimesh shadow API. It mirrors
+// the messages of pkg/shadow/shadowpb/shadow.proto in the infinimesh repository the operator
+// uses, which isn't part of the vendored infinimesh module. Only the fields the operator reads
+// and sets are declared.
+package shadowpb
+
+import (
+	"context"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"google.golang.org/grpc"
+)
+
+type VersionedValue struct {
+	Version   uint64               `protobuf:"varint,1,opt,name=version,proto3" json:"version,omitempty"`
+	Data      *Value               `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	Timestamp *timestamp.Timestamp `protobuf:"bytes,3,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+}
+
+func (m *VersionedValue) Reset()         { *m = VersionedValue{} }
+func (m *VersionedValue) String() string { return proto.CompactTextString(m) }
+func (*VersionedValue) ProtoMessage()    {}
+
+type Shadow struct {
+	Reported *VersionedValue `protobuf:"bytes,1,opt,name=reported,proto3" json:"reported,omitempty"`
+	Desired  *VersionedValue `protobuf:"bytes,2,opt,name=desired,proto3" json:"desired,omitempty"`
+}
+
+func (m *Shadow) Reset()         { *m = Shadow{} }
+func (m *Shadow) String() string { return proto.CompactTextString(m) }
+func (*Shadow) ProtoMessage()    {}
+
+type GetRequest struct {
+	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+}
+
+func (m *GetRequest) Reset()         { *m = GetRequest{} }
+func (m *GetRequest) String() string { return proto.CompactTextString(m) }
+func (*GetRequest) ProtoMessage()    {}
+
+type GetResponse struct {
+	Shadow *Shadow `protobuf:"bytes,1,opt,name=shadow,proto3" json:"shadow,omitempty"`
+}
+
+func (m *GetResponse) Reset()         { *m = GetResponse{} }
+func (m *GetResponse) String() string { return proto.CompactTextString(m) }
+func (*GetResponse) ProtoMessage()    {}
+
+type PatchDesiredStateRequest struct {
+	Id   string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Data *Value `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+}
+
+func (m *PatchDesiredStateRequest) Reset()         { *m = PatchDesiredStateRequest{} }
+func (m *PatchDesiredStateRequest) String() string { return proto.CompactTextString(m) }
+func (*PatchDesiredStateRequest) ProtoMessage()    {}
+
+type PatchDesiredStateResponse struct{}
+
+func (m *PatchDesiredStateResponse) Reset()         { *m = PatchDesiredStateResponse{} }
+func (m *PatchDesiredStateResponse) String() string { return proto.CompactTextString(m) }
+func (*PatchDesiredStateResponse) ProtoMessage()    {}
+
+// ShadowsClient is the client API for the Shadows service.
+type ShadowsClient interface {
+	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error)
+	PatchDesiredState(ctx context.Context, in *PatchDesiredStateRequest, opts ...grpc.CallOption) (*PatchDesiredStateResponse, error)
+}
+
+type shadowsClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewShadowsClient(cc *grpc.ClientConn) ShadowsClient {
+	return &shadowsClient{cc}
+}
+
+func (c *shadowsClient) Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error) {
+	out := new(GetResponse)
+	err := c.cc.Invoke(ctx, "/infinimesh.shadow.Shadows/Get", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shadowsClient) PatchDesiredState(ctx context.Context, in *PatchDesiredStateRequest, opts ...grpc.CallOption) (*PatchDesiredStateResponse, error) {
+	out := new(PatchDesiredStateResponse)
+	err := c.cc.Invoke(ctx, "/infinimesh.shadow.Shadows/PatchDesiredState", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
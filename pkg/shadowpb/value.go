@@ -0,0 +1,258 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shadowpb
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// Field numbers of google.protobuf.Value, Struct and ListValue
+const (
+	valueNull   = 1
+	valueNumber = 2
+	valueString = 3
+	valueBool   = 4
+	valueStruct = 5
+	valueList   = 6
+
+	structFields = 1
+	listValues   = 1
+
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// Value is a google.protobuf.Value holding JSON. The well-known types that come with it aren't
+// vendored, so it encodes itself.
+type Value struct {
+	JSON json.RawMessage
+}
+
+func (m *Value) Reset()         { *m = Value{} }
+func (m *Value) String() string { return string(m.JSON) }
+func (*Value) ProtoMessage()    {}
+
+// Marshal encodes the JSON of m as a google.protobuf.Value.
+func (m *Value) Marshal() ([]byte, error) {
+	var v interface{}
+	if len(m.JSON) > 0 {
+		if err := json.Unmarshal(m.JSON, &v); err != nil {
+			return nil, err
+		}
+	}
+	b := proto.NewBuffer(nil)
+	if err := encodeValue(b, v); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Unmarshal decodes a google.protobuf.Value into the JSON of m.
+func (m *Value) Unmarshal(data []byte) error {
+	v, err := decodeValue(data)
+	if err != nil {
+		return err
+	}
+	m.JSON, err = json.Marshal(v)
+	return err
+}
+
+func encodeValue(b *proto.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		b.EncodeVarint(valueNull<<3 | wireVarint)
+		b.EncodeVarint(0)
+	case float64:
+		b.EncodeVarint(valueNumber<<3 | wireFixed64)
+		b.EncodeFixed64(math.Float64bits(v))
+	case string:
+		b.EncodeVarint(valueString<<3 | wireBytes)
+		b.EncodeStringBytes(v)
+	case bool:
+		b.EncodeVarint(valueBool<<3 | wireVarint)
+		if v {
+			b.EncodeVarint(1)
+		} else {
+			b.EncodeVarint(0)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		s := proto.NewBuffer(nil)
+		for _, key := range keys {
+			entry := proto.NewBuffer(nil)
+			entry.EncodeVarint(1<<3 | wireBytes)
+			entry.EncodeStringBytes(key)
+			value := proto.NewBuffer(nil)
+			if err := encodeValue(value, v[key]); err != nil {
+				return err
+			}
+			entry.EncodeVarint(2<<3 | wireBytes)
+			entry.EncodeRawBytes(value.Bytes())
+			s.EncodeVarint(structFields<<3 | wireBytes)
+			s.EncodeRawBytes(entry.Bytes())
+		}
+		b.EncodeVarint(valueStruct<<3 | wireBytes)
+		b.EncodeRawBytes(s.Bytes())
+	case []interface{}:
+		l := proto.NewBuffer(nil)
+		for _, item := range v {
+			value := proto.NewBuffer(nil)
+			if err := encodeValue(value, item); err != nil {
+				return err
+			}
+			l.EncodeVarint(listValues<<3 | wireBytes)
+			l.EncodeRawBytes(value.Bytes())
+		}
+		b.EncodeVarint(valueList<<3 | wireBytes)
+		b.EncodeRawBytes(l.Bytes())
+	default:
+		return fmt.Errorf("unsupported JSON value %T", v)
+	}
+	return nil
+}
+
+func decodeValue(data []byte) (interface{}, error) {
+	var v interface{}
+	err := decodeFields(data, func(field uint64, b *proto.Buffer) error {
+		var err error
+		switch field {
+		case valueNull:
+			_, err = b.DecodeVarint()
+			v = nil
+		case valueNumber:
+			var bits uint64
+			bits, err = b.DecodeFixed64()
+			v = math.Float64frombits(bits)
+		case valueString:
+			v, err = b.DecodeStringBytes()
+		case valueBool:
+			var x uint64
+			x, err = b.DecodeVarint()
+			v = x != 0
+		case valueStruct:
+			var raw []byte
+			if raw, err = b.DecodeRawBytes(false); err != nil {
+				return err
+			}
+			v, err = decodeStruct(raw)
+		case valueList:
+			var raw []byte
+			if raw, err = b.DecodeRawBytes(false); err != nil {
+				return err
+			}
+			v, err = decodeList(raw)
+		}
+		return err
+	})
+	return v, err
+}
+
+func decodeStruct(data []byte) (map[string]interface{}, error) {
+	result := map[string]interface{}{}
+	err := decodeFields(data, func(field uint64, b *proto.Buffer) error {
+		if field != structFields {
+			return nil
+		}
+		raw, err := b.DecodeRawBytes(false)
+		if err != nil {
+			return err
+		}
+		var key string
+		var value interface{}
+		err = decodeFields(raw, func(field uint64, b *proto.Buffer) error {
+			var err error
+			switch field {
+			case 1:
+				key, err = b.DecodeStringBytes()
+			case 2:
+				var raw []byte
+				if raw, err = b.DecodeRawBytes(false); err != nil {
+					return err
+				}
+				value, err = decodeValue(raw)
+			}
+			return err
+		})
+		result[key] = value
+		return err
+	})
+	return result, err
+}
+
+func decodeList(data []byte) ([]interface{}, error) {
+	result := []interface{}{}
+	err := decodeFields(data, func(field uint64, b *proto.Buffer) error {
+		if field != listValues {
+			return nil
+		}
+		raw, err := b.DecodeRawBytes(false)
+		if err != nil {
+			return err
+		}
+		value, err := decodeValue(raw)
+		result = append(result, value)
+		return err
+	})
+	return result, err
+}
+
+// decodeFields calls decode for each field of the message in data. Fields decode doesn't
+// consume are skipped.
+func decodeFields(data []byte, decode func(field uint64, b *proto.Buffer) error) error {
+	b := proto.NewBuffer(data)
+	for len(b.Unread()) > 0 {
+		tag, err := b.DecodeVarint()
+		if err != nil {
+			return err
+		}
+		field, wire := tag>>3, tag&7
+		before := len(b.Unread())
+		if err := decode(field, b); err != nil {
+			return err
+		}
+		if len(b.Unread()) != before {
+			continue
+		}
+		switch wire {
+		case wireVarint:
+			_, err = b.DecodeVarint()
+		case wireFixed64:
+			_, err = b.DecodeFixed64()
+		case wireBytes:
+			_, err = b.DecodeRawBytes(false)
+		case wireFixed32:
+			_, err = b.DecodeFixed32()
+		default:
+			err = fmt.Errorf("unsupported wire type %v", wire)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
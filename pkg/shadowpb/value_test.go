@@ -0,0 +1,69 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package shadowpb
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+)
+
+func TestValueRoundTrip(t *testing.T) {
+	for _, js := range []string{
+		`null`,
+		`1.5`,
+		`"on"`,
+		`true`,
+		`[]`,
+		`{}`,
+		`{"led":{"color":"red","brightness":0.8},"interval":30,"enabled":false,"zones":[1,"a",null,{"b":[]}]}`,
+	} {
+		in := &PatchDesiredStateRequest{Id: "0x1", Data: &Value{JSON: []byte(js)}}
+		data, err := proto.Marshal(in)
+		if err != nil {
+			t.Fatalf("%v: %v", js, err)
+		}
+		out := &PatchDesiredStateRequest{}
+		if err := proto.Unmarshal(data, out); err != nil {
+			t.Fatalf("%v: %v", js, err)
+		}
+		if out.Id != "0x1" {
+			t.Errorf("%v: id %q", js, out.Id)
+		}
+
+		// Keys come back sorted
+		want := &Value{JSON: []byte(js)}
+		wantData, _ := want.Marshal()
+		gotData, _ := out.Data.Marshal()
+		if !bytes.Equal(wantData, gotData) {
+			t.Errorf("%v: decoded as %s", js, out.Data.JSON)
+		}
+	}
+}
+
+func TestValueWireFormat(t *testing.T) {
+	// {"a": "b"} as encoded by protoc generated code
+	want := []byte{0x2a, 0x0a, 0x0a, 0x08, 0x0a, 0x01, 'a', 0x12, 0x03, 0x1a, 0x01, 'b'}
+	got, err := (&Value{JSON: []byte(`{"a":"b"}`)}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("got % x, want % x", got, want)
+	}
+}
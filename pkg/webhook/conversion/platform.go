@@ -0,0 +1,317 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package conversion
+
+import (
+	infinimeshv1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1"
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+)
+
+// ToV1beta1 returns in as v1beta1, the version the controller reconciles.
+func ToV1beta1(in *infinimeshv1.Platform) *infinimeshv1beta1.Platform {
+	out := &infinimeshv1beta1.Platform{}
+	convertPlatformToV1beta1(in, out)
+	return out
+}
+
+// The types both versions share field for field are converted directly, so adding a field to
+// only one of them fails to compile instead of being dropped.
+
+func convertPlatformToV1(in *infinimeshv1beta1.Platform, out *infinimeshv1.Platform) {
+	out.TypeMeta = in.TypeMeta
+	out.TypeMeta.APIVersion = infinimeshv1.SchemeGroupVersion.String()
+	out.ObjectMeta = in.ObjectMeta
+
+	spec := &in.Spec
+	out.Spec = infinimeshv1.PlatformSpec{
+		Version:  spec.Version,
+		Upgrade:  convertUpgradeToV1(spec.Upgrade),
+		Registry: spec.Host.Registry,
+		Storage:  spec.InfinimeshDefaultStorage.Storage,
+		Dgraph: infinimeshv1.PlatformDgraph{
+			Enabled: spec.Controller.Dgraph,
+			Storage: spec.DGraph.Storage,
+			Alpha:   infinimeshv1.PlatformDgraphNode{Storage: spec.DGraphAlpha.Storage},
+			Zero:    infinimeshv1.PlatformDgraphNode{Storage: spec.DGraphZero.Storage},
+		},
+		Kafka: infinimeshv1.PlatformKafka{
+			BootstrapServers: spec.Kafka.BootstrapServers,
+			StrimziCluster:   spec.Kafka.StrimziCluster,
+		},
+		Redis: infinimeshv1.PlatformRedis{
+			DeviceDetails: convertRedisStoreToV1(spec.Redis.DeviceDetails),
+			Twin:          convertRedisStoreToV1(spec.Redis.Twin),
+		},
+		DeviceRegistry:  infinimeshv1.PlatformComponent{Enabled: spec.Controller.DeviceRegistry},
+		DeviceDetails:   infinimeshv1.PlatformComponent{Enabled: spec.Controller.DeviceDetails},
+		NodeServer:      infinimeshv1.PlatformComponent{Enabled: spec.Controller.NodeServer},
+		TelemetryRouter: infinimeshv1.PlatformComponent{Enabled: spec.Controller.TelemetryRouter},
+		Twin:            infinimeshv1.PlatformComponent{Enabled: spec.Controller.Twin},
+		MQTTBridge: infinimeshv1.PlatformMQTTBridge{
+			Enabled:    spec.Controller.MQTTBridge,
+			SecretName: spec.MQTT.SecretName,
+		},
+		Timeseries: infinimeshv1.PlatformTimeseries{Enabled: spec.Controller.Timeseries},
+		Apiserver: infinimeshv1.PlatformEndpoint{
+			Enabled: spec.Controller.APIServer,
+			Host:    spec.Apiserver.GRPC.Host,
+			TLS:     spec.Apiserver.GRPC.TLS,
+		},
+		ApiserverRest: infinimeshv1.PlatformEndpoint{
+			Enabled: spec.Controller.APIServerRest,
+			Host:    spec.Apiserver.Restful.Host,
+			TLS:     spec.Apiserver.Restful.TLS,
+		},
+		Frontend: infinimeshv1.PlatformEndpoint{
+			Enabled: spec.Controller.Frontend,
+			Host:    spec.App.Host,
+			TLS:     spec.App.TLS,
+		},
+		Grafana: infinimeshv1.PlatformGrafana(spec.Grafana),
+		Jobs: infinimeshv1.PlatformJobs{
+			ResetRootAccountPassword: infinimeshv1.PlatformComponent{Enabled: spec.Controller.ResetRootAccountPwd},
+			HardDeleteNamespaces:     infinimeshv1.PlatformComponent{Enabled: spec.Controller.HardDeleteNamespaceCronjob},
+		},
+		Maintenance: infinimeshv1.PlatformMaintenance(spec.Maintenance),
+		DeviceCA:    infinimeshv1.PlatformDeviceCA(spec.DeviceCA),
+		Security:    infinimeshv1.PlatformSecurity(spec.Security),
+	}
+
+	if spec.DGraph.External != nil {
+		external := infinimeshv1.PlatformDgraphExternal(*spec.DGraph.External)
+		out.Spec.Dgraph.External = &external
+	}
+	if spec.Kafka.Topics != nil {
+		out.Spec.Kafka.Topics = make([]infinimeshv1.PlatformKafkaTopic, len(spec.Kafka.Topics))
+		for i, topic := range spec.Kafka.Topics {
+			out.Spec.Kafka.Topics[i] = infinimeshv1.PlatformKafkaTopic(topic)
+		}
+	}
+	if spec.Kafka.TLS != nil {
+		tls := infinimeshv1.PlatformKafkaTLS(*spec.Kafka.TLS)
+		out.Spec.Kafka.TLS = &tls
+	}
+	if spec.Kafka.SASL != nil {
+		sasl := infinimeshv1.PlatformKafkaSASL(*spec.Kafka.SASL)
+		out.Spec.Kafka.SASL = &sasl
+	}
+	if spec.Kafka.Managed != nil {
+		managed := infinimeshv1.PlatformKafkaManaged(*spec.Kafka.Managed)
+		out.Spec.Kafka.Managed = &managed
+	}
+	if spec.Timeseries.TimescaleDB != nil {
+		timescaleDB := infinimeshv1.PlatformTimescaleDB(*spec.Timeseries.TimescaleDB)
+		out.Spec.Timeseries.TimescaleDB = &timescaleDB
+	}
+	if spec.Observability.Prometheus != nil {
+		prometheus := infinimeshv1.PlatformPrometheus(*spec.Observability.Prometheus)
+		out.Spec.Observability.Prometheus = &prometheus
+	}
+
+	status := &in.Status
+	out.Status = infinimeshv1.PlatformStatus{
+		Paused:              status.Paused,
+		UnmanagedComponents: status.UnmanagedComponents,
+		Maintenance:         status.Maintenance,
+		CurrentVersion:      status.CurrentVersion,
+		TargetVersion:       status.TargetVersion,
+	}
+	if status.KafkaTopics != nil {
+		out.Status.KafkaTopics = make([]infinimeshv1.PlatformKafkaTopicStatus, len(status.KafkaTopics))
+		for i, topic := range status.KafkaTopics {
+			out.Status.KafkaTopics[i] = infinimeshv1.PlatformKafkaTopicStatus(topic)
+		}
+	}
+	if status.Upgrade != nil {
+		upgrade := infinimeshv1.PlatformUpgradeStatus(*status.Upgrade)
+		out.Status.Upgrade = &upgrade
+	}
+	if status.UpgradeHistory != nil {
+		out.Status.UpgradeHistory = make([]infinimeshv1.PlatformUpgradeRecord, len(status.UpgradeHistory))
+		for i, record := range status.UpgradeHistory {
+			out.Status.UpgradeHistory[i] = infinimeshv1.PlatformUpgradeRecord(record)
+		}
+	}
+	if status.DeviceCA != nil {
+		deviceCA := infinimeshv1.PlatformDeviceCAStatus(*status.DeviceCA)
+		out.Status.DeviceCA = &deviceCA
+	}
+}
+
+func convertUpgradeToV1(in infinimeshv1beta1.PlatformUpgrade) infinimeshv1.PlatformUpgrade {
+	out := infinimeshv1.PlatformUpgrade{StepTimeout: in.StepTimeout}
+	if in.Hooks != nil {
+		out.Hooks = make([]infinimeshv1.PlatformUpgradeHook, len(in.Hooks))
+		for i, hook := range in.Hooks {
+			out.Hooks[i] = infinimeshv1.PlatformUpgradeHook(hook)
+		}
+	}
+	return out
+}
+
+func convertRedisStoreToV1(in infinimeshv1beta1.PlatformRedisStore) infinimeshv1.PlatformRedisStore {
+	out := infinimeshv1.PlatformRedisStore{
+		Mode:        in.Mode,
+		Replicas:    in.Replicas,
+		AuthSecret:  in.AuthSecret,
+		Persistence: in.Persistence,
+		Storage:     in.Storage,
+		Resources:   in.Resources,
+	}
+	if in.External != nil {
+		external := infinimeshv1.PlatformRedisExternal(*in.External)
+		out.External = &external
+	}
+	return out
+}
+
+func convertPlatformToV1beta1(in *infinimeshv1.Platform, out *infinimeshv1beta1.Platform) {
+	out.TypeMeta = in.TypeMeta
+	out.TypeMeta.APIVersion = infinimeshv1beta1.SchemeGroupVersion.String()
+	out.ObjectMeta = in.ObjectMeta
+
+	spec := &in.Spec
+	out.Spec = infinimeshv1beta1.PlatformSpec{
+		MQTT:        infinimeshv1beta1.PlatformMQTTBroker{SecretName: spec.MQTTBridge.SecretName},
+		DGraph:      infinimeshv1beta1.PlatformDgraph{Storage: spec.Dgraph.Storage},
+		DGraphAlpha: infinimeshv1beta1.PlatformDgraphAlpha{Storage: spec.Dgraph.Alpha.Storage},
+		DGraphZero:  infinimeshv1beta1.PlatformDgraphZero{Storage: spec.Dgraph.Zero.Storage},
+		Kafka: infinimeshv1beta1.PlatformKafka{
+			BootstrapServers: spec.Kafka.BootstrapServers,
+			StrimziCluster:   spec.Kafka.StrimziCluster,
+		},
+		Apiserver: infinimeshv1beta1.PlatformApiserver{
+			GRPC:    infinimeshv1beta1.PlatformGRPCApiserver{Host: spec.Apiserver.Host, TLS: spec.Apiserver.TLS},
+			Restful: infinimeshv1beta1.PlatformRestfulApiserver{Host: spec.ApiserverRest.Host, TLS: spec.ApiserverRest.TLS},
+		},
+		App:                      infinimeshv1beta1.PlatformApp{Host: spec.Frontend.Host, TLS: spec.Frontend.TLS},
+		InfinimeshDefaultStorage: infinimeshv1beta1.PlatformInfinimeshDefaultStorage{Storage: spec.Storage},
+		Controller: infinimeshv1beta1.PlatformController{
+			DeviceDetails:              spec.DeviceDetails.Enabled,
+			APIServer:                  spec.Apiserver.Enabled,
+			DeviceRegistry:             spec.DeviceRegistry.Enabled,
+			Dgraph:                     spec.Dgraph.Enabled,
+			Frontend:                   spec.Frontend.Enabled,
+			HardDeleteNamespaceCronjob: spec.Jobs.HardDeleteNamespaces.Enabled,
+			Timeseries:                 spec.Timeseries.Enabled,
+			MQTTBridge:                 spec.MQTTBridge.Enabled,
+			NodeServer:                 spec.NodeServer.Enabled,
+			ResetRootAccountPwd:        spec.Jobs.ResetRootAccountPassword.Enabled,
+			TelemetryRouter:            spec.TelemetryRouter.Enabled,
+			Twin:                       spec.Twin.Enabled,
+			APIServerRest:              spec.ApiserverRest.Enabled,
+		},
+		Host: infinimeshv1beta1.PlatformHost{Registry: spec.Registry},
+		Redis: infinimeshv1beta1.PlatformRedis{
+			DeviceDetails: convertRedisStoreToV1beta1(spec.Redis.DeviceDetails),
+			Twin:          convertRedisStoreToV1beta1(spec.Redis.Twin),
+		},
+		Grafana:     infinimeshv1beta1.PlatformGrafana(spec.Grafana),
+		Maintenance: infinimeshv1beta1.PlatformMaintenance(spec.Maintenance),
+		Version:     spec.Version,
+		Upgrade:     convertUpgradeToV1beta1(spec.Upgrade),
+		DeviceCA:    infinimeshv1beta1.PlatformDeviceCA(spec.DeviceCA),
+		Security:    infinimeshv1beta1.PlatformSecurity(spec.Security),
+	}
+
+	if spec.Dgraph.External != nil {
+		external := infinimeshv1beta1.PlatformDgraphExternal(*spec.Dgraph.External)
+		out.Spec.DGraph.External = &external
+	}
+	if spec.Kafka.Topics != nil {
+		out.Spec.Kafka.Topics = make([]infinimeshv1beta1.PlatformKafkaTopic, len(spec.Kafka.Topics))
+		for i, topic := range spec.Kafka.Topics {
+			out.Spec.Kafka.Topics[i] = infinimeshv1beta1.PlatformKafkaTopic(topic)
+		}
+	}
+	if spec.Kafka.TLS != nil {
+		tls := infinimeshv1beta1.PlatformKafkaTLS(*spec.Kafka.TLS)
+		out.Spec.Kafka.TLS = &tls
+	}
+	if spec.Kafka.SASL != nil {
+		sasl := infinimeshv1beta1.PlatformKafkaSASL(*spec.Kafka.SASL)
+		out.Spec.Kafka.SASL = &sasl
+	}
+	if spec.Kafka.Managed != nil {
+		managed := infinimeshv1beta1.PlatformKafkaManaged(*spec.Kafka.Managed)
+		out.Spec.Kafka.Managed = &managed
+	}
+	if spec.Timeseries.TimescaleDB != nil {
+		timescaleDB := infinimeshv1beta1.PlatformTimescaleDB(*spec.Timeseries.TimescaleDB)
+		out.Spec.Timeseries.TimescaleDB = &timescaleDB
+	}
+	if spec.Observability.Prometheus != nil {
+		prometheus := infinimeshv1beta1.PlatformPrometheus(*spec.Observability.Prometheus)
+		out.Spec.Observability.Prometheus = &prometheus
+	}
+
+	status := &in.Status
+	out.Status = infinimeshv1beta1.PlatformStatus{
+		Paused:              status.Paused,
+		UnmanagedComponents: status.UnmanagedComponents,
+		Maintenance:         status.Maintenance,
+		CurrentVersion:      status.CurrentVersion,
+		TargetVersion:       status.TargetVersion,
+	}
+	if status.KafkaTopics != nil {
+		out.Status.KafkaTopics = make([]infinimeshv1beta1.PlatformKafkaTopicStatus, len(status.KafkaTopics))
+		for i, topic := range status.KafkaTopics {
+			out.Status.KafkaTopics[i] = infinimeshv1beta1.PlatformKafkaTopicStatus(topic)
+		}
+	}
+	if status.Upgrade != nil {
+		upgrade := infinimeshv1beta1.PlatformUpgradeStatus(*status.Upgrade)
+		out.Status.Upgrade = &upgrade
+	}
+	if status.UpgradeHistory != nil {
+		out.Status.UpgradeHistory = make([]infinimeshv1beta1.PlatformUpgradeRecord, len(status.UpgradeHistory))
+		for i, record := range status.UpgradeHistory {
+			out.Status.UpgradeHistory[i] = infinimeshv1beta1.PlatformUpgradeRecord(record)
+		}
+	}
+	if status.DeviceCA != nil {
+		deviceCA := infinimeshv1beta1.PlatformDeviceCAStatus(*status.DeviceCA)
+		out.Status.DeviceCA = &deviceCA
+	}
+}
+
+func convertUpgradeToV1beta1(in infinimeshv1.PlatformUpgrade) infinimeshv1beta1.PlatformUpgrade {
+	out := infinimeshv1beta1.PlatformUpgrade{StepTimeout: in.StepTimeout}
+	if in.Hooks != nil {
+		out.Hooks = make([]infinimeshv1beta1.PlatformUpgradeHook, len(in.Hooks))
+		for i, hook := range in.Hooks {
+			out.Hooks[i] = infinimeshv1beta1.PlatformUpgradeHook(hook)
+		}
+	}
+	return out
+}
+
+func convertRedisStoreToV1beta1(in infinimeshv1.PlatformRedisStore) infinimeshv1beta1.PlatformRedisStore {
+	out := infinimeshv1beta1.PlatformRedisStore{
+		Mode:        in.Mode,
+		Replicas:    in.Replicas,
+		AuthSecret:  in.AuthSecret,
+		Persistence: in.Persistence,
+		Storage:     in.Storage,
+		Resources:   in.Resources,
+	}
+	if in.External != nil {
+		external := infinimeshv1beta1.PlatformRedisExternal(*in.External)
+		out.External = &external
+	}
+	return out
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package conversion
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	fuzz "github.com/google/gofuzz"
+	"github.com/onsi/gomega"
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	infinimeshv1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1"
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+)
+
+func newFuzzer(seed int64) *fuzz.Fuzzer {
+	return fuzz.New().RandSource(rand.NewSource(seed)).NilChance(0.2).NumElements(0, 3).Funcs(
+		func(q *resource.Quantity, c fuzz.Continue) {
+			*q = *resource.NewQuantity(c.Int63n(1000), resource.DecimalSI)
+		},
+		func(t *metav1.Time, c fuzz.Continue) {
+			*t = metav1.Unix(c.Int63n(1<<32), 0)
+		},
+		func(obj *runtime.RawExtension, c fuzz.Continue) {},
+	)
+}
+
+func TestRoundTripFromV1beta1(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	for seed := int64(0); seed < 100; seed++ {
+		in := &infinimeshv1beta1.Platform{}
+		newFuzzer(seed).Fuzz(in)
+		in.APIVersion = infinimeshv1beta1.SchemeGroupVersion.String()
+
+		hub := &infinimeshv1.Platform{}
+		convertPlatformToV1(in, hub)
+		out := &infinimeshv1beta1.Platform{}
+		convertPlatformToV1beta1(hub, out)
+
+		g.Expect(out).To(gomega.Equal(in), "seed %v", seed)
+	}
+}
+
+func TestRoundTripFromV1(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	for seed := int64(0); seed < 100; seed++ {
+		in := &infinimeshv1.Platform{}
+		newFuzzer(seed).Fuzz(in)
+		in.APIVersion = infinimeshv1.SchemeGroupVersion.String()
+
+		spoke := &infinimeshv1beta1.Platform{}
+		convertPlatformToV1beta1(in, spoke)
+		out := &infinimeshv1.Platform{}
+		convertPlatformToV1(spoke, out)
+
+		g.Expect(out).To(gomega.Equal(in), "seed %v", seed)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	in := &infinimeshv1beta1.Platform{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "infinimesh.infinimesh.io/v1beta1", Kind: "Platform"},
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+	}
+	in.Spec.App.Host = "app.example.com"
+	in.Spec.Controller.Frontend = true
+	in.Spec.MQTT.SecretName = "mqtt-cert"
+	raw, err := json.Marshal(in)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	review := &apiextensionsv1beta1.ConversionReview{
+		Request: &apiextensionsv1beta1.ConversionRequest{
+			UID:               "1234",
+			DesiredAPIVersion: "infinimesh.infinimesh.io/v1",
+			Objects:           []runtime.RawExtension{{Raw: raw}},
+		},
+	}
+	body, err := json.Marshal(review)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	w := httptest.NewRecorder()
+	(&Handler{}).ServeHTTP(w, httptest.NewRequest(http.MethodPost, Path, bytes.NewReader(body)))
+	g.Expect(w.Code).To(gomega.Equal(http.StatusOK))
+
+	response := &apiextensionsv1beta1.ConversionReview{}
+	g.Expect(json.Unmarshal(w.Body.Bytes(), response)).NotTo(gomega.HaveOccurred())
+	g.Expect(response.Response.UID).To(gomega.BeEquivalentTo("1234"))
+	g.Expect(response.Response.Result.Status).To(gomega.Equal(metav1.StatusSuccess))
+	g.Expect(response.Response.ConvertedObjects).To(gomega.HaveLen(1))
+
+	out := &infinimeshv1.Platform{}
+	g.Expect(json.Unmarshal(response.Response.ConvertedObjects[0].Raw, out)).NotTo(gomega.HaveOccurred())
+	g.Expect(out.APIVersion).To(gomega.Equal("infinimesh.infinimesh.io/v1"))
+	g.Expect(out.Name).To(gomega.Equal("foo"))
+	g.Expect(out.Spec.Frontend).To(gomega.Equal(infinimeshv1.PlatformEndpoint{Enabled: true, Host: "app.example.com"}))
+	g.Expect(out.Spec.MQTTBridge.SecretName).To(gomega.Equal("mqtt-cert"))
+}
+
+func TestHandlerRejectsOtherKinds(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	response := convertReview(&apiextensionsv1beta1.ConversionRequest{
+		DesiredAPIVersion: "infinimesh.infinimesh.io/v1",
+		Objects:           []runtime.RawExtension{{Raw: []byte(`{"apiVersion":"v1","kind":"Pod"}`)}},
+	})
+	g.Expect(response.Result.Status).To(gomega.Equal(metav1.StatusFailure))
+	g.Expect(response.ConvertedObjects).To(gomega.BeEmpty())
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package conversion serves the conversion webhook of the Platform CRD, converting between
+// v1beta1 and v1.
+package conversion
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	logf "sigs.k8s.io/controller-runtime/pkg/runtime/log"
+
+	infinimeshv1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1"
+	infinimeshv1beta1 "github.com/infinimesh/operator/pkg/apis/infinimesh/v1beta1"
+)
+
+var log = logf.Log.WithName("conversion-webhook")
+
+// Path is the path of the webhook in the CRD's conversion config.
+const Path = "/convert"
+
+// Port, CertDir and Stop configure the webhook server, set them before Add. CertDir holds
+// tls.crt and tls.key, they are read again when they change. The server shuts down once Stop
+// is closed.
+var (
+	Port    = 9876
+	CertDir = "/tmp/cert"
+	Stop    <-chan struct{}
+)
+
+// Add serves the conversion webhook. It is served by every replica, not just the leader, as
+// the apiserver calls any of them.
+func Add(mgr manager.Manager) error {
+	certs := &certLoader{cert: filepath.Join(CertDir, "tls.crt"), key: filepath.Join(CertDir, "tls.key")}
+	if _, err := os.Stat(certs.cert); os.IsNotExist(err) {
+		// cert-manager may not have issued it yet
+		log.Info("No certificate yet, the conversion webhook fails handshakes until there is one", "certDir", CertDir)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(Path, &Handler{})
+	server := &http.Server{
+		Addr:      ":" + strconv.Itoa(Port),
+		Handler:   mux,
+		TLSConfig: &tls.Config{GetCertificate: certs.GetCertificate},
+	}
+	go func() {
+		log.Info("Serving conversion webhook", "port", Port)
+		if err := server.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+			log.Error(err, "Conversion webhook stopped")
+		}
+	}()
+	go func() {
+		<-Stop
+		if err := server.Shutdown(context.Background()); err != nil {
+			log.Error(err, "Failed to shut down the conversion webhook")
+		}
+	}()
+	return nil
+}
+
+// certLoader loads the certificate of the webhook, again whenever its file changes.
+type certLoader struct {
+	cert, key string
+
+	mu      sync.Mutex
+	modTime time.Time
+	current *tls.Certificate
+}
+
+func (l *certLoader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	info, err := os.Stat(l.cert)
+	if err != nil {
+		if l.current != nil {
+			return l.current, nil
+		}
+		return nil, err
+	}
+	if l.current != nil && info.ModTime().Equal(l.modTime) {
+		return l.current, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(l.cert, l.key)
+	if err != nil {
+		// The key may not be written yet, keep serving the previous certificate meanwhile
+		if l.current != nil {
+			log.Error(err, "Failed to reload the certificate")
+			return l.current, nil
+		}
+		return nil, err
+	}
+	log.Info("Loaded certificate", "certDir", filepath.Dir(l.cert))
+	l.current = &cert
+	l.modTime = info.ModTime()
+	return l.current, nil
+}
+
+// Handler converts the Platforms of a ConversionReview.
+type Handler struct{}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	review := &apiextensionsv1beta1.ConversionReview{}
+	if err := json.NewDecoder(r.Body).Decode(review); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if review.Request == nil {
+		http.Error(w, "missing request", http.StatusBadRequest)
+		return
+	}
+
+	review.Response = convertReview(review.Request)
+	review.Request = nil
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(review); err != nil {
+		log.Error(err, "Failed to write conversion response")
+	}
+}
+
+func convertReview(request *apiextensionsv1beta1.ConversionRequest) *apiextensionsv1beta1.ConversionResponse {
+	response := &apiextensionsv1beta1.ConversionResponse{UID: request.UID}
+	for _, obj := range request.Objects {
+		converted, err := convert(obj.Raw, request.DesiredAPIVersion)
+		if err != nil {
+			response.Result = metav1.Status{Status: metav1.StatusFailure, Message: err.Error()}
+			return response
+		}
+		response.ConvertedObjects = append(response.ConvertedObjects, runtime.RawExtension{Raw: converted})
+	}
+	response.Result = metav1.Status{Status: metav1.StatusSuccess}
+	return response
+}
+
+// convert returns the Platform in raw as desiredAPIVersion.
+func convert(raw []byte, desiredAPIVersion string) ([]byte, error) {
+	typeMeta := metav1.TypeMeta{}
+	if err := json.Unmarshal(raw, &typeMeta); err != nil {
+		return nil, err
+	}
+	if typeMeta.Kind != "Platform" {
+		return nil, fmt.Errorf("can't convert %v", typeMeta.Kind)
+	}
+	if typeMeta.APIVersion == desiredAPIVersion {
+		return raw, nil
+	}
+
+	switch {
+	case typeMeta.APIVersion == infinimeshv1beta1.SchemeGroupVersion.String() && desiredAPIVersion == infinimeshv1.SchemeGroupVersion.String():
+		in := &infinimeshv1beta1.Platform{}
+		if err := json.Unmarshal(raw, in); err != nil {
+			return nil, err
+		}
+		out := &infinimeshv1.Platform{}
+		convertPlatformToV1(in, out)
+		return json.Marshal(out)
+	case typeMeta.APIVersion == infinimeshv1.SchemeGroupVersion.String() && desiredAPIVersion == infinimeshv1beta1.SchemeGroupVersion.String():
+		in := &infinimeshv1.Platform{}
+		if err := json.Unmarshal(raw, in); err != nil {
+			return nil, err
+		}
+		out := &infinimeshv1beta1.Platform{}
+		convertPlatformToV1beta1(in, out)
+		return json.Marshal(out)
+	}
+	return nil, fmt.Errorf("can't convert from %v to %v", typeMeta.APIVersion, desiredAPIVersion)
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2019 infinimesh, inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package conversion
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert writes a self-signed certificate for name to dir, modified at modTime.
+func writeCert(t *testing.T, dir, name string, modTime time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(certFile, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func servedName(t *testing.T, l *certLoader) string {
+	cert, err := l.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed.Subject.CommonName
+}
+
+func TestCertLoaderReloads(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webhook-cert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	l := &certLoader{cert: filepath.Join(dir, "tls.crt"), key: filepath.Join(dir, "tls.key")}
+
+	// Handshakes fail until the certificate is issued
+	if _, err := l.GetCertificate(nil); err == nil {
+		t.Error("served without a certificate")
+	}
+
+	issued := time.Now().Add(-time.Hour)
+	writeCert(t, dir, "first", issued)
+	if name := servedName(t, l); name != "first" {
+		t.Fatalf("serving %v", name)
+	}
+
+	writeCert(t, dir, "second", issued.Add(time.Minute))
+	if name := servedName(t, l); name != "second" {
+		t.Errorf("rotated certificate isn't served, serving %v", name)
+	}
+
+	// A half-written rotation keeps the previous certificate
+	if err := ioutil.WriteFile(l.key, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(l.cert, time.Now(), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if name := servedName(t, l); name != "second" {
+		t.Errorf("serving %v", name)
+	}
+}